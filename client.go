@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"strings"
 
@@ -106,17 +107,47 @@ func dialAddrContext(
 	config *Config,
 	use0RTT bool,
 ) (quicSession, error) {
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+	if err := validateTLSConfig(tlsConf, config); err != nil {
+		return nil, err
+	}
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
 	}
-	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	var portRange PortRange
+	if config != nil {
+		portRange = config.SourcePortRange
+	}
+	udpConn, err := listenUDPInRange(portRange)
 	if err != nil {
 		return nil, err
 	}
 	return dialContext(ctx, udpConn, udpAddr, addr, tlsConf, config, use0RTT, true)
 }
 
+// listenUDPInRange creates a UDP socket bound to a port in the range.
+// The search starts at a random port, such that concurrent dials don't compete for the same ports.
+func listenUDPInRange(r PortRange) (*net.UDPConn, error) {
+	if r.Min == 0 {
+		return net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	}
+	numPorts := int(r.Max) - int(r.Min) + 1
+	offset := rand.Intn(numPorts)
+	var lastErr error
+	for i := 0; i < numPorts; i++ {
+		port := int(r.Min) + (offset+i)%numPorts
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: port})
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("quic: no source port available in range %d-%d: %w", r.Min, r.Max, lastErr)
+}
+
 // Dial establishes a new QUIC connection to a server using a net.PacketConn. If
 // the PacketConn satisfies the OOBCapablePacketConn interface (as a net.UDPConn
 // does), ECN and packet info support will be enabled. In this case, ReadMsgUDP
@@ -192,6 +223,9 @@ func dialContext(
 	if err := validateConfig(config); err != nil {
 		return nil, err
 	}
+	if err := validateTLSConfig(tlsConf, config); err != nil {
+		return nil, err
+	}
 	config = populateClientConfig(config, createdPacketConn)
 	packetHandlers, err := getMultiplexer().AddConn(pconn, config.ConnectionIDLength, config.StatelessResetKey, config.Tracer)
 	if err != nil {
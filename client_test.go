@@ -145,6 +145,57 @@ var _ = Describe("Client", func() {
 			Eventually(remoteAddrChan).Should(Receive(Equal("127.0.0.1:17890")))
 		})
 
+		It("binds to a port in the SourcePortRange", func() {
+			manager := NewMockPacketHandlerManager(mockCtrl)
+			manager.EXPECT().Add(gomock.Any(), gomock.Any())
+			manager.EXPECT().Destroy()
+			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
+
+			localAddrChan := make(chan net.Addr, 1)
+			newClientSession = func(
+				conn sendConn,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ protocol.PacketNumber,
+				_ bool,
+				_ bool,
+				_ logging.ConnectionTracer,
+				_ uint64,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) quicSession {
+				localAddrChan <- conn.LocalAddr()
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().run()
+				sess.EXPECT().HandshakeComplete().Return(context.Background())
+				return sess
+			}
+			portRange := PortRange{Min: 41230, Max: 41239}
+			_, err := DialAddr("localhost:17890", tlsConf, &Config{SourcePortRange: portRange})
+			Expect(err).ToNot(HaveOccurred())
+			var localAddr net.Addr
+			Eventually(localAddrChan).Should(Receive(&localAddr))
+			Expect(localAddr.(*net.UDPAddr).Port).To(And(
+				BeNumerically(">=", portRange.Min),
+				BeNumerically("<=", portRange.Max),
+			))
+		})
+
+		It("errors if all ports in the SourcePortRange are in use", func() {
+			portRange := PortRange{Min: 41240, Max: 41241}
+			for port := portRange.Min; port <= portRange.Max; port++ {
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: int(port)})
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+			}
+			_, err := DialAddr("localhost:17890", tlsConf, &Config{SourcePortRange: portRange})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("quic: no source port available in range 41240-41241"))
+		})
+
 		It("uses the tls.Config.ServerName as the hostname, if present", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
@@ -487,6 +538,18 @@ var _ = Describe("Client", func() {
 				Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 			})
 
+			It("errors when the tls.Config doesn't allow TLS 1.3", func() {
+				tlsConf.MaxVersion = tls.VersionTLS12
+				_, err := Dial(packetConn, nil, "localhost:1234", tlsConf, nil)
+				Expect(err).To(MatchError("quic: tls.Config.MaxVersion is TLS 1.2, but QUIC requires TLS 1.3"))
+			})
+
+			It("errors when the tls.Config allows older TLS versions, if RequireTLS13MinVersion is set", func() {
+				tlsConf.MinVersion = tls.VersionTLS11
+				_, err := Dial(packetConn, nil, "localhost:1234", tlsConf, &Config{RequireTLS13MinVersion: true})
+				Expect(err).To(MatchError("quic: tls.Config.MinVersion is TLS 1.1, but Config.RequireTLS13MinVersion requires TLS 1.3"))
+			})
+
 			It("disables bidirectional streams", func() {
 				config := &Config{
 					MaxIncomingStreams:    -1,
@@ -1,12 +1,16 @@
 package quic
 
 import (
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/quicvarint"
 )
 
 // Clone clones a Config
@@ -29,9 +33,59 @@ func validateConfig(config *Config) error {
 	if config.MaxIncomingUniStreams > 1<<60 {
 		return errors.New("invalid value for Config.MaxIncomingUniStreams")
 	}
+	if config.MaxDatagramFrameSize < 0 || config.MaxDatagramFrameSize > quicvarint.Max {
+		return errors.New("invalid value for Config.MaxDatagramFrameSize")
+	}
+	if config.InitialCongestionWindow > protocol.MaxCongestionWindowPackets {
+		return errors.New("invalid value for Config.InitialCongestionWindow")
+	}
+	if config.SourcePortRange.Min > config.SourcePortRange.Max || (config.SourcePortRange.Min == 0 && config.SourcePortRange.Max != 0) {
+		return errors.New("invalid value for Config.SourcePortRange")
+	}
+	for id := range config.AdditionalTransportParameters {
+		if id > quicvarint.Max || wire.IsKnownTransportParameter(id) || wire.IsGreasedTransportParameter(id) {
+			return fmt.Errorf("invalid transport parameter ID in Config.AdditionalTransportParameters: %#x", id)
+		}
+	}
 	return nil
 }
 
+// validateTLSConfig checks that the tls.Config allows TLS 1.3, which is the only TLS version that can be used with QUIC.
+// If config.RequireTLS13MinVersion is set, the tls.Config must not allow any older TLS version.
+// Both tlsConf and config may be nil.
+func validateTLSConfig(tlsConf *tls.Config, config *Config) error {
+	if tlsConf == nil {
+		return nil
+	}
+	if tlsConf.MaxVersion != 0 && tlsConf.MaxVersion < tls.VersionTLS13 {
+		return fmt.Errorf("quic: tls.Config.MaxVersion is %s, but QUIC requires TLS 1.3", tlsVersionName(tlsConf.MaxVersion))
+	}
+	if tlsConf.MinVersion > tls.VersionTLS13 {
+		return fmt.Errorf("quic: tls.Config.MinVersion is %s, but QUIC requires TLS 1.3", tlsVersionName(tlsConf.MinVersion))
+	}
+	if config != nil && config.RequireTLS13MinVersion && tlsConf.MinVersion < tls.VersionTLS13 {
+		return fmt.Errorf("quic: tls.Config.MinVersion is %s, but Config.RequireTLS13MinVersion requires TLS 1.3", tlsVersionName(tlsConf.MinVersion))
+	}
+	return nil
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case 0:
+		return "not set"
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("%#04x", v)
+	}
+}
+
 // populateServerConfig populates fields in the quic.Config with their default values, if none are set
 // it may be called with nil
 func populateServerConfig(config *Config) *Config {
@@ -99,6 +153,14 @@ func populateConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	maxDatagramFrameSize := config.MaxDatagramFrameSize
+	if maxDatagramFrameSize == 0 {
+		maxDatagramFrameSize = int64(protocol.MaxDatagramFrameSize)
+	}
+	initialCongestionWindow := config.InitialCongestionWindow
+	if initialCongestionWindow == 0 {
+		initialCongestionWindow = protocol.DefaultInitialCongestionWindow
+	}
 
 	return &Config{
 		Versions:                         versions,
@@ -116,8 +178,14 @@ func populateConfig(config *Config) *Config {
 		StatelessResetKey:                config.StatelessResetKey,
 		TokenStore:                       config.TokenStore,
 		EnableDatagrams:                  config.EnableDatagrams,
+		MaxDatagramFrameSize:             maxDatagramFrameSize,
+		AdditionalTransportParameters:    config.AdditionalTransportParameters,
+		SourcePortRange:                  config.SourcePortRange,
+		InitialCongestionWindow:          initialCongestionWindow,
+		StreamScheduler:                  config.StreamScheduler,
 		DisablePathMTUDiscovery:          config.DisablePathMTUDiscovery,
 		DisableVersionNegotiationPackets: config.DisableVersionNegotiationPackets,
+		RequireTLS13MinVersion:           config.RequireTLS13MinVersion,
 		Tracer:                           config.Tracer,
 	}
 }
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"reflect"
@@ -8,6 +9,7 @@ import (
 
 	mocklogging "github.com/lucas-clemente/quic-go/internal/mocks/logging"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/quicvarint"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -30,6 +32,50 @@ var _ = Describe("Config", func() {
 		It("errors on too large values for MaxIncomingUniStreams", func() {
 			Expect(validateConfig(&Config{MaxIncomingUniStreams: 1<<60 + 1})).To(MatchError("invalid value for Config.MaxIncomingUniStreams"))
 		})
+
+		It("errors on invalid values for MaxDatagramFrameSize", func() {
+			Expect(validateConfig(&Config{MaxDatagramFrameSize: -1})).To(MatchError("invalid value for Config.MaxDatagramFrameSize"))
+			Expect(validateConfig(&Config{MaxDatagramFrameSize: quicvarint.Max + 1})).To(MatchError("invalid value for Config.MaxDatagramFrameSize"))
+		})
+
+		It("errors on too large values for InitialCongestionWindow", func() {
+			Expect(validateConfig(&Config{InitialCongestionWindow: protocol.MaxCongestionWindowPackets})).To(Succeed())
+			Expect(validateConfig(&Config{InitialCongestionWindow: protocol.MaxCongestionWindowPackets + 1})).To(MatchError("invalid value for Config.InitialCongestionWindow"))
+		})
+
+		It("errors on invalid values for SourcePortRange", func() {
+			Expect(validateConfig(&Config{SourcePortRange: PortRange{Min: 1000, Max: 1000}})).To(Succeed())
+			Expect(validateConfig(&Config{SourcePortRange: PortRange{Min: 1001, Max: 1000}})).To(MatchError("invalid value for Config.SourcePortRange"))
+			Expect(validateConfig(&Config{SourcePortRange: PortRange{Max: 1000}})).To(MatchError("invalid value for Config.SourcePortRange"))
+		})
+
+		It("errors on invalid transport parameter IDs in AdditionalTransportParameters", func() {
+			Expect(validateConfig(&Config{AdditionalTransportParameters: map[uint64][]byte{0x1337: []byte("foobar")}})).To(Succeed())
+			// initial_max_data
+			Expect(validateConfig(&Config{AdditionalTransportParameters: map[uint64][]byte{0x4: {}}})).To(MatchError("invalid transport parameter ID in Config.AdditionalTransportParameters: 0x4"))
+			// greased
+			Expect(validateConfig(&Config{AdditionalTransportParameters: map[uint64][]byte{27: {}}})).To(MatchError("invalid transport parameter ID in Config.AdditionalTransportParameters: 0x1b"))
+			Expect(validateConfig(&Config{AdditionalTransportParameters: map[uint64][]byte{quicvarint.Max + 1: {}}})).To(HaveOccurred())
+		})
+
+		It("accepts tls.Configs that allow TLS 1.3", func() {
+			Expect(validateTLSConfig(nil, nil)).To(Succeed())
+			Expect(validateTLSConfig(&tls.Config{}, nil)).To(Succeed())
+			Expect(validateTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}, nil)).To(Succeed())
+			Expect(validateTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS13}, &Config{})).To(Succeed())
+			Expect(validateTLSConfig(&tls.Config{MinVersion: tls.VersionTLS13}, &Config{RequireTLS13MinVersion: true})).To(Succeed())
+		})
+
+		It("errors on tls.Configs that don't allow TLS 1.3", func() {
+			Expect(validateTLSConfig(&tls.Config{MaxVersion: tls.VersionTLS12}, nil)).To(MatchError("quic: tls.Config.MaxVersion is TLS 1.2, but QUIC requires TLS 1.3"))
+			Expect(validateTLSConfig(&tls.Config{MinVersion: 0x305}, nil)).To(MatchError("quic: tls.Config.MinVersion is 0x0305, but QUIC requires TLS 1.3"))
+		})
+
+		It("errors on a MinVersion lower than TLS 1.3, if RequireTLS13MinVersion is set", func() {
+			config := &Config{RequireTLS13MinVersion: true}
+			Expect(validateTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}, config)).To(MatchError("quic: tls.Config.MinVersion is TLS 1.2, but Config.RequireTLS13MinVersion requires TLS 1.3"))
+			Expect(validateTLSConfig(&tls.Config{}, config)).To(MatchError("quic: tls.Config.MinVersion is not set, but Config.RequireTLS13MinVersion requires TLS 1.3"))
+		})
 	})
 
 	configWithNonZeroNonFunctionFields := func() *Config {
@@ -75,10 +121,22 @@ var _ = Describe("Config", func() {
 				f.Set(reflect.ValueOf(true))
 			case "EnableDatagrams":
 				f.Set(reflect.ValueOf(true))
+			case "MaxDatagramFrameSize":
+				f.Set(reflect.ValueOf(int64(1337)))
+			case "AdditionalTransportParameters":
+				f.Set(reflect.ValueOf(map[uint64][]byte{0x1337: []byte("foobar")}))
+			case "SourcePortRange":
+				f.Set(reflect.ValueOf(PortRange{Min: 1000, Max: 2000}))
+			case "InitialCongestionWindow":
+				f.Set(reflect.ValueOf(uint32(100)))
+			case "StreamScheduler":
+				f.Set(reflect.ValueOf(&highestStreamFirstScheduler{}))
 			case "DisableVersionNegotiationPackets":
 				f.Set(reflect.ValueOf(true))
 			case "DisablePathMTUDiscovery":
 				f.Set(reflect.ValueOf(true))
+			case "RequireTLS13MinVersion":
+				f.Set(reflect.ValueOf(true))
 			case "Tracer":
 				f.Set(reflect.ValueOf(mocklogging.NewMockTracer(mockCtrl)))
 			default:
@@ -156,6 +214,8 @@ var _ = Describe("Config", func() {
 			Expect(c.MaxIncomingUniStreams).To(BeEquivalentTo(protocol.DefaultMaxIncomingUniStreams))
 			Expect(c.DisableVersionNegotiationPackets).To(BeFalse())
 			Expect(c.DisablePathMTUDiscovery).To(BeFalse())
+			Expect(c.MaxDatagramFrameSize).To(BeEquivalentTo(protocol.MaxDatagramFrameSize))
+			Expect(c.InitialCongestionWindow).To(BeEquivalentTo(protocol.DefaultInitialCongestionWindow))
 		})
 
 		It("populates empty fields with default values, for the server", func() {
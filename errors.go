@@ -56,3 +56,13 @@ func (e *StreamError) Is(target error) bool {
 func (e *StreamError) Error() string {
 	return fmt.Sprintf("stream %d canceled with error code %d", e.StreamID, e.ErrorCode)
 }
+
+// A DatagramTooLargeError is returned from Session.SendMessage if the message
+// doesn't fit into a DATAGRAM frame of the size the peer is willing to receive.
+type DatagramTooLargeError struct {
+	MaxDataLen int64
+}
+
+func (e *DatagramTooLargeError) Error() string {
+	return fmt.Sprintf("message too large (maximum: %d bytes)", e.MaxDataLen)
+}
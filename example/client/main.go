@@ -5,12 +5,15 @@ import (
 	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/http3"
@@ -18,7 +21,6 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/lucas-clemente/quic-go/qlog"
-	"github.com/montanaflynn/stats"
 )
 
 func main() {
@@ -27,8 +29,12 @@ func main() {
 	keyLogFile := flag.String("keylog", "", "key log file")
 	insecure := flag.Bool("insecure", false, "skip certificate verification")
 	enableQlog := flag.Bool("qlog", false, "output a qlog (in the same directory)")
+	qlogStdout := flag.Bool("qlog-stdout", false, "write the qlogs to stdout as a JSON text sequence (the summary is then written to stderr)")
+	qlogMaxSize := flag.Int64("qlog-max-size", 0, "rotate qlog files after they exceed this size (in bytes)")
+	qlogCategories := flag.String("qlog-categories", "", "comma-separated list of qlog event categories to emit (default: all)")
 	discovery := flag.String("n", "alt-svc", "the way to find availability and endpoint detail of HTTP/3")
 	times := flag.Int("times", 1, "how many time to repeat request to the client")
+	use0RTT := flag.Bool("0rtt", false, "reuse TLS session tickets across the repeated requests, and send them using 0-RTT")
 	flag.Parse()
 	urls := flag.Args()
 
@@ -57,17 +63,45 @@ func main() {
 	}
 	testdata.AddRootCA(pool)
 
+	// The response bodies are logged to stderr.
+	// If the qlogs are written to stdout, the summary is written to stderr as well.
+	var out io.Writer = os.Stdout
+	if *qlogStdout {
+		out = os.Stderr
+	}
+
 	var qconf quic.Config
+	var tracers []logging.Tracer
 	if *enableQlog {
-		qconf.Tracer = qlog.NewTracer(func(_ logging.Perspective, connID []byte) io.WriteCloser {
+		tracers = append(tracers, qlog.NewRotatingTracer(func(_ logging.Perspective, connID []byte, index int) io.WriteCloser {
 			filename := fmt.Sprintf("client_%x.qlog", connID)
+			if index > 0 {
+				filename = fmt.Sprintf("client_%x_%d.qlog", connID, index)
+			}
 			f, err := os.Create(filename)
 			if err != nil {
 				log.Fatal(err)
 			}
 			log.Printf("Creating qlog file %s.\n", filename)
 			return utils.NewBufferedWriteCloser(bufio.NewWriter(f), f)
-		})
+		}, *qlogMaxSize))
+	}
+	if *qlogStdout {
+		stdout := newJSONSeqOutput(os.Stdout)
+		tracers = append(tracers, qlog.NewTracer(func(logging.Perspective, []byte) io.WriteCloser {
+			return stdout.newWriter()
+		}))
+	}
+	if len(*qlogCategories) > 0 {
+		for i, t := range tracers {
+			tracers[i], err = qlog.NewFilteringTracer(t, strings.Split(*qlogCategories, ",")...)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if len(tracers) > 0 {
+		qconf.Tracer = logging.NewMultiplexedTracer(tracers...)
 	}
 
 	var connectionDiscovery http3.ConnectionDiscovery
@@ -80,9 +114,25 @@ func main() {
 		panic("invalid option of connection discovery")
 	}
 
+	method := http.MethodGet
+	var sessionCache tls.ClientSessionCache
+	if *use0RTT {
+		method = http3.MethodGet0RTT
+		// The session tickets are shared by the RoundTrippers of all iterations,
+		// so that every connection but the first one can use 0-RTT.
+		sessionCache = tls.NewLRUClientSessionCache(len(urls))
+	}
+
+	var skipped []string
 	for _, addr := range urls {
+		var unresolvable bool
 		h3Count := 0
+		resumedCount := 0
+		attempted0RTTCount := 0
+		zeroRTTCount := 0
 		records := make([]float64, 0, *times)
+		ttfbRecords := make([]float64, 0, *times)
+		latencyRecords := make([]float64, 0, *times)
 		for i := 0; i < *times; i++ {
 
 			// new client
@@ -91,6 +141,7 @@ func main() {
 					RootCAs:            pool,
 					InsecureSkipVerify: *insecure,
 					KeyLogWriter:       keyLog,
+					ClientSessionCache: sessionCache,
 				},
 				QuicConfig:          &qconf,
 				ConnectionDiscovery: connectionDiscovery,
@@ -100,14 +151,35 @@ func main() {
 				Transport: roundTripper,
 			}
 
-			rsp, err := client.Get(addr)
+			req, err := http.NewRequest(method, addr, nil)
 			if err != nil {
 				log.Fatal(err)
 			}
+			start := time.Now()
+			rsp, err := client.Do(req)
+			latency := time.Since(start)
+			if err != nil {
+				if isDNSError(err) {
+					log.Printf("Skipping %s, since the host couldn't be resolved: %s", addr, err)
+					unresolvable = true
+					break
+				}
+				log.Fatalf("Request to %s failed: %s", addr, err)
+			}
 
 			if rsp.ProtoMajor == 3 {
 				h3Count++
 			}
+			if roundTripper.MetricsResumed {
+				resumedCount++
+			}
+			if roundTripper.MetricsAttempted0RTT {
+				attempted0RTTCount++
+			}
+			if roundTripper.MetricsAccepted0RTT {
+				// the handshake didn't delay the request
+				zeroRTTCount++
+			}
 
 			if !*quiet {
 				body := &bytes.Buffer{}
@@ -120,25 +192,50 @@ func main() {
 				logger.Infof("Response Body:")
 				logger.Infof("%s", body.Bytes())
 			}
-			if roundTripper.MetricsHandshakeDone.IsZero() || roundTripper.MetricsHandshakeStart.IsZero() {
-				panic("metric is not available!")
+			latencyRecords = append(latencyRecords, float64(latency.Milliseconds()))
+			// Requests sent using 0-RTT don't wait for the handshake to complete,
+			// so the handshake duration is not available for them.
+			if !*use0RTT || !roundTripper.MetricsHandshakeDone.IsZero() {
+				if roundTripper.MetricsHandshakeDone.IsZero() || roundTripper.MetricsHandshakeStart.IsZero() {
+					panic("metric is not available!")
+				}
+				duration := roundTripper.MetricsHandshakeDone.Sub(roundTripper.MetricsHandshakeStart).Milliseconds()
+				records = append(records, float64(duration))
 			}
-			duration := roundTripper.MetricsHandshakeDone.Sub(roundTripper.MetricsHandshakeStart).Milliseconds()
-			records = append(records, float64(duration))
+			ttfbRecords = append(ttfbRecords, float64(roundTripper.MetricsTimeToFirstByte().Milliseconds()))
 		}
 
-		mean, _ := stats.Mean(records)
-		stdev, _ := stats.StandardDeviation(records)
-		min, _ := stats.Min(records)
-		p25, _ := stats.Percentile(records, 25.0)
-		median, _ := stats.Median(records)
-		p75, _ := stats.Percentile(records, 75.0)
-		max, _ := stats.Max(records)
-
-		fmt.Printf("----------------------------------------------------------------\n")
-		fmt.Printf("H3 access to %s : %d times out of %d time\n", addr, h3Count, *times)
-		fmt.Printf("Average: %gms, Standard deviation: %gms\n", mean, stdev)
-		fmt.Printf("Box plot... %gms, %gms, %gms, %gms, %gms\n", min, p25, median, p75, max)
-		fmt.Printf("----------------------------------------------------------------\n")
+		if unresolvable {
+			skipped = append(skipped, addr)
+			continue
+		}
+
+		report := Compute(records)
+		ttfbReport := Compute(ttfbRecords)
+		latencyReport := Compute(latencyRecords)
+
+		fmt.Fprintf(out, "----------------------------------------------------------------\n")
+		fmt.Fprintf(out, "H3 access to %s : %d times out of %d time\n", addr, h3Count, *times)
+		fmt.Fprintf(out, "TLS session resumed: %d times out of %d time\n", resumedCount, *times)
+		fmt.Fprintf(out, "0-RTT attempted: %d times, accepted: %d times out of %d time\n", attempted0RTTCount, zeroRTTCount, *times)
+		if report.Count > 0 {
+			fmt.Fprintf(out, "Average: %gms, Standard deviation: %gms\n", report.Mean, report.StandardDeviation)
+			fmt.Fprintf(out, "Box plot... %gms, %gms, %gms, %gms, %gms\n", report.Min, report.P25, report.Median, report.P75, report.Max)
+		} else {
+			fmt.Fprintf(out, "Handshake duration not available, since all requests were sent using 0-RTT\n")
+		}
+		fmt.Fprintf(out, "Time to first byte... Average: %gms, Median: %gms, Max: %gms\n", ttfbReport.Mean, ttfbReport.Median, ttfbReport.Max)
+		fmt.Fprintf(out, "Request latency (including the handshake)... Average: %gms, Median: %gms, Max: %gms\n", latencyReport.Mean, latencyReport.Median, latencyReport.Max)
+		fmt.Fprintf(out, "----------------------------------------------------------------\n")
 	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, "Skipped %d URL(s) that couldn't be resolved: %s\n", len(skipped), strings.Join(skipped, ", "))
+	}
+}
+
+// isDNSError says if a request failed because the host couldn't be resolved,
+// as opposed to a failure of the handshake or of the request itself.
+func isDNSError(err error) bool {
+	var dnsErr *http3.ErrDNS
+	return errors.As(err, &dnsErr)
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/lucas-clemente/quic-go/http3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	It("detects DNS errors", func() {
+		dnsErr := &http3.ErrDNS{Host: "example.invalid", Err: &net.DNSError{Err: "no such host", Name: "example.invalid"}}
+		Expect(isDNSError(dnsErr)).To(BeTrue())
+		// http.Client wraps the error returned by the RoundTripper
+		Expect(isDNSError(&url.Error{Op: "Get", URL: "https://example.invalid", Err: dnsErr})).To(BeTrue())
+		Expect(isDNSError(fmt.Errorf("request failed: %w", dnsErr))).To(BeTrue())
+	})
+
+	It("doesn't treat handshake errors as DNS errors", func() {
+		quicErr := &http3.ErrQUICDial{Addr: "127.0.0.1:443", Err: errors.New("handshake failed")}
+		Expect(isDNSError(&url.Error{Op: "Get", URL: "https://localhost", Err: quicErr})).To(BeFalse())
+		Expect(isDNSError(errors.New("request failed"))).To(BeFalse())
+	})
+})
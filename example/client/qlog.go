@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// recordSeparator starts every record of a JSON text sequence (RFC 7464).
+const recordSeparator = 0x1e
+
+// A jsonSeqOutput writes the qlogs of multiple connections to a single io.Writer, e.g. to stdout.
+// The qlog records (one per line) are written as a JSON text sequence.
+// Every record is written at once, so that the records of different connections are not interleaved.
+type jsonSeqOutput struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func newJSONSeqOutput(w io.Writer) *jsonSeqOutput {
+	return &jsonSeqOutput{w: w}
+}
+
+// newWriter returns the io.WriteCloser for the qlog of a connection.
+func (o *jsonSeqOutput) newWriter() io.WriteCloser {
+	return &jsonSeqWriter{output: o}
+}
+
+func (o *jsonSeqOutput) writeRecord(record []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	b := make([]byte, 0, len(record)+2)
+	b = append(b, recordSeparator)
+	b = append(b, record...)
+	if len(record) == 0 || record[len(record)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	_, err := o.w.Write(b)
+	return err
+}
+
+type jsonSeqWriter struct {
+	output *jsonSeqOutput
+	buf    []byte // the beginning of a record that hasn't been written completely yet
+}
+
+var _ io.WriteCloser = &jsonSeqWriter{}
+
+func (w *jsonSeqWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := w.output.writeRecord(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Close writes the last record, in case the qlog doesn't end with a newline.
+// It doesn't close the underlying io.Writer, since it's shared by all connections.
+func (w *jsonSeqWriter) Close() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.output.writeRecord(w.buf)
+	w.buf = nil
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("qlog output", func() {
+	It("writes the records as a JSON text sequence", func() {
+		buf := &bytes.Buffer{}
+		w := newJSONSeqOutput(buf).newWriter()
+		_, err := w.Write([]byte("{\"foo\":1}\n{\"bar\":"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.String()).To(Equal("\x1e{\"foo\":1}\n"))
+		_, err = w.Write([]byte("2}\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.String()).To(Equal("\x1e{\"foo\":1}\n\x1e{\"bar\":2}\n"))
+		Expect(w.Close()).To(Succeed())
+		Expect(buf.String()).To(Equal("\x1e{\"foo\":1}\n\x1e{\"bar\":2}\n"))
+	})
+
+	It("writes an incomplete record when closed", func() {
+		buf := &bytes.Buffer{}
+		w := newJSONSeqOutput(buf).newWriter()
+		_, err := w.Write([]byte("{\"foo\":1}"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.Len()).To(BeZero())
+		Expect(w.Close()).To(Succeed())
+		Expect(buf.String()).To(Equal("\x1e{\"foo\":1}\n"))
+	})
+
+	It("doesn't interleave the records of different connections", func() {
+		buf := &bytes.Buffer{}
+		out := newJSONSeqOutput(buf)
+		w1 := out.newWriter()
+		w2 := out.newWriter()
+		_, err := w1.Write([]byte("{\"conn\":"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w2.Write([]byte("{\"conn\":2}\n"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w1.Write([]byte("1}\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.String()).To(Equal("\x1e{\"conn\":2}\n\x1e{\"conn\":1}\n"))
+	})
+})
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+
+	"github.com/montanaflynn/stats"
+)
+
+// A StatsBackend computes the statistics of a RunReport, e.g. using an HDR histogram.
+// The methods are only called with non-empty inputs, and must not modify the records.
+type StatsBackend interface {
+	Mean(records []float64) float64
+	StandardDeviation(records []float64) float64
+	Min(records []float64) float64
+	Percentile(records []float64, percent float64) float64
+	Median(records []float64) float64
+	Max(records []float64) float64
+}
+
+// DefaultStatsBackend is the StatsBackend used by Compute.
+// It uses github.com/montanaflynn/stats.
+var DefaultStatsBackend StatsBackend = montanaflynnStats{}
+
+// A RunReport summarizes the durations (in milliseconds) measured over multiple runs.
+// For an empty input, all statistics are NaN.
+type RunReport struct {
+	Count int
+
+	Mean              float64
+	StandardDeviation float64
+
+	Min    float64
+	P25    float64
+	Median float64
+	P75    float64
+	Max    float64
+}
+
+// Compute computes the statistics of the records, using the DefaultStatsBackend.
+func Compute(records []float64) RunReport {
+	return ComputeWith(DefaultStatsBackend, records)
+}
+
+// ComputeWith computes the statistics of the records, using the StatsBackend b.
+func ComputeWith(b StatsBackend, records []float64) RunReport {
+	r := RunReport{Count: len(records)}
+	if len(records) == 0 {
+		nan := math.NaN()
+		r.Mean, r.StandardDeviation = nan, nan
+		r.Min, r.P25, r.Median, r.P75, r.Max = nan, nan, nan, nan, nan
+		return r
+	}
+	r.Mean = b.Mean(records)
+	r.StandardDeviation = b.StandardDeviation(records)
+	r.Min = b.Min(records)
+	r.P25 = b.Percentile(records, 25)
+	r.Median = b.Median(records)
+	r.P75 = b.Percentile(records, 75)
+	r.Max = b.Max(records)
+	return r
+}
+
+type montanaflynnStats struct{}
+
+var _ StatsBackend = montanaflynnStats{}
+
+// The errors can be ignored, since they're only returned for empty inputs.
+
+func (montanaflynnStats) Mean(records []float64) float64 {
+	m, _ := stats.Mean(records)
+	return m
+}
+
+func (montanaflynnStats) StandardDeviation(records []float64) float64 {
+	sd, _ := stats.StandardDeviation(records)
+	return sd
+}
+
+func (montanaflynnStats) Min(records []float64) float64 {
+	m, _ := stats.Min(records)
+	return m
+}
+
+// Percentile calculates the percentile.
+// stats.Percentile fails for small inputs if the percentile falls below the first element
+// (e.g. the 25th percentile of 2 or 3 elements). The nearest rank is used in that case.
+func (montanaflynnStats) Percentile(records []float64, percent float64) float64 {
+	if p, err := stats.Percentile(records, percent); err == nil {
+		return p
+	}
+	p, _ := stats.PercentileNearestRank(records, percent)
+	return p
+}
+
+func (montanaflynnStats) Median(records []float64) float64 {
+	m, _ := stats.Median(records)
+	return m
+}
+
+func (montanaflynnStats) Max(records []float64) float64 {
+	m, _ := stats.Max(records)
+	return m
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Run Report", func() {
+	It("returns NaN for an empty input", func() {
+		r := Compute(nil)
+		Expect(r.Count).To(BeZero())
+		for _, v := range []float64{r.Mean, r.StandardDeviation, r.Min, r.P25, r.Median, r.P75, r.Max} {
+			Expect(math.IsNaN(v)).To(BeTrue())
+		}
+	})
+
+	It("computes the statistics of a single record", func() {
+		Expect(Compute([]float64{42})).To(Equal(RunReport{
+			Count:  1,
+			Mean:   42,
+			Min:    42,
+			P25:    42,
+			Median: 42,
+			P75:    42,
+			Max:    42,
+		}))
+	})
+
+	It("computes the statistics of multiple records", func() {
+		r := Compute([]float64{4, 1, 3, 2})
+		Expect(r.Count).To(Equal(4))
+		Expect(r.Mean).To(Equal(2.5))
+		Expect(r.StandardDeviation).To(BeNumerically("~", math.Sqrt(1.25), 1e-9))
+		Expect(r.Min).To(Equal(1.0))
+		Expect(r.P25).To(Equal(1.0))
+		Expect(r.Median).To(Equal(2.5))
+		Expect(r.P75).To(Equal(3.0))
+		Expect(r.Max).To(Equal(4.0))
+	})
+
+	It("doesn't modify the records", func() {
+		records := []float64{4, 1, 3, 2}
+		Compute(records)
+		Expect(records).To(Equal([]float64{4, 1, 3, 2}))
+	})
+
+	// stats.Percentile fails if the percentile falls below the first element.
+	It("computes the 25th percentile of 2 records", func() {
+		r := Compute([]float64{20, 10})
+		Expect(r.Mean).To(Equal(15.0))
+		Expect(r.StandardDeviation).To(Equal(5.0))
+		Expect(r.P25).To(Equal(10.0))
+		Expect(r.Median).To(Equal(15.0))
+		Expect(r.P75).To(Equal(15.0))
+	})
+
+	It("computes the 25th percentile of 3 records", func() {
+		r := Compute([]float64{3, 1, 2})
+		Expect(r.P25).To(Equal(1.0))
+		Expect(r.Median).To(Equal(2.0))
+		Expect(r.P75).To(Equal(2.5))
+	})
+
+	Context("using a custom stats backend", func() {
+		It("passes the records to the backend", func() {
+			records := []float64{4, 1, 3, 2}
+			b := &fakeStatsBackend{}
+			r := ComputeWith(b, records)
+			Expect(b.calls).To(Equal([]string{"mean", "stddev", "min", "p25", "median", "p75", "max"}))
+			for _, in := range b.inputs {
+				Expect(in).To(Equal(records))
+			}
+			Expect(r).To(Equal(RunReport{
+				Count:             4,
+				Mean:              1,
+				StandardDeviation: 2,
+				Min:               3,
+				P25:               25,
+				Median:            4,
+				P75:               75,
+				Max:               5,
+			}))
+		})
+
+		It("doesn't call the backend for an empty input", func() {
+			b := &fakeStatsBackend{}
+			r := ComputeWith(b, nil)
+			Expect(b.calls).To(BeEmpty())
+			Expect(math.IsNaN(r.Mean)).To(BeTrue())
+		})
+	})
+})
+
+type fakeStatsBackend struct {
+	calls  []string
+	inputs [][]float64
+}
+
+var _ StatsBackend = &fakeStatsBackend{}
+
+func (b *fakeStatsBackend) record(name string, records []float64) {
+	b.calls = append(b.calls, name)
+	b.inputs = append(b.inputs, records)
+}
+
+func (b *fakeStatsBackend) Mean(r []float64) float64 {
+	b.record("mean", r)
+	return 1
+}
+
+func (b *fakeStatsBackend) StandardDeviation(r []float64) float64 {
+	b.record("stddev", r)
+	return 2
+}
+
+func (b *fakeStatsBackend) Min(r []float64) float64 {
+	b.record("min", r)
+	return 3
+}
+
+func (b *fakeStatsBackend) Percentile(r []float64, percent float64) float64 {
+	b.record(fmt.Sprintf("p%g", percent), r)
+	return percent
+}
+
+func (b *fakeStatsBackend) Median(r []float64) float64 {
+	b.record("median", r)
+	return 4
+}
+
+func (b *fakeStatsBackend) Max(r []float64) float64 {
+	b.record("max", r)
+	return 5
+}
@@ -30,6 +30,8 @@ type framerI struct {
 
 	activeStreams map[protocol.StreamID]struct{}
 	streamQueue   []protocol.StreamID
+	// scheduler reorders the streamQueue. If nil, streams are served round-robin.
+	scheduler StreamScheduler
 
 	controlFrameMutex sync.Mutex
 	controlFrames     []wire.Frame
@@ -39,11 +41,13 @@ var _ framer = &framerI{}
 
 func newFramer(
 	streamGetter streamGetter,
+	scheduler StreamScheduler,
 	v protocol.VersionNumber,
 ) framer {
 	return &framerI{
 		streamGetter:  streamGetter,
 		activeStreams: make(map[protocol.StreamID]struct{}),
+		scheduler:     scheduler,
 		version:       v,
 	}
 }
@@ -97,6 +101,9 @@ func (f *framerI) AppendStreamFrames(frames []ackhandler.Frame, maxLen protocol.
 	var length protocol.ByteCount
 	var lastFrame *ackhandler.Frame
 	f.mutex.Lock()
+	if f.scheduler != nil && len(f.streamQueue) > 1 {
+		f.scheduler.Schedule(f.streamQueue)
+	}
 	// pop STREAM frames, until less than MinStreamFrameSize bytes are left in the packet
 	numActiveStreams := len(f.streamQueue)
 	for i := 0; i < numActiveStreams; i++ {
@@ -3,6 +3,7 @@ package quic
 import (
 	"bytes"
 	"math/rand"
+	"sort"
 
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -14,6 +15,16 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// highestStreamFirstScheduler is a StreamScheduler that always serves the stream with the highest stream ID first.
+type highestStreamFirstScheduler struct {
+	calls int
+}
+
+func (s *highestStreamFirstScheduler) Schedule(streams []StreamID) {
+	s.calls++
+	sort.Slice(streams, func(i, j int) bool { return streams[i] > streams[j] })
+}
+
 var _ = Describe("Framer", func() {
 	const (
 		id1 = protocol.StreamID(10)
@@ -33,7 +44,7 @@ var _ = Describe("Framer", func() {
 		stream1.EXPECT().StreamID().Return(protocol.StreamID(5)).AnyTimes()
 		stream2 = NewMockSendStreamI(mockCtrl)
 		stream2.EXPECT().StreamID().Return(protocol.StreamID(6)).AnyTimes()
-		framer = newFramer(streamGetter, version)
+		framer = newFramer(streamGetter, nil, version)
 	})
 
 	Context("handling control frames", func() {
@@ -275,6 +286,34 @@ var _ = Describe("Framer", func() {
 			Expect(frames[1].Frame).To(Equal(f1))
 		})
 
+		It("uses the stream scheduler to decide the order of the streams", func() {
+			scheduler := &highestStreamFirstScheduler{}
+			framer = newFramer(streamGetter, scheduler, version)
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil)
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil).Times(2)
+			f1 := &wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}
+			f21 := &wire.StreamFrame{StreamID: id2, Data: []byte("foobaz")}
+			f22 := &wire.StreamFrame{StreamID: id2, Data: []byte("raboof")}
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(&ackhandler.Frame{Frame: f21}, true)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(&ackhandler.Frame{Frame: f22}, false)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(&ackhandler.Frame{Frame: f1}, false)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			// Without the scheduler, stream 1 would be served first,
+			// and stream 2 would be served by round-robin after stream 1.
+			frames, _ := framer.AppendStreamFrames(nil, protocol.MinStreamFrameSize)
+			Expect(frames).To(HaveLen(1))
+			Expect(frames[0].Frame).To(Equal(f21))
+			frames, _ = framer.AppendStreamFrames(nil, protocol.MinStreamFrameSize)
+			Expect(frames).To(HaveLen(1))
+			Expect(frames[0].Frame).To(Equal(f22))
+			frames, _ = framer.AppendStreamFrames(nil, protocol.MinStreamFrameSize)
+			Expect(frames).To(HaveLen(1))
+			Expect(frames[0].Frame).To(Equal(f1))
+			// The scheduler is not called if there's only a single stream with data.
+			Expect(scheduler.calls).To(Equal(2))
+		})
+
 		It("only asks a stream for data once, even if it was reported active multiple times", func() {
 			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil)
 			f := &wire.StreamFrame{Data: []byte("foobar")}
@@ -7,6 +7,7 @@ require (
 	github.com/ebi-yade/altsvc-go v0.1.1
 	github.com/francoispqt/gojay v1.2.13
 	github.com/golang/mock v1.6.0
+	github.com/klauspost/compress v1.15.9
 	github.com/marten-seemann/qpack v0.2.1
 	github.com/marten-seemann/qtls-go1-16 v0.1.4
 	github.com/marten-seemann/qtls-go1-17 v0.1.0
@@ -0,0 +1,71 @@
+package quic
+
+import "github.com/lucas-clemente/quic-go/internal/protocol"
+
+// handshakeProgress records how far the handshake got.
+// It is reported in timeout errors, to help diagnosing stalled handshakes,
+// e.g. due to middleboxes dropping packets.
+type handshakeProgress struct {
+	reached uint8
+	last    handshakeStep
+}
+
+type handshakeStep uint8
+
+const (
+	handshakeStepSentInitial handshakeStep = 1 << iota
+	handshakeStepReceivedInitial
+	handshakeStepSentHandshake
+	handshakeStepReceivedHandshake
+	handshakeStepReceivedTransportParameters
+)
+
+func (s handshakeStep) String() string {
+	switch s {
+	case handshakeStepSentInitial:
+		return "sent Initial packet"
+	case handshakeStepReceivedInitial:
+		return "received Initial packet"
+	case handshakeStepSentHandshake:
+		return "sent Handshake packet"
+	case handshakeStepReceivedHandshake:
+		return "received Handshake packet"
+	case handshakeStepReceivedTransportParameters:
+		return "received transport parameters"
+	default:
+		return ""
+	}
+}
+
+// record records a step, if it wasn't reached before.
+func (p *handshakeProgress) record(step handshakeStep) {
+	if p.reached&uint8(step) != 0 {
+		return
+	}
+	p.reached |= uint8(step)
+	p.last = step
+}
+
+func (p *handshakeProgress) sentPacket(encLevel protocol.EncryptionLevel) {
+	switch encLevel {
+	case protocol.EncryptionInitial:
+		p.record(handshakeStepSentInitial)
+	case protocol.EncryptionHandshake:
+		p.record(handshakeStepSentHandshake)
+	}
+}
+
+func (p *handshakeProgress) receivedPacket(encLevel protocol.EncryptionLevel) {
+	switch encLevel {
+	case protocol.EncryptionInitial:
+		p.record(handshakeStepReceivedInitial)
+	case protocol.EncryptionHandshake:
+		p.record(handshakeStepReceivedHandshake)
+	}
+}
+
+// String returns the last step that was reached.
+// It returns an empty string if no step was reached yet.
+func (p *handshakeProgress) String() string {
+	return p.last.String()
+}
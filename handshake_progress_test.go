@@ -0,0 +1,43 @@
+package quic
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handshake Progress", func() {
+	It("is empty before any packet was sent", func() {
+		var p handshakeProgress
+		Expect(p.String()).To(BeEmpty())
+	})
+
+	It("reports the last step that was reached", func() {
+		var p handshakeProgress
+		p.sentPacket(protocol.EncryptionInitial)
+		Expect(p.String()).To(Equal("sent Initial packet"))
+		p.receivedPacket(protocol.EncryptionInitial)
+		Expect(p.String()).To(Equal("received Initial packet"))
+		p.receivedPacket(protocol.EncryptionHandshake)
+		Expect(p.String()).To(Equal("received Handshake packet"))
+		p.record(handshakeStepReceivedTransportParameters)
+		Expect(p.String()).To(Equal("received transport parameters"))
+	})
+
+	It("doesn't report steps that were already reached before", func() {
+		var p handshakeProgress
+		p.sentPacket(protocol.EncryptionInitial)
+		p.receivedPacket(protocol.EncryptionInitial)
+		p.sentPacket(protocol.EncryptionInitial)
+		Expect(p.String()).To(Equal("received Initial packet"))
+	})
+
+	It("ignores 0-RTT and 1-RTT packets", func() {
+		var p handshakeProgress
+		p.sentPacket(protocol.EncryptionInitial)
+		p.sentPacket(protocol.Encryption0RTT)
+		p.receivedPacket(protocol.Encryption1RTT)
+		Expect(p.String()).To(Equal("sent Initial packet"))
+	})
+})
@@ -0,0 +1,85 @@
+package http3
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// AddressFamily controls which IP address family is used when dialing a host.
+type AddressFamily int
+
+const (
+	// AddressFamilyAuto uses the addresses as returned by the resolver.
+	AddressFamilyAuto AddressFamily = iota
+	// AddressFamilyIPv4 only dials IPv4 addresses.
+	AddressFamilyIPv4
+	// AddressFamilyIPv6 only dials IPv6 addresses.
+	AddressFamilyIPv6
+)
+
+func (f AddressFamily) String() string {
+	switch f {
+	case AddressFamilyAuto:
+		return "auto"
+	case AddressFamilyIPv4:
+		return "IPv4"
+	case AddressFamilyIPv6:
+		return "IPv6"
+	default:
+		return fmt.Sprintf("unknown address family (%d)", int(f))
+	}
+}
+
+// tcpNetwork returns the network used for dialing TCP connections.
+func (f AddressFamily) tcpNetwork() string {
+	switch f {
+	case AddressFamilyIPv4:
+		return "tcp4"
+	case AddressFamilyIPv6:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+func (f AddressFamily) matches(ip net.IP) bool {
+	switch f {
+	case AddressFamilyIPv4:
+		return ip.To4() != nil
+	case AddressFamilyIPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// resolveAddr resolves the host of addr (in host:port format),
+// and returns the first address of the requested address family.
+// For AddressFamilyAuto, addr is returned unchanged, and resolved when dialing.
+func resolveAddr(ctx context.Context, addr string, family AddressFamily) (string, error) {
+	if family == AddressFamilyAuto {
+		return addr, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	var ips []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IPAddr{{IP: ip}}
+	} else {
+		ips, err = lookupIPAddr(ctx, host)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, ip := range ips {
+		if family.matches(ip.IP) {
+			return net.JoinHostPort(ip.String(), port), nil
+		}
+	}
+	return "", fmt.Errorf("http3: no %s address found for %s", family, host)
+}
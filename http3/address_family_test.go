@@ -0,0 +1,87 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Address Family", func() {
+	var origLookupIPAddr func(context.Context, string) ([]net.IPAddr, error)
+
+	BeforeEach(func() {
+		origLookupIPAddr = lookupIPAddr
+		lookupIPAddr = func(_ context.Context, host string) ([]net.IPAddr, error) {
+			Expect(host).To(Equal("quic.clemente.io"))
+			return []net.IPAddr{
+				{IP: net.ParseIP("2001:db8::1")},
+				{IP: net.ParseIP("192.0.2.1")},
+			}, nil
+		}
+	})
+
+	AfterEach(func() {
+		lookupIPAddr = origLookupIPAddr
+	})
+
+	It("has a string representation", func() {
+		Expect(AddressFamilyAuto.String()).To(Equal("auto"))
+		Expect(AddressFamilyIPv4.String()).To(Equal("IPv4"))
+		Expect(AddressFamilyIPv6.String()).To(Equal("IPv6"))
+		Expect(AddressFamily(42).String()).To(Equal("unknown address family (42)"))
+	})
+
+	It("doesn't resolve the hostname for AddressFamilyAuto", func() {
+		lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+			Fail("didn't expect a lookup")
+			return nil, nil
+		}
+		addr, err := resolveAddr(context.Background(), "quic.clemente.io:443", AddressFamilyAuto)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addr).To(Equal("quic.clemente.io:443"))
+	})
+
+	It("selects an IPv4 address", func() {
+		addr, err := resolveAddr(context.Background(), "quic.clemente.io:443", AddressFamilyIPv4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addr).To(Equal("192.0.2.1:443"))
+	})
+
+	It("selects an IPv6 address", func() {
+		addr, err := resolveAddr(context.Background(), "quic.clemente.io:443", AddressFamilyIPv6)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addr).To(Equal("[2001:db8::1]:443"))
+	})
+
+	It("errors if there's no address of the requested family", func() {
+		lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}}, nil
+		}
+		_, err := resolveAddr(context.Background(), "quic.clemente.io:443", AddressFamilyIPv6)
+		Expect(err).To(MatchError("http3: no IPv6 address found for quic.clemente.io"))
+	})
+
+	It("checks the family of IP addresses", func() {
+		addr, err := resolveAddr(context.Background(), "192.0.2.1:443", AddressFamilyIPv4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addr).To(Equal("192.0.2.1:443"))
+		_, err = resolveAddr(context.Background(), "192.0.2.1:443", AddressFamilyIPv6)
+		Expect(err).To(MatchError("http3: no IPv6 address found for 192.0.2.1"))
+	})
+
+	It("returns resolver errors", func() {
+		testErr := errors.New("lookup failed")
+		lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) { return nil, testErr }
+		_, err := resolveAddr(context.Background(), "quic.clemente.io:443", AddressFamilyIPv4)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("uses the address family for TCP connections", func() {
+		Expect(AddressFamilyAuto.tcpNetwork()).To(Equal("tcp"))
+		Expect(AddressFamilyIPv4.tcpNetwork()).To(Equal("tcp4"))
+		Expect(AddressFamilyIPv6.tcpNetwork()).To(Equal("tcp6"))
+	})
+})
@@ -0,0 +1,21 @@
+package http3
+
+import "net/http"
+
+// HeaderAffinity returns a RoundTripper.ConnectionAffinity function
+// that uses the value of the request header name as the affinity key.
+func HeaderAffinity(name string) func(*http.Request) string {
+	return func(req *http.Request) string { return req.Header.Get(name) }
+}
+
+// CookieAffinity returns a RoundTripper.ConnectionAffinity function
+// that uses the value of the cookie name as the affinity key.
+func CookieAffinity(name string) func(*http.Request) string {
+	return func(req *http.Request) string {
+		c, err := req.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
@@ -0,0 +1,34 @@
+package http3
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection Affinity", func() {
+	var req *http.Request
+
+	BeforeEach(func() {
+		var err error
+		req, err = http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("uses the value of a header", func() {
+		affinity := HeaderAffinity("X-Session")
+		Expect(affinity(req)).To(BeEmpty())
+		req.Header.Set("X-Session", "foobar")
+		Expect(affinity(req)).To(Equal("foobar"))
+	})
+
+	It("uses the value of a cookie", func() {
+		affinity := CookieAffinity("session")
+		Expect(affinity(req)).To(BeEmpty())
+		req.AddCookie(&http.Cookie{Name: "other", Value: "lorem"})
+		Expect(affinity(req)).To(BeEmpty())
+		req.AddCookie(&http.Cookie{Name: "session", Value: "foobar"})
+		Expect(affinity(req)).To(Equal("foobar"))
+	})
+})
@@ -0,0 +1,176 @@
+package http3
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ebi-yade/altsvc-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// Before HTTP/3 was standardized, servers advertised QUIC using the legacy quic token, e.g.
+//
+//	Alt-Svc: quic=":443"; ma=2592000; v="46,43"
+//
+// The versions in the v parameter are usually gQUIC versions (Q046 and Q043 in this example),
+// which are not supported. A legacy entry is only used if its version list contains a
+// supported QUIC version (written in hexadecimal, e.g. v="1" for QUIC version 1).
+// It is then mapped to an entry for the ALPN of that version.
+// All other legacy entries are ignored.
+const altSvcLegacyQUIC = "quic"
+
+// parseAltSvc parses the value of an Alt-Svc header field, including legacy quic entries.
+func parseAltSvc(hdr string) ([]altsvc.Service, error) {
+	if strings.TrimSpace(hdr) == "clear" {
+		return altsvc.Parse("clear")
+	}
+	svcs := make([]altsvc.Service, 0)
+	for _, entry := range splitOutsideQuotes(hdr, ',') {
+		entry = strings.TrimSpace(entry)
+		if strings.HasPrefix(entry, altSvcLegacyQUIC+"=") {
+			svcs = append(svcs, parseLegacyAltSvc(entry)...)
+			continue
+		}
+		s, err := altsvc.Parse(entry)
+		if err != nil {
+			return nil, err
+		}
+		svcs = append(svcs, s...)
+	}
+	return svcs, nil
+}
+
+// parseLegacyAltSvc parses a legacy quic entry.
+// It returns one entry for every supported version in the version list.
+// Malformed entries are ignored.
+func parseLegacyAltSvc(entry string) []altsvc.Service {
+	var svc altsvc.Service
+	var versions []protocol.VersionNumber
+	for i, param := range splitOutsideQuotes(entry, ';') {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil
+		}
+		if i == 0 {
+			authority, err := strconv.Unquote(kv[1])
+			if err != nil {
+				return nil
+			}
+			addr := strings.SplitN(authority, ":", 2)
+			if len(addr) != 2 {
+				return nil
+			}
+			svc.AltAuthority = altsvc.AltAuthority{Host: addr[0], Port: addr[1]}
+			continue
+		}
+		switch kv[0] {
+		case "ma":
+			ma, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return nil
+			}
+			svc.MaxAge = ma
+		case "v":
+			list, err := strconv.Unquote(kv[1])
+			if err != nil {
+				return nil
+			}
+			for _, v := range strings.Split(list, ",") {
+				version, err := strconv.ParseUint(strings.TrimSpace(v), 16, 32)
+				if err != nil {
+					continue
+				}
+				if protocol.IsSupportedVersion(protocol.SupportedVersions, protocol.VersionNumber(version)) {
+					versions = append(versions, protocol.VersionNumber(version))
+				}
+			}
+		}
+	}
+	svcs := make([]altsvc.Service, 0, len(versions))
+	seen := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		alpn := versionToALPN(v)
+		if seen[alpn] {
+			continue
+		}
+		seen[alpn] = true
+		s := svc
+		s.ProtocolID = alpn
+		svcs = append(svcs, s)
+	}
+	return svcs
+}
+
+// selectAltService selects the HTTP/3 alternative that is dialed, if multiple alternatives are cached for an origin.
+// Only alternatives for the ALPN of one of the versions (in order of preference) are considered.
+// The preference order is:
+//  1. the alternative for the version that comes first in versions,
+//  2. then the alternative with the lowest port,
+//  3. then the alternative that was advertised first.
+func selectAltService(svcs []service, versions []protocol.VersionNumber) (service, bool) {
+	var selected service
+	var selectedRank, selectedPort int
+	found := false
+	for _, s := range svcs {
+		rank := -1
+		for i, v := range versions {
+			if versionToALPN(v) == s.ProtocolID {
+				rank = i
+				break
+			}
+		}
+		if rank < 0 {
+			continue
+		}
+		port, err := strconv.Atoi(s.AltAuthority.Port)
+		if err != nil {
+			continue
+		}
+		// Only replace the selected alternative if it's strictly worse, so the first one advertised wins a tie.
+		if found && (rank > selectedRank || (rank == selectedRank && port >= selectedPort)) {
+			continue
+		}
+		selected, selectedRank, selectedPort, found = s, rank, port, true
+	}
+	return selected, found
+}
+
+// altSvcAddr returns the address of an alternative for the origin (given as host:port).
+// If the alternative doesn't specify a host, it is the host of the origin.
+func altSvcAddr(origin string, svc altsvc.Service) (string, bool) {
+	host := svc.AltAuthority.Host
+	if host == "" {
+		var err error
+		host, _, err = net.SplitHostPort(origin)
+		if err != nil {
+			return "", false
+		}
+	}
+	return net.JoinHostPort(host, svc.AltAuthority.Port), true
+}
+
+// splitOutsideQuotes splits s at every occurrence of sep that is not inside a quoted string.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	var quoted, escaped bool
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
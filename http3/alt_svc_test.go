@@ -0,0 +1,125 @@
+package http3
+
+import (
+	"github.com/ebi-yade/altsvc-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alt-Svc parsing", func() {
+	It("parses Alt-Svc headers", func() {
+		svcs, err := parseAltSvc(`h3=":443"; ma=3600, h3-29="alt.example.com:8443"; ma=60`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svcs).To(Equal([]altsvc.Service{
+			{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600},
+			{ProtocolID: "h3-29", AltAuthority: altsvc.AltAuthority{Host: "alt.example.com", Port: "8443"}, MaxAge: 60},
+		}))
+	})
+
+	It("parses clear", func() {
+		svcs, err := parseAltSvc("clear")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svcs).To(Equal([]altsvc.Service{{Clear: true}}))
+	})
+
+	It("returns errors for invalid headers", func() {
+		_, err := parseAltSvc(`h3=":443"; foobar`)
+		Expect(err).To(HaveOccurred())
+		_, err = parseAltSvc("")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("ignores legacy quic entries for gQUIC versions", func() {
+		svcs, err := parseAltSvc(`quic=":443"; ma=2592000; v="46,43"`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svcs).To(BeEmpty())
+	})
+
+	It("keeps the other entries when ignoring legacy quic entries", func() {
+		svcs, err := parseAltSvc(`h3-29=":443"; ma=2592000, quic=":443"; ma=2592000; v="46,43"`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svcs).To(Equal([]altsvc.Service{
+			{ProtocolID: "h3-29", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 2592000},
+		}))
+	})
+
+	It("maps legacy quic entries for supported versions to an h3 entry", func() {
+		svcs, err := parseAltSvc(`quic="quic.clemente.io:443"; ma=3600; v="46,ff00001d,1"`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svcs).To(Equal([]altsvc.Service{
+			{ProtocolID: "h3-29", AltAuthority: altsvc.AltAuthority{Host: "quic.clemente.io", Port: "443"}, MaxAge: 3600},
+			{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Host: "quic.clemente.io", Port: "443"}, MaxAge: 3600},
+		}))
+	})
+
+	It("ignores malformed legacy quic entries", func() {
+		for _, hdr := range []string{
+			`quic=443; v="1"`,
+			`quic=":443"; ma=foo; v="1"`,
+			`quic=":443"; v=1`,
+			`quic=":443"; foobar; v="1"`,
+		} {
+			svcs, err := parseAltSvc(hdr + `, h3=":443"`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(svcs).To(Equal([]altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}}}))
+		}
+	})
+
+	Context("selecting an alternative", func() {
+		svc := func(protocolID, host, port string) service {
+			return service{Service: altsvc.Service{ProtocolID: protocolID, AltAuthority: altsvc.AltAuthority{Host: host, Port: port}}}
+		}
+		versions := []protocol.VersionNumber{protocol.Version1, protocol.VersionDraft29}
+
+		It("prefers the version that comes first", func() {
+			s, ok := selectAltService([]service{svc("h3-29", "", "443"), svc("h3", "", "8443")}, versions)
+			Expect(ok).To(BeTrue())
+			Expect(s.ProtocolID).To(Equal("h3"))
+			s, ok = selectAltService([]service{svc("h3-29", "", "443"), svc("h3", "", "8443")}, []protocol.VersionNumber{protocol.VersionDraft29, protocol.Version1})
+			Expect(ok).To(BeTrue())
+			Expect(s.ProtocolID).To(Equal("h3-29"))
+		})
+
+		It("prefers the lowest port", func() {
+			s, ok := selectAltService([]service{svc("h3", "", "8443"), svc("h3", "", "443"), svc("h3", "", "1234")}, versions)
+			Expect(ok).To(BeTrue())
+			Expect(s.AltAuthority.Port).To(Equal("443"))
+		})
+
+		It("prefers the alternative advertised first", func() {
+			s, ok := selectAltService([]service{svc("h3", "alt1.example.com", "443"), svc("h3", "alt2.example.com", "443")}, versions)
+			Expect(ok).To(BeTrue())
+			Expect(s.AltAuthority.Host).To(Equal("alt1.example.com"))
+		})
+
+		It("ignores alternatives for unsupported versions", func() {
+			s, ok := selectAltService([]service{svc("h2", "", "1"), svc("h3-29", "", "2"), svc("h3", "", "3")}, []protocol.VersionNumber{protocol.Version1})
+			Expect(ok).To(BeTrue())
+			Expect(s.AltAuthority.Port).To(Equal("3"))
+			_, ok = selectAltService([]service{svc("h2", "", "1"), svc("h3-29", "", "2")}, []protocol.VersionNumber{protocol.Version1})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("ignores alternatives with an invalid port", func() {
+			s, ok := selectAltService([]service{svc("h3", "", "foo"), svc("h3", "", "8443")}, versions)
+			Expect(ok).To(BeTrue())
+			Expect(s.AltAuthority.Port).To(Equal("8443"))
+		})
+
+		It("uses the host of the origin, if the alternative doesn't specify a host", func() {
+			addr, ok := altSvcAddr("quic.clemente.io:443", altsvc.Service{AltAuthority: altsvc.AltAuthority{Port: "8443"}})
+			Expect(ok).To(BeTrue())
+			Expect(addr).To(Equal("quic.clemente.io:8443"))
+			addr, ok = altSvcAddr("quic.clemente.io:443", altsvc.Service{AltAuthority: altsvc.AltAuthority{Host: "::1", Port: "8443"}})
+			Expect(ok).To(BeTrue())
+			Expect(addr).To(Equal("[::1]:8443"))
+		})
+	})
+
+	It("splits outside of quoted strings", func() {
+		Expect(splitOutsideQuotes(`a="1,2",b="3\",4"`, ',')).To(Equal([]string{`a="1,2"`, `b="3\",4"`}))
+		Expect(splitOutsideQuotes("a", ',')).To(Equal([]string{"a"}))
+	})
+})
@@ -3,26 +3,88 @@ package http3
 import (
 	"fmt"
 	"io"
+	"net"
+	"sync"
+	"time"
 
 	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
 // The body of a http.Request or http.Response.
 type body struct {
-	str quic.Stream
+	str quic.ReceiveStream
 
 	// only set for the http.Response
 	// The channel is closed when the user is done with this response:
 	// either when Read() errors, or when Close() is called.
-	reqDone       chan<- struct{}
-	reqDoneClosed bool
+	reqDone     chan<- struct{}
+	reqDoneOnce sync.Once
 
 	onFrameError func()
+	// only set for the http.Response
+	// If nil, PUSH_PROMISE frames are treated as unexpected frames.
+	onPushPromise func(*pushPromiseFrame) error
+	// bufferPool is used by WriteTo. If nil, the defaultBufferPool is used.
+	bufferPool BufferPool
+	// only set for the http.Response
+	// If set, it is called every time a DATA frame was read completely.
+	onDataFrameRead func(length uint64)
+	// only set for the http.Response
+	// If larger than 0, reading more than maxBytes bytes fails with a ResponseBodyTooLargeError.
+	maxBytes  int64
+	bytesRead int64
+	// only set for the http.Response, see startIdleTimer
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	abandoned   utils.AtomicBool
+	// only set for the http.Response, see setReadTimeout
+	readTimeout  time.Duration
+	readTimer    *time.Timer
+	readTimedOut utils.AtomicBool
 
+	frameLength           uint64
 	bytesRemainingInFrame uint64
 }
 
-var _ io.ReadCloser = &body{}
+// ResponseBodyTooLargeError is returned when reading a response body that is larger than
+// RoundTripper.MaxResponseBodyBytes.
+type ResponseBodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *ResponseBodyTooLargeError) Error() string {
+	return fmt.Sprintf("http3: response body too large (limit: %d bytes)", e.Limit)
+}
+
+// ResponseBodyAbandonedError is returned when reading a response body that was abandoned,
+// because it wasn't read from for RoundTripper.ResponseBodyIdleTimeout.
+type ResponseBodyAbandonedError struct {
+	IdleTimeout time.Duration
+}
+
+func (e *ResponseBodyAbandonedError) Error() string {
+	return fmt.Sprintf("http3: response body abandoned (not read for %s)", e.IdleTimeout)
+}
+
+// ResponseBodyReadTimeoutError is returned when reading a response body stalls,
+// because no data was received for RoundTripper.IdleReadTimeout.
+type ResponseBodyReadTimeoutError struct {
+	Duration time.Duration
+}
+
+var _ net.Error = &ResponseBodyReadTimeoutError{}
+
+func (e *ResponseBodyReadTimeoutError) Error() string {
+	return fmt.Sprintf("http3: timeout reading response body (no data received for %s)", e.Duration)
+}
+func (e *ResponseBodyReadTimeoutError) Timeout() bool   { return true }
+func (e *ResponseBodyReadTimeoutError) Temporary() bool { return true }
+
+var (
+	_ io.ReadCloser = &body{}
+	_ io.WriterTo   = &body{}
+)
 
 func newRequestBody(str quic.Stream, onFrameError func()) *body {
 	return &body{
@@ -31,7 +93,7 @@ func newRequestBody(str quic.Stream, onFrameError func()) *body {
 	}
 }
 
-func newResponseBody(str quic.Stream, done chan<- struct{}, onFrameError func()) *body {
+func newResponseBody(str quic.ReceiveStream, done chan<- struct{}, onFrameError func()) *body {
 	return &body{
 		str:          str,
 		onFrameError: onFrameError,
@@ -40,9 +102,48 @@ func newResponseBody(str quic.Stream, done chan<- struct{}, onFrameError func())
 }
 
 func (r *body) Read(b []byte) (int, error) {
+	if r.idleTimer != nil {
+		// The body is not abandoned while the application is waiting for data.
+		r.idleTimer.Stop()
+	}
+	if r.abandoned.Get() {
+		return 0, &ResponseBodyAbandonedError{IdleTimeout: r.idleTimeout}
+	}
+	if r.readTimedOut.Get() {
+		return 0, &ResponseBodyReadTimeoutError{Duration: r.readTimeout}
+	}
+	if r.maxBytes > 0 {
+		// Read one byte more than allowed, so we notice when the body exceeds the limit.
+		if remaining := r.maxBytes - r.bytesRead; int64(len(b)) > remaining+1 {
+			b = b[:remaining+1]
+		}
+	}
+	if r.readTimer != nil {
+		r.readTimer.Reset(r.readTimeout)
+	}
 	n, err := r.readImpl(b)
+	if r.readTimer != nil {
+		r.readTimer.Stop()
+	}
+	if r.maxBytes > 0 {
+		r.bytesRead += int64(n)
+		if r.bytesRead > r.maxBytes {
+			n -= int(r.bytesRead - r.maxBytes)
+			r.bytesRead = r.maxBytes
+			// There's no need to receive the rest of the body.
+			r.str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+			err = &ResponseBodyTooLargeError{Limit: r.maxBytes}
+		}
+	}
 	if err != nil {
+		if r.abandoned.Get() {
+			err = &ResponseBodyAbandonedError{IdleTimeout: r.idleTimeout}
+		} else if r.readTimedOut.Get() {
+			err = &ResponseBodyReadTimeoutError{Duration: r.readTimeout}
+		}
 		r.requestDone()
+	} else if r.idleTimer != nil {
+		r.idleTimer.Reset(r.idleTimeout)
 	}
 	return n, err
 }
@@ -60,8 +161,18 @@ func (r *body) readImpl(b []byte) (int, error) {
 				// skip HEADERS frames
 				continue
 			case *dataFrame:
+				r.frameLength = f.Length
 				r.bytesRemainingInFrame = f.Length
 				break parseLoop
+			case *pushPromiseFrame:
+				if r.onPushPromise == nil {
+					r.onFrameError()
+					return 0, fmt.Errorf("peer sent an unexpected frame: %T", f)
+				}
+				if err := r.onPushPromise(f); err != nil {
+					return 0, err
+				}
+				continue
 			default:
 				r.onFrameError()
 				// parseNextFrame skips over unknown frame types
@@ -79,18 +190,87 @@ func (r *body) readImpl(b []byte) (int, error) {
 		n, err = r.str.Read(b)
 	}
 	r.bytesRemainingInFrame -= uint64(n)
+	if r.bytesRemainingInFrame == 0 && r.onDataFrameRead != nil {
+		r.onDataFrameRead(r.frameLength)
+	}
 	return n, err
 }
 
+// WriteTo writes the body to w, using a buffer from the buffer pool.
+// This avoids allocating a new buffer for every call to io.Copy.
+func (r *body) WriteTo(w io.Writer) (int64, error) {
+	pool := r.bufferPool
+	if pool == nil {
+		pool = defaultBufferPool
+	}
+	buf := pool.Get()
+	defer pool.Put(buf)
+
+	var written int64
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			nw, werr := w.Write(buf[:n])
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+			if nw != n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// startIdleTimer makes the body abandon itself when the application doesn't read from it for timeout.
+// Without this, a body that is neither read until the end nor closed keeps the stream open
+// (and the request in flight) for the lifetime of the connection.
+func (r *body) startIdleTimer(timeout time.Duration) {
+	r.idleTimeout = timeout
+	r.idleTimer = time.AfterFunc(timeout, r.abandon)
+}
+
+// abandon resets the stream, so the server stops sending the rest of the body.
+func (r *body) abandon() {
+	r.abandoned.Set(true)
+	r.str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+	r.requestDone()
+}
+
+// setReadTimeout makes reads fail, if no data is received for timeout while the application is waiting for data.
+// The time between reads isn't counted, see startIdleTimer for that.
+func (r *body) setReadTimeout(timeout time.Duration) {
+	r.readTimeout = timeout
+	r.readTimer = time.AfterFunc(timeout, r.readTimeoutExpired)
+	r.readTimer.Stop()
+}
+
+// readTimeoutExpired resets the stream, which unblocks the pending read.
+func (r *body) readTimeoutExpired() {
+	r.readTimedOut.Set(true)
+	r.str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+}
+
 func (r *body) requestDone() {
-	if r.reqDoneClosed || r.reqDone == nil {
+	if r.reqDone == nil {
 		return
 	}
-	close(r.reqDone)
-	r.reqDoneClosed = true
+	r.reqDoneOnce.Do(func() { close(r.reqDone) })
 }
 
 func (r *body) Close() error {
+	if r.idleTimer != nil {
+		r.idleTimer.Stop()
+	}
+	if r.readTimer != nil {
+		r.readTimer.Stop()
+	}
 	r.requestDone()
 	// If the EOF was read, CancelRead() is a no-op.
 	r.str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
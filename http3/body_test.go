@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go"
@@ -27,6 +29,61 @@ func (t bodyType) String() string {
 	return "response"
 }
 
+type countingBufferPool struct {
+	size       int
+	gets, puts int
+}
+
+func (p *countingBufferPool) Get() []byte {
+	p.gets++
+	return make([]byte, p.size)
+}
+
+func (p *countingBufferPool) Put([]byte) { p.puts++ }
+
+// benchmarkStream is a quic.ReceiveStream that returns a response consisting of DATA frames.
+type benchmarkStream struct {
+	*bytes.Reader
+}
+
+var _ quic.ReceiveStream = &benchmarkStream{}
+
+func (s *benchmarkStream) StreamID() quic.StreamID         { return 0 }
+func (s *benchmarkStream) CancelRead(quic.StreamErrorCode) {}
+func (s *benchmarkStream) SetReadDeadline(time.Time) error { return nil }
+
+func BenchmarkResponseBodyCopy(b *testing.B) {
+	// io.Discard implements io.ReaderFrom, which would take precedence over io.WriterTo
+	dst := struct{ io.Writer }{io.Discard}
+	data := &bytes.Buffer{}
+	chunk := make([]byte, 16*1024)
+	for i := 0; i < 64; i++ { // 1 MB
+		(&dataFrame{Length: uint64(len(chunk))}).Write(data)
+		data.Write(chunk)
+	}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rb := newResponseBody(&benchmarkStream{Reader: bytes.NewReader(data.Bytes())}, nil, func() {})
+			if _, err := io.Copy(dst, rb); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rb := newResponseBody(&benchmarkStream{Reader: bytes.NewReader(data.Bytes())}, nil, func() {})
+			// hide the WriteTo method, forcing io.Copy to allocate a buffer
+			if _, err := io.Copy(dst, struct{ io.Reader }{rb}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
 var _ = Describe("Body", func() {
 	var (
 		rb            *body
@@ -155,6 +212,39 @@ var _ = Describe("Body", func() {
 				Expect(errorCbCalled).To(BeTrue())
 			})
 
+			It("copies the body using WriteTo", func() {
+				buf.Write(getDataFrame([]byte("foo")))
+				buf.Write(getDataFrame([]byte("bar")))
+				out := &bytes.Buffer{}
+				n, err := io.Copy(out, rb)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(6))
+				Expect(out.String()).To(Equal("foobar"))
+			})
+
+			It("uses the configured buffer pool", func() {
+				pool := &countingBufferPool{size: 2}
+				rb.bufferPool = pool
+				buf.Write(getDataFrame([]byte("foobar")))
+				out := &bytes.Buffer{}
+				n, err := io.Copy(out, rb)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(6))
+				Expect(out.String()).To(Equal("foobar"))
+				Expect(pool.gets).To(Equal(1))
+				Expect(pool.puts).To(Equal(1))
+			})
+
+			It("returns errors from WriteTo", func() {
+				buf.Write(getDataFrame([]byte("foo")))
+				(&settingsFrame{}).Write(buf)
+				out := &bytes.Buffer{}
+				n, err := io.Copy(out, rb)
+				Expect(err).To(MatchError("peer sent an unexpected frame: *http3.settingsFrame"))
+				Expect(n).To(BeEquivalentTo(3))
+				Expect(out.String()).To(Equal("foo"))
+			})
+
 			if bodyType == bodyTypeResponse {
 				It("closes the reqDone channel when Read errors", func() {
 					buf.Write([]byte("invalid"))
@@ -177,6 +267,81 @@ var _ = Describe("Body", func() {
 					Expect(rb.Close()).To(Succeed())
 				})
 
+				It("calls the callback every time a DATA frame was read", func() {
+					var frames []uint64
+					rb.onDataFrameRead = func(length uint64) { frames = append(frames, length) }
+					buf.Write(getDataFrame([]byte("foobar")))
+					buf.Write(getDataFrame(nil))
+					buf.Write(getDataFrame([]byte("lorem ipsum")))
+					b := make([]byte, 4)
+					n, err := rb.Read(b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(4))
+					Expect(frames).To(BeEmpty())
+					// read the rest of the first frame
+					n, err = rb.Read(b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(2))
+					Expect(frames).To(Equal([]uint64{6}))
+					// empty DATA frames are reported as well
+					n, err = rb.Read(b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(BeZero())
+					Expect(frames).To(Equal([]uint64{6, 0}))
+					_, err = io.ReadAll(rb)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(frames).To(Equal([]uint64{6, 0, 11}))
+				})
+
+				It("errors when the body exceeds the limit", func() {
+					rb.maxBytes = 8
+					buf.Write(getDataFrame([]byte("foobar")))
+					buf.Write(getDataFrame([]byte("lorem ipsum")))
+					str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+					data, err := io.ReadAll(rb)
+					Expect(err).To(MatchError(&ResponseBodyTooLargeError{Limit: 8}))
+					Expect(data).To(Equal([]byte("foobarlo")))
+					Expect(reqDone).To(BeClosed())
+				})
+
+				It("reads bodies that are exactly as large as the limit", func() {
+					rb.maxBytes = 6
+					buf.Write(getDataFrame([]byte("foo")))
+					buf.Write(getDataFrame([]byte("bar")))
+					data, err := io.ReadAll(rb)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(data).To(Equal([]byte("foobar")))
+				})
+
+				It("abandons the body when it isn't read from", func() {
+					const idleTimeout = 50 * time.Millisecond
+					buf.Write(getDataFrame([]byte("foobar")))
+					canceled := make(chan struct{})
+					str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) { close(canceled) })
+					rb.startIdleTimer(scaleDuration(idleTimeout))
+					// reading from the body resets the timer
+					for i := 0; i < 3; i++ {
+						time.Sleep(scaleDuration(idleTimeout / 2))
+						_, err := rb.Read([]byte{0})
+						Expect(err).ToNot(HaveOccurred())
+					}
+					Consistently(canceled, scaleDuration(idleTimeout/2)).ShouldNot(BeClosed())
+					Eventually(canceled).Should(BeClosed())
+					Expect(reqDone).To(BeClosed())
+					_, err := rb.Read([]byte{0})
+					Expect(err).To(MatchError(&ResponseBodyAbandonedError{IdleTimeout: scaleDuration(idleTimeout)}))
+				})
+
+				It("doesn't abandon the body after it was closed", func() {
+					const idleTimeout = 50 * time.Millisecond
+					str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+					rb.startIdleTimer(scaleDuration(idleTimeout))
+					Expect(rb.Close()).To(Succeed())
+					Expect(reqDone).To(BeClosed())
+					// the mock would fail on a second call to CancelRead
+					time.Sleep(scaleDuration(2 * idleTimeout))
+				})
+
 				It("allows multiple calls to Close", func() {
 					str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).MaxTimes(2)
 					Expect(rb.Close()).To(Succeed())
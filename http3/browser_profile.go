@@ -0,0 +1,75 @@
+package http3
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+)
+
+// A BrowserProfile makes the connections of the RoundTripper resemble those of a browser,
+// making it harder to fingerprint the application, see RoundTripper.BrowserProfile.
+// The TLS ClientHello can only be adjusted as far as crypto/tls allows:
+// The curve preferences are applied, but it doesn't contain GREASE values, and the order of its extensions is fixed.
+type BrowserProfile struct {
+	// UserAgent is sent in the User-Agent header, unless RoundTripper.UserAgent is set.
+	UserAgent string
+	// Settings are sent in the SETTINGS frame, in this order.
+	// They replace the settings that quic-go sends by default. H3_DATAGRAM is appended if datagrams are enabled.
+	// Since the client doesn't support the QPACK dynamic table, SETTINGS_QPACK_MAX_TABLE_CAPACITY must not be set.
+	Settings []Setting
+	// GreaseSettings adds a setting with a random reserved identifier and a random value
+	// to the SETTINGS frame (RFC 9114, Section 7.2.4.1), as browsers do.
+	GreaseSettings bool
+	// CurvePreferences are used for the TLS handshake, unless TLSClientConfig.CurvePreferences is set.
+	CurvePreferences []tls.CurveID
+}
+
+// A Setting is an HTTP/3 setting.
+type Setting struct {
+	ID    uint64
+	Value uint64
+}
+
+// BrowserProfileChrome returns a profile that resembles the HTTP/3 connections of Chrome.
+// Every call returns a new profile, which can be modified by the caller.
+func BrowserProfileChrome() *BrowserProfile {
+	return &BrowserProfile{
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.110 Safari/537.36",
+		Settings: []Setting{
+			{ID: settingMaxFieldSectionSize, Value: 262144},
+		},
+		GreaseSettings:   true,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	}
+}
+
+// settingsFrame returns the SETTINGS frame for the profile.
+func (p *BrowserProfile) settingsFrame(datagram bool) *settingsFrame {
+	f := &settingsFrame{
+		Datagram: datagram,
+		other:    make(map[uint64]uint64, len(p.Settings)+1),
+		order:    make([]uint64, 0, len(p.Settings)+1),
+	}
+	for _, s := range p.Settings {
+		if _, ok := f.other[s.ID]; ok || s.ID == settingDatagram {
+			continue
+		}
+		f.other[s.ID] = s.Value
+		f.order = append(f.order, s.ID)
+	}
+	if p.GreaseSettings {
+		id, val := greaseSetting()
+		f.other[id] = val
+		f.order = append(f.order, id)
+	}
+	return f
+}
+
+// greaseSetting returns a setting with a random reserved identifier (0x1f * N + 0x21)
+// and a random value.
+// crypto/rand is used, since the reserved setting would otherwise be the same for every process.
+func greaseSetting() (id, val uint64) {
+	var b [8]byte
+	rand.Read(b[:])
+	return 0x1f*uint64(binary.BigEndian.Uint32(b[:4])) + 0x21, uint64(binary.BigEndian.Uint32(b[4:]))
+}
@@ -0,0 +1,119 @@
+package http3
+
+import (
+	"bytes"
+	"crypto/tls"
+
+	"github.com/golang/mock/gomock"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Browser Profiles", func() {
+	isGreaseSetting := func(id uint64) bool { return id >= 0x21 && (id-0x21)%0x1f == 0 }
+
+	It("creates the SETTINGS frame", func() {
+		p := &BrowserProfile{Settings: []Setting{
+			{ID: settingQPACKBlockedStreams, Value: 100},
+			{ID: settingMaxFieldSectionSize, Value: 1337},
+			{ID: settingQPACKBlockedStreams, Value: 42},
+		}}
+		Expect(p.settingsFrame(true)).To(Equal(&settingsFrame{
+			Datagram: true,
+			other:    map[uint64]uint64{settingQPACKBlockedStreams: 100, settingMaxFieldSectionSize: 1337},
+			order:    []uint64{settingQPACKBlockedStreams, settingMaxFieldSectionSize},
+		}))
+	})
+
+	It("adds a GREASE setting", func() {
+		p := &BrowserProfile{
+			Settings:       []Setting{{ID: settingMaxFieldSectionSize, Value: 1337}},
+			GreaseSettings: true,
+		}
+		f := p.settingsFrame(false)
+		Expect(f.order).To(HaveLen(2))
+		Expect(f.order[0]).To(BeEquivalentTo(settingMaxFieldSectionSize))
+		Expect(isGreaseSetting(f.order[1])).To(BeTrue())
+		Expect(f.other).To(HaveKey(f.order[1]))
+		// the reserved identifier is chosen randomly
+		ids := make(map[uint64]struct{})
+		for i := 0; i < 10; i++ {
+			id, _ := greaseSetting()
+			Expect(isGreaseSetting(id)).To(BeTrue())
+			ids[id] = struct{}{}
+		}
+		Expect(len(ids)).To(BeNumerically(">", 1))
+	})
+
+	It("returns a new Chrome profile every time", func() {
+		p := BrowserProfileChrome()
+		p.UserAgent = "foobar"
+		p.Settings[0].Value = 1337
+		p.CurvePreferences[0] = tls.CurveP521
+		Expect(BrowserProfileChrome()).ToNot(Equal(p))
+		Expect(BrowserProfileChrome().Settings[0].Value).To(BeEquivalentTo(262144))
+		Expect(BrowserProfileChrome().CurvePreferences[0]).To(Equal(tls.X25519))
+	})
+
+	It("applies the User-Agent and the curve preferences", func() {
+		cl, err := newClient("localhost:1337", nil, &roundTripperOpts{BrowserProfile: BrowserProfileChrome()}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.requestWriter.userAgent).To(Equal(BrowserProfileChrome().UserAgent))
+		Expect(cl.tlsConf.CurvePreferences).To(Equal([]tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}))
+	})
+
+	It("doesn't override the configured User-Agent and curve preferences", func() {
+		cl, err := newClient(
+			"localhost:1337",
+			&tls.Config{CurvePreferences: []tls.CurveID{tls.CurveP521}},
+			&roundTripperOpts{BrowserProfile: BrowserProfileChrome(), UserAgent: "foobar"},
+			nil,
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.requestWriter.userAgent).To(Equal("foobar"))
+		Expect(cl.tlsConf.CurvePreferences).To(Equal([]tls.CurveID{tls.CurveP521}))
+	})
+
+	It("sends the profile's SETTINGS", func() {
+		cl, err := newClient("localhost:1337", nil, &roundTripperOpts{BrowserProfile: BrowserProfileChrome(), EnableDatagram: true}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		controlBuf := &bytes.Buffer{}
+		controlStr := mockquic.NewMockStream(mockCtrl)
+		controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(controlBuf.Write)
+		sess := mockquic.NewMockEarlySession(mockCtrl)
+		sess.EXPECT().OpenUniStream().Return(controlStr, nil)
+		cl.session = sess
+		Expect(cl.setupSession()).To(Succeed())
+
+		streamType, err := quicvarint.Read(controlBuf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(streamType).To(BeEquivalentTo(streamTypeControlStream))
+		frameType, err := quicvarint.Read(controlBuf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frameType).To(BeEquivalentTo(0x4))
+		l, err := quicvarint.Read(controlBuf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(controlBuf.Len()).To(BeEquivalentTo(l))
+		var ids, vals []uint64
+		for controlBuf.Len() > 0 {
+			id, err := quicvarint.Read(controlBuf)
+			Expect(err).ToNot(HaveOccurred())
+			val, err := quicvarint.Read(controlBuf)
+			Expect(err).ToNot(HaveOccurred())
+			ids = append(ids, id)
+			vals = append(vals, val)
+		}
+		// SETTINGS_MAX_FIELD_SECTION_SIZE, GREASE, H3_DATAGRAM
+		Expect(ids).To(HaveLen(3))
+		Expect(ids[0]).To(BeEquivalentTo(settingMaxFieldSectionSize))
+		Expect(vals[0]).To(BeEquivalentTo(262144))
+		Expect(isGreaseSetting(ids[1])).To(BeTrue())
+		Expect(ids[2]).To(BeEquivalentTo(settingDatagram))
+		Expect(vals[2]).To(BeEquivalentTo(1))
+		Expect(ids).ToNot(ContainElement(BeEquivalentTo(settingNoRFC7540Priorities)))
+	})
+})
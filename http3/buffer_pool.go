@@ -0,0 +1,42 @@
+package http3
+
+import "sync"
+
+// A BufferPool is used to obtain buffers for copying HTTP bodies.
+// It has the same semantics as the httputil.BufferPool.
+type BufferPool interface {
+	Get() []byte
+	Put([]byte)
+}
+
+const defaultBufferPoolBufferSize = 32 * 1024
+
+// defaultBufferPool is used if no BufferPool is configured.
+var defaultBufferPool BufferPool = newSyncBufferPool(defaultBufferPoolBufferSize)
+
+// syncBufferPool is a BufferPool backed by a sync.Pool.
+type syncBufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+func newSyncBufferPool(size int) *syncBufferPool {
+	p := &syncBufferPool{size: size}
+	p.pool.New = func() interface{} {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+func (p *syncBufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+func (p *syncBufferPool) Put(b []byte) {
+	if cap(b) < p.size { // don't put buffers of the wrong size back into the pool
+		return
+	}
+	b = b[:p.size]
+	p.pool.Put(&b)
+}
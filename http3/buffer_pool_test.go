@@ -0,0 +1,29 @@
+package http3
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Buffer Pool", func() {
+	It("returns buffers of the configured size", func() {
+		pool := newSyncBufferPool(1337)
+		b := pool.Get()
+		Expect(b).To(HaveLen(1337))
+		pool.Put(b)
+		Expect(pool.Get()).To(HaveLen(1337))
+	})
+
+	It("restores the length of buffers that were sliced", func() {
+		pool := newSyncBufferPool(1337)
+		b := pool.Get()
+		pool.Put(b[:10])
+		Expect(pool.Get()).To(HaveLen(1337))
+	})
+
+	It("doesn't accept buffers that are too small", func() {
+		pool := newSyncBufferPool(1337)
+		pool.Put(make([]byte, 10))
+		Expect(pool.Get()).To(HaveLen(1337))
+	})
+})
@@ -0,0 +1,79 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// CapsuleType is the type of a Capsule, as defined by the Capsule Protocol (RFC 9297).
+type CapsuleType uint64
+
+// CapsuleTypeDatagram is the type of the DATAGRAM capsule, see section 3.5 of RFC 9297.
+const CapsuleTypeDatagram CapsuleType = 0x00
+
+// ParseCapsule parses the header of the next Capsule on the data stream of a CONNECT request,
+// i.e. the response body on the client side, or the request body on the server side.
+// It returns an io.Reader that can be used to read the Capsule value.
+// The value must be read entirely (i.e. until io.EOF) before ParseCapsule is called again.
+// It returns io.EOF if the stream ends at a Capsule boundary.
+func ParseCapsule(r quicvarint.Reader) (CapsuleType, io.Reader, error) {
+	cr := &countingByteReader{Reader: r}
+	ct, err := quicvarint.Read(cr)
+	if err != nil {
+		if err == io.EOF && cr.n > 0 {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	l, err := quicvarint.Read(r)
+	if err != nil {
+		if err == io.EOF {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+	return CapsuleType(ct), &exactReader{R: io.LimitReader(r, int64(l)).(*io.LimitedReader)}, nil
+}
+
+// WriteCapsule writes a Capsule to the data stream of a CONNECT request,
+// i.e. the request body on the client side, or the response on the server side.
+// The Capsule is written using a single call to w.Write,
+// such that it isn't split across multiple DATA frames.
+func WriteCapsule(w io.Writer, ct CapsuleType, value []byte) error {
+	buf := &bytes.Buffer{}
+	buf.Grow(int(quicvarint.Len(uint64(ct))+quicvarint.Len(uint64(len(value)))) + len(value))
+	quicvarint.Write(buf, uint64(ct))
+	quicvarint.Write(buf, uint64(len(value)))
+	buf.Write(value)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type countingByteReader struct {
+	quicvarint.Reader
+	n int
+}
+
+func (r *countingByteReader) ReadByte() (byte, error) {
+	b, err := r.Reader.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
+
+// exactReader returns io.ErrUnexpectedEOF if the underlying stream ends
+// before the whole Capsule value was read.
+type exactReader struct {
+	R *io.LimitedReader
+}
+
+func (r *exactReader) Read(b []byte) (int, error) {
+	n, err := r.R.Read(b)
+	if err == io.EOF && r.R.N > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
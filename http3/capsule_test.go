@@ -0,0 +1,99 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/mock/gomock"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Capsule", func() {
+	It("parses Capsules", func() {
+		b := &bytes.Buffer{}
+		quicvarint.Write(b, 1337)
+		quicvarint.Write(b, 6)
+		b.WriteString("foobar")
+		r := bytes.NewReader(b.Bytes())
+		ct, cr, err := ParseCapsule(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ct).To(BeEquivalentTo(1337))
+		val, err := ioutil.ReadAll(cr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(val)).To(Equal("foobar"))
+		_, _, err = ParseCapsule(r)
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("writes Capsules", func() {
+		buf := &bytes.Buffer{}
+		Expect(WriteCapsule(buf, CapsuleTypeDatagram, []byte("foobar"))).To(Succeed())
+		Expect(buf.Bytes()).To(Equal(append([]byte{0x0, 0x6}, []byte("foobar")...)))
+	})
+
+	It("errors on EOFs", func() {
+		buf := &bytes.Buffer{}
+		Expect(WriteCapsule(buf, 1337, []byte("foobar"))).To(Succeed())
+		data := buf.Bytes()
+		for i := 1; i < len(data); i++ {
+			ct, r, err := ParseCapsule(bytes.NewReader(data[:i]))
+			if err != nil {
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+				continue
+			}
+			Expect(ct).To(BeEquivalentTo(1337))
+			_, err = ioutil.ReadAll(r)
+			Expect(err).To(Equal(io.ErrUnexpectedEOF))
+		}
+	})
+
+	It("round-trips Capsules through a loopback tunnel", func() {
+		pr, pw := io.Pipe()
+		go func() {
+			defer GinkgoRecover()
+			Expect(WriteCapsule(pw, CapsuleTypeDatagram, []byte("foo"))).To(Succeed())
+			Expect(WriteCapsule(pw, 0x1337, []byte("bar"))).To(Succeed())
+			pw.Close()
+		}()
+		r := quicvarint.NewReader(pr)
+		ct, cr, err := ParseCapsule(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ct).To(Equal(CapsuleTypeDatagram))
+		val, err := ioutil.ReadAll(cr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(val)).To(Equal("foo"))
+		ct, cr, err = ParseCapsule(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ct).To(BeEquivalentTo(0x1337))
+		val, err = ioutil.ReadAll(cr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(val)).To(Equal("bar"))
+		_, _, err = ParseCapsule(r)
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("reads Capsules from the body of a CONNECT response", func() {
+		capsules := &bytes.Buffer{}
+		Expect(WriteCapsule(capsules, CapsuleTypeDatagram, []byte("foobar"))).To(Succeed())
+		buf := &bytes.Buffer{}
+		// split the Capsule across two DATA frames
+		(&dataFrame{Length: 3}).Write(buf)
+		buf.Write(capsules.Next(3))
+		(&dataFrame{Length: uint64(capsules.Len())}).Write(buf)
+		buf.Write(capsules.Bytes())
+		str := mockquic.NewMockStream(mockCtrl)
+		str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+		rb := newResponseBody(str, make(chan struct{}), func() {})
+		ct, cr, err := ParseCapsule(quicvarint.NewReader(rb))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ct).To(Equal(CapsuleTypeDatagram))
+		val, err := ioutil.ReadAll(cr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(val)).To(Equal("foobar"))
+	})
+})
@@ -7,15 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/qtls"
 	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/lucas-clemente/quic-go/quicvarint"
 	"github.com/marten-seemann/qpack"
 )
@@ -25,8 +30,13 @@ import (
 const MethodGet0RTT = "GET_0RTT"
 
 const (
-	defaultUserAgent              = "quic-go HTTP/3"
-	defaultMaxResponseHeaderBytes = 10 * 1 << 20 // 10 MB
+	defaultUserAgent               = "quic-go HTTP/3"
+	defaultMaxResponseHeaderBytes  = 10 * 1 << 20 // 10 MB
+	defaultConnectionIdleThreshold = 30 * time.Second
+	// the maximum number of QUIC versions tried when the handshake fails, see isVersionError
+	maxVersionAttempts = 3
+	// the TLS alert sent when the ALPN negotiation fails
+	tlsAlertNoApplicationProtocol = 120
 )
 
 var defaultQuicConfig = &quic.Config{
@@ -35,34 +45,137 @@ var defaultQuicConfig = &quic.Config{
 	Versions:           []protocol.VersionNumber{protocol.VersionTLS},
 }
 
-var dialAddr = quic.DialAddrEarly
+var errConnectionDraining = errors.New("http3: connection is draining")
+
+// ErrRequestCanceled is returned for requests that were in flight when RoundTripper.CancelAll was called.
+var ErrRequestCanceled = errors.New("http3: request canceled by CancelAll")
+
+// errStreamLimitReached is returned by openStream if OpenConnectionOnStreamLimit is set,
+// and the server's stream limit was reached. The request is then sent on a second connection.
+var errStreamLimitReached = errors.New("http3: stream limit reached")
+
+var (
+	dialAddr  = quic.DialAddrEarly
+	dialEarly = quic.DialEarly
+)
 
 type roundTripperOpts struct {
-	DisableCompression bool
-	EnableDatagram     bool
-	MaxHeaderBytes     int64
+	DisableCompression      bool
+	EnableZstd              bool
+	CompressRequestBody     bool
+	CompressBodyMinSize     int64
+	EnableDatagram          bool
+	DisablePathMTUDiscovery bool
+	MaxHeaderBytes          int64
+	MaxBodyBytes            int64
+	PushHandler             func(*http.Request, *http.Response)
+	UserAgent               string
+	BrowserProfile          *BrowserProfile
+	BufferPool              BufferPool
+	AddressFamily           AddressFamily
+	DialAddrOverride        func(host string) (string, bool)
+	PathFailureTimeout      time.Duration
+	OnConnectionIdle        func(host string, idleFor time.Duration)
+	ConnectionIdleThreshold time.Duration
+	IdleConnTimeout         time.Duration
+	MaxSendRate             int
+	PacketLoss              *PacketLossConfig
+	OnResponseChunk         func(req *http.Request, n int)
+	// only set if MaxConcurrentDials is set
+	// A slot needs to be acquired by sending on the channel before dialing.
+	DialSemaphore chan struct{}
+	// only set if latency histograms are enabled
+	Latency *latencyHistograms
+
+	OnStreamLimitReached func(host string)
+	// If set, openStream returns errStreamLimitReached instead of waiting for a new stream.
+	OpenConnectionOnStreamLimit bool
+	EnableConnectionStats       bool
+	TokenStore                  quic.TokenStore
+	// responses with these content types are not decompressed transparently
+	NoDecompressionContentTypes []string
+	BodyIdleTimeout             time.Duration
+	IdleReadTimeout             time.Duration
+	InitialCongestionWindow     uint32
+	StreamScheduler             quic.StreamScheduler
+	ResponseHeaderTimeout       time.Duration
+	// returns the address of the Alt-Svc alternative to dial, for a client configured for versions
+	AltSvcAddr func(host string, versions []quic.VersionNumber) (string, bool)
 }
 
 // client is a HTTP3 client doing requests
 type client struct {
+	// number of requests in flight, accessed atomically
+	// must be the first field, so it's 64-bit aligned on 32-bit platforms
+	inFlight int64
+	// the time (in Unix nanoseconds) the last request completed, accessed atomically
+	idleSince int64
+
 	tlsConf *tls.Config
 	config  *quic.Config
 	opts    *roundTripperOpts
 
-	dialOnce     sync.Once
-	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error)
-	handshakeErr error
+	dialOnce sync.Once
+	// closed when dial returned, see startDial
+	dialDone chan struct{}
+	// closed when dialing was started, see dialStarted
+	dialStartedChan chan struct{}
+	dialer          func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error)
+	handshakeErr    error
 
 	requestWriter *requestWriter
 
 	decoder *qpack.Decoder
 
 	hostname string
-	session  quic.EarlySession
+	// sessionMutex guards the session, since it's accessed by the RoundTripper while the connection is dialed.
+	// dial sets the session once the handshake was started successfully.
+	// warmup and openStream can access it without holding the mutex, after dialDone was closed.
+	sessionMutex sync.Mutex
+	session      quic.EarlySession
+	// set by Close, such that a session that is still being dialed is closed right away
+	closed bool
+	// set when the session was closed by a stateless reset
+	statelessReset utils.AtomicBool
+	// set when the session was closed because the path broke
+	pathFailed utils.AtomicBool
+	// set when the session was closed because it was idle for too long, see RoundTripper.IdleConnTimeout
+	idleClosed utils.AtomicBool
+	// set when the connection is draining, see RoundTripper.DrainConnection
+	draining  utils.AtomicBool
+	drainOnce sync.Once
+
+	// closed by cancelAll, which then replaces it for subsequent requests
+	cancelAllMutex sync.Mutex
+	cancelAllChan  chan struct{}
+
+	pushPromises pushPromises
+
+	// closed when setupSession returned
+	controlStrReady chan struct{}
+	controlStrMutex sync.Mutex
+	controlStr      quic.SendStream // nil if the control stream couldn't be opened
+
+	settingsMutex sync.Mutex
+	settings      *Settings // the settings received from the server
+	// closed when the server's SETTINGS frame was received
+	settingsReceived chan struct{}
+
+	// only set if datagrams are enabled
+	datagramMux *DatagramMux
+	// only set if connection statistics are enabled
+	stats *connStats
 
 	logger utils.Logger
 
+	// metricsMutex guards the metrics, since requests are sent concurrently
+	metricsMutex         sync.Mutex
 	metricsHandshakeDone time.Time
+	// the time the last request was sent, and the first byte of its response was received
+	metricsRequestSent time.Time
+	metricsFirstByte   time.Time
+	// how the session of the last request was established, see RoundTripper.MetricsAttempted0RTT
+	metricsResumed, metricsAttempted0RTT, metricsAccepted0RTT bool
 }
 
 func newClient(
@@ -72,17 +185,31 @@ func newClient(
 	quicConfig *quic.Config,
 	dialer func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlySession, error),
 ) (*client, error) {
+	if opts.PacketLoss != nil {
+		if err := opts.PacketLoss.validate(); err != nil {
+			return nil, err
+		}
+	}
 	if quicConfig == nil {
 		quicConfig = defaultQuicConfig.Clone()
 	} else if len(quicConfig.Versions) == 0 {
 		quicConfig = quicConfig.Clone()
 		quicConfig.Versions = []quic.VersionNumber{defaultQuicConfig.Versions[0]}
 	}
-	if len(quicConfig.Versions) != 1 {
-		return nil, errors.New("can only use a single QUIC version for dialing a HTTP/3 connection")
-	}
 	quicConfig.MaxIncomingStreams = -1 // don't allow any bidirectional streams
 	quicConfig.EnableDatagrams = opts.EnableDatagram
+	if opts.DisablePathMTUDiscovery {
+		quicConfig.DisablePathMTUDiscovery = true
+	}
+	if opts.TokenStore != nil {
+		quicConfig.TokenStore = opts.TokenStore
+	}
+	if opts.InitialCongestionWindow > 0 {
+		quicConfig.InitialCongestionWindow = opts.InitialCongestionWindow
+	}
+	if opts.StreamScheduler != nil {
+		quicConfig.StreamScheduler = opts.StreamScheduler
+	}
 	logger := utils.DefaultLogger.WithPrefix("h3 client")
 
 	if tlsConf == nil {
@@ -90,30 +217,153 @@ func newClient(
 	} else {
 		tlsConf = tlsConf.Clone()
 	}
-	// Replace existing ALPNs by H3
-	tlsConf.NextProtos = []string{versionToALPN(quicConfig.Versions[0])}
+	// Use the ALPNs from the tls.Config, if set.
+	// Otherwise, offer the H3 ALPNs matching the QUIC versions.
+	// The server might send a Version Negotiation packet, in which case
+	// a version further down the list will be used.
+	if len(tlsConf.NextProtos) == 0 {
+		tlsConf.NextProtos = versionsToALPNs(quicConfig.Versions)
+	}
+	if opts.BrowserProfile != nil && len(tlsConf.CurvePreferences) == 0 {
+		tlsConf.CurvePreferences = opts.BrowserProfile.CurvePreferences
+	}
+
+	requestWriter := newRequestWriter(logger)
+	if opts.UserAgent != "" {
+		requestWriter.userAgent = opts.UserAgent
+	} else if opts.BrowserProfile != nil && opts.BrowserProfile.UserAgent != "" {
+		requestWriter.userAgent = opts.BrowserProfile.UserAgent
+	}
 
-	return &client{
-		hostname:      authorityAddr("https", hostname),
-		tlsConf:       tlsConf,
-		requestWriter: newRequestWriter(logger),
-		decoder:       qpack.NewDecoder(func(hf qpack.HeaderField) {}),
-		config:        quicConfig,
-		opts:          opts,
-		dialer:        dialer,
-		logger:        logger,
-	}, nil
+	c := &client{
+		hostname:        authorityAddr("https", hostname),
+		tlsConf:         tlsConf,
+		requestWriter:   requestWriter,
+		decoder:         qpack.NewDecoder(func(hf qpack.HeaderField) {}),
+		config:          quicConfig,
+		opts:            opts,
+		dialer:          dialer,
+		logger:          logger,
+		controlStrReady: make(chan struct{}),
+
+		settingsReceived: make(chan struct{}),
+	}
+	if opts.EnableConnectionStats {
+		c.stats = newConnStats()
+	}
+	return c, nil
 }
 
-func (c *client) dial() error {
-	var err error
-	if c.dialer != nil {
-		c.session, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
+// addTracer adds t to the tracers of conf.
+func addTracer(conf *quic.Config, t logging.Tracer) {
+	if conf.Tracer == nil {
+		conf.Tracer = t
 	} else {
-		c.session, err = dialAddr(c.hostname, c.tlsConf, c.config)
+		conf.Tracer = logging.NewMultiplexedTracer(conf.Tracer, t)
+	}
+}
+
+// versionsToALPNs returns the H3 ALPNs for the QUIC versions, preserving their order.
+func versionsToALPNs(versions []quic.VersionNumber) []string {
+	alpns := make([]string, 0, len(versions))
+	for _, v := range versions {
+		alpn := versionToALPN(v)
+		if alpn == "" {
+			continue
+		}
+		var found bool
+		for _, a := range alpns {
+			if a == alpn {
+				found = true
+				break
+			}
+		}
+		if !found {
+			alpns = append(alpns, alpn)
+		}
+	}
+	return alpns
+}
+
+func (c *client) dial(ctx context.Context) error {
+	dialStart := time.Now()
+	var addr string
+	var overridden bool
+	if c.opts.DialAddrOverride != nil {
+		addr, overridden = c.opts.DialAddrOverride(c.hostname)
+	}
+	var err error
+	if !overridden {
+		addr = c.hostname
+		if c.opts.AltSvcAddr != nil {
+			if alt, ok := c.opts.AltSvcAddr(c.hostname, c.config.Versions); ok {
+				addr = alt
+			}
+		}
+		addr, err = resolveAddr(ctx, addr, c.opts.AddressFamily)
+		if err != nil {
+			return &ErrDNS{Host: c.hostname, Err: err}
+		}
+	}
+	tlsConf := c.tlsConf
+	if addr != c.hostname && tlsConf.ServerName == "" {
+		// We're dialing an IP address, but the server certificate is issued for the hostname.
+		tlsConf = tlsConf.Clone()
+		tlsConf.ServerName, _, _ = net.SplitHostPort(c.hostname)
+	}
+	quicConf := c.config
+	if quicConf.Tracer != nil {
+		// Make the values of the context that triggered dialing available to the application's tracer.
+		quicConf = c.config.Clone()
+		quicConf.Tracer = &connContextTracer{Tracer: quicConf.Tracer, ctx: ctx}
+	}
+	var monitor *pathMonitor
+	if c.opts.PathFailureTimeout > 0 {
+		monitor = newPathMonitor(c.opts.PathFailureTimeout)
+		if quicConf == c.config {
+			quicConf = c.config.Clone()
+		}
+		addTracer(quicConf, &pathMonitorTracer{monitor: monitor})
+	}
+	if c.stats != nil {
+		if quicConf == c.config {
+			quicConf = c.config.Clone()
+		}
+		addTracer(quicConf, &connStatsTracer{stats: c.stats})
+	}
+	if c.opts.DialSemaphore != nil {
+		// Requests waiting for the dial return when they're canceled, see waitForDial.
+		c.opts.DialSemaphore <- struct{}{}
+	}
+	var sess quic.EarlySession
+	versions := quicConf.Versions
+	for i := 0; ; i++ {
+		sess, err = c.dialSession(addr, tlsConf, quicConf)
+		if err == nil || !isVersionError(err) || i+1 >= len(versions) || i+1 >= maxVersionAttempts {
+			break
+		}
+		c.logger.Debugf("Handshake using %s failed (%s). Retrying with %s.", versions[i], err, versions[i+1])
+		if quicConf == c.config {
+			quicConf = c.config.Clone()
+		}
+		quicConf.Versions = versions[i+1:]
+	}
+	if c.opts.DialSemaphore != nil {
+		<-c.opts.DialSemaphore
 	}
 	if err != nil {
-		return err
+		return newQUICDialError(addr, err)
+	}
+	c.sessionMutex.Lock()
+	closed := c.closed
+	c.session = sess
+	c.sessionMutex.Unlock()
+	if closed {
+		sess.CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+		return errors.New("http3: client closed while dialing")
+	}
+	if monitor != nil {
+		monitor.setFailureHandler(c.handlePathFailure)
 	}
 
 	// send the SETTINGs frame, using 0-RTT data, if possible
@@ -124,11 +374,104 @@ func (c *client) dial() error {
 		}
 	}()
 
+	if c.opts.EnableDatagram {
+		c.datagramMux = newDatagramMux(c.session)
+		c.datagramMux.checkSupport = c.checkDatagramSupport
+		go c.datagramMux.run()
+	}
+
+	if c.opts.Latency != nil {
+		go func() {
+			select {
+			case <-c.session.HandshakeComplete().Done():
+				c.opts.Latency.observeHandshake(time.Since(dialStart))
+			case <-c.session.Context().Done():
+			}
+		}()
+	}
+
+	atomic.StoreInt64(&c.idleSince, time.Now().UnixNano())
+	if c.opts.OnConnectionIdle != nil {
+		go c.monitorIdle()
+	}
+	if c.opts.IdleConnTimeout > 0 {
+		go c.closeWhenIdle()
+	}
+
 	go c.handleUnidirectionalStreams()
 	return nil
 }
 
+// dialSession dials a single QUIC connection.
+func (c *client) dialSession(addr string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+	if c.dialer != nil {
+		return c.dialer("udp", addr, tlsConf, quicConf)
+	}
+	if wrap := c.opts.packetConnWrapper(); wrap != nil {
+		return dialWrappedPacketConn(addr, tlsConf, quicConf, wrap)
+	}
+	return dialAddr(addr, tlsConf, quicConf)
+}
+
+// isVersionError says if a handshake failure shows that the server doesn't support the QUIC version that was offered,
+// i.e. if the version negotiation failed, or if the server didn't accept any of the ALPNs.
+// In that case, the next version from the quic.Config is tried, see maxVersionAttempts.
+// Timeouts are not retried: They say nothing about the version, and retrying them would
+// delay the failure when dialing an unreachable server.
+func isVersionError(err error) bool {
+	var vnErr *quic.VersionNegotiationError
+	if errors.As(err, &vnErr) {
+		return true
+	}
+	var transportErr *quic.TransportError
+	return errors.As(err, &transportErr) && transportErr.ErrorCode == quic.TransportErrorCode(0x100+tlsAlertNoApplicationProtocol)
+}
+
+// packetConnWrapper returns a function that wraps the net.PacketConn used for dialing,
+// or nil if it doesn't need to be wrapped.
+func (o *roundTripperOpts) packetConnWrapper() func(net.PacketConn) net.PacketConn {
+	if o.MaxSendRate <= 0 && o.PacketLoss == nil {
+		return nil
+	}
+	return func(conn net.PacketConn) net.PacketConn {
+		if o.PacketLoss != nil {
+			conn = newLossyPacketConn(conn, o.PacketLoss)
+		}
+		// Dropped packets are lost after they were sent on the constrained link.
+		if o.MaxSendRate > 0 {
+			conn = newThrottledPacketConn(conn, o.MaxSendRate)
+		}
+		return conn
+	}
+}
+
+// dialWrappedPacketConn dials a QUIC connection like quic.DialAddrEarly,
+// but sends and receives the packets on the wrapped net.PacketConn.
+// The net.PacketConn is closed when the connection is closed.
+func dialWrappedPacketConn(addr string, tlsConf *tls.Config, quicConf *quic.Config, wrap func(net.PacketConn) net.PacketConn) (quic.EarlySession, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	sess, err := dialEarly(wrap(udpConn), udpAddr, addr, tlsConf, quicConf)
+	if err != nil {
+		udpConn.Close()
+		return nil, err
+	}
+	go func() {
+		<-sess.Context().Done()
+		udpConn.Close()
+	}()
+	return sess, nil
+}
+
 func (c *client) setupSession() error {
+	defer close(c.controlStrReady)
+
 	// open the control stream
 	str, err := c.session.OpenUniStream()
 	if err != nil {
@@ -137,8 +480,45 @@ func (c *client) setupSession() error {
 	buf := &bytes.Buffer{}
 	quicvarint.Write(buf, streamTypeControlStream)
 	// send the SETTINGS frame
-	(&settingsFrame{Datagram: c.opts.EnableDatagram}).Write(buf)
-	_, err = str.Write(buf.Bytes())
+	if c.opts.BrowserProfile != nil {
+		c.opts.BrowserProfile.settingsFrame(c.opts.EnableDatagram).Write(buf)
+	} else {
+		(&settingsFrame{
+			Datagram: c.opts.EnableDatagram,
+			// we use the prioritization scheme of RFC 9218
+			other: map[uint64]uint64{settingNoRFC7540Priorities: 1},
+		}).Write(buf)
+	}
+	// Server Push is only allowed after we sent a MAX_PUSH_ID frame.
+	if c.opts.PushHandler != nil {
+		(&maxPushIDFrame{PushID: maxPushID}).Write(buf)
+	}
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	c.controlStrMutex.Lock()
+	c.controlStr = str
+	c.controlStrMutex.Unlock()
+	return nil
+}
+
+// sendPriorityUpdate sends a PRIORITY_UPDATE frame for the request sent on stream id.
+func (c *client) sendPriorityUpdate(id quic.StreamID, p Priority) error {
+	select {
+	case <-c.controlStrReady:
+	case <-c.session.Context().Done():
+		return c.session.Context().Err()
+	}
+
+	c.controlStrMutex.Lock()
+	defer c.controlStrMutex.Unlock()
+
+	if c.controlStr == nil {
+		return errors.New("http3: control stream not open")
+	}
+	buf := &bytes.Buffer{}
+	(&priorityUpdateFrame{StreamID: uint64(id), Priority: p.String()}).Write(buf)
+	_, err := c.controlStr.Write(buf.Bytes())
 	return err
 }
 
@@ -147,6 +527,7 @@ func (c *client) handleUnidirectionalStreams() {
 		str, err := c.session.AcceptUniStream(context.Background())
 		if err != nil {
 			c.logger.Debugf("accepting unidirectional stream failed: %s", err)
+			c.checkStatelessReset(err)
 			return
 		}
 
@@ -164,8 +545,12 @@ func (c *client) handleUnidirectionalStreams() {
 				// TODO: check that only one stream of each type is opened.
 				return
 			case streamTypePushStream:
-				// We never increased the Push ID, so we don't expect any push streams.
-				c.session.CloseWithError(quic.ApplicationErrorCode(errorIDError), "")
+				if c.opts.PushHandler == nil {
+					// We never sent a MAX_PUSH_ID frame, so we don't expect any push streams.
+					c.session.CloseWithError(quic.ApplicationErrorCode(errorIDError), "")
+					return
+				}
+				c.handlePushStream(str)
 				return
 			default:
 				str.CancelRead(quic.StreamErrorCode(errorStreamCreationError))
@@ -181,6 +566,14 @@ func (c *client) handleUnidirectionalStreams() {
 				c.session.CloseWithError(quic.ApplicationErrorCode(errorMissingSettings), "")
 				return
 			}
+			settings := settingsFromFrame(sf)
+			c.settingsMutex.Lock()
+			first := c.settings == nil
+			c.settings = &settings
+			c.settingsMutex.Unlock()
+			if first {
+				close(c.settingsReceived)
+			}
 			if !sf.Datagram {
 				return
 			}
@@ -194,11 +587,278 @@ func (c *client) handleUnidirectionalStreams() {
 	}
 }
 
+// startDial starts dialing the connection, if that didn't happen yet.
+// The returned channel is closed when dialing completed.
+// The connection is shared by all requests, so dialing isn't canceled with ctx: Only its values are used.
+func (c *client) startDial(ctx context.Context) <-chan struct{} {
+	c.dialOnce.Do(func() {
+		close(c.dialStarted())
+		c.dialDone = make(chan struct{})
+		dialCtx := detachContext(ctx)
+		go func() {
+			defer close(c.dialDone)
+			c.handshakeErr = c.dial(dialCtx)
+		}()
+	})
+	return c.dialDone
+}
+
+// dialStarted returns a channel that is closed once dialing was started.
+// Unlike startDial, it doesn't start dialing, which allows observing the handshake without triggering it.
+func (c *client) dialStarted() chan struct{} {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+	if c.dialStartedChan == nil {
+		c.dialStartedChan = make(chan struct{})
+	}
+	return c.dialStartedChan
+}
+
+// waitForDial dials the connection, if that didn't happen yet, and waits until dialing completed.
+// If ctx is canceled first, ctx.Err() is returned. Dialing continues for later requests.
+func (c *client) waitForDial(ctx context.Context) error {
+	select {
+	case <-c.startDial(ctx):
+		return c.handshakeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// warmup dials the connection, if it wasn't dialed yet, and waits for the handshake to complete.
+func (c *client) warmup(ctx context.Context) error {
+	if err := c.waitForDial(ctx); err != nil {
+		return err
+	}
+	select {
+	case <-c.session.HandshakeComplete().Done():
+		return nil
+	case <-c.session.Context().Done():
+		return errors.New("http3: connection closed before the handshake completed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// getSession returns the session, or nil if it wasn't dialed yet.
+func (c *client) getSession() quic.EarlySession {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+	return c.session
+}
+
+// handshakeComplete says if the session was dialed, completed the handshake, and is still alive.
+func (c *client) handshakeComplete() bool {
+	sess := c.getSession()
+	if sess == nil {
+		return false
+	}
+	select {
+	case <-sess.Context().Done():
+		return false
+	default:
+	}
+	select {
+	case <-sess.HandshakeComplete().Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// checkStatelessReset records if the session was closed by a stateless reset.
+// The server lost the state for this connection, so a new connection needs to be dialed.
+func (c *client) checkStatelessReset(err error) {
+	var resetErr *quic.StatelessResetError
+	if errors.As(err, &resetErr) {
+		c.statelessReset.Set(true)
+	}
+}
+
+// handlePathFailure closes the session when the path broke.
+// Requests in flight fail with errPathFailure, and the RoundTripper dials a new connection.
+func (c *client) handlePathFailure() {
+	c.logger.Debugf("No packets received for %s, closing the session", c.opts.PathFailureTimeout)
+	c.pathFailed.Set(true)
+	c.session.CloseWithError(quic.ApplicationErrorCode(errorNoError), "path failure")
+}
+
+// drain stops the client from opening new streams.
+// The session is closed as soon as all requests in flight have completed.
+func (c *client) drain() {
+	c.draining.Set(true)
+	if c.requestsInFlight() == 0 {
+		c.closeDrained()
+	}
+}
+
+func (c *client) closeDrained() {
+	c.drainOnce.Do(func() {
+		c.logger.Debugf("Closing drained connection to %s", c.hostname)
+		c.Close()
+	})
+}
+
 func (c *client) Close() error {
-	if c.session == nil {
+	c.sessionMutex.Lock()
+	c.closed = true
+	sess := c.session
+	c.sessionMutex.Unlock()
+	if sess == nil {
 		return nil
 	}
-	return c.session.CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+	return sess.CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+}
+
+// negotiatedVersion returns the QUIC version of the session.
+// It returns false if the handshake hasn't completed yet.
+func (c *client) negotiatedVersion() (quic.VersionNumber, bool) {
+	sess := c.getSession()
+	if sess == nil {
+		return 0, false
+	}
+	select {
+	case <-sess.HandshakeComplete().Done():
+	default:
+		return 0, false
+	}
+	return sess.ConnectionState().Version, true
+}
+
+// tlsParameters returns the cipher suite and the key exchange group negotiated in the handshake.
+// It returns false if the handshake hasn't completed yet.
+func (c *client) tlsParameters() (TLSParameters, bool) {
+	sess := c.getSession()
+	if sess == nil {
+		return TLSParameters{}, false
+	}
+	select {
+	case <-sess.HandshakeComplete().Done():
+	default:
+		return TLSParameters{}, false
+	}
+	cs := sess.ConnectionState()
+	return TLSParameters{
+		CipherSuite:      cs.TLS.CipherSuite,
+		KeyExchangeGroup: cs.KeyExchangeGroup,
+	}, true
+}
+
+// connectionStats returns the statistics of the connection.
+// It returns false if connection statistics are not enabled, or if the connection wasn't dialed yet.
+func (c *client) connectionStats() (ConnectionStats, bool) {
+	if c.stats == nil {
+		return ConnectionStats{}, false
+	}
+	stats := c.stats.get()
+	if stats.PacketsSent == 0 {
+		return ConnectionStats{}, false
+	}
+	return stats, true
+}
+
+// connStats returns the ConnStats passed to the predicate of RoundTripper.CloseConnections.
+func (c *client) connStats() ConnStats {
+	var s ConnStats
+	s.RequestsInFlight = int(c.requestsInFlight())
+	if idleSince := atomic.LoadInt64(&c.idleSince); s.RequestsInFlight == 0 && idleSince != 0 {
+		s.IdleFor = time.Since(time.Unix(0, idleSince))
+	}
+	s.Stats, _ = c.connectionStats()
+	return s
+}
+
+// serverSettings returns the settings received from the server.
+// It returns false if the server's SETTINGS frame wasn't received yet.
+func (c *client) serverSettings() (Settings, bool) {
+	c.settingsMutex.Lock()
+	defer c.settingsMutex.Unlock()
+
+	if c.settings == nil {
+		return Settings{}, false
+	}
+	return *c.settings, true
+}
+
+// checkDatagramSupport checks that the server enabled datagram support,
+// both on the QUIC and on the HTTP/3 layer.
+// It blocks until the handshake completed and the server's SETTINGS frame was received.
+func (c *client) checkDatagramSupport() error {
+	select {
+	case <-c.session.HandshakeComplete().Done():
+	case <-c.session.Context().Done():
+		return errors.New("http3: connection closed before the handshake completed")
+	}
+	if !c.session.ConnectionState().SupportsDatagrams {
+		return &ErrDatagramsNotSupported{}
+	}
+	select {
+	case <-c.settingsReceived:
+	case <-c.session.Context().Done():
+		return errors.New("http3: connection closed before the server's SETTINGS frame was received")
+	}
+	if settings, _ := c.serverSettings(); !settings.Datagram {
+		return &ErrDatagramsNotSupported{MissingSetting: true}
+	}
+	return nil
+}
+
+// requestsInFlight returns the number of requests that haven't completed yet.
+func (c *client) requestsInFlight() int64 {
+	return atomic.LoadInt64(&c.inFlight)
+}
+
+// monitorIdle calls OnConnectionIdle while the connection is idle, until the connection is closed.
+func (c *client) monitorIdle() {
+	threshold := c.opts.ConnectionIdleThreshold
+	if threshold <= 0 {
+		threshold = defaultConnectionIdleThreshold
+	}
+	timer := time.NewTimer(threshold)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.session.Context().Done():
+			return
+		}
+		wait := threshold
+		if c.requestsInFlight() == 0 {
+			idleFor := time.Since(time.Unix(0, atomic.LoadInt64(&c.idleSince)))
+			if idleFor >= threshold {
+				c.opts.OnConnectionIdle(c.hostname, idleFor)
+			} else {
+				wait = threshold - idleFor
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// closeWhenIdle closes the connection once it didn't have any requests in flight for IdleConnTimeout.
+func (c *client) closeWhenIdle() {
+	timeout := c.opts.IdleConnTimeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.session.Context().Done():
+			return
+		}
+		wait := timeout
+		if c.requestsInFlight() == 0 {
+			idleFor := time.Since(time.Unix(0, atomic.LoadInt64(&c.idleSince)))
+			if idleFor >= timeout {
+				c.logger.Debugf("Closing connection to %s, idle for %s", c.hostname, idleFor)
+				c.idleClosed.Set(true)
+				c.Close()
+				return
+			}
+			wait = timeout - idleFor
+		}
+		timer.Reset(wait)
+	}
 }
 
 func (c *client) maxHeaderBytes() uint64 {
@@ -214,119 +874,281 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, fmt.Errorf("http3 client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
 	}
 
-	c.dialOnce.Do(func() {
-		c.handshakeErr = c.dial()
-	})
-
-	if c.handshakeErr != nil {
-		return nil, c.handshakeErr
-	}
-
 	// Immediately send out this request, if this is a 0-RTT request.
-	if req.Method == MethodGet0RTT {
+	use0RTT := req.Method == MethodGet0RTT
+	if use0RTT {
 		req.Method = http.MethodGet
-	} else {
-		// wait for the handshake to complete
-		select {
-		case <-c.session.HandshakeComplete().Done():
-			c.metricsHandshakeDone = time.Now()
-		case <-req.Context().Done():
-			return nil, req.Context().Err()
-		}
 	}
-
-	str, err := c.session.OpenStreamSync(req.Context())
+	str, err := c.openStream(req.Context(), use0RTT)
 	if err != nil {
 		return nil, err
 	}
+	if h, ok := req.Context().Value(priorityHandleContextKey).(*PriorityHandle); ok {
+		h.bind(c, str.StreamID())
+	}
 
 	// Request Cancellation:
 	// This go routine keeps running even after RoundTrip() returns.
 	// It is shut down when the application is done processing the body.
 	reqDone := make(chan struct{})
+	reqStart := time.Now()
+	var receivedResponse utils.AtomicBool
+	var canceledAll utils.AtomicBool
+	cancelAllChan := c.cancelAllSignal()
+	atomic.AddInt64(&c.inFlight, 1)
 	go func() {
+		defer c.requestCompleted()
 		select {
 		case <-req.Context().Done():
 			str.CancelWrite(quic.StreamErrorCode(errorRequestCanceled))
 			str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+		case <-cancelAllChan:
+			canceledAll.Set(true)
+			str.CancelWrite(quic.StreamErrorCode(errorRequestCanceled))
+			str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
 		case <-reqDone:
+			if c.opts.Latency != nil && receivedResponse.Get() {
+				c.opts.Latency.observeTotal(time.Since(reqStart))
+			}
 		}
 	}()
 
 	rsp, rerr := c.doRequest(req, str, reqDone)
+	if rerr.err == nil && c.opts.Latency != nil {
+		receivedResponse.Set(true)
+		c.opts.Latency.observeTimeToFirstByte(time.Since(reqStart))
+	}
 	if rerr.err != nil { // if any error occurred
 		close(reqDone)
-		if rerr.streamErr != 0 { // if it was a stream error
-			str.CancelWrite(quic.StreamErrorCode(rerr.streamErr))
+		c.checkStatelessReset(rerr.err)
+		c.abortRequest(str, rerr)
+		if c.pathFailed.Get() {
+			return nil, errPathFailure
 		}
-		if rerr.connErr != 0 { // if it was a connection error
-			var reason string
-			if rerr.err != nil {
-				reason = rerr.err.Error()
-			}
-			c.session.CloseWithError(quic.ApplicationErrorCode(rerr.connErr), reason)
+		if canceledAll.Get() {
+			return nil, ErrRequestCanceled
 		}
 	}
 	return rsp, rerr.err
 }
 
+// cancelAllSignal returns the channel that is closed when cancelAll is called.
+func (c *client) cancelAllSignal() <-chan struct{} {
+	c.cancelAllMutex.Lock()
+	defer c.cancelAllMutex.Unlock()
+	if c.cancelAllChan == nil {
+		c.cancelAllChan = make(chan struct{})
+	}
+	return c.cancelAllChan
+}
+
+// cancelAll resets the streams of all requests in flight, without closing the session.
+// Requests sent afterwards are not affected.
+func (c *client) cancelAll() {
+	c.cancelAllMutex.Lock()
+	defer c.cancelAllMutex.Unlock()
+	if c.cancelAllChan != nil {
+		close(c.cancelAllChan)
+		c.cancelAllChan = nil
+	}
+}
+
+// openStream dials the connection, if that didn't happen yet, and opens a new request stream.
+// Unless use0RTT is set, it waits for the handshake to complete first.
+func (c *client) openStream(ctx context.Context, use0RTT bool) (quic.Stream, error) {
+	if err := c.waitForDial(ctx); err != nil {
+		return nil, err
+	}
+	if c.draining.Get() {
+		return nil, errConnectionDraining
+	}
+
+	if !use0RTT {
+		// wait for the handshake to complete
+		select {
+		case <-c.session.HandshakeComplete().Done():
+			c.metricsMutex.Lock()
+			c.metricsHandshakeDone = time.Now()
+			c.metricsMutex.Unlock()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if c.opts.OnStreamLimitReached != nil || c.opts.OpenConnectionOnStreamLimit {
+		// Try opening the stream without blocking first, to find out if the stream limit was reached.
+		str, err := c.session.OpenStream()
+		if err == nil {
+			return str, nil
+		}
+		if !isStreamLimitError(err) {
+			return nil, c.openStreamError(err)
+		}
+		if c.opts.OnStreamLimitReached != nil {
+			c.opts.OnStreamLimitReached(c.hostname)
+		}
+		if c.opts.OpenConnectionOnStreamLimit {
+			return nil, errStreamLimitReached
+		}
+	}
+
+	str, err := c.session.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, c.openStreamError(err)
+	}
+	return str, nil
+}
+
+func (c *client) openStreamError(err error) error {
+	c.checkStatelessReset(err)
+	if c.pathFailed.Get() {
+		return errPathFailure
+	}
+	return err
+}
+
+// isStreamLimitError says if opening a stream failed because the peer's stream limit was reached.
+func isStreamLimitError(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Temporary()
+}
+
+// requestCompleted is called when a request that was counted in inFlight completed.
+func (c *client) requestCompleted() {
+	// Set the idle time first, so it's never outdated when the monitor sees no requests in flight.
+	atomic.StoreInt64(&c.idleSince, time.Now().UnixNano())
+	if atomic.AddInt64(&c.inFlight, -1) == 0 && c.draining.Get() {
+		c.closeDrained()
+	}
+}
+
+// abortRequest resets the stream if rerr is a stream error, or closes the session if it is a connection error.
+func (c *client) abortRequest(str quic.Stream, rerr requestError) {
+	if rerr.streamErr != 0 { // if it was a stream error
+		str.CancelWrite(quic.StreamErrorCode(rerr.streamErr))
+		// Don't leave the rest of the response unread, it would use up flow control credit.
+		str.CancelRead(quic.StreamErrorCode(rerr.streamErr))
+	}
+	if rerr.connErr != 0 { // if it was a connection error
+		var reason string
+		if rerr.err != nil {
+			reason = rerr.err.Error()
+		}
+		c.session.CloseWithError(quic.ApplicationErrorCode(rerr.connErr), reason)
+	}
+}
+
 func (c *client) doRequest(
 	req *http.Request,
 	str quic.Stream,
 	reqDone chan struct{},
 ) (*http.Response, requestError) {
-	var requestGzip bool
-	if !c.opts.DisableCompression && req.Method != "HEAD" && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
-		requestGzip = true
-	}
-	if err := c.requestWriter.WriteRequest(str, req, requestGzip); err != nil {
-		return nil, newStreamError(errorInternalError, err)
+	if c.opts.CompressRequestBody && shouldCompressRequestBody(req, c.opts.CompressBodyMinSize) {
+		req = compressRequestBody(req)
 	}
-
-	frame, err := parseNextFrame(str)
-	if err != nil {
-		return nil, newStreamError(errorFrameError, err)
+	var acceptEncoding string
+	if !c.opts.DisableCompression && req.Method != "HEAD" && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		acceptEncoding = "gzip"
+		if c.opts.EnableZstd {
+			acceptEncoding = "zstd, gzip"
+		}
 	}
-	hf, ok := frame.(*headersFrame)
-	if !ok {
-		return nil, newConnError(errorFrameUnexpected, errors.New("expected first frame to be a HEADERS frame"))
+	var ht *headerTimer
+	if c.opts.ResponseHeaderTimeout > 0 {
+		ht = newHeaderTimer(str, c.opts.ResponseHeaderTimeout)
+		if req.Body != nil {
+			// The request writer closes the body when it's done sending it.
+			newReq := *req
+			newReq.Body = &timedRequestBody{ReadCloser: req.Body, timer: ht}
+			req = &newReq
+		}
 	}
-	if hf.Length > c.maxHeaderBytes() {
-		return nil, newStreamError(errorFrameError, fmt.Errorf("HEADERS frame too large: %d bytes (max: %d)", hf.Length, c.maxHeaderBytes()))
+	if err := c.requestWriter.WriteRequest(str, req, acceptEncoding); err != nil {
+		return nil, newStreamError(errorInternalError, err)
 	}
-	headerBlock := make([]byte, hf.Length)
-	if _, err := io.ReadFull(str, headerBlock); err != nil {
-		return nil, newStreamError(errorRequestIncomplete, err)
+	c.metricsMutex.Lock()
+	c.metricsRequestSent = time.Now()
+	c.metricsMutex.Unlock()
+	if ht != nil && req.Body == nil {
+		ht.start()
 	}
-	hfs, err := c.decoder.DecodeFull(headerBlock)
-	if err != nil {
-		// TODO: use the right error code
-		return nil, newConnError(errorGeneralProtocolError, err)
+	rsp, rerr := c.readResponse(req, str, reqDone, acceptEncoding, ht)
+	if rerr.err != nil && ht != nil {
+		if err := ht.stop(); err != nil {
+			// reading the response failed because the timer reset the stream
+			return nil, newStreamError(errorRequestCanceled, err)
+		}
 	}
+	return rsp, rerr
+}
 
-	connState := qtls.ToTLSConnectionState(c.session.ConnectionState().TLS)
-	res := &http.Response{
-		Proto:      "HTTP/3",
-		ProtoMajor: 3,
-		Header:     http.Header{},
-		TLS:        &connState,
-	}
-	for _, hf := range hfs {
-		switch hf.Name {
-		case ":status":
-			status, err := strconv.Atoi(hf.Value)
-			if err != nil {
-				return nil, newStreamError(errorGeneralProtocolError, errors.New("malformed non-numeric status pseudo header"))
+// readResponse reads the response to req from the stream.
+// If acceptEncoding is not empty, the response body is decompressed transparently.
+// If ht is not nil, it is stopped when the response headers were received.
+func (c *client) readResponse(
+	req *http.Request,
+	str quic.Stream,
+	reqDone chan struct{},
+	acceptEncoding string,
+	ht *headerTimer,
+) (*http.Response, requestError) {
+	var hf *headersFrame
+	for receivedFirstByte := false; hf == nil; receivedFirstByte = true {
+		frame, err := parseNextFrame(str)
+		if err != nil {
+			return nil, newStreamError(errorFrameError, err)
+		}
+		if !receivedFirstByte {
+			c.metricsMutex.Lock()
+			c.metricsFirstByte = time.Now()
+			c.metricsMutex.Unlock()
+		}
+		switch f := frame.(type) {
+		case *headersFrame:
+			hf = f
+		case *pushPromiseFrame:
+			// The server may send PUSH_PROMISE frames before the response.
+			if rerr := c.handlePushPromise(str, f); rerr.err != nil {
+				return nil, rerr
 			}
-			res.StatusCode = status
-			res.Status = hf.Value + " " + http.StatusText(status)
 		default:
-			res.Header.Add(hf.Name, hf.Value)
+			return nil, newConnError(errorFrameUnexpected, errors.New("expected first frame to be a HEADERS frame"))
+		}
+	}
+	hfs, rerr := c.readHeaderBlock(str, "HEADERS", hf.Length)
+	if rerr.err != nil {
+		return nil, rerr
+	}
+	if ht != nil {
+		if err := ht.stop(); err != nil {
+			return nil, newStreamError(errorRequestCanceled, err)
 		}
 	}
+	res, rerr := c.responseFromHeaders(hfs)
+	if rerr.err != nil {
+		return nil, rerr
+	}
 	respBody := newResponseBody(str, reqDone, func() {
 		c.session.CloseWithError(quic.ApplicationErrorCode(errorFrameUnexpected), "")
 	})
+	respBody.bufferPool = c.opts.BufferPool
+	respBody.maxBytes = c.opts.MaxBodyBytes
+	if c.opts.BodyIdleTimeout > 0 {
+		respBody.startIdleTimer(c.opts.BodyIdleTimeout)
+	}
+	if c.opts.IdleReadTimeout > 0 {
+		respBody.setReadTimeout(c.opts.IdleReadTimeout)
+	}
+	if c.opts.OnResponseChunk != nil {
+		respBody.onDataFrameRead = func(length uint64) { c.opts.OnResponseChunk(req, int(length)) }
+	}
+	respBody.onPushPromise = func(f *pushPromiseFrame) error {
+		rerr := c.handlePushPromise(str, f)
+		if rerr.connErr != 0 {
+			c.session.CloseWithError(quic.ApplicationErrorCode(rerr.connErr), rerr.err.Error())
+		}
+		return rerr.err
+	}
 
 	// Rules for when to set Content-Length are defined in https://tools.ietf.org/html/rfc7230#section-3.3.2.
 	_, hasTransferEncoding := res.Header["Transfer-Encoding"]
@@ -342,15 +1164,97 @@ func (c *client) doRequest(
 		}
 	}
 
-	if requestGzip && res.Header.Get("Content-Encoding") == "gzip" {
+	if acceptEncoding != "" && matchesContentType(res.Header.Get("Content-Type"), c.opts.NoDecompressionContentTypes) {
+		// pass the compressed response body to the application, as if it had set the Accept-Encoding header itself
+		acceptEncoding = ""
+	}
+	contentEncoding := res.Header.Get("Content-Encoding")
+	if acceptEncoding != "" && contentEncoding == "gzip" {
 		res.Header.Del("Content-Encoding")
 		res.Header.Del("Content-Length")
 		res.ContentLength = -1
 		res.Body = newGzipReader(respBody)
 		res.Uncompressed = true
+	} else if c.opts.EnableZstd && acceptEncoding != "" && contentEncoding == "zstd" {
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Body = newZstdReader(respBody)
+		res.Uncompressed = true
+	} else if c.datagramMux != nil {
+		res.Body = &datagramBody{body: respBody, mux: c.datagramMux, sess: c.session}
 	} else {
 		res.Body = respBody
 	}
 
 	return res, requestError{}
 }
+
+// matchesContentType says if the media type of contentType is contained in types.
+// Types of the form "type/*" match all subtypes.
+func matchesContentType(contentType string, types []string) bool {
+	if len(types) == 0 || contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == mediaType {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// readHeaderBlock reads and decodes a QPACK-encoded header block of length bytes.
+func (c *client) readHeaderBlock(str io.Reader, frameName string, length uint64) ([]qpack.HeaderField, requestError) {
+	if length > c.maxHeaderBytes() {
+		return nil, newStreamError(errorFrameError, fmt.Errorf("%s frame too large: %d bytes (max: %d)", frameName, length, c.maxHeaderBytes()))
+	}
+	headerBlock := make([]byte, length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		return nil, newStreamError(errorRequestIncomplete, err)
+	}
+	hfs, err := c.decoder.DecodeFull(headerBlock)
+	if err != nil {
+		// TODO: use the right error code
+		return nil, newConnError(errorGeneralProtocolError, err)
+	}
+	return hfs, requestError{}
+}
+
+func (c *client) responseFromHeaders(hfs []qpack.HeaderField) (*http.Response, requestError) {
+	cs := c.session.ConnectionState()
+	c.metricsMutex.Lock()
+	c.metricsResumed = cs.TLS.DidResume
+	c.metricsAttempted0RTT = cs.Attempted0RTT
+	c.metricsAccepted0RTT = cs.TLS.Used0RTT
+	c.metricsMutex.Unlock()
+	connState := qtls.ToTLSConnectionState(cs.TLS)
+	res := &http.Response{
+		Proto:      "HTTP/3",
+		ProtoMajor: 3,
+		Header:     http.Header{},
+		TLS:        &connState,
+	}
+	for _, hf := range hfs {
+		switch hf.Name {
+		case ":status":
+			status, err := strconv.Atoi(hf.Value)
+			if err != nil {
+				return nil, newStreamError(errorGeneralProtocolError, errors.New("malformed non-numeric status pseudo header"))
+			}
+			res.StatusCode = status
+			res.Status = hf.Value + " " + http.StatusText(status)
+		default:
+			res.Header.Add(hf.Name, hf.Value)
+		}
+	}
+	return res, requestError{}
+}
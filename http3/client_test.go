@@ -9,12 +9,19 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/klauspost/compress/zstd"
 	"github.com/lucas-clemente/quic-go"
+	mocklogging "github.com/lucas-clemente/quic-go/internal/mocks/logging"
 	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/lucas-clemente/quic-go/quicvarint"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -25,6 +32,22 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// streamLimitError is returned by quic.Session.OpenStream when the peer's stream limit was reached.
+type streamLimitError struct{}
+
+var _ net.Error = streamLimitError{}
+
+func (streamLimitError) Error() string   { return "too many open streams" }
+func (streamLimitError) Timeout() bool   { return false }
+func (streamLimitError) Temporary() bool { return true }
+
+// lifoScheduler is a quic.StreamScheduler that serves the most recently opened stream first.
+type lifoScheduler struct{}
+
+func (lifoScheduler) Schedule(streams []quic.StreamID) {
+	sort.Slice(streams, func(i, j int) bool { return streams[i] > streams[j] })
+}
+
 var _ = Describe("Client", func() {
 	var (
 		client       *client
@@ -53,12 +76,21 @@ var _ = Describe("Client", func() {
 		dialAddr = origDialAddr
 	})
 
-	It("rejects quic.Configs that allow multiple QUIC versions", func() {
+	It("offers the ALPNs for all QUIC versions, if the quic.Config allows multiple QUIC versions", func() {
 		qconf := &quic.Config{
-			Versions: []quic.VersionNumber{protocol.VersionDraft29, protocol.Version1},
+			Versions: []quic.VersionNumber{protocol.Version1, protocol.VersionDraft29},
+		}
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, qconf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialAddrCalled bool
+		dialAddr = func(_ string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+			Expect(quicConf.Versions).To(Equal([]protocol.VersionNumber{protocol.Version1, protocol.VersionDraft29}))
+			Expect(tlsConf.NextProtos).To(Equal([]string{nextProtoH3, nextProtoH3Draft29}))
+			dialAddrCalled = true
+			return nil, errors.New("test done")
 		}
-		_, err := newClient("localhost:1337", nil, &roundTripperOpts{}, qconf, nil)
-		Expect(err).To(MatchError("can only use a single QUIC version for dialing a HTTP/3 connection"))
+		client.RoundTrip(req)
+		Expect(dialAddrCalled).To(BeTrue())
 	})
 
 	It("uses the default QUIC and TLS config if none is give", func() {
@@ -91,6 +123,274 @@ var _ = Describe("Client", func() {
 		Expect(dialAddrCalled).To(BeTrue())
 	})
 
+	It("only dials the preferred address family", func() {
+		origLookupIPAddr := lookupIPAddr
+		defer func() { lookupIPAddr = origLookupIPAddr }()
+		lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}, {IP: net.ParseIP("2001:db8::1")}}, nil
+		}
+		client, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{AddressFamily: AddressFamilyIPv6}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialAddrCalled bool
+		dialAddr = func(hostname string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(hostname).To(Equal("[2001:db8::1]:443"))
+			Expect(tlsConf.ServerName).To(Equal("quic.clemente.io"))
+			dialAddrCalled = true
+			return nil, errors.New("test done")
+		}
+		req, err := http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		Expect(dialAddrCalled).To(BeTrue())
+		Expect(client.tlsConf.ServerName).To(BeEmpty())
+	})
+
+	It("returns an ErrDNS if resolving the host fails", func() {
+		origLookupIPAddr := lookupIPAddr
+		defer func() { lookupIPAddr = origLookupIPAddr }()
+		lookupErr := &net.DNSError{Err: "no such host", Name: "quic.clemente.io", IsNotFound: true}
+		lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) { return nil, lookupErr }
+		client, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{AddressFamily: AddressFamilyIPv6}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			Fail("didn't expect any dial")
+			return nil, nil
+		}
+		req, err := http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError(lookupErr))
+		var dnsErr *ErrDNS
+		Expect(errors.As(err, &dnsErr)).To(BeTrue())
+		Expect(dnsErr.Host).To(Equal("quic.clemente.io:443"))
+	})
+
+	It("returns when the request is canceled while resolving the host", func() {
+		origLookupIPAddr := lookupIPAddr
+		defer func() { lookupIPAddr = origLookupIPAddr }()
+		unblock := make(chan struct{})
+		var lookups int
+		lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+			lookups++
+			<-unblock
+			return []net.IPAddr{{IP: net.ParseIP("2001:db8::1")}}, nil
+		}
+		client, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{AddressFamily: AddressFamilyIPv6}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		testDone := make(chan struct{})
+		defer close(testDone)
+		dialAddr = func(addr string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(addr).To(Equal("[2001:db8::1]:443"))
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-testDone
+				return nil, errors.New("test done")
+			}).AnyTimes()
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			headerBuf := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBuf)
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+			Expect(enc.Close()).To(Succeed())
+			buf := &bytes.Buffer{}
+			(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+			buf.Write(headerBuf.Bytes())
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+			sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			return sess, nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(25*time.Millisecond))
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		// The lookup isn't canceled, since the connection is used by later requests as well.
+		// Canceling the first request must not fail the next one.
+		close(unblock)
+		req, err = http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		rsp, err := client.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(200))
+		Expect(lookups).To(Equal(1))
+	})
+
+	It("signals that dialing started, without starting to dial", func() {
+		client, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialed := make(chan struct{})
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			close(dialed)
+			return nil, errors.New("test done")
+		}
+		started := client.dialStarted()
+		Consistently(started).ShouldNot(BeClosed())
+		Expect(dialed).ToNot(BeClosed())
+		Eventually(client.startDial(context.Background())).Should(BeClosed())
+		Expect(started).To(BeClosed())
+		Expect(dialed).To(BeClosed())
+	})
+
+	It("returns an ErrDNS if the QUIC dialer fails to resolve the host", func() {
+		client, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			return nil, &net.OpError{Op: "dial", Net: "udp", Err: &net.DNSError{Err: "no such host", Name: "quic.clemente.io"}}
+		}
+		req, err := http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		var dnsErr *ErrDNS
+		Expect(errors.As(err, &dnsErr)).To(BeTrue())
+		var quicErr *ErrQUICDial
+		Expect(errors.As(err, &quicErr)).To(BeFalse())
+	})
+
+	It("returns an ErrQUICDial if dialing fails", func() {
+		testErr := errors.New("handshake error")
+		client, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return nil, testErr }
+		req, err := http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+		var quicErr *ErrQUICDial
+		Expect(errors.As(err, &quicErr)).To(BeTrue())
+		Expect(quicErr.Addr).To(Equal("quic.clemente.io:443"))
+		var dnsErr *ErrDNS
+		Expect(errors.As(err, &dnsErr)).To(BeFalse())
+	})
+
+	It("dials the address returned by DialAddrOverride", func() {
+		var overrideCalledWith string
+		opts := &roundTripperOpts{
+			AddressFamily: AddressFamilyIPv6,
+			DialAddrOverride: func(host string) (string, bool) {
+				overrideCalledWith = host
+				return "192.0.2.1:1234", true
+			},
+		}
+		client, err := newClient("quic.clemente.io:443", nil, opts, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialAddrCalled bool
+		dialAddr = func(hostname string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(hostname).To(Equal("192.0.2.1:1234"))
+			Expect(tlsConf.ServerName).To(Equal("quic.clemente.io"))
+			dialAddrCalled = true
+			return nil, errors.New("test done")
+		}
+		req, err := http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		Expect(dialAddrCalled).To(BeTrue())
+		Expect(overrideCalledWith).To(Equal("quic.clemente.io:443"))
+	})
+
+	It("dials the address of the Alt-Svc alternative", func() {
+		var altSvcCalledWith string
+		opts := &roundTripperOpts{
+			AltSvcAddr: func(host string, versions []quic.VersionNumber) (string, bool) {
+				altSvcCalledWith = host
+				Expect(versions).To(Equal([]quic.VersionNumber{quic.VersionDraft29}))
+				return "alt.clemente.io:8443", true
+			},
+		}
+		client, err := newClient("quic.clemente.io:443", nil, opts, &quic.Config{Versions: []quic.VersionNumber{quic.VersionDraft29}}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialAddrCalled bool
+		dialAddr = func(hostname string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(hostname).To(Equal("alt.clemente.io:8443"))
+			Expect(tlsConf.ServerName).To(Equal("quic.clemente.io"))
+			dialAddrCalled = true
+			return nil, errors.New("test done")
+		}
+		req, err := http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		Expect(dialAddrCalled).To(BeTrue())
+		Expect(altSvcCalledWith).To(Equal("quic.clemente.io:443"))
+	})
+
+	It("throttles the PacketConn if MaxSendRate is set", func() {
+		origDialEarly := dialEarly
+		defer func() { dialEarly = origDialEarly }()
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{MaxSendRate: 1000}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			Fail("didn't expect dialAddr to be called")
+			return nil, nil
+		}
+		var dialEarlyCalled bool
+		dialEarly = func(conn net.PacketConn, addr net.Addr, host string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(conn).To(BeAssignableToTypeOf(&throttledPacketConn{}))
+			Expect(conn.(*throttledPacketConn).rate).To(Equal(1000))
+			Expect(addr.String()).To(Equal("127.0.0.1:1337"))
+			Expect(host).To(Equal("localhost:1337"))
+			dialEarlyCalled = true
+			return nil, errors.New("test done")
+		}
+		req, err := http.NewRequest("GET", "https://localhost:1337", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		Expect(dialEarlyCalled).To(BeTrue())
+	})
+
+	It("drops packets if PacketLoss is set", func() {
+		Expect(os.Setenv(packetLossEnv, "1")).To(Succeed())
+		defer os.Unsetenv(packetLossEnv)
+		origDialEarly := dialEarly
+		defer func() { dialEarly = origDialEarly }()
+		lossConf := &PacketLossConfig{Period: 10}
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{MaxSendRate: 1000, PacketLoss: lossConf}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialEarlyCalled bool
+		dialEarly = func(conn net.PacketConn, _ net.Addr, _ string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			// packets are dropped after they were sent on the throttled link
+			Expect(conn).To(BeAssignableToTypeOf(&throttledPacketConn{}))
+			lossyConn := conn.(*throttledPacketConn).PacketConn
+			Expect(lossyConn).To(BeAssignableToTypeOf(&lossyPacketConn{}))
+			Expect(lossyConn.(*lossyPacketConn).config).To(Equal(lossConf))
+			dialEarlyCalled = true
+			return nil, errors.New("test done")
+		}
+		req, err := http.NewRequest("GET", "https://localhost:1337", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		Expect(dialEarlyCalled).To(BeTrue())
+	})
+
+	It("resolves the address if DialAddrOverride doesn't override it", func() {
+		opts := &roundTripperOpts{DialAddrOverride: func(string) (string, bool) { return "192.0.2.1:1234", false }}
+		client, err := newClient("quic.clemente.io:443", nil, opts, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialAddrCalled bool
+		dialAddr = func(hostname string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(hostname).To(Equal("quic.clemente.io:443"))
+			dialAddrCalled = true
+			return nil, errors.New("test done")
+		}
+		req, err := http.NewRequest("GET", "https://quic.clemente.io:443", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError("test done"))
+		Expect(dialAddrCalled).To(BeTrue())
+	})
+
 	It("uses the TLS config and QUIC config", func() {
 		tlsConf := &tls.Config{
 			ServerName: "foo.bar",
@@ -107,7 +407,7 @@ var _ = Describe("Client", func() {
 		) (quic.EarlySession, error) {
 			Expect(hostname).To(Equal("localhost:1337"))
 			Expect(tlsConfP.ServerName).To(Equal(tlsConf.ServerName))
-			Expect(tlsConfP.NextProtos).To(Equal([]string{nextProtoH3}))
+			Expect(tlsConfP.NextProtos).To(Equal([]string{"proto foo", "proto bar"}))
 			Expect(quicConfP.MaxIdleTimeout).To(Equal(quicConf.MaxIdleTimeout))
 			dialAddrCalled = true
 			return nil, errors.New("test done")
@@ -118,6 +418,32 @@ var _ = Describe("Client", func() {
 		Expect(tlsConf.NextProtos).To(Equal([]string{"proto foo", "proto bar"}))
 	})
 
+	It("offers a custom ALPN, if set in the TLS config", func() {
+		client, err := newClient("localhost:1337", &tls.Config{NextProtos: []string{"h3-ebi"}}, &roundTripperOpts{}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialAddrCalled bool
+		dialAddr = func(_ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(tlsConf.NextProtos).To(Equal([]string{"h3-ebi"}))
+			dialAddrCalled = true
+			return nil, errors.New("test done")
+		}
+		client.RoundTrip(req)
+		Expect(dialAddrCalled).To(BeTrue())
+	})
+
+	It("offers the H3 ALPN, if the TLS config doesn't set any", func() {
+		client, err := newClient("localhost:1337", &tls.Config{ServerName: "foo.bar"}, &roundTripperOpts{}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		var dialAddrCalled bool
+		dialAddr = func(_ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+			Expect(tlsConf.NextProtos).To(Equal([]string{nextProtoH3}))
+			dialAddrCalled = true
+			return nil, errors.New("test done")
+		}
+		client.RoundTrip(req)
+		Expect(dialAddrCalled).To(BeTrue())
+	})
+
 	It("uses the custom dialer, if provided", func() {
 		testErr := errors.New("test done")
 		tlsConf := &tls.Config{ServerName: "foo.bar"}
@@ -138,6 +464,92 @@ var _ = Describe("Client", func() {
 		Expect(dialerCalled).To(BeTrue())
 	})
 
+	Context("retrying with the next version", func() {
+		versions := []quic.VersionNumber{protocol.VersionDraft29, protocol.Version1, 0x1337, 0x4242}
+
+		It("retries with the next version, if the version negotiation fails", func() {
+			var offered [][]quic.VersionNumber
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			dialer := func(_, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				offered = append(offered, quicConf.Versions)
+				if len(offered) == 1 {
+					return nil, &quic.VersionNegotiationError{Ours: quicConf.Versions, Theirs: []quic.VersionNumber{0x42}}
+				}
+				return sess, nil
+			}
+			quicConf := &quic.Config{Versions: versions}
+			client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, quicConf, dialer)
+			Expect(err).ToNot(HaveOccurred())
+			testErr := errors.New("test done")
+			sess.EXPECT().OpenUniStream().Return(nil, testErr).MaxTimes(1)
+			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+			sess.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, testErr).MaxTimes(1)
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			sess.EXPECT().OpenStreamSync(gomock.Any()).Return(nil, testErr)
+			_, err = client.RoundTrip(req)
+			Expect(err).To(MatchError(testErr))
+			Expect(offered).To(Equal([][]quic.VersionNumber{versions, versions[1:]}))
+			// the quic.Config passed to the client is not modified
+			Expect(quicConf.Versions).To(Equal(versions))
+		})
+
+		It("retries with the next version, if the server doesn't accept the ALPN", func() {
+			var offered [][]quic.VersionNumber
+			dialer := func(_, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				offered = append(offered, quicConf.Versions)
+				return nil, &quic.TransportError{ErrorCode: 0x100 + 120}
+			}
+			client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, &quic.Config{Versions: versions[:2]}, dialer)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.RoundTrip(req)
+			var transportErr *quic.TransportError
+			Expect(errors.As(err, &transportErr)).To(BeTrue())
+			Expect(offered).To(Equal([][]quic.VersionNumber{versions[:2], versions[1:2]}))
+		})
+
+		It("tries a bounded number of versions", func() {
+			testErr := &quic.TransportError{ErrorCode: 0x100 + 120}
+			var offered [][]quic.VersionNumber
+			dialer := func(_, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				offered = append(offered, quicConf.Versions)
+				return nil, testErr
+			}
+			client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, &quic.Config{Versions: versions}, dialer)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.RoundTrip(req)
+			Expect(err).To(MatchError(testErr))
+			Expect(offered).To(HaveLen(maxVersionAttempts))
+		})
+
+		It("dials an unreachable server only once", func() {
+			testErr := &quic.HandshakeTimeoutError{}
+			var dialed int
+			dialer := func(_, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				dialed++
+				return nil, testErr
+			}
+			client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, &quic.Config{Versions: versions}, dialer)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.RoundTrip(req)
+			Expect(err).To(MatchError(testErr))
+			Expect(dialed).To(Equal(1))
+		})
+
+		It("doesn't retry other errors", func() {
+			testErr := errors.New("test error")
+			var dialed int
+			dialer := func(_, _ string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				dialed++
+				return nil, testErr
+			}
+			client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, &quic.Config{Versions: versions}, dialer)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = client.RoundTrip(req)
+			Expect(err).To(MatchError(testErr))
+			Expect(dialed).To(Equal(1))
+		})
+	})
+
 	It("enables HTTP/3 Datagrams", func() {
 		testErr := errors.New("handshake error")
 		client, err := newClient("localhost:1337", nil, &roundTripperOpts{EnableDatagram: true}, nil, nil)
@@ -150,6 +562,76 @@ var _ = Describe("Client", func() {
 		Expect(err).To(MatchError(testErr))
 	})
 
+	It("disables Path MTU Discovery", func() {
+		testErr := errors.New("handshake error")
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{DisablePathMTUDiscovery: true}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(hostname string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+			Expect(quicConf.DisablePathMTUDiscovery).To(BeTrue())
+			return nil, testErr
+		}
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("uses the token store", func() {
+		testErr := errors.New("handshake error")
+		tokenStore := quic.NewLRUTokenStore(1, 1)
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{TokenStore: tokenStore}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(hostname string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+			Expect(quicConf.TokenStore).To(Equal(tokenStore))
+			return nil, testErr
+		}
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("sets the initial congestion window", func() {
+		testErr := errors.New("handshake error")
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{InitialCongestionWindow: 100}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(hostname string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+			Expect(quicConf.InitialCongestionWindow).To(BeEquivalentTo(100))
+			return nil, testErr
+		}
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("uses the stream scheduler", func() {
+		testErr := errors.New("handshake error")
+		scheduler := &lifoScheduler{}
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{StreamScheduler: scheduler}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(hostname string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+			Expect(quicConf.StreamScheduler).To(Equal(scheduler))
+			return nil, testErr
+		}
+		_, err = client.RoundTrip(req)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("makes the values of the request context available to the tracer", func() {
+		type ctxKey struct{}
+		testErr := errors.New("handshake error")
+		tracer := mocklogging.NewMockTracer(mockCtrl)
+		client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, &quic.Config{Tracer: tracer}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		dialAddr = func(hostname string, _ *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+			quicConf.Tracer.TracerForConnection(context.Background(), logging.PerspectiveClient, nil)
+			return nil, testErr
+		}
+		tracer.EXPECT().TracerForConnection(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _ logging.Perspective, _ logging.ConnectionID) logging.ConnectionTracer {
+				Expect(ctx.Value(ctxKey{})).To(Equal("request ID"))
+				return nil
+			},
+		)
+		_, err = client.RoundTrip(req.WithContext(context.WithValue(context.Background(), ctxKey{}, "request ID")))
+		Expect(err).To(MatchError(testErr))
+	})
+
 	It("errors when dialing fails", func() {
 		testErr := errors.New("handshake error")
 		client, err := newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
@@ -167,6 +649,18 @@ var _ = Describe("Client", func() {
 		Expect(client.Close()).To(Succeed())
 	})
 
+	It("matches content types", func() {
+		types := []string{"image/png", "video/*"}
+		Expect(matchesContentType("image/png", types)).To(BeTrue())
+		Expect(matchesContentType("Image/PNG; charset=binary", types)).To(BeTrue())
+		Expect(matchesContentType("video/mp4", types)).To(BeTrue())
+		Expect(matchesContentType("image/gif", types)).To(BeFalse())
+		Expect(matchesContentType("videos/mp4", types)).To(BeFalse())
+		Expect(matchesContentType("", types)).To(BeFalse())
+		Expect(matchesContentType("invalid;;", types)).To(BeFalse())
+		Expect(matchesContentType("image/png", nil)).To(BeFalse())
+	})
+
 	Context("validating the address", func() {
 		It("refuses to do requests for the wrong host", func() {
 			req, err := http.NewRequest("https", "https://quic.clemente.io:1336/foobar.html", nil)
@@ -187,6 +681,56 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	Context("checking datagram support", func() {
+		var sess *mockquic.MockEarlySession
+
+		BeforeEach(func() {
+			sess = mockquic.NewMockEarlySession(mockCtrl)
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			client.session = sess
+		})
+
+		It("accepts datagrams if the server enabled them on the QUIC and on the HTTP/3 layer", func() {
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{SupportsDatagrams: true})
+			client.settings = &Settings{Datagram: true}
+			close(client.settingsReceived)
+			Expect(client.checkDatagramSupport()).To(Succeed())
+		})
+
+		It("errors if the server didn't enable QUIC datagrams", func() {
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{SupportsDatagrams: false})
+			err := client.checkDatagramSupport()
+			var dgErr *ErrDatagramsNotSupported
+			Expect(errors.As(err, &dgErr)).To(BeTrue())
+			Expect(dgErr.MissingSetting).To(BeFalse())
+			Expect(err).To(MatchError("http3: server didn't enable QUIC datagrams"))
+		})
+
+		It("errors if the server didn't send SETTINGS_H3_DATAGRAM", func() {
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{SupportsDatagrams: true})
+			client.settings = &Settings{}
+			close(client.settingsReceived)
+			err := client.checkDatagramSupport()
+			var dgErr *ErrDatagramsNotSupported
+			Expect(errors.As(err, &dgErr)).To(BeTrue())
+			Expect(dgErr.MissingSetting).To(BeTrue())
+			Expect(err).To(MatchError("http3: server didn't enable HTTP/3 datagrams"))
+		})
+
+		It("waits for the server's SETTINGS frame", func() {
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{SupportsDatagrams: true})
+			errChan := make(chan error, 1)
+			go func() { errChan <- client.checkDatagramSupport() }()
+			Consistently(errChan).ShouldNot(Receive())
+			client.settingsMutex.Lock()
+			client.settings = &Settings{Datagram: true}
+			client.settingsMutex.Unlock()
+			close(client.settingsReceived)
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+	})
+
 	Context("control stream handling", func() {
 		var (
 			request              *http.Request
@@ -235,6 +779,46 @@ var _ = Describe("Client", func() {
 			time.Sleep(scaleDuration(20 * time.Millisecond)) // don't EXPECT any calls to sess.CloseWithError
 		})
 
+		It("records the settings sent by the server", func() {
+			_, ok := client.serverSettings()
+			Expect(ok).To(BeFalse())
+			buf := &bytes.Buffer{}
+			quicvarint.Write(buf, streamTypeControlStream)
+			(&settingsFrame{
+				Datagram: true,
+				other: map[uint64]uint64{
+					settingQPACKMaxTableCapacity: 4096,
+					settingMaxFieldSectionSize:   1337,
+					settingQPACKBlockedStreams:   16,
+					settingEnableConnectProtocol: 1,
+					settingNoRFC7540Priorities:   1,
+					0x42:                         0x1337,
+				},
+			}).Write(buf)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				return controlStr, nil
+			})
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-testDone
+				return nil, errors.New("test done")
+			})
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError("done"))
+			Eventually(func() bool { _, ok := client.serverSettings(); return ok }).Should(BeTrue())
+			settings, _ := client.serverSettings()
+			Expect(settings).To(Equal(Settings{
+				QPACKMaxTableCapacity: 4096,
+				MaxFieldSectionSize:   1337,
+				QPACKBlockedStreams:   16,
+				EnableConnectProtocol: true,
+				NoRFC7540Priorities:   true,
+				Datagram:              true,
+				Other:                 map[uint64]uint64{0x42: 0x1337},
+			}))
+		})
+
 		for _, t := range []uint64{streamTypeQPACKEncoderStream, streamTypeQPACKDecoderStream} {
 			streamType := t
 			name := "encoder"
@@ -358,6 +942,7 @@ var _ = Describe("Client", func() {
 
 		It("errors when the server advertises datagram support (and we enabled support for it)", func() {
 			client.opts.EnableDatagram = true
+			sess.EXPECT().ReceiveMessage().Return(nil, errors.New("done")).AnyTimes()
 			buf := &bytes.Buffer{}
 			quicvarint.Write(buf, streamTypeControlStream)
 			(&settingsFrame{Datagram: true}).Write(buf)
@@ -370,17 +955,202 @@ var _ = Describe("Client", func() {
 				<-testDone
 				return nil, errors.New("test done")
 			})
-			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{SupportsDatagrams: false})
-			done := make(chan struct{})
-			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).Do(func(code quic.ApplicationErrorCode, reason string) {
-				defer GinkgoRecover()
-				Expect(code).To(BeEquivalentTo(errorSettingsError))
-				Expect(reason).To(Equal("missing QUIC Datagram support"))
-				close(done)
-			})
-			_, err := client.RoundTrip(request)
-			Expect(err).To(MatchError("done"))
-			Eventually(done).Should(BeClosed())
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{SupportsDatagrams: false})
+			done := make(chan struct{})
+			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).Do(func(code quic.ApplicationErrorCode, reason string) {
+				defer GinkgoRecover()
+				Expect(code).To(BeEquivalentTo(errorSettingsError))
+				Expect(reason).To(Equal("missing QUIC Datagram support"))
+				close(done)
+			})
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError("done"))
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("Server Push", func() {
+		var (
+			request      *http.Request
+			str          *mockquic.MockStream
+			sess         *mockquic.MockEarlySession
+			controlBuf   *bytes.Buffer
+			settingsDone chan struct{}
+		)
+
+		encodeHeaders := func(headers map[string]string) []byte {
+			buf := &bytes.Buffer{}
+			enc := qpack.NewEncoder(buf)
+			for name, value := range headers {
+				Expect(enc.WriteField(qpack.HeaderField{Name: name, Value: value})).To(Succeed())
+			}
+			Expect(enc.Close()).To(Succeed())
+			return buf.Bytes()
+		}
+
+		writePushPromise := func(buf *bytes.Buffer, pushID uint64, path string) {
+			headerBlock := encodeHeaders(map[string]string{
+				":method":    "GET",
+				":scheme":    "https",
+				":authority": "quic.clemente.io:1337",
+				":path":      path,
+			})
+			(&pushPromiseFrame{PushID: pushID, Length: uint64(len(headerBlock))}).Write(buf)
+			buf.Write(headerBlock)
+		}
+
+		writeResponse := func(buf *bytes.Buffer, status string, body string) {
+			headerBlock := encodeHeaders(map[string]string{":status": status})
+			(&headersFrame{Length: uint64(len(headerBlock))}).Write(buf)
+			buf.Write(headerBlock)
+			if len(body) > 0 {
+				(&dataFrame{Length: uint64(len(body))}).Write(buf)
+				buf.WriteString(body)
+			}
+		}
+
+		BeforeEach(func() {
+			controlBuf = &bytes.Buffer{}
+			settingsDone = make(chan struct{})
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				defer close(settingsDone)
+				return controlBuf.Write(b)
+			})
+			str = mockquic.NewMockStream(mockCtrl)
+			sess = mockquic.NewMockEarlySession(mockCtrl)
+			sess.EXPECT().OpenUniStream().Return(controlStr, nil)
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) { return sess, nil }
+			var err error
+			request, err = http.NewRequest("GET", "https://quic.clemente.io:1337/index.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("refuses pushes by default", func() {
+			buf := &bytes.Buffer{}
+			writePushPromise(buf, 0, "/style.css")
+			writeResponse(buf, "200", "")
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			testDone := make(chan struct{})
+			defer close(testDone)
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-testDone
+				return nil, errors.New("test done")
+			})
+			sess.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorIDError), gomock.Any())
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError("received a PUSH_PROMISE frame, but Server Push is disabled"))
+			Eventually(settingsDone).Should(BeClosed())
+			_, err = quicvarint.Read(controlBuf) // stream type
+			Expect(err).ToNot(HaveOccurred())
+			f, err := parseNextFrame(controlBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(BeAssignableToTypeOf(&settingsFrame{}))
+			Expect(controlBuf.Len()).To(BeZero()) // no MAX_PUSH_ID frame
+		})
+
+		It("delivers pushed responses to the PushHandler", func() {
+			type pushed struct {
+				req *http.Request
+				rsp *http.Response
+			}
+			pushChan := make(chan pushed, 1)
+			client.opts.PushHandler = func(req *http.Request, rsp *http.Response) {
+				pushChan <- pushed{req: req, rsp: rsp}
+			}
+
+			pushBuf := &bytes.Buffer{}
+			quicvarint.Write(pushBuf, streamTypePushStream)
+			quicvarint.Write(pushBuf, 3) // push ID
+			writeResponse(pushBuf, "200", "body {}")
+			pushStr := mockquic.NewMockStream(mockCtrl)
+			pushStr.EXPECT().Read(gomock.Any()).DoAndReturn(pushBuf.Read).AnyTimes()
+			testDone := make(chan struct{})
+			defer close(testDone)
+			sess.EXPECT().AcceptUniStream(gomock.Any()).Return(pushStr, nil)
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-testDone
+				return nil, errors.New("test done")
+			})
+
+			buf := &bytes.Buffer{}
+			writePushPromise(buf, 3, "/style.css")
+			writeResponse(buf, "200", "")
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).Times(2)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			rsp, err := client.RoundTrip(request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+
+			var p pushed
+			Eventually(pushChan).Should(Receive(&p))
+			Expect(p.req.Method).To(Equal(http.MethodGet))
+			Expect(p.req.URL.String()).To(Equal("https://quic.clemente.io:1337/style.css"))
+			Expect(p.rsp.Request).To(Equal(p.req))
+			Expect(p.rsp.StatusCode).To(Equal(200))
+			data, err := ioutil.ReadAll(p.rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("body {}"))
+
+			Eventually(settingsDone).Should(BeClosed())
+			_, err = quicvarint.Read(controlBuf) // stream type
+			Expect(err).ToNot(HaveOccurred())
+			_, err = parseNextFrame(controlBuf) // SETTINGS
+			Expect(err).ToNot(HaveOccurred())
+			t, err := quicvarint.Read(controlBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(BeEquivalentTo(0xd))    // MAX_PUSH_ID
+			_, err = quicvarint.Read(controlBuf) // length
+			Expect(err).ToNot(HaveOccurred())
+			maxID, err := quicvarint.Read(controlBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(maxID).To(BeEquivalentTo(maxPushID))
+		})
+
+		It("errors when two push streams use the same push ID", func() {
+			pushChan := make(chan *http.Response, 2)
+			client.opts.PushHandler = func(_ *http.Request, rsp *http.Response) { pushChan <- rsp }
+
+			newPushStream := func() *mockquic.MockStream {
+				pushBuf := &bytes.Buffer{}
+				quicvarint.Write(pushBuf, streamTypePushStream)
+				quicvarint.Write(pushBuf, 3) // push ID
+				writeResponse(pushBuf, "200", "body {}")
+				pushStr := mockquic.NewMockStream(mockCtrl)
+				pushStr.EXPECT().Read(gomock.Any()).DoAndReturn(pushBuf.Read).AnyTimes()
+				return pushStr
+			}
+			testDone := make(chan struct{})
+			defer close(testDone)
+			sess.EXPECT().AcceptUniStream(gomock.Any()).Return(newPushStream(), nil)
+			sess.EXPECT().AcceptUniStream(gomock.Any()).Return(newPushStream(), nil)
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-testDone
+				return nil, errors.New("test done")
+			})
+			closed := make(chan struct{})
+			sess.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorIDError), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) { close(closed) })
+
+			buf := &bytes.Buffer{}
+			writePushPromise(buf, 3, "/style.css")
+			writeResponse(buf, "200", "")
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+			rsp, err := client.RoundTrip(request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Eventually(pushChan).Should(Receive())
+			Eventually(closed).Should(BeClosed())
+			Consistently(pushChan).ShouldNot(Receive())
 		})
 	})
 
@@ -389,6 +1159,7 @@ var _ = Describe("Client", func() {
 			request              *http.Request
 			str                  *mockquic.MockStream
 			sess                 *mockquic.MockEarlySession
+			controlStr           *mockquic.MockStream
 			settingsFrameWritten chan struct{}
 		)
 		testDone := make(chan struct{})
@@ -437,7 +1208,7 @@ var _ = Describe("Client", func() {
 
 		BeforeEach(func() {
 			settingsFrameWritten = make(chan struct{})
-			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr = mockquic.NewMockStream(mockCtrl)
 			controlStr.EXPECT().Write(gomock.Any()).Do(func(b []byte) {
 				defer GinkgoRecover()
 				r := bytes.NewReader(b)
@@ -473,6 +1244,41 @@ var _ = Describe("Client", func() {
 			Expect(err).To(MatchError(testErr))
 		})
 
+		It("reports when the stream limit is reached", func() {
+			var reported []string
+			client.opts.OnStreamLimitReached = func(host string) { reported = append(reported, host) }
+			testErr := errors.New("stream open error")
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			gomock.InOrder(
+				sess.EXPECT().OpenStream().Return(nil, streamLimitError{}),
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(nil, testErr),
+			)
+			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError(testErr))
+			Expect(reported).To(Equal([]string{"quic.clemente.io:1337"}))
+		})
+
+		It("doesn't wait for a stream, if it should open a new connection when the stream limit is reached", func() {
+			client.opts.OpenConnectionOnStreamLimit = true
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			sess.EXPECT().OpenStream().Return(nil, streamLimitError{})
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError(errStreamLimitReached))
+		})
+
+		It("doesn't report other errors when opening a stream as reaching the stream limit", func() {
+			var reported bool
+			client.opts.OnStreamLimitReached = func(string) { reported = true }
+			testErr := errors.New("stream open error")
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			sess.EXPECT().OpenStream().Return(nil, testErr)
+			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError(testErr))
+			Expect(reported).To(BeFalse())
+		})
+
 		It("performs a 0-RTT request", func() {
 			testErr := errors.New("stream open error")
 			request.Method = MethodGet0RTT
@@ -482,6 +1288,7 @@ var _ = Describe("Client", func() {
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
 			str.EXPECT().Close()
 			str.EXPECT().CancelWrite(gomock.Any())
+			str.EXPECT().CancelRead(gomock.Any())
 			str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
 				return 0, testErr
 			})
@@ -507,6 +1314,176 @@ var _ = Describe("Client", func() {
 			Expect(rsp.StatusCode).To(Equal(418))
 		})
 
+		It("demultiplexes datagrams received for request streams", func() {
+			client.opts.EnableDatagram = true
+			datagrams := make(chan []byte, 2)
+			done := make(chan struct{})
+			defer close(done)
+			sess.EXPECT().ReceiveMessage().DoAndReturn(func() ([]byte, error) {
+				select {
+				case b := <-datagrams:
+					return b, nil
+				case <-done:
+					return nil, errors.New("test done")
+				}
+			}).AnyTimes()
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx).Times(2)
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).Times(2)
+			proxyAddr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 443}
+			sess.EXPECT().RemoteAddr().Return(proxyAddr).Times(2)
+			received := make([]chan []byte, 2)
+			for i := 0; i < 2; i++ {
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().StreamID().Return(quic.StreamID(4 * i)).AnyTimes()
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(bytes.NewBuffer(getResponse(200)).Read).AnyTimes()
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Body).To(BeAssignableToTypeOf(&datagramBody{}))
+				d := rsp.Body.(Datagrammer)
+				Expect(d.DatagramFlowID()).To(BeEquivalentTo(i))
+				Expect(rsp.Body.(TunnelAddrs).RemoteAddr()).To(Equal(proxyAddr))
+				received[i] = make(chan []byte, 1)
+				c := received[i]
+				Expect(d.DatagramMux().Handle(d.DatagramFlowID(), func(b []byte) { c <- b })).To(Succeed())
+			}
+			datagrams <- []byte{1, 'b', 'a', 'r'}
+			datagrams <- []byte{0, 'f', 'o', 'o'}
+			Eventually(received[0]).Should(Receive(Equal([]byte("foo"))))
+			Eventually(received[1]).Should(Receive(Equal([]byte("bar"))))
+		})
+
+		It("counts requests in flight until the response body is closed", func() {
+			rspBuf := bytes.NewBuffer(getResponse(200))
+			gomock.InOrder(
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx),
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+			)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			str.EXPECT().CancelRead(gomock.Any())
+			Expect(client.requestsInFlight()).To(BeZero())
+			rsp, err := client.RoundTrip(request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.requestsInFlight()).To(BeEquivalentTo(1))
+			Expect(rsp.Body.Close()).To(Succeed())
+			Eventually(client.requestsInFlight).Should(BeZero())
+		})
+
+		It("calls the idle callback", func() {
+			const threshold = 50 * time.Millisecond
+			type idleEvent struct {
+				host    string
+				idleFor time.Duration
+				time    time.Time
+			}
+			events := make(chan idleEvent, 10)
+			client.opts.ConnectionIdleThreshold = threshold
+			client.opts.OnConnectionIdle = func(host string, idleFor time.Duration) {
+				events <- idleEvent{host: host, idleFor: idleFor, time: time.Now()}
+			}
+			sessCtx, sessCancel := context.WithCancel(context.Background())
+			defer sessCancel()
+			sess.EXPECT().Context().Return(sessCtx).AnyTimes()
+			rspBuf := bytes.NewBuffer(getResponse(200))
+			gomock.InOrder(
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx),
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+			)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			str.EXPECT().CancelRead(gomock.Any())
+			rsp, err := client.RoundTrip(request)
+			Expect(err).ToNot(HaveOccurred())
+			// the connection is not idle while the request is in flight
+			Consistently(events, 3*threshold).ShouldNot(Receive())
+			closed := time.Now()
+			Expect(rsp.Body.Close()).To(Succeed())
+			var ev idleEvent
+			Eventually(events).Should(Receive(&ev))
+			Expect(ev.host).To(Equal("quic.clemente.io:1337"))
+			Expect(ev.idleFor).To(BeNumerically(">=", threshold))
+			Expect(ev.time.Sub(closed)).To(BeNumerically(">=", threshold))
+			// the callback is called periodically
+			Eventually(events).Should(Receive(&ev))
+			Expect(ev.idleFor).To(BeNumerically(">=", 2*threshold))
+			// the callback is not called after the connection was closed
+			sessCancel()
+			time.Sleep(threshold / 2) // wait for the monitor to return
+			for len(events) > 0 {
+				<-events
+			}
+			Consistently(events, 2*threshold).ShouldNot(Receive())
+		})
+
+		It("sends a PRIORITY_UPDATE frame when the priority is changed", func() {
+			rspBuf := bytes.NewBuffer(getResponse(200))
+			h := &PriorityHandle{priority: Priority{Urgency: DefaultUrgency}}
+			request = request.WithContext(context.WithValue(context.Background(), priorityHandleContextKey, h))
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			gomock.InOrder(
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx),
+				sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil),
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+			)
+			str.EXPECT().StreamID().Return(quic.StreamID(8)).AnyTimes()
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			str.EXPECT().CancelRead(gomock.Any())
+			rsp, err := client.RoundTrip(request)
+			Expect(err).ToNot(HaveOccurred())
+			controlBuf := &bytes.Buffer{}
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(controlBuf.Write)
+			Expect(h.Update(Priority{Urgency: 1, Incremental: true})).To(Succeed())
+			Expect(h.Priority()).To(Equal(Priority{Urgency: 1, Incremental: true}))
+			expected := &bytes.Buffer{}
+			(&priorityUpdateFrame{StreamID: 8, Priority: "u=1, i"}).Write(expected)
+			Expect(controlBuf.Bytes()).To(Equal(expected.Bytes()))
+			Expect(rsp.Body.Close()).To(Succeed())
+		})
+
+		It("closes a draining connection when the requests in flight completed", func() {
+			rspBuf := bytes.NewBuffer(getResponse(200))
+			gomock.InOrder(
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx),
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+			)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			str.EXPECT().CancelRead(gomock.Any())
+			rsp, err := client.RoundTrip(request)
+			Expect(err).ToNot(HaveOccurred())
+			closed := make(chan struct{})
+			sess.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorNoError), "").Do(func(quic.ApplicationErrorCode, string) { close(closed) })
+			client.drain()
+			Consistently(closed).ShouldNot(BeClosed())
+			// no new requests are sent on a draining connection
+			_, err = client.RoundTrip(request)
+			Expect(err).To(MatchError(errConnectionDraining))
+			Expect(rsp.Body.Close()).To(Succeed())
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("closes a draining connection right away if it is idle", func() {
+			gomock.InOrder(
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx),
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(nil, errors.New("test err")),
+			)
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError("test err"))
+			sess.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+			client.drain()
+		})
+
 		Context("requests containing a Body", func() {
 			var strBuf *bytes.Buffer
 
@@ -529,6 +1506,7 @@ var _ = Describe("Client", func() {
 				gomock.InOrder(
 					str.EXPECT().Close().Do(func() { close(done) }),
 					str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1), // when reading the response errors
+					str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1),
 				)
 				// the response body is sent asynchronously, while already reading the response
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
@@ -550,6 +1528,7 @@ var _ = Describe("Client", func() {
 						close(done)
 					}),
 					str.EXPECT().CancelWrite(gomock.Any()),
+					str.EXPECT().CancelRead(gomock.Any()),
 				)
 
 				// the response body is sent asynchronously, while already reading the response
@@ -573,6 +1552,7 @@ var _ = Describe("Client", func() {
 				str.EXPECT().Close().Do(func() { close(done) })
 				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
 				str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1) // when reading the response errors
+				str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1)
 				// the response body is sent asynchronously, while already reading the response
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
 				req, err := client.RoundTrip(request)
@@ -597,6 +1577,7 @@ var _ = Describe("Client", func() {
 				buf := &bytes.Buffer{}
 				(&headersFrame{Length: 1338}).Write(buf)
 				str.EXPECT().CancelWrite(quic.StreamErrorCode(errorFrameError))
+				str.EXPECT().CancelRead(quic.StreamErrorCode(errorFrameError))
 				closed := make(chan struct{})
 				str.EXPECT().Close().Do(func() { close(closed) })
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
@@ -639,6 +1620,7 @@ var _ = Describe("Client", func() {
 					str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) { close(done) }),
 				)
 				str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1)
+				str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1)
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
 					cancel()
 					<-canceled
@@ -670,6 +1652,165 @@ var _ = Describe("Client", func() {
 				cancel()
 				Eventually(done).Should(BeClosed())
 			})
+
+			It("cancels all requests in flight, without closing the session", func() {
+				const num = 3
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+				streams := make(chan quic.Stream, num+1)
+				sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+					return <-streams, nil
+				}).Times(num + 1)
+				errChan := make(chan error, num)
+				for i := 0; i < num; i++ {
+					str := mockquic.NewMockStream(mockCtrl)
+					canceled := make(chan struct{})
+					str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+					str.EXPECT().Close().MaxTimes(1)
+					str.EXPECT().CancelWrite(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) { close(canceled) })
+					str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+					str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).MinTimes(1)
+					str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+					str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+						<-canceled
+						return 0, errors.New("canceled")
+					})
+					streams <- str
+					go func() {
+						_, err := client.RoundTrip(request)
+						errChan <- err
+					}()
+				}
+				Eventually(client.requestsInFlight).Should(BeEquivalentTo(num))
+				Consistently(errChan).ShouldNot(Receive())
+				client.cancelAll()
+				for i := 0; i < num; i++ {
+					Eventually(errChan).Should(Receive(Equal(ErrRequestCanceled)))
+				}
+
+				// the session is still used for new requests
+				rspBuf := bytes.NewBuffer(getResponse(200))
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				streams <- str
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+			})
+
+			It("resets the stream when the response headers aren't received in time", func() {
+				const timeout = 50 * time.Millisecond
+				client.opts.ResponseHeaderTimeout = scaleDuration(timeout)
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				canceled := make(chan struct{})
+				var once sync.Once
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(errorRequestCanceled)).MinTimes(1)
+				str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) {
+					once.Do(func() { close(canceled) })
+				}).MinTimes(1)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+					<-canceled
+					return 0, errors.New("stream canceled")
+				})
+				start := time.Now()
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(&ErrResponseHeaderTimeout{Duration: scaleDuration(timeout)}))
+				Expect(time.Since(start)).To(BeNumerically(">=", scaleDuration(timeout)))
+			})
+
+			It("doesn't time out after the response headers were received", func() {
+				const timeout = 50 * time.Millisecond
+				client.opts.ResponseHeaderTimeout = scaleDuration(timeout)
+				rspBuf := bytes.NewBuffer(getResponse(200))
+				(&dataFrame{Length: 6}).Write(rspBuf)
+				rspBuf.Write([]byte("foobar"))
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				// the mock would fail on calls to CancelRead and CancelWrite
+				time.Sleep(scaleDuration(2 * timeout))
+				data, err := io.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal("foobar"))
+			})
+
+			It("resets the stream when the response body is abandoned", func() {
+				const idleTimeout = 50 * time.Millisecond
+				client.opts.BodyIdleTimeout = scaleDuration(idleTimeout)
+				rspBuf := bytes.NewBuffer(getResponse(200))
+				(&dataFrame{Length: 6}).Write(rspBuf)
+				rspBuf.Write([]byte("foobar"))
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				str.EXPECT().Close()
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				done := make(chan struct{})
+				str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) { close(done) })
+				start := time.Now()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.requestsInFlight()).To(BeEquivalentTo(1))
+				Eventually(done).Should(BeClosed())
+				Expect(time.Since(start)).To(BeNumerically(">=", scaleDuration(idleTimeout)))
+				Eventually(client.requestsInFlight).Should(BeZero())
+				_, err = rsp.Body.Read([]byte{0})
+				Expect(err).To(MatchError(&ResponseBodyAbandonedError{IdleTimeout: scaleDuration(idleTimeout)}))
+			})
+
+			It("resets the stream when no body data is received while reading", func() {
+				const readTimeout = 50 * time.Millisecond
+				client.opts.IdleReadTimeout = scaleDuration(readTimeout)
+				rspBuf := bytes.NewBuffer(getResponse(200))
+				(&dataFrame{Length: 6}).Write(rspBuf)
+				rspBuf.Write([]byte("foo")) // the server pauses in the middle of the body
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				str.EXPECT().Close()
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				canceled := make(chan struct{})
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+					if rspBuf.Len() > 0 {
+						return rspBuf.Read(b)
+					}
+					<-canceled
+					return 0, errors.New("stream canceled")
+				}).AnyTimes()
+				var once sync.Once
+				str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) {
+					once.Do(func() { close(canceled) })
+				}).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				// Waiting before reading doesn't count towards the timeout.
+				time.Sleep(scaleDuration(2 * readTimeout))
+				b := make([]byte, 6)
+				n, err := rsp.Body.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(b[:n])).To(Equal("foo"))
+				start := time.Now()
+				_, err = rsp.Body.Read(b)
+				Expect(err).To(MatchError(&ResponseBodyReadTimeoutError{Duration: scaleDuration(readTimeout)}))
+				var nerr net.Error
+				Expect(errors.As(err, &nerr)).To(BeTrue())
+				Expect(nerr.Timeout()).To(BeTrue())
+				Expect(time.Since(start)).To(And(
+					BeNumerically(">=", scaleDuration(readTimeout)),
+					BeNumerically("<", scaleDuration(3*readTimeout)),
+				))
+				Eventually(client.requestsInFlight).Should(BeZero())
+			})
 		})
 
 		Context("gzip compression", func() {
@@ -684,6 +1825,7 @@ var _ = Describe("Client", func() {
 				gomock.InOrder(
 					str.EXPECT().Close(),
 					str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1), // when the Read errors
+					str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1),
 				)
 				str.EXPECT().Read(gomock.Any()).Return(0, errors.New("test done"))
 				_, err := client.RoundTrip(request)
@@ -701,6 +1843,7 @@ var _ = Describe("Client", func() {
 				gomock.InOrder(
 					str.EXPECT().Close(),
 					str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1), // when the Read errors
+					str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1),
 				)
 				str.EXPECT().Read(gomock.Any()).Return(0, errors.New("test done"))
 				_, err = client.RoundTrip(request)
@@ -735,6 +1878,65 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Uncompressed).To(BeTrue())
 			})
 
+			gzipResponse := func(contentType string) (*bytes.Buffer, []byte) {
+				buf := &bytes.Buffer{}
+				rstr := mockquic.NewMockStream(mockCtrl)
+				rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
+				rw := newResponseWriter(rstr, utils.DefaultLogger)
+				rw.Header().Set("Content-Encoding", "gzip")
+				if contentType != "" {
+					rw.Header().Set("Content-Type", contentType)
+				}
+				compressed := &bytes.Buffer{}
+				gz := gzip.NewWriter(compressed)
+				gz.Write([]byte("gzipped response"))
+				gz.Close()
+				rw.Write(compressed.Bytes())
+				rw.Flush()
+				return buf, compressed.Bytes()
+			}
+
+			It("doesn't request compression for Range requests, and doesn't decompress the response", func() {
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				rspBuf, compressed := gzipResponse("")
+				reqBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				str.EXPECT().Close()
+
+				request.Header.Set("Range", "bytes=0-")
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(decodeHeader(reqBuf)).ToNot(HaveKey("accept-encoding"))
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(compressed))
+				Expect(rsp.Header.Get("Content-Encoding")).To(Equal("gzip"))
+				Expect(rsp.Uncompressed).To(BeFalse())
+			})
+
+			It("doesn't decompress responses with content types that decompression is disabled for", func() {
+				client, err := newClient("quic.clemente.io:1337", nil, &roundTripperOpts{NoDecompressionContentTypes: []string{"image/png", "video/*"}}, nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				rspBuf, compressed := gzipResponse("video/mp4")
+				reqBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				str.EXPECT().Close()
+
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(decodeHeader(reqBuf)).To(HaveKeyWithValue("accept-encoding", "gzip"))
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(compressed))
+				Expect(rsp.Header.Get("Content-Encoding")).To(Equal("gzip"))
+				Expect(rsp.Uncompressed).To(BeFalse())
+			})
+
 			It("only decompresses the response if the response contains the right content-encoding header", func() {
 				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
 				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
@@ -756,5 +1958,81 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Header.Get("Content-Encoding")).To(BeEmpty())
 			})
 		})
+
+		Context("zstd compression", func() {
+			zstdResponse := func(data []byte) *bytes.Buffer {
+				buf := &bytes.Buffer{}
+				rstr := mockquic.NewMockStream(mockCtrl)
+				rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
+				rw := newResponseWriter(rstr, utils.DefaultLogger)
+				rw.Header().Set("Content-Encoding", "zstd")
+				zw, err := zstd.NewWriter(rw)
+				Expect(err).ToNot(HaveOccurred())
+				zw.Write(data)
+				Expect(zw.Close()).To(Succeed())
+				rw.Flush()
+				return buf
+			}
+
+			BeforeEach(func() {
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+				var err error
+				client, err = newClient("quic.clemente.io:1337", nil, &roundTripperOpts{EnableZstd: true}, nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("adds zstd to the accept-encoding header", func() {
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				buf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write)
+				gomock.InOrder(
+					str.EXPECT().Close(),
+					str.EXPECT().CancelWrite(gomock.Any()).MaxTimes(1), // when the Read errors
+					str.EXPECT().CancelRead(gomock.Any()).MaxTimes(1),
+				)
+				str.EXPECT().Read(gomock.Any()).Return(0, errors.New("test done"))
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError("test done"))
+				hfs := decodeHeader(buf)
+				Expect(hfs).To(HaveKeyWithValue("accept-encoding", "zstd, gzip"))
+			})
+
+			It("decompresses the response", func() {
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				buf := zstdResponse([]byte("zstd-compressed response"))
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().Close()
+
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.ContentLength).To(BeEquivalentTo(-1))
+				Expect(string(data)).To(Equal("zstd-compressed response"))
+				Expect(rsp.Header.Get("Content-Encoding")).To(BeEmpty())
+				Expect(rsp.Uncompressed).To(BeTrue())
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(rsp.Body.Close()).To(Succeed())
+			})
+
+			It("doesn't decompress the response, if zstd is disabled", func() {
+				var err error
+				client, err = newClient("quic.clemente.io:1337", nil, &roundTripperOpts{}, nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				sess.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				buf := zstdResponse([]byte("zstd-compressed response"))
+				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().Close()
+
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Header.Get("Content-Encoding")).To(Equal("zstd"))
+				Expect(rsp.Uncompressed).To(BeFalse())
+			})
+		})
 	})
 })
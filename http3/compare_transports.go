@@ -0,0 +1,79 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CompareTransports sends req using both HTTP/3 and TCP, e.g. for tooling that measures the latency of both transports.
+// Unlike ConnectionDiscoveryHappyEyeballs, the requests don't race: Both are sent at the same time, and both run to completion.
+// h3Dur and tcpDur are the times from sending the respective request until its response headers were received,
+// or until it failed.
+// The HTTP/3 request uses the cached QUIC connection to the host, if there is one, and it isn't retried.
+// The TCP request uses a new connection, like a request that falls back to TCP. The Alt-Svc header of its response isn't cached.
+// The body of req must be replayable (see http.Request.GetBody), since it is sent twice.
+// If one of the requests fails, err is non-nil, and the response of the other request is still returned.
+// The caller is responsible for closing the bodies of the returned responses.
+// The request metrics (e.g. MetricsHandshakeDone) are not updated.
+func (r *RoundTripper) CompareTransports(ctx context.Context, req *http.Request) (h3Res, tcpRes *http.Response, h3Dur, tcpDur time.Duration, err error) {
+	if req.URL == nil || req.URL.Host == "" {
+		closeRequestBody(req)
+		return nil, nil, 0, 0, errors.New("http3: no Host in request URL")
+	}
+	if !canRewindRequest(req) {
+		closeRequestBody(req)
+		return nil, nil, 0, 0, errors.New("http3: comparing transports requires a request body that can be sent again")
+	}
+	h3Req, err := rewindRequest(req)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	tcpReq, err := rewindRequest(req)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	hostname := authorityAddr("https", hostnameFromRequest(req))
+	cl, err := r.getClient(hostname, RoundTripOpt{})
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	quicClient, ok := cl.(*client)
+	if !ok {
+		return nil, nil, 0, 0, errors.New("http3: client is not http3.client")
+	}
+	tcpClient := &http.Client{
+		Transport:     r.newTCPTransport(RoundTripOpt{}),
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var h3Err, tcpErr error
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		h3Res, _, h3Err = r.roundTripOnClient(h3Req.Clone(ctx), hostname, RoundTripOpt{}, quicClient)
+		h3Dur = time.Since(start)
+	}()
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		tcpRes, tcpErr = tcpClient.Do(tcpRequest(tcpReq.Clone(ctx)))
+		tcpDur = time.Since(start)
+	}()
+	wg.Wait()
+
+	switch {
+	case h3Err != nil && tcpErr != nil:
+		err = fmt.Errorf("http3: HTTP/3 request failed: %w, TCP request failed: %s", h3Err, tcpErr)
+	case h3Err != nil:
+		err = fmt.Errorf("http3: HTTP/3 request failed: %w", h3Err)
+	case tcpErr != nil:
+		err = fmt.Errorf("http3: TCP request failed: %w", tcpErr)
+	}
+	return h3Res, tcpRes, h3Dur, tcpDur, err
+}
@@ -0,0 +1,42 @@
+package http3
+
+import (
+	"context"
+
+	"github.com/lucas-clemente/quic-go/logging"
+)
+
+// connContextTracer wraps the logging.Tracer of the quic.Config,
+// such that the context passed to TracerForConnection carries the values of the context
+// that the connection was dialed for, i.e. the context of the first request or of the Warmup call.
+// This allows correlating connections with requests, e.g. using a request ID.
+type connContextTracer struct {
+	logging.Tracer
+	ctx context.Context
+}
+
+var _ logging.Tracer = &connContextTracer{}
+
+func (t *connContextTracer) TracerForConnection(ctx context.Context, p logging.Perspective, odcid logging.ConnectionID) logging.ConnectionTracer {
+	return t.Tracer.TracerForConnection(&valuesContext{Context: ctx, values: t.ctx}, p, odcid)
+}
+
+// valuesContext is a context.Context that falls back to the values of another context.
+// Cancellation and deadlines are determined by the embedded context only.
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c *valuesContext) Value(key interface{}) interface{} {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+	return c.values.Value(key)
+}
+
+// detachContext returns a context that carries the values of ctx, but that is never canceled and has no deadline.
+// The connection is shared by all requests, so it must outlive the request that triggered dialing.
+func detachContext(ctx context.Context) context.Context {
+	return &valuesContext{Context: context.Background(), values: ctx}
+}
@@ -0,0 +1,73 @@
+package http3
+
+import (
+	"context"
+	"time"
+
+	mocklogging "github.com/lucas-clemente/quic-go/internal/mocks/logging"
+	"github.com/lucas-clemente/quic-go/logging"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection Context Tracer", func() {
+	type ctxKey string
+
+	It("adds the values of the dialing context", func() {
+		tracer := mocklogging.NewMockTracer(mockCtrl)
+		dialCtx := context.WithValue(context.Background(), ctxKey("request ID"), "foobar")
+		t := &connContextTracer{Tracer: tracer, ctx: dialCtx}
+		connCtx := context.WithValue(context.Background(), ctxKey("connection"), "conn")
+		connID := logging.ConnectionID{1, 2, 3, 4}
+		tracer.EXPECT().TracerForConnection(gomock.Any(), logging.PerspectiveClient, connID).DoAndReturn(
+			func(ctx context.Context, _ logging.Perspective, _ logging.ConnectionID) logging.ConnectionTracer {
+				Expect(ctx.Value(ctxKey("request ID"))).To(Equal("foobar"))
+				Expect(ctx.Value(ctxKey("connection"))).To(Equal("conn"))
+				Expect(ctx.Value(ctxKey("unknown"))).To(BeNil())
+				return nil
+			},
+		)
+		Expect(t.TracerForConnection(connCtx, logging.PerspectiveClient, connID)).To(BeNil())
+	})
+
+	It("prefers the values of the connection context", func() {
+		tracer := mocklogging.NewMockTracer(mockCtrl)
+		dialCtx := context.WithValue(context.Background(), ctxKey("key"), "dial")
+		t := &connContextTracer{Tracer: tracer, ctx: dialCtx}
+		connCtx := context.WithValue(context.Background(), ctxKey("key"), "conn")
+		tracer.EXPECT().TracerForConnection(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _ logging.Perspective, _ logging.ConnectionID) logging.ConnectionTracer {
+				Expect(ctx.Value(ctxKey("key"))).To(Equal("conn"))
+				return nil
+			},
+		)
+		t.TracerForConnection(connCtx, logging.PerspectiveClient, nil)
+	})
+
+	It("doesn't propagate the cancellation of the dialing context", func() {
+		tracer := mocklogging.NewMockTracer(mockCtrl)
+		dialCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+		t := &connContextTracer{Tracer: tracer, ctx: dialCtx}
+		tracer.EXPECT().TracerForConnection(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _ logging.Perspective, _ logging.ConnectionID) logging.ConnectionTracer {
+				Expect(ctx.Err()).ToNot(HaveOccurred())
+				return nil
+			},
+		)
+		t.TracerForConnection(context.Background(), logging.PerspectiveClient, nil)
+	})
+
+	It("detaches the values from the cancellation and the deadline of a context", func() {
+		ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey("key"), "value"), time.Hour)
+		cancel()
+		detached := detachContext(ctx)
+		Expect(detached.Value(ctxKey("key"))).To(Equal("value"))
+		Expect(detached.Err()).ToNot(HaveOccurred())
+		Expect(detached.Done()).To(BeNil())
+		_, ok := detached.Deadline()
+		Expect(ok).To(BeFalse())
+	})
+})
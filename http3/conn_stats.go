@@ -0,0 +1,130 @@
+package http3
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+)
+
+// ConnectionStats are statistics of a QUIC connection, see RoundTripper.ConnectionStats.
+type ConnectionStats struct {
+	// SmoothedRTT, LatestRTT and MinRTT are the RTT estimates of the connection.
+	// They are zero until the first RTT sample was taken.
+	SmoothedRTT time.Duration
+	LatestRTT   time.Duration
+	MinRTT      time.Duration
+	// CongestionWindow is the current congestion window, in bytes.
+	CongestionWindow int64
+	// BytesInFlight is the number of bytes sent that were neither acknowledged nor declared lost yet.
+	BytesInFlight int64
+
+	PacketsSent     uint64
+	PacketsReceived uint64
+	// PacketsLost is the number of packets that were declared lost.
+	PacketsLost   uint64
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+// connStats collects the ConnectionStats of a connection.
+// It is a logging.ConnectionTracer, and is therefore called from the QUIC connection's run loop.
+type connStats struct {
+	mutex sync.Mutex
+	stats ConnectionStats
+}
+
+var (
+	_ logging.Tracer           = &connStatsTracer{}
+	_ logging.ConnectionTracer = &connStats{}
+)
+
+func newConnStats() *connStats {
+	return &connStats{}
+}
+
+// get returns a snapshot of the statistics.
+func (s *connStats) get() ConnectionStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stats
+}
+
+func (s *connStats) SentPacket(_ *logging.ExtendedHeader, size logging.ByteCount, _ *logging.AckFrame, _ []logging.Frame) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stats.PacketsSent++
+	s.stats.BytesSent += uint64(size)
+}
+
+func (s *connStats) ReceivedPacket(_ *logging.ExtendedHeader, size logging.ByteCount, _ []logging.Frame) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stats.PacketsReceived++
+	s.stats.BytesReceived += uint64(size)
+}
+
+func (s *connStats) UpdatedMetrics(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, _ int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stats.SmoothedRTT = rttStats.SmoothedRTT()
+	s.stats.LatestRTT = rttStats.LatestRTT()
+	s.stats.MinRTT = rttStats.MinRTT()
+	s.stats.CongestionWindow = int64(cwnd)
+	s.stats.BytesInFlight = int64(bytesInFlight)
+}
+
+func (s *connStats) LostPacket(logging.EncryptionLevel, logging.PacketNumber, logging.PacketLossReason) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stats.PacketsLost++
+}
+
+func (s *connStats) StartedConnection(local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
+}
+
+func (s *connStats) NegotiatedVersion(chosen logging.VersionNumber, clientVersions, serverVersions []logging.VersionNumber) {
+}
+func (s *connStats) ClosedConnection(error)                                                    {}
+func (s *connStats) SentTransportParameters(*logging.TransportParameters)                      {}
+func (s *connStats) ReceivedTransportParameters(*logging.TransportParameters)                  {}
+func (s *connStats) RestoredTransportParameters(*logging.TransportParameters)                  {}
+func (s *connStats) ReceivedVersionNegotiationPacket(*logging.Header, []logging.VersionNumber) {}
+func (s *connStats) ReceivedRetry(*logging.Header)                                             {}
+func (s *connStats) BufferedPacket(logging.PacketType)                                         {}
+func (s *connStats) DroppedPacket(logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
+func (s *connStats) AcknowledgedPacket(logging.EncryptionLevel, logging.PacketNumber)   {}
+func (s *connStats) UpdatedCongestionState(logging.CongestionState)                     {}
+func (s *connStats) UpdatedPTOCount(value uint32)                                       {}
+func (s *connStats) UpdatedKeyFromTLS(logging.EncryptionLevel, logging.Perspective)     {}
+func (s *connStats) UpdatedKey(generation logging.KeyPhase, remote bool)                {}
+func (s *connStats) DroppedEncryptionLevel(logging.EncryptionLevel)                     {}
+func (s *connStats) DroppedKey(logging.KeyPhase)                                        {}
+func (s *connStats) SetLossTimer(logging.TimerType, logging.EncryptionLevel, time.Time) {}
+func (s *connStats) LossTimerExpired(logging.TimerType, logging.EncryptionLevel)        {}
+func (s *connStats) LossTimerCanceled()                                                 {}
+func (s *connStats) ReceivedPathChallenge([8]byte)                                      {}
+func (s *connStats) Close()                                                             {}
+func (s *connStats) Debug(string, string)                                               {}
+
+// connStatsTracer is a logging.Tracer that returns the connStats for the connection.
+// A client only dials a single connection, so the same connStats is returned for every connection.
+type connStatsTracer struct {
+	stats *connStats
+}
+
+func (t *connStatsTracer) TracerForConnection(context.Context, logging.Perspective, logging.ConnectionID) logging.ConnectionTracer {
+	return t.stats
+}
+func (t *connStatsTracer) SentPacket(net.Addr, *logging.Header, logging.ByteCount, []logging.Frame) {
+}
+func (t *connStatsTracer) DroppedPacket(net.Addr, logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
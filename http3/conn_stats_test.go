@@ -0,0 +1,66 @@
+package http3
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection Statistics", func() {
+	It("counts sent, received and lost packets", func() {
+		s := newConnStats()
+		s.SentPacket(&logging.ExtendedHeader{}, 1200, nil, nil)
+		s.SentPacket(&logging.ExtendedHeader{}, 100, nil, nil)
+		s.ReceivedPacket(&logging.ExtendedHeader{}, 1000, nil)
+		s.LostPacket(logging.Encryption1RTT, 1, logging.PacketLossReorderingThreshold)
+		stats := s.get()
+		Expect(stats.PacketsSent).To(BeEquivalentTo(2))
+		Expect(stats.BytesSent).To(BeEquivalentTo(1300))
+		Expect(stats.PacketsReceived).To(BeEquivalentTo(1))
+		Expect(stats.BytesReceived).To(BeEquivalentTo(1000))
+		Expect(stats.PacketsLost).To(BeEquivalentTo(1))
+	})
+
+	It("records the RTT and the congestion controller state", func() {
+		s := newConnStats()
+		rttStats := &logging.RTTStats{}
+		rttStats.UpdateRTT(50*time.Millisecond, 0, time.Now())
+		rttStats.UpdateRTT(30*time.Millisecond, 0, time.Now())
+		s.UpdatedMetrics(rttStats, 12000, 3000, 3)
+		stats := s.get()
+		Expect(stats.SmoothedRTT).To(Equal(rttStats.SmoothedRTT()))
+		Expect(stats.LatestRTT).To(Equal(30 * time.Millisecond))
+		Expect(stats.MinRTT).To(Equal(30 * time.Millisecond))
+		Expect(stats.CongestionWindow).To(BeEquivalentTo(12000))
+		Expect(stats.BytesInFlight).To(BeEquivalentTo(3000))
+	})
+
+	It("returns the same collector for every connection", func() {
+		s := newConnStats()
+		t := &connStatsTracer{stats: s}
+		Expect(t.TracerForConnection(context.Background(), logging.PerspectiveClient, nil)).To(Equal(s))
+	})
+
+	It("only reports statistics once the connection was dialed", func() {
+		cl, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{EnableConnectionStats: true}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, ok := cl.connectionStats()
+		Expect(ok).To(BeFalse())
+		cl.stats.SentPacket(&logging.ExtendedHeader{}, 1200, nil, nil)
+		stats, ok := cl.connectionStats()
+		Expect(ok).To(BeTrue())
+		Expect(stats.PacketsSent).To(BeEquivalentTo(1))
+	})
+
+	It("doesn't report statistics if they're not enabled", func() {
+		cl, err := newClient("quic.clemente.io:443", nil, &roundTripperOpts{}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.stats).To(BeNil())
+		_, ok := cl.connectionStats()
+		Expect(ok).To(BeFalse())
+	})
+})
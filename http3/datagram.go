@@ -0,0 +1,188 @@
+package http3
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// DatagramFlowID returns the flow ID of the HTTP/3 datagrams associated with a request stream.
+// This is the quarter stream ID, see section 2.1 of RFC 9297.
+func DatagramFlowID(id quic.StreamID) uint64 {
+	return uint64(id) / 4
+}
+
+// A DatagramHandler is called for every HTTP/3 datagram received for a flow ID.
+// The payload doesn't include the flow ID.
+type DatagramHandler func(payload []byte)
+
+// Datagrammer is implemented by the response bodies returned by the RoundTripper,
+// and by the http.ResponseWriter passed to the Server's handlers,
+// if HTTP/3 datagrams are enabled (using EnableDatagrams).
+// Note that the response body is wrapped, and doesn't implement Datagrammer,
+// if the RoundTripper transparently decompresses it.
+type Datagrammer interface {
+	// DatagramFlowID returns the flow ID associated with the request stream.
+	DatagramFlowID() uint64
+	// DatagramMux returns the DatagramMux of the connection.
+	DatagramMux() *DatagramMux
+}
+
+// TunnelAddrs is implemented by the Datagrammers, i.e. by the streams of requests that tunnel datagrams,
+// such as CONNECT-UDP requests to a MASQUE proxy.
+// It reports the addresses of the QUIC connection that carries the tunnel.
+// On the client side, the remote address is the address of the proxy.
+// The target sees the proxy's address as the client address, see AppendForwarded for passing on the original one.
+type TunnelAddrs interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+type addrSession interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// datagramBody is the body of a response, if HTTP/3 datagrams are enabled.
+type datagramBody struct {
+	*body
+	mux  *DatagramMux
+	sess addrSession
+}
+
+var (
+	_ Datagrammer = &datagramBody{}
+	_ TunnelAddrs = &datagramBody{}
+)
+
+func (b *datagramBody) DatagramFlowID() uint64    { return DatagramFlowID(b.str.StreamID()) }
+func (b *datagramBody) DatagramMux() *DatagramMux { return b.mux }
+func (b *datagramBody) LocalAddr() net.Addr       { return b.sess.LocalAddr() }
+func (b *datagramBody) RemoteAddr() net.Addr      { return b.sess.RemoteAddr() }
+
+// datagramResponseWriter is passed to the Server's handlers, if HTTP/3 datagrams are enabled.
+type datagramResponseWriter struct {
+	*responseWriter
+	mux  *DatagramMux
+	sess addrSession
+}
+
+var (
+	_ Datagrammer = &datagramResponseWriter{}
+	_ TunnelAddrs = &datagramResponseWriter{}
+)
+
+func (w *datagramResponseWriter) DatagramFlowID() uint64 {
+	return DatagramFlowID(w.stream.StreamID())
+}
+func (w *datagramResponseWriter) DatagramMux() *DatagramMux { return w.mux }
+func (w *datagramResponseWriter) LocalAddr() net.Addr       { return w.sess.LocalAddr() }
+func (w *datagramResponseWriter) RemoteAddr() net.Addr      { return w.sess.RemoteAddr() }
+
+// ErrDatagramsNotSupported is returned when sending an HTTP/3 datagram,
+// if the server didn't enable datagram support.
+// This can happen on the QUIC layer (if the server didn't send the max_datagram_frame_size transport parameter),
+// or on the HTTP/3 layer (if the server didn't send SETTINGS_H3_DATAGRAM).
+type ErrDatagramsNotSupported struct {
+	// MissingSetting is set if QUIC datagrams were negotiated, but the server didn't send SETTINGS_H3_DATAGRAM.
+	MissingSetting bool
+}
+
+func (e *ErrDatagramsNotSupported) Error() string {
+	if e.MissingSetting {
+		return "http3: server didn't enable HTTP/3 datagrams"
+	}
+	return "http3: server didn't enable QUIC datagrams"
+}
+
+type datagramSession interface {
+	SendMessage([]byte) error
+	ReceiveMessage() ([]byte, error)
+}
+
+// A DatagramMux sends HTTP/3 datagrams on a connection,
+// and demultiplexes the datagrams it receives to handlers, by their flow ID.
+// Datagrams for flow IDs that no handler is registered for are dropped.
+type DatagramMux struct {
+	sess datagramSession
+	// checkSupport checks that the peer supports datagrams before sending a datagram.
+	// It is nil if the peer's support isn't checked.
+	checkSupport func() error
+
+	mutex    sync.Mutex
+	handlers map[uint64]DatagramHandler
+}
+
+func newDatagramMux(sess datagramSession) *DatagramMux {
+	return &DatagramMux{
+		sess:     sess,
+		handlers: make(map[uint64]DatagramHandler),
+	}
+}
+
+// Handle registers the handler for a flow ID.
+// It errors if a handler is already registered for this flow ID.
+func (m *DatagramMux) Handle(flowID uint64, handler DatagramHandler) error {
+	if flowID > quicvarint.Max {
+		return fmt.Errorf("http3: invalid datagram flow ID %d", flowID)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.handlers[flowID]; ok {
+		return fmt.Errorf("http3: a handler for datagram flow ID %d is already registered", flowID)
+	}
+	m.handlers[flowID] = handler
+	return nil
+}
+
+// RemoveHandler removes the handler for a flow ID.
+func (m *DatagramMux) RemoveHandler(flowID uint64) {
+	m.mutex.Lock()
+	delete(m.handlers, flowID)
+	m.mutex.Unlock()
+}
+
+// SendDatagram sends a datagram for a flow ID.
+// On the client side, it returns an ErrDatagramsNotSupported if the server didn't enable datagram support.
+// If the server's SETTINGS frame wasn't received yet, it blocks until it is received.
+func (m *DatagramMux) SendDatagram(flowID uint64, payload []byte) error {
+	if flowID > quicvarint.Max {
+		return fmt.Errorf("http3: invalid datagram flow ID %d", flowID)
+	}
+	if m.checkSupport != nil {
+		if err := m.checkSupport(); err != nil {
+			return err
+		}
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, int(quicvarint.Len(flowID))+len(payload)))
+	quicvarint.Write(buf, flowID)
+	buf.Write(payload)
+	return m.sess.SendMessage(buf.Bytes())
+}
+
+// run receives datagrams, until the connection is closed.
+func (m *DatagramMux) run() {
+	for {
+		data, err := m.sess.ReceiveMessage()
+		if err != nil {
+			return
+		}
+		r := bytes.NewReader(data)
+		flowID, err := quicvarint.Read(r)
+		if err != nil {
+			// TODO: close the connection with H3_DATAGRAM_ERROR
+			continue
+		}
+		m.mutex.Lock()
+		handler, ok := m.handlers[flowID]
+		m.mutex.Unlock()
+		if ok {
+			handler(data[len(data)-r.Len():])
+		}
+	}
+}
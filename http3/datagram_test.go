@@ -0,0 +1,91 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/golang/mock/gomock"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Datagrams", func() {
+	var (
+		sess *mockquic.MockEarlySession
+		mux  *DatagramMux
+	)
+
+	BeforeEach(func() {
+		sess = mockquic.NewMockEarlySession(mockCtrl)
+		mux = newDatagramMux(sess)
+	})
+
+	It("uses the quarter stream ID as the flow ID", func() {
+		Expect(DatagramFlowID(0)).To(BeZero())
+		Expect(DatagramFlowID(4)).To(BeEquivalentTo(1))
+		Expect(DatagramFlowID(400)).To(BeEquivalentTo(100))
+	})
+
+	It("sends datagrams", func() {
+		sess.EXPECT().SendMessage(gomock.Any()).DoAndReturn(func(b []byte) error {
+			r := bytes.NewReader(b)
+			flowID, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(flowID).To(BeEquivalentTo(1337))
+			Expect(b[len(b)-r.Len():]).To(Equal([]byte("foobar")))
+			return nil
+		})
+		Expect(mux.SendDatagram(1337, []byte("foobar"))).To(Succeed())
+	})
+
+	It("doesn't send datagrams if the peer doesn't support them", func() {
+		mux.checkSupport = func() error { return &ErrDatagramsNotSupported{MissingSetting: true} }
+		err := mux.SendDatagram(1337, []byte("foobar"))
+		Expect(err).To(MatchError(&ErrDatagramsNotSupported{MissingSetting: true}))
+	})
+
+	It("errors when sending datagrams for invalid flow IDs", func() {
+		Expect(mux.SendDatagram(quicvarint.Max+1, []byte("foobar"))).To(MatchError("http3: invalid datagram flow ID 4611686018427387904"))
+	})
+
+	It("demultiplexes datagrams by their flow ID", func() {
+		received := make(map[uint64][][]byte)
+		for _, flowID := range []uint64{0, 1} {
+			flowID := flowID
+			Expect(mux.Handle(flowID, func(b []byte) { received[flowID] = append(received[flowID], b) })).To(Succeed())
+		}
+		gomock.InOrder(
+			sess.EXPECT().ReceiveMessage().Return([]byte{0, 'f', 'o', 'o'}, nil),
+			sess.EXPECT().ReceiveMessage().Return([]byte{1, 'b', 'a', 'r'}, nil),
+			sess.EXPECT().ReceiveMessage().Return([]byte{2, 'b', 'a', 'z'}, nil), // no handler registered
+			sess.EXPECT().ReceiveMessage().Return([]byte{0x40}, nil),             // invalid varint
+			sess.EXPECT().ReceiveMessage().Return([]byte{1, 'r', 'a', 'b'}, nil),
+			sess.EXPECT().ReceiveMessage().Return(nil, errors.New("done")),
+		)
+		mux.run()
+		Expect(received).To(Equal(map[uint64][][]byte{
+			0: {[]byte("foo")},
+			1: {[]byte("bar"), []byte("rab")},
+		}))
+	})
+
+	It("removes handlers", func() {
+		var called bool
+		Expect(mux.Handle(42, func([]byte) { called = true })).To(Succeed())
+		mux.RemoveHandler(42)
+		gomock.InOrder(
+			sess.EXPECT().ReceiveMessage().Return([]byte{42, 'f', 'o', 'o'}, nil),
+			sess.EXPECT().ReceiveMessage().Return(nil, errors.New("done")),
+		)
+		mux.run()
+		Expect(called).To(BeFalse())
+	})
+
+	It("refuses to register two handlers for the same flow ID", func() {
+		Expect(mux.Handle(42, func([]byte) {})).To(Succeed())
+		Expect(mux.Handle(42, func([]byte) {})).To(MatchError("http3: a handler for datagram flow ID 42 is already registered"))
+	})
+})
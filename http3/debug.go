@@ -0,0 +1,107 @@
+package http3
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type debugAltService struct {
+	ProtocolID string    `json:"protocol_id"`
+	Host       string    `json:"host,omitempty"`
+	Port       string    `json:"port"`
+	Persist    bool      `json:"persist"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type debugConnection struct {
+	Key               string `json:"key"`
+	Host              string `json:"host"`
+	HandshakeComplete bool   `json:"handshake_complete"`
+	RequestsInFlight  int64  `json:"requests_in_flight"`
+}
+
+type debugInfo struct {
+	Connections            []debugConnection            `json:"connections"`
+	AltServices            map[string][]debugAltService `json:"alt_services"`
+	MetricsHandshakeStart  time.Time                    `json:"metrics_handshake_start"`
+	MetricsHandshakeDone   time.Time                    `json:"metrics_handshake_done"`
+	MetricsTimeToFirstByte time.Duration                `json:"metrics_time_to_first_byte"`
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<html>
+<head><title>http3.RoundTripper</title></head>
+<body>
+<h1>Connections</h1>
+<table>
+<tr><th>Key</th><th>Host</th><th>Handshake complete</th><th>Requests in flight</th></tr>
+{{range .Connections}}<tr><td>{{.Key}}</td><td>{{.Host}}</td><td>{{.HandshakeComplete}}</td><td>{{.RequestsInFlight}}</td></tr>
+{{end}}</table>
+<h1>Alt-Svc</h1>
+<table>
+<tr><th>Origin</th><th>Protocol</th><th>Alternative</th><th>Expires</th></tr>
+{{range $origin, $svcs := .AltServices}}{{range $svcs}}<tr><td>{{$origin}}</td><td>{{.ProtocolID}}</td><td>{{.Host}}:{{.Port}}</td><td>{{if .Persist}}persistent{{else}}{{.ExpiresAt}}{{end}}</td></tr>
+{{end}}{{end}}</table>
+<h1>Last handshake</h1>
+<p>Started: {{.MetricsHandshakeStart}}<br>Done: {{.MetricsHandshakeDone}}</p>
+<h1>Last request</h1>
+<p>Time to first byte: {{.MetricsTimeToFirstByte}}</p>
+</body>
+</html>
+`))
+
+// DebugHandler returns a http.Handler that renders the internal state of the RoundTripper:
+// the cached connections, the Alt-Svc cache and the metrics of the last handshake and request.
+// The state is rendered as HTML, or as JSON if the request has the query parameter format=json.
+// Similar to net/http/pprof, it should only be exposed on internal endpoints.
+func (r *RoundTripper) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		info := r.debugInfo()
+		if req.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(info)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		debugTemplate.Execute(w, info)
+	})
+}
+
+func (r *RoundTripper) debugInfo() *debugInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	info := &debugInfo{
+		Connections:            make([]debugConnection, 0, len(r.clients)),
+		AltServices:            make(map[string][]debugAltService, len(r.services)),
+		MetricsHandshakeStart:  r.MetricsHandshakeStart,
+		MetricsHandshakeDone:   r.MetricsHandshakeDone,
+		MetricsTimeToFirstByte: r.MetricsTimeToFirstByte(),
+	}
+	for key, cl := range r.clients {
+		conn := debugConnection{Key: key}
+		if c, ok := cl.(*client); ok {
+			conn.Host = c.hostname
+			conn.RequestsInFlight = c.requestsInFlight()
+			_, conn.HandshakeComplete = c.negotiatedVersion()
+		}
+		info.Connections = append(info.Connections, conn)
+	}
+	sort.Slice(info.Connections, func(i, j int) bool { return info.Connections[i].Key < info.Connections[j].Key })
+	for hostname, svcs := range r.services {
+		entries := make([]debugAltService, 0, len(svcs))
+		for _, s := range svcs {
+			entries = append(entries, debugAltService{
+				ProtocolID: s.ProtocolID,
+				Host:       s.AltAuthority.Host,
+				Port:       s.AltAuthority.Port,
+				Persist:    s.Persist == 1,
+				ExpiresAt:  s.expiredAt,
+			})
+		}
+		info.AltServices[hostname] = entries
+	}
+	return info
+}
@@ -0,0 +1,50 @@
+package http3
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/ebi-yade/altsvc-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Debug Handler", func() {
+	var rt *RoundTripper
+
+	BeforeEach(func() {
+		rt = &RoundTripper{}
+		rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+		rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": &client{hostname: "quic.clemente.io:443"}}
+	})
+
+	It("renders HTML", func() {
+		rec := httptest.NewRecorder()
+		rt.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/http3", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+		Expect(rec.Body.String()).To(ContainSubstring("quic.clemente.io:443"))
+	})
+
+	It("renders JSON", func() {
+		rt.MetricsRequestSent = time.Now().Add(-time.Second)
+		rt.MetricsFirstResponseByte = rt.MetricsRequestSent.Add(1337 * time.Millisecond)
+		rec := httptest.NewRecorder()
+		rt.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/http3?format=json", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+		var info debugInfo
+		Expect(json.Unmarshal(rec.Body.Bytes(), &info)).To(Succeed())
+		Expect(info.Connections).To(HaveLen(1))
+		Expect(info.Connections[0].Host).To(Equal("quic.clemente.io:443"))
+		Expect(info.Connections[0].HandshakeComplete).To(BeFalse())
+		Expect(info.AltServices).To(HaveKey("quic.clemente.io:443"))
+		Expect(info.AltServices["quic.clemente.io:443"]).To(HaveLen(1))
+		Expect(info.AltServices["quic.clemente.io:443"][0].ProtocolID).To(Equal("h3"))
+		Expect(info.AltServices["quic.clemente.io:443"][0].ExpiresAt).ToNot(BeZero())
+		Expect(info.MetricsTimeToFirstByte).To(Equal(1337 * time.Millisecond))
+	})
+})
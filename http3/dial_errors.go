@@ -0,0 +1,77 @@
+package http3
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// The dial errors allow distinguishing the reason a request failed using errors.As.
+// They don't change the error message of the error they wrap.
+
+// ErrDNS is returned when the host couldn't be resolved,
+// both when dialing a QUIC connection and when falling back to TCP.
+type ErrDNS struct {
+	Host string
+	Err  error
+}
+
+func (e *ErrDNS) Error() string { return e.Err.Error() }
+func (e *ErrDNS) Unwrap() error { return e.Err }
+
+// ErrQUICDial is returned when a QUIC connection couldn't be established,
+// e.g. because the QUIC handshake failed.
+type ErrQUICDial struct {
+	Addr string
+	Err  error
+}
+
+func (e *ErrQUICDial) Error() string { return e.Err.Error() }
+func (e *ErrQUICDial) Unwrap() error { return e.Err }
+
+// ErrTCPDial is returned when the TCP connection used for the fallback couldn't be established.
+type ErrTCPDial struct {
+	Addr string
+	Err  error
+}
+
+func (e *ErrTCPDial) Error() string { return e.Err.Error() }
+func (e *ErrTCPDial) Unwrap() error { return e.Err }
+
+// ErrDiscoveryTimeout is returned when neither QUIC nor TCP succeeded within RoundTripper.DiscoveryTimeout
+// when racing both protocols using Happy Eyeballs.
+type ErrDiscoveryTimeout struct {
+	Duration time.Duration
+}
+
+var _ net.Error = &ErrDiscoveryTimeout{}
+
+func (e *ErrDiscoveryTimeout) Error() string {
+	return fmt.Sprintf("http3: connection discovery timed out after %s", e.Duration)
+}
+func (e *ErrDiscoveryTimeout) Timeout() bool   { return true }
+func (e *ErrDiscoveryTimeout) Temporary() bool { return true }
+
+// newQUICDialError wraps an error returned when dialing a QUIC connection.
+// Errors resolving the host are reported as an ErrDNS.
+func newQUICDialError(addr string, err error) error {
+	if isDNSError(err) {
+		return &ErrDNS{Host: addr, Err: err}
+	}
+	return &ErrQUICDial{Addr: addr, Err: err}
+}
+
+// newTCPDialError wraps an error returned when dialing a TCP connection.
+// Errors resolving the host are reported as an ErrDNS.
+func newTCPDialError(addr string, err error) error {
+	if isDNSError(err) {
+		return &ErrDNS{Host: addr, Err: err}
+	}
+	return &ErrTCPDial{Addr: addr, Err: err}
+}
+
+func isDNSError(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
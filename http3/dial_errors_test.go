@@ -0,0 +1,57 @@
+package http3
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dial errors", func() {
+	dnsErr := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "quic.clemente.io"}}
+
+	It("wraps QUIC dial errors", func() {
+		testErr := errors.New("handshake error")
+		err := newQUICDialError("quic.clemente.io:443", testErr)
+		Expect(err).To(MatchError(testErr))
+		Expect(err.Error()).To(Equal("handshake error"))
+		var quicErr *ErrQUICDial
+		Expect(errors.As(err, &quicErr)).To(BeTrue())
+		Expect(quicErr.Addr).To(Equal("quic.clemente.io:443"))
+	})
+
+	It("wraps TCP dial errors", func() {
+		testErr := errors.New("connection refused")
+		err := newTCPDialError("quic.clemente.io:443", testErr)
+		Expect(err).To(MatchError(testErr))
+		var tcpErr *ErrTCPDial
+		Expect(errors.As(err, &tcpErr)).To(BeTrue())
+		Expect(tcpErr.Addr).To(Equal("quic.clemente.io:443"))
+	})
+
+	It("reports DNS errors", func() {
+		for _, err := range []error{
+			newQUICDialError("quic.clemente.io:443", dnsErr),
+			newTCPDialError("quic.clemente.io:443", dnsErr),
+		} {
+			Expect(err).To(MatchError(dnsErr))
+			var e *ErrDNS
+			Expect(errors.As(err, &e)).To(BeTrue())
+			Expect(e.Host).To(Equal("quic.clemente.io:443"))
+			var quicErr *ErrQUICDial
+			Expect(errors.As(err, &quicErr)).To(BeFalse())
+			var tcpErr *ErrTCPDial
+			Expect(errors.As(err, &tcpErr)).To(BeFalse())
+		}
+	})
+
+	It("reports discovery timeouts as timeouts", func() {
+		var err error = &ErrDiscoveryTimeout{Duration: 250 * time.Millisecond}
+		Expect(err.Error()).To(Equal("http3: connection discovery timed out after 250ms"))
+		var netErr net.Error
+		Expect(errors.As(err, &netErr)).To(BeTrue())
+		Expect(netErr.Timeout()).To(BeTrue())
+	})
+})
@@ -0,0 +1,79 @@
+package http3
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AppendForwarded records that a request is forwarded on behalf of client,
+// e.g. by a MASQUE proxy that sends requests through a CONNECT-UDP tunnel,
+// where the target only sees the address of the proxy (see TunnelAddrs).
+// It appends an element with the for (and, unless by is nil, the by) parameter to the Forwarded header (RFC 7239),
+// and appends the client's IP to the X-Forwarded-For header, for servers that don't support the Forwarded header.
+// Existing elements (added by previous proxies) are preserved.
+func AppendForwarded(h http.Header, client, by net.Addr) {
+	elem := "for=" + forwardedNode(client)
+	if by != nil {
+		elem += ";by=" + forwardedNode(by)
+	}
+	appendHeaderList(h, "Forwarded", elem)
+	appendHeaderList(h, "X-Forwarded-For", addrIP(client))
+}
+
+// ForwardedFor returns the client addresses that a request was forwarded for, starting with the original client.
+// They are taken from the Forwarded header, or from the X-Forwarded-For header if there's no Forwarded header.
+// The values are not validated, and can be set by any client.
+func ForwardedFor(h http.Header) []string {
+	var addrs []string
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, v := range values {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					pair = strings.TrimSpace(pair)
+					if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+						addrs = append(addrs, strings.Trim(pair[4:], `"`))
+					}
+				}
+			}
+		}
+		return addrs
+	}
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
+
+// forwardedNode formats an address as a node of the Forwarded header, see section 6 of RFC 7239.
+// IPv6 addresses and ports contain characters that require the node to be quoted.
+func forwardedNode(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return `"` + addr.String() + `"`
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return `"` + host + ":" + port + `"`
+}
+
+// addrIP returns the IP of an address, without the port.
+func addrIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func appendHeaderList(h http.Header, key, value string) {
+	if prior := strings.Join(h.Values(key), ", "); prior != "" {
+		value = prior + ", " + value
+	}
+	h.Set(key, value)
+}
@@ -0,0 +1,60 @@
+package http3
+
+import (
+	"net"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Forwarded", func() {
+	client := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 43), Port: 47011}
+	proxy := &net.UDPAddr{IP: net.ParseIP("2001:db8:cafe::17"), Port: 443}
+
+	It("sets the Forwarded and X-Forwarded-For headers", func() {
+		h := http.Header{}
+		AppendForwarded(h, client, proxy)
+		Expect(h.Get("Forwarded")).To(Equal(`for="192.0.2.43:47011";by="[2001:db8:cafe::17]:443"`))
+		Expect(h.Get("X-Forwarded-For")).To(Equal("192.0.2.43"))
+	})
+
+	It("omits the by parameter", func() {
+		h := http.Header{}
+		AppendForwarded(h, proxy, nil)
+		Expect(h.Get("Forwarded")).To(Equal(`for="[2001:db8:cafe::17]:443"`))
+		Expect(h.Get("X-Forwarded-For")).To(Equal("2001:db8:cafe::17"))
+	})
+
+	It("appends to the headers set by previous proxies", func() {
+		h := http.Header{}
+		h.Add("Forwarded", "for=198.51.100.17")
+		h.Add("Forwarded", `for="[2001:db8::1]:1234"`)
+		h.Set("X-Forwarded-For", "198.51.100.17, 2001:db8::1")
+		AppendForwarded(h, client, nil)
+		Expect(h.Values("Forwarded")).To(Equal([]string{`for=198.51.100.17, for="[2001:db8::1]:1234", for="192.0.2.43:47011"`}))
+		Expect(h.Get("X-Forwarded-For")).To(Equal("198.51.100.17, 2001:db8::1, 192.0.2.43"))
+	})
+
+	It("parses the Forwarded header", func() {
+		h := http.Header{}
+		h.Add("Forwarded", `for=198.51.100.17;proto=https, For="[2001:db8::1]:1234"`)
+		h.Add("Forwarded", `by=203.0.113.60;for="192.0.2.43:47011"`)
+		h.Set("X-Forwarded-For", "10.0.0.1")
+		Expect(ForwardedFor(h)).To(Equal([]string{"198.51.100.17", "[2001:db8::1]:1234", "192.0.2.43:47011"}))
+	})
+
+	It("falls back to the X-Forwarded-For header", func() {
+		h := http.Header{}
+		h.Add("X-Forwarded-For", "198.51.100.17, 2001:db8::1")
+		h.Add("X-Forwarded-For", "192.0.2.43")
+		Expect(ForwardedFor(h)).To(Equal([]string{"198.51.100.17", "2001:db8::1", "192.0.2.43"}))
+	})
+
+	It("returns the addresses set by AppendForwarded", func() {
+		h := http.Header{}
+		AppendForwarded(h, client, proxy)
+		AppendForwarded(h, proxy, nil)
+		Expect(ForwardedFor(h)).To(Equal([]string{"192.0.2.43:47011", "[2001:db8:cafe::17]:443"}))
+	})
+})
@@ -2,6 +2,7 @@ package http3
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,10 +31,10 @@ func parseNextFrame(r io.Reader) (frame, error) {
 		return &headersFrame{Length: l}, nil
 	case 0x4:
 		return parseSettingsFrame(r, l)
+	case 0x5:
+		return parsePushPromiseFrame(qr, l)
 	case 0x3: // CANCEL_PUSH
 		fallthrough
-	case 0x5: // PUSH_PROMISE
-		fallthrough
 	case 0x7: // GOAWAY
 		fallthrough
 	case 0xd: // MAX_PUSH_ID
@@ -67,11 +68,62 @@ func (f *headersFrame) Write(b *bytes.Buffer) {
 	quicvarint.Write(b, f.Length)
 }
 
+// A pushPromiseFrame is a PUSH_PROMISE frame.
+// The push ID is parsed, the header block (of Length bytes) needs to be read by the caller.
+type pushPromiseFrame struct {
+	PushID uint64
+	Length uint64
+}
+
+func parsePushPromiseFrame(r quicvarint.Reader, l uint64) (*pushPromiseFrame, error) {
+	pushID, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	idLen := uint64(quicvarint.Len(pushID))
+	if idLen > l {
+		return nil, errors.New("PUSH_PROMISE frame too short")
+	}
+	return &pushPromiseFrame{PushID: pushID, Length: l - idLen}, nil
+}
+
+func (f *pushPromiseFrame) Write(b *bytes.Buffer) {
+	quicvarint.Write(b, 0x5)
+	quicvarint.Write(b, uint64(quicvarint.Len(f.PushID))+f.Length)
+	quicvarint.Write(b, f.PushID)
+}
+
+type maxPushIDFrame struct {
+	PushID uint64
+}
+
+func (f *maxPushIDFrame) Write(b *bytes.Buffer) {
+	quicvarint.Write(b, 0xd)
+	quicvarint.Write(b, uint64(quicvarint.Len(f.PushID)))
+	quicvarint.Write(b, f.PushID)
+}
+
+// A priorityUpdateFrame is a PRIORITY_UPDATE frame for a request stream (RFC 9218, Section 7.1).
+type priorityUpdateFrame struct {
+	StreamID uint64
+	Priority string // the Priority Field Value
+}
+
+func (f *priorityUpdateFrame) Write(b *bytes.Buffer) {
+	quicvarint.Write(b, 0xf0700)
+	quicvarint.Write(b, uint64(quicvarint.Len(f.StreamID))+uint64(len(f.Priority)))
+	quicvarint.Write(b, f.StreamID)
+	b.WriteString(f.Priority)
+}
+
 const settingDatagram = 0x276
 
 type settingsFrame struct {
 	Datagram bool
 	other    map[uint64]uint64 // all settings that we don't explicitly recognize
+	// If set, the settings in other are written in this order, followed by H3_DATAGRAM.
+	// Every setting in other must be listed.
+	order []uint64
 }
 
 func parseSettingsFrame(r io.Reader, l uint64) (*settingsFrame, error) {
@@ -131,12 +183,20 @@ func (f *settingsFrame) Write(b *bytes.Buffer) {
 		l += quicvarint.Len(settingDatagram) + quicvarint.Len(1)
 	}
 	quicvarint.Write(b, uint64(l))
+	if f.order != nil {
+		for _, id := range f.order {
+			quicvarint.Write(b, id)
+			quicvarint.Write(b, f.other[id])
+		}
+	}
 	if f.Datagram {
 		quicvarint.Write(b, settingDatagram)
 		quicvarint.Write(b, 1)
 	}
-	for id, val := range f.other {
-		quicvarint.Write(b, id)
-		quicvarint.Write(b, val)
+	if f.order == nil {
+		for id, val := range f.other {
+			quicvarint.Write(b, id)
+			quicvarint.Write(b, val)
+		}
 	}
 }
@@ -72,6 +72,85 @@ var _ = Describe("Frames", func() {
 		})
 	})
 
+	Context("PUSH_PROMISE frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 5) // type byte
+			data = appendVarInt(data, 2+0x10)
+			data = appendVarInt(data, 0x42) // push ID
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&pushPromiseFrame{}))
+			Expect(frame.(*pushPromiseFrame).PushID).To(Equal(uint64(0x42)))
+			Expect(frame.(*pushPromiseFrame).Length).To(Equal(uint64(0x10)))
+		})
+
+		It("errors when the frame is too short for the push ID", func() {
+			data := appendVarInt(nil, 5) // type byte
+			data = appendVarInt(data, 1)
+			data = appendVarInt(data, 0x1337) // push ID, 2 bytes
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("PUSH_PROMISE frame too short"))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&pushPromiseFrame{PushID: 0x1337, Length: 0xdead}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&pushPromiseFrame{}))
+			Expect(frame.(*pushPromiseFrame).PushID).To(Equal(uint64(0x1337)))
+			Expect(frame.(*pushPromiseFrame).Length).To(Equal(uint64(0xdead)))
+		})
+	})
+
+	Context("MAX_PUSH_ID frames", func() {
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&maxPushIDFrame{PushID: 0x1337}).Write(buf)
+			r := bytes.NewReader(buf.Bytes())
+			t, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(Equal(uint64(0xd)))
+			l, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(l).To(BeEquivalentTo(quicvarint.Len(0x1337)))
+			pushID, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pushID).To(Equal(uint64(0x1337)))
+			Expect(r.Len()).To(BeZero())
+		})
+	})
+
+	Context("PRIORITY_UPDATE frames", func() {
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&priorityUpdateFrame{StreamID: 0x1337, Priority: "u=2, i"}).Write(buf)
+			r := bytes.NewReader(buf.Bytes())
+			t, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(Equal(uint64(0xf0700)))
+			l, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(l).To(BeEquivalentTo(quicvarint.Len(0x1337) + 6))
+			streamID, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(streamID).To(Equal(uint64(0x1337)))
+			Expect(r.Len()).To(Equal(6))
+			prio := make([]byte, 6)
+			r.Read(prio)
+			Expect(string(prio)).To(Equal("u=2, i"))
+		})
+
+		It("is skipped when parsing", func() {
+			buf := &bytes.Buffer{}
+			(&priorityUpdateFrame{StreamID: 0x1337, Priority: "u=2"}).Write(buf)
+			(&dataFrame{Length: 0x42}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&dataFrame{Length: 0x42}))
+		})
+	})
+
 	Context("SETTINGS frames", func() {
 		It("parses", func() {
 			settings := appendVarInt(nil, 13)
@@ -114,6 +193,24 @@ var _ = Describe("Frames", func() {
 			Expect(frame).To(Equal(sf))
 		})
 
+		It("writes the settings in the given order", func() {
+			sf := &settingsFrame{
+				Datagram: true,
+				other:    map[uint64]uint64{1: 2, 99: 999, 13: 37},
+				order:    []uint64{99, 1, 13},
+			}
+			buf := &bytes.Buffer{}
+			sf.Write(buf)
+			expected := appendVarInt(nil, 99)
+			for _, v := range []uint64{999, 1, 2, 13, 37, settingDatagram, 1} {
+				expected = appendVarInt(expected, v)
+			}
+			Expect(buf.Bytes()[2:]).To(Equal(expected))
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&settingsFrame{Datagram: true, other: sf.other}))
+		})
+
 		It("errors on EOF", func() {
 			sf := &settingsFrame{other: map[uint64]uint64{
 				13:         37,
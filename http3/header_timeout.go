@@ -0,0 +1,91 @@
+package http3
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// ErrResponseHeaderTimeout is returned when the response headers weren't received
+// within RoundTripper.ResponseHeaderTimeout after the request was written.
+type ErrResponseHeaderTimeout struct {
+	Duration time.Duration
+}
+
+var _ net.Error = &ErrResponseHeaderTimeout{}
+
+func (e *ErrResponseHeaderTimeout) Error() string {
+	return fmt.Sprintf("http3: timeout awaiting response headers (after %s)", e.Duration)
+}
+func (e *ErrResponseHeaderTimeout) Timeout() bool   { return true }
+func (e *ErrResponseHeaderTimeout) Temporary() bool { return true }
+
+// A headerTimer resets the request stream if the response headers aren't received in time.
+// The timer is started when the request (including its body) was written completely.
+type headerTimer struct {
+	str     quic.Stream
+	timeout time.Duration
+
+	mutex   sync.Mutex
+	timer   *time.Timer
+	stopped bool
+	expired bool
+}
+
+func newHeaderTimer(str quic.Stream, timeout time.Duration) *headerTimer {
+	return &headerTimer{str: str, timeout: timeout}
+}
+
+// start starts the timer. It is a no-op if the timer was already started or stopped.
+func (t *headerTimer) start() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stopped || t.timer != nil {
+		return
+	}
+	t.timer = time.AfterFunc(t.timeout, t.expire)
+}
+
+func (t *headerTimer) expire() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stopped {
+		return
+	}
+	t.expired = true
+	t.str.CancelWrite(quic.StreamErrorCode(errorRequestCanceled))
+	t.str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+}
+
+// stop stops the timer, if it didn't expire yet.
+// It returns an ErrResponseHeaderTimeout if the timer expired.
+func (t *headerTimer) stop() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.stopped = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	if t.expired {
+		return &ErrResponseHeaderTimeout{Duration: t.timeout}
+	}
+	return nil
+}
+
+// timedRequestBody starts the headerTimer when the request writer is done with the body.
+type timedRequestBody struct {
+	io.ReadCloser
+	timer *headerTimer
+}
+
+func (b *timedRequestBody) Close() error {
+	b.timer.start()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,87 @@
+package http3
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type closeRecordingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecordingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+var _ = Describe("Response Header Timeout", func() {
+	const timeout = 50 * time.Millisecond
+
+	var str *mockquic.MockStream
+
+	BeforeEach(func() {
+		str = mockquic.NewMockStream(mockCtrl)
+	})
+
+	It("has a good error message", func() {
+		var err error = &ErrResponseHeaderTimeout{Duration: time.Second}
+		Expect(err).To(MatchError("http3: timeout awaiting response headers (after 1s)"))
+		var nerr net.Error
+		Expect(errors.As(err, &nerr)).To(BeTrue())
+		Expect(nerr.Timeout()).To(BeTrue())
+	})
+
+	It("resets the stream when the timer expires", func() {
+		canceled := make(chan struct{})
+		str.EXPECT().CancelWrite(quic.StreamErrorCode(errorRequestCanceled))
+		str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) { close(canceled) })
+		t := newHeaderTimer(str, scaleDuration(timeout))
+		start := time.Now()
+		t.start()
+		Eventually(canceled).Should(BeClosed())
+		Expect(time.Since(start)).To(BeNumerically(">=", scaleDuration(timeout)))
+		Expect(t.stop()).To(MatchError(&ErrResponseHeaderTimeout{Duration: scaleDuration(timeout)}))
+	})
+
+	It("doesn't reset the stream when stopped in time", func() {
+		t := newHeaderTimer(str, scaleDuration(timeout))
+		t.start()
+		Expect(t.stop()).To(Succeed())
+		// the mock would fail on calls to CancelRead and CancelWrite
+		time.Sleep(scaleDuration(2 * timeout))
+	})
+
+	It("doesn't start after it was stopped", func() {
+		t := newHeaderTimer(str, scaleDuration(timeout))
+		Expect(t.stop()).To(Succeed())
+		t.start()
+		time.Sleep(scaleDuration(2 * timeout))
+	})
+
+	It("starts when the request body is closed", func() {
+		canceled := make(chan struct{})
+		str.EXPECT().CancelWrite(gomock.Any())
+		str.EXPECT().CancelRead(gomock.Any()).Do(func(quic.StreamErrorCode) { close(canceled) })
+		t := newHeaderTimer(str, scaleDuration(timeout))
+		inner := &closeRecordingBody{Reader: strings.NewReader("foobar")}
+		body := &timedRequestBody{ReadCloser: inner, timer: t}
+		data, err := io.ReadAll(body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("foobar"))
+		Consistently(canceled, scaleDuration(2*timeout)).ShouldNot(BeClosed())
+		Expect(body.Close()).To(Succeed())
+		Expect(inner.closed).To(BeTrue())
+		Eventually(canceled).Should(BeClosed())
+	})
+})
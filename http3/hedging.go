@@ -0,0 +1,123 @@
+package http3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// canHedgeRequest says if a duplicate of the request can be sent, see RoundTripper.HedgeDelay.
+func canHedgeRequest(req *http.Request) bool {
+	if !isIdempotent(req.Method) {
+		return false
+	}
+	return canRewindRequest(req)
+}
+
+type hedgedResult struct {
+	attempt int // 0 for the original request, 1 for the duplicate
+	res     *http.Response
+	cl      *client
+	err     error
+}
+
+// cancelingBody cancels the context of the request when the response body is closed.
+// It is used for the responses of hedged requests, and of requests racing QUIC against TCP.
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+var _ io.WriterTo = &cancelingBody{}
+
+// WriteTo uses the WriteTo method of the response body, if available,
+// since embedding the io.ReadCloser hides it from io.Copy.
+func (b *cancelingBody) WriteTo(w io.Writer) (int64, error) {
+	if wt, ok := b.ReadCloser.(io.WriterTo); ok {
+		return wt.WriteTo(w)
+	}
+	return io.Copy(w, struct{ io.Reader }{b.ReadCloser})
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// roundTripHedged sends the request, and a duplicate on a second connection
+// if no response was received after HedgeDelay.
+// The first response is returned, and the other request is canceled.
+func (r *RoundTripper) roundTripHedged(req *http.Request, hostname string, opt RoundTripOpt, cl *client) (*http.Response, error) {
+	results := make(chan hedgedResult, 2)
+	var cancels []context.CancelFunc
+	send := func(req *http.Request, opt RoundTripOpt, cl *client) {
+		ctx, cancel := context.WithCancel(req.Context())
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			res, cl, err := r.sendWithRetries(req.WithContext(ctx), hostname, opt, cl)
+			results <- hedgedResult{attempt: attempt, res: res, cl: cl, err: err}
+		}()
+	}
+
+	send(req, opt, cl)
+	timer := time.NewTimer(r.HedgeDelay)
+	defer timer.Stop()
+	timerC := timer.C
+	pending := 1
+	var origErr error
+	for {
+		select {
+		case <-timerC:
+			timerC = nil
+			hedgeReq, err := rewindRequest(req)
+			if err != nil {
+				continue
+			}
+			hedgeOpt := opt
+			hedgeOpt.hedge = true
+			hedgeCl, err := r.getClient(hostname, hedgeOpt)
+			if err != nil {
+				continue
+			}
+			if c, ok := hedgeCl.(*client); ok {
+				send(hedgeReq, hedgeOpt, c)
+				pending++
+			}
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				for i, cancel := range cancels {
+					if i != result.attempt {
+						cancel()
+					}
+				}
+				// The other request might still return a response, which needs to be closed.
+				for ; pending > 0; pending-- {
+					go func() {
+						if res := <-results; res.res != nil {
+							res.res.Body.Close()
+						}
+					}()
+				}
+				r.setMetricsFromClient(result.cl)
+				result.res.Body = &cancelingBody{ReadCloser: result.res.Body, cancel: cancels[result.attempt]}
+				return result.res, nil
+			}
+			cancels[result.attempt]()
+			if result.attempt == 0 {
+				origErr = result.err
+			}
+			if pending > 0 {
+				continue
+			}
+			// If the original request failed before HedgeDelay, no duplicate is sent.
+			if origErr != nil {
+				return nil, origErr
+			}
+			return nil, result.err
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ebi-yade/altsvc-go"
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/marten-seemann/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request Hedging", func() {
+	var (
+		rt           *RoundTripper
+		hostname     string
+		req          *http.Request
+		testDone     chan struct{}
+		dials        int32
+		handshakeCtx context.Context // an already canceled context
+		origDialAddr = dialAddr
+	)
+
+	// newHedgeSession creates a session that responds with "foobar".
+	// If stall is set, no response is sent until the stream is canceled, which closes the canceled channel.
+	newHedgeSession := func(stall bool, canceled chan<- struct{}) *mockquic.MockEarlySession {
+		done := testDone
+		sess := mockquic.NewMockEarlySession(mockCtrl)
+		controlStr := mockquic.NewMockStream(mockCtrl)
+		controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+		sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+		sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+			<-done
+			return nil, errors.New("test done")
+		}).AnyTimes()
+		sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+		sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+		sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+		sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+			headerBuf := &bytes.Buffer{}
+			enc := qpack.NewEncoder(headerBuf)
+			Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+			Expect(enc.Close()).To(Succeed())
+			buf := &bytes.Buffer{}
+			(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+			buf.Write(headerBuf.Bytes())
+			(&dataFrame{Length: 6}).Write(buf)
+			buf.WriteString("foobar")
+			cancelChan := make(chan struct{})
+			var cancelOnce sync.Once
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			str.EXPECT().Close().AnyTimes()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				if stall {
+					<-cancelChan
+					return 0, errors.New("canceled")
+				}
+				return buf.Read(b)
+			}).AnyTimes()
+			str.EXPECT().CancelRead(gomock.Any()).Do(func(quic.StreamErrorCode) {
+				cancelOnce.Do(func() {
+					close(cancelChan)
+					if canceled != nil {
+						close(canceled)
+					}
+				})
+			}).AnyTimes()
+			str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+			return str, nil
+		}).AnyTimes()
+		return sess
+	}
+
+	BeforeEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		handshakeCtx = ctx
+		testDone = make(chan struct{})
+		atomic.StoreInt32(&dials, 0)
+		rt = &RoundTripper{HedgeDelay: 50 * time.Millisecond}
+		var err error
+		req, err = http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		hostname = authorityAddr("https", hostnameFromRequest(req))
+		rt.setServices(hostname, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+		origDialAddr = dialAddr
+	})
+
+	AfterEach(func() {
+		close(testDone)
+		dialAddr = origDialAddr
+	})
+
+	It("sends a duplicate request if the first connection stalls", func() {
+		canceled := make(chan struct{})
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			// the first connection stalls, the second one responds right away
+			if atomic.AddInt32(&dials, 1) == 1 {
+				return newHedgeSession(true, canceled), nil
+			}
+			return newHedgeSession(false, nil), nil
+		}
+		start := time.Now()
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", rt.HedgeDelay))
+		Expect(rsp.StatusCode).To(Equal(200))
+		Expect(io.ReadAll(rsp.Body)).To(Equal([]byte("foobar")))
+		Expect(rsp.Body.Close()).To(Succeed())
+		Expect(atomic.LoadInt32(&dials)).To(BeEquivalentTo(2))
+		// the stalled request is canceled
+		Eventually(canceled).Should(BeClosed())
+	})
+
+	It("doesn't hedge the request if the response arrives in time", func() {
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			atomic.AddInt32(&dials, 1)
+			return newHedgeSession(false, nil), nil
+		}
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(io.ReadAll(rsp.Body)).To(Equal([]byte("foobar")))
+		Expect(rsp.Body.Close()).To(Succeed())
+		Consistently(func() int32 { return atomic.LoadInt32(&dials) }, 2*rt.HedgeDelay).Should(BeEquivalentTo(1))
+	})
+
+	It("copies the body of a hedged response using WriteTo", func() {
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			if atomic.AddInt32(&dials, 1) == 1 {
+				return newHedgeSession(true, nil), nil
+			}
+			return newHedgeSession(false, nil), nil
+		}
+		pool := &countingBufferPool{size: 1024}
+		rt.BufferPool = pool
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.Body).To(BeAssignableToTypeOf(&cancelingBody{}))
+		buf := &bytes.Buffer{}
+		// bytes.Buffer implements io.ReaderFrom, which would take precedence over io.WriterTo
+		n, err := io.Copy(struct{ io.Writer }{buf}, rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(BeEquivalentTo(6))
+		Expect(buf.String()).To(Equal("foobar"))
+		Expect(pool.gets).To(Equal(1))
+		Expect(pool.puts).To(Equal(1))
+		Expect(rsp.Body.Close()).To(Succeed())
+	})
+
+	It("doesn't hedge non-idempotent requests", func() {
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			atomic.AddInt32(&dials, 1)
+			return newHedgeSession(true, nil), nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*rt.HedgeDelay)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://quic.clemente.io/foobar.html", strings.NewReader("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).To(HaveOccurred())
+		Expect(atomic.LoadInt32(&dials)).To(BeEquivalentTo(1))
+	})
+
+	It("returns the error if the request fails before the hedge delay", func() {
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+			atomic.AddInt32(&dials, 1)
+			return nil, errors.New("handshake error")
+		}
+		_, err := rt.RoundTrip(req)
+		Expect(err).To(MatchError("handshake error"))
+		Consistently(func() int32 { return atomic.LoadInt32(&dials) }, 2*rt.HedgeDelay).Should(BeEquivalentTo(1))
+	})
+
+	It("only hedges requests that can be sent again", func() {
+		req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(canHedgeRequest(req)).To(BeTrue())
+		req, err = http.NewRequest(http.MethodPut, "https://quic.clemente.io/foobar.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(canHedgeRequest(req)).To(BeFalse())
+		// http.NewRequest sets GetBody for a strings.Reader
+		req, err = http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", strings.NewReader("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(canHedgeRequest(req)).To(BeTrue())
+		req.GetBody = nil
+		Expect(canHedgeRequest(req)).To(BeFalse())
+	})
+})
@@ -0,0 +1,141 @@
+package http3
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// The upper bounds of the latency histogram buckets: 1ms, 2ms, 4ms, ..., 65.536s.
+// Durations exceeding the largest bound are counted in an additional overflow bucket.
+const (
+	latencyHistogramMinBound   = time.Millisecond
+	latencyHistogramNumBuckets = 17
+)
+
+// A HistogramBucket counts the durations up to (and including) UpperBound,
+// that are larger than the upper bound of the previous bucket.
+// The upper bound of the overflow bucket is math.MaxInt64.
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// A HistogramSnapshot is a snapshot of a latency histogram.
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket
+	// Count is the total number of durations recorded.
+	Count uint64
+	// Sum is the sum of all durations recorded.
+	Sum time.Duration
+}
+
+// Mean returns the mean of the recorded durations.
+// It returns 0 if no duration was recorded.
+func (s HistogramSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Percentile returns an approximation of the p-th percentile (0 < p <= 100) of the recorded durations:
+// the upper bound of the bucket that contains the percentile.
+// It returns 0 if no duration was recorded.
+func (s HistogramSnapshot) Percentile(p float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(s.Count)))
+	if rank == 0 {
+		rank = 1
+	}
+	var count uint64
+	for _, b := range s.Buckets {
+		count += b.Count
+		if count >= rank {
+			return b.UpperBound
+		}
+	}
+	return s.Buckets[len(s.Buckets)-1].UpperBound
+}
+
+// LatencySnapshot is a snapshot of the latency histograms collected by the RoundTripper.
+type LatencySnapshot struct {
+	// Handshake is the duration of QUIC handshakes, from dialing until the handshake completed.
+	Handshake HistogramSnapshot
+	// TimeToFirstByte is the duration from sending a request until the response headers were received.
+	TimeToFirstByte HistogramSnapshot
+	// Total is the duration from sending a request until the response body was read or closed.
+	Total HistogramSnapshot
+}
+
+type histogram struct {
+	counts [latencyHistogramNumBuckets + 1]uint64
+	count  uint64
+	sum    time.Duration
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for bound := latencyHistogramMinBound; i < latencyHistogramNumBuckets && d > bound; bound *= 2 {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Buckets: make([]HistogramBucket, 0, len(h.counts)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	bound := latencyHistogramMinBound
+	for i, c := range h.counts {
+		b := HistogramBucket{UpperBound: bound, Count: c}
+		if i == latencyHistogramNumBuckets {
+			b.UpperBound = math.MaxInt64
+		}
+		s.Buckets = append(s.Buckets, b)
+		bound *= 2
+	}
+	return s
+}
+
+// latencyHistograms collects the latency histograms of a RoundTripper.
+// It is safe for concurrent use.
+type latencyHistograms struct {
+	mutex                  sync.Mutex
+	handshake, ttfb, total histogram
+}
+
+func (l *latencyHistograms) observeHandshake(d time.Duration) {
+	l.mutex.Lock()
+	l.handshake.observe(d)
+	l.mutex.Unlock()
+}
+
+func (l *latencyHistograms) observeTimeToFirstByte(d time.Duration) {
+	l.mutex.Lock()
+	l.ttfb.observe(d)
+	l.mutex.Unlock()
+}
+
+func (l *latencyHistograms) observeTotal(d time.Duration) {
+	l.mutex.Lock()
+	l.total.observe(d)
+	l.mutex.Unlock()
+}
+
+func (l *latencyHistograms) snapshot() LatencySnapshot {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return LatencySnapshot{
+		Handshake:       l.handshake.snapshot(),
+		TimeToFirstByte: l.ttfb.snapshot(),
+		Total:           l.total.snapshot(),
+	}
+}
@@ -0,0 +1,71 @@
+package http3
+
+import (
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Latency Histograms", func() {
+	It("buckets durations", func() {
+		var h histogram
+		h.observe(0)
+		h.observe(time.Millisecond)
+		h.observe(time.Millisecond + 1)
+		h.observe(3 * time.Millisecond)
+		h.observe(time.Hour)
+		s := h.snapshot()
+		Expect(s.Buckets).To(HaveLen(latencyHistogramNumBuckets + 1))
+		Expect(s.Buckets[0]).To(Equal(HistogramBucket{UpperBound: time.Millisecond, Count: 2}))
+		Expect(s.Buckets[1]).To(Equal(HistogramBucket{UpperBound: 2 * time.Millisecond, Count: 1}))
+		Expect(s.Buckets[2]).To(Equal(HistogramBucket{UpperBound: 4 * time.Millisecond, Count: 1}))
+		Expect(s.Buckets[latencyHistogramNumBuckets-1].UpperBound).To(Equal(65536 * time.Millisecond))
+		Expect(s.Buckets[latencyHistogramNumBuckets]).To(Equal(HistogramBucket{UpperBound: math.MaxInt64, Count: 1}))
+		Expect(s.Count).To(BeEquivalentTo(5))
+		Expect(s.Sum).To(Equal(time.Hour + 5*time.Millisecond + 1))
+	})
+
+	It("calculates percentiles", func() {
+		var h histogram
+		for i := 0; i < 50; i++ {
+			h.observe(time.Millisecond / 2)
+		}
+		for i := 0; i < 40; i++ {
+			h.observe(3 * time.Millisecond)
+		}
+		for i := 0; i < 9; i++ {
+			h.observe(100 * time.Millisecond)
+		}
+		h.observe(100 * time.Second)
+		s := h.snapshot()
+		Expect(s.Percentile(1)).To(Equal(time.Millisecond))
+		Expect(s.Percentile(50)).To(Equal(time.Millisecond))
+		Expect(s.Percentile(51)).To(Equal(4 * time.Millisecond))
+		Expect(s.Percentile(90)).To(Equal(4 * time.Millisecond))
+		Expect(s.Percentile(99)).To(Equal(128 * time.Millisecond))
+		Expect(s.Percentile(100)).To(Equal(time.Duration(math.MaxInt64)))
+	})
+
+	It("calculates the mean", func() {
+		var h histogram
+		Expect(h.snapshot().Mean()).To(BeZero())
+		h.observe(time.Second)
+		h.observe(3 * time.Second)
+		Expect(h.snapshot().Mean()).To(Equal(2 * time.Second))
+	})
+
+	It("collects histograms for handshakes, time to first byte and total durations", func() {
+		l := &latencyHistograms{}
+		l.observeHandshake(time.Millisecond)
+		l.observeTimeToFirstByte(time.Millisecond)
+		l.observeTimeToFirstByte(time.Millisecond)
+		l.observeTotal(time.Second)
+		s := l.snapshot()
+		Expect(s.Handshake.Count).To(BeEquivalentTo(1))
+		Expect(s.TimeToFirstByte.Count).To(BeEquivalentTo(2))
+		Expect(s.Total.Count).To(BeEquivalentTo(1))
+		Expect(s.Total.Sum).To(Equal(time.Second))
+	})
+})
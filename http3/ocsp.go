@@ -0,0 +1,68 @@
+package http3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var errMissingOCSPStaple = errors.New("http3: server didn't staple an OCSP response")
+
+// requireOCSPStaple makes the handshake fail unless the server staples a valid OCSP response,
+// see RoundTripper.RequireOCSPStaple.
+// It must be called on a copy of the tls.Config.
+func requireOCSPStaple(conf *tls.Config) {
+	addVerifyConnection(conf, verifyOCSPStaple)
+}
+
+// addVerifyConnection adds a check to the VerifyConnection callback of the tls.Config.
+// A VerifyConnection callback that was already set is run first.
+func addVerifyConnection(conf *tls.Config, verify func(tls.ConnectionState) error) {
+	verifyConnection := conf.VerifyConnection
+	conf.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verifyConnection != nil {
+			if err := verifyConnection(cs); err != nil {
+				return err
+			}
+		}
+		return verify(cs)
+	}
+}
+
+// verifyOCSPStaple checks that the OCSP response stapled by the server is signed by the issuer,
+// is still valid, and says that the certificate is not revoked.
+func verifyOCSPStaple(cs tls.ConnectionState) error {
+	if len(cs.OCSPResponse) == 0 {
+		return errMissingOCSPStaple
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("http3: no peer certificate to check the OCSP response for")
+	}
+	var issuer *x509.Certificate
+	if len(cs.VerifiedChains) > 0 && len(cs.VerifiedChains[0]) > 1 {
+		issuer = cs.VerifiedChains[0][1]
+	} else if len(cs.PeerCertificates) > 1 {
+		issuer = cs.PeerCertificates[1]
+	} else {
+		return errors.New("http3: no issuer to verify the OCSP response")
+	}
+	resp, err := ocsp.ParseResponseForCert(cs.OCSPResponse, cs.PeerCertificates[0], issuer)
+	if err != nil {
+		return fmt.Errorf("http3: invalid OCSP response: %w", err)
+	}
+	if !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		return errors.New("http3: OCSP response expired")
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return errors.New("http3: the server's certificate was revoked")
+	default:
+		return errors.New("http3: the OCSP status of the server's certificate is unknown")
+	}
+}
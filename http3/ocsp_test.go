@@ -0,0 +1,136 @@
+package http3
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// generateTestCertificates generates a CA, and a leaf certificate issued by that CA.
+func generateTestCertificates() (ca *x509.Certificate, caKey crypto.Signer, leaf *x509.Certificate, leafKey crypto.Signer) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	caTempl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caRaw, err := x509.CreateCertificate(rand.Reader, caTempl, caTempl, caKey.Public(), caKey)
+	Expect(err).ToNot(HaveOccurred())
+	ca, err = x509.ParseCertificate(caRaw)
+	Expect(err).ToNot(HaveOccurred())
+
+	leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	leafTempl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafRaw, err := x509.CreateCertificate(rand.Reader, leafTempl, ca, leafKey.Public(), caKey)
+	Expect(err).ToNot(HaveOccurred())
+	leaf, err = x509.ParseCertificate(leafRaw)
+	Expect(err).ToNot(HaveOccurred())
+	return ca, caKey, leaf, leafKey
+}
+
+func createOCSPResponse(ca *x509.Certificate, caKey crypto.Signer, leaf *x509.Certificate, status int, nextUpdate time.Time) []byte {
+	resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+		Status:       status,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, caKey)
+	Expect(err).ToNot(HaveOccurred())
+	return resp
+}
+
+var _ = Describe("OCSP stapling", func() {
+	var (
+		ca, leaf *x509.Certificate
+		caKey    crypto.Signer
+	)
+
+	BeforeEach(func() {
+		ca, caKey, leaf, _ = generateTestCertificates()
+	})
+
+	connState := func(staple []byte) tls.ConnectionState {
+		return tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{leaf},
+			VerifiedChains:   [][]*x509.Certificate{{leaf, ca}},
+			OCSPResponse:     staple,
+		}
+	}
+
+	It("accepts a valid staple", func() {
+		staple := createOCSPResponse(ca, caKey, leaf, ocsp.Good, time.Now().Add(time.Hour))
+		Expect(verifyOCSPStaple(connState(staple))).To(Succeed())
+	})
+
+	It("uses the certificate chain sent by the server, if the chain wasn't verified", func() {
+		staple := createOCSPResponse(ca, caKey, leaf, ocsp.Good, time.Now().Add(time.Hour))
+		cs := connState(staple)
+		cs.VerifiedChains = nil
+		Expect(verifyOCSPStaple(cs)).To(MatchError("http3: no issuer to verify the OCSP response"))
+		cs.PeerCertificates = []*x509.Certificate{leaf, ca}
+		Expect(verifyOCSPStaple(cs)).To(Succeed())
+	})
+
+	It("rejects a missing staple", func() {
+		Expect(verifyOCSPStaple(connState(nil))).To(MatchError(errMissingOCSPStaple))
+	})
+
+	It("rejects revoked certificates", func() {
+		staple := createOCSPResponse(ca, caKey, leaf, ocsp.Revoked, time.Now().Add(time.Hour))
+		Expect(verifyOCSPStaple(connState(staple))).To(MatchError("http3: the server's certificate was revoked"))
+	})
+
+	It("rejects an unknown status", func() {
+		staple := createOCSPResponse(ca, caKey, leaf, ocsp.Unknown, time.Now().Add(time.Hour))
+		Expect(verifyOCSPStaple(connState(staple))).To(MatchError("http3: the OCSP status of the server's certificate is unknown"))
+	})
+
+	It("rejects expired responses", func() {
+		staple := createOCSPResponse(ca, caKey, leaf, ocsp.Good, time.Now().Add(-time.Second))
+		Expect(verifyOCSPStaple(connState(staple))).To(MatchError("http3: OCSP response expired"))
+	})
+
+	It("rejects responses not signed by the issuer", func() {
+		otherCA, otherKey, _, _ := generateTestCertificates()
+		staple := createOCSPResponse(otherCA, otherKey, leaf, ocsp.Good, time.Now().Add(time.Hour))
+		Expect(verifyOCSPStaple(connState(staple))).To(MatchError(ContainSubstring("http3: invalid OCSP response")))
+	})
+
+	It("keeps the existing VerifyConnection callback", func() {
+		testErr := errors.New("test error")
+		conf := &tls.Config{VerifyConnection: func(tls.ConnectionState) error { return testErr }}
+		requireOCSPStaple(conf)
+		staple := createOCSPResponse(ca, caKey, leaf, ocsp.Good, time.Now().Add(time.Hour))
+		Expect(conf.VerifyConnection(connState(staple))).To(MatchError(testErr))
+		conf = &tls.Config{}
+		requireOCSPStaple(conf)
+		Expect(conf.VerifyConnection(connState(staple))).To(Succeed())
+		Expect(conf.VerifyConnection(connState(nil))).To(MatchError(errMissingOCSPStaple))
+	})
+})
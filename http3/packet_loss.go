@@ -0,0 +1,101 @@
+package http3
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+)
+
+// packetLossEnv needs to be set to 1 to use RoundTripper.PacketLoss.
+const packetLossEnv = "QUIC_GO_ALLOW_PACKET_LOSS_INJECTION"
+
+var errPacketLossNotAllowed = errors.New("http3: packet loss injection is only intended for testing, set " + packetLossEnv + "=1 to enable it")
+
+// PacketLossConfig configures the packets dropped by RoundTripper.PacketLoss.
+// Packets are dropped in both directions.
+type PacketLossConfig struct {
+	// Rate is the probability that a packet is dropped, in the range [0, 1].
+	Rate float64
+	// Period, if larger than 0, drops every Period-th packet.
+	Period int
+	// Seed seeds the random number generator used for Rate.
+	Seed int64
+}
+
+func (c *PacketLossConfig) validate() error {
+	if os.Getenv(packetLossEnv) != "1" {
+		return errPacketLossNotAllowed
+	}
+	if c.Rate < 0 || c.Rate > 1 {
+		return errors.New("http3: invalid packet loss rate")
+	}
+	if c.Period < 0 {
+		return errors.New("http3: invalid packet loss period")
+	}
+	return nil
+}
+
+// A lossyPacketConn drops packets, to test the loss recovery.
+type lossyPacketConn struct {
+	net.PacketConn
+
+	config *PacketLossConfig
+
+	mutex       sync.Mutex
+	rand        *rand.Rand
+	numSent     int
+	numReceived int
+	numDropped  int
+}
+
+var _ net.PacketConn = &lossyPacketConn{}
+
+func newLossyPacketConn(conn net.PacketConn, config *PacketLossConfig) *lossyPacketConn {
+	return &lossyPacketConn{
+		PacketConn: conn,
+		config:     config,
+		rand:       rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// drop decides if a packet is dropped.
+// count is the number of packets sent or received before, in the respective direction.
+func (c *lossyPacketConn) drop(count *int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*count++
+	drop := c.config.Period > 0 && *count%c.config.Period == 0
+	if !drop && c.config.Rate > 0 {
+		drop = c.rand.Float64() < c.config.Rate
+	}
+	if drop {
+		c.numDropped++
+	}
+	return drop
+}
+
+func (c *lossyPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if c.drop(&c.numSent) {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func (c *lossyPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || !c.drop(&c.numReceived) {
+			return n, addr, err
+		}
+	}
+}
+
+// dropped returns the number of packets dropped.
+func (c *lossyPacketConn) dropped() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.numDropped
+}
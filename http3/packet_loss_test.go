@@ -0,0 +1,106 @@
+package http3
+
+import (
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type packetSource struct {
+	net.PacketConn
+	written int
+}
+
+func (c *packetSource) ReadFrom(p []byte) (int, net.Addr, error) {
+	return copy(p, []byte("foobar")), nil, nil
+}
+
+func (c *packetSource) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.written++
+	return len(p), nil
+}
+
+var _ = Describe("Packet Loss", func() {
+	BeforeEach(func() {
+		Expect(os.Setenv(packetLossEnv, "1")).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv(packetLossEnv)).To(Succeed())
+	})
+
+	It("can only be used if explicitly enabled", func() {
+		Expect(os.Unsetenv(packetLossEnv)).To(Succeed())
+		Expect((&PacketLossConfig{Rate: 0.1}).validate()).To(MatchError(errPacketLossNotAllowed))
+		Expect(os.Setenv(packetLossEnv, "true")).To(Succeed())
+		Expect((&PacketLossConfig{Rate: 0.1}).validate()).To(MatchError(errPacketLossNotAllowed))
+		Expect(os.Setenv(packetLossEnv, "1")).To(Succeed())
+		Expect((&PacketLossConfig{Rate: 0.1}).validate()).To(Succeed())
+		_, err := newClient("localhost:1337", nil, &roundTripperOpts{PacketLoss: &PacketLossConfig{}}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.Unsetenv(packetLossEnv)).To(Succeed())
+		_, err = newClient("localhost:1337", nil, &roundTripperOpts{PacketLoss: &PacketLossConfig{}}, nil, nil)
+		Expect(err).To(MatchError(errPacketLossNotAllowed))
+	})
+
+	It("rejects invalid configs", func() {
+		Expect((&PacketLossConfig{Rate: 1.1}).validate()).To(MatchError("http3: invalid packet loss rate"))
+		Expect((&PacketLossConfig{Rate: -0.1}).validate()).To(MatchError("http3: invalid packet loss rate"))
+		Expect((&PacketLossConfig{Period: -1}).validate()).To(MatchError("http3: invalid packet loss period"))
+	})
+
+	It("drops every n-th sent packet", func() {
+		src := &packetSource{}
+		conn := newLossyPacketConn(src, &PacketLossConfig{Period: 3})
+		for i := 0; i < 9; i++ {
+			n, err := conn.WriteTo([]byte("foobar"), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(6))
+		}
+		Expect(src.written).To(Equal(6))
+		Expect(conn.dropped()).To(Equal(3))
+	})
+
+	It("drops received packets", func() {
+		conn := newLossyPacketConn(&packetSource{}, &PacketLossConfig{Period: 2})
+		b := make([]byte, 100)
+		for i := 0; i < 5; i++ {
+			n, _, err := conn.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("foobar")))
+		}
+		// every second packet was dropped: packets 2, 4, 6 and 8
+		Expect(conn.dropped()).To(Equal(4))
+	})
+
+	It("drops packets randomly", func() {
+		const num = 10000
+		src := &packetSource{}
+		conn := newLossyPacketConn(src, &PacketLossConfig{Rate: 0.2, Seed: 42})
+		for i := 0; i < num; i++ {
+			_, err := conn.WriteTo([]byte("foobar"), nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(conn.dropped()).To(BeNumerically("~", num/5, num/50))
+		Expect(src.written).To(Equal(num - conn.dropped()))
+		// the same seed drops the same packets
+		conn2 := newLossyPacketConn(&packetSource{}, &PacketLossConfig{Rate: 0.2, Seed: 42})
+		for i := 0; i < num; i++ {
+			_, err := conn2.WriteTo([]byte("foobar"), nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(conn2.dropped()).To(Equal(conn.dropped()))
+	})
+
+	It("doesn't drop any packets with the zero value", func() {
+		src := &packetSource{}
+		conn := newLossyPacketConn(src, &PacketLossConfig{})
+		for i := 0; i < 100; i++ {
+			_, err := conn.WriteTo([]byte("foobar"), nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(src.written).To(Equal(100))
+	})
+})
@@ -0,0 +1,163 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+)
+
+var errPathFailure = errors.New("http3: no packets received for PathFailureTimeout, the path is assumed to be broken")
+
+// A pathMonitor detects when the path of a connection broke,
+// e.g. because the client switched networks, or because a NAT rebinding occurred.
+// The path is assumed to be broken when ack-eliciting 1-RTT packets were sent,
+// but no packet was received for the timeout.
+// Long header packets are ignored, failing handshakes are detected by the handshake timeout.
+type pathMonitor struct {
+	timeout time.Duration
+
+	mutex     sync.Mutex
+	onFailure func()
+	timer     *time.Timer
+	// the time the first ack-eliciting packet was sent after the last packet was received,
+	// zero if we're not waiting for any packets
+	waitingSince time.Time
+	failed       bool
+	closed       bool
+}
+
+var (
+	_ logging.Tracer           = &pathMonitorTracer{}
+	_ logging.ConnectionTracer = &pathMonitor{}
+)
+
+func newPathMonitor(timeout time.Duration) *pathMonitor {
+	return &pathMonitor{timeout: timeout}
+}
+
+// setFailureHandler sets the function that is called when the path broke.
+// If the path already broke, it is called right away.
+func (m *pathMonitor) setFailureHandler(f func()) {
+	m.mutex.Lock()
+	m.onFailure = f
+	failed := m.failed
+	m.mutex.Unlock()
+	if failed {
+		f()
+	}
+}
+
+func (m *pathMonitor) sentPacket() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.failed || m.closed || !m.waitingSince.IsZero() {
+		return
+	}
+	m.waitingSince = time.Now()
+	if m.timer == nil {
+		m.timer = time.AfterFunc(m.timeout, m.check)
+	} else {
+		m.timer.Reset(m.timeout)
+	}
+}
+
+func (m *pathMonitor) receivedPacket() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.waitingSince = time.Time{}
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+}
+
+func (m *pathMonitor) check() {
+	m.mutex.Lock()
+	if m.waitingSince.IsZero() || m.failed || m.closed {
+		m.mutex.Unlock()
+		return
+	}
+	if d := time.Since(m.waitingSince); d < m.timeout {
+		m.timer.Reset(m.timeout - d)
+		m.mutex.Unlock()
+		return
+	}
+	m.failed = true
+	onFailure := m.onFailure
+	m.mutex.Unlock()
+	if onFailure != nil {
+		onFailure()
+	}
+}
+
+func (m *pathMonitor) SentPacket(hdr *logging.ExtendedHeader, _ logging.ByteCount, _ *logging.AckFrame, frames []logging.Frame) {
+	// Packets that only contain an ACK frame are not acknowledged by the peer.
+	if hdr.IsLongHeader || len(frames) == 0 {
+		return
+	}
+	m.sentPacket()
+}
+
+func (m *pathMonitor) ReceivedPacket(*logging.ExtendedHeader, logging.ByteCount, []logging.Frame) {
+	m.receivedPacket()
+}
+
+func (m *pathMonitor) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.closed = true
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+}
+
+func (m *pathMonitor) StartedConnection(local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
+}
+
+func (m *pathMonitor) NegotiatedVersion(chosen logging.VersionNumber, clientVersions, serverVersions []logging.VersionNumber) {
+}
+func (m *pathMonitor) ClosedConnection(error)                                                    {}
+func (m *pathMonitor) SentTransportParameters(*logging.TransportParameters)                      {}
+func (m *pathMonitor) ReceivedTransportParameters(*logging.TransportParameters)                  {}
+func (m *pathMonitor) RestoredTransportParameters(*logging.TransportParameters)                  {}
+func (m *pathMonitor) ReceivedVersionNegotiationPacket(*logging.Header, []logging.VersionNumber) {}
+func (m *pathMonitor) ReceivedRetry(*logging.Header)                                             {}
+func (m *pathMonitor) BufferedPacket(logging.PacketType)                                         {}
+func (m *pathMonitor) DroppedPacket(logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
+func (m *pathMonitor) UpdatedMetrics(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
+}
+func (m *pathMonitor) AcknowledgedPacket(logging.EncryptionLevel, logging.PacketNumber) {}
+func (m *pathMonitor) LostPacket(logging.EncryptionLevel, logging.PacketNumber, logging.PacketLossReason) {
+}
+func (m *pathMonitor) UpdatedCongestionState(logging.CongestionState)                     {}
+func (m *pathMonitor) UpdatedPTOCount(value uint32)                                       {}
+func (m *pathMonitor) UpdatedKeyFromTLS(logging.EncryptionLevel, logging.Perspective)     {}
+func (m *pathMonitor) UpdatedKey(generation logging.KeyPhase, remote bool)                {}
+func (m *pathMonitor) DroppedEncryptionLevel(logging.EncryptionLevel)                     {}
+func (m *pathMonitor) DroppedKey(logging.KeyPhase)                                        {}
+func (m *pathMonitor) SetLossTimer(logging.TimerType, logging.EncryptionLevel, time.Time) {}
+func (m *pathMonitor) LossTimerExpired(logging.TimerType, logging.EncryptionLevel)        {}
+func (m *pathMonitor) LossTimerCanceled()                                                 {}
+func (m *pathMonitor) ReceivedPathChallenge([8]byte)                                      {}
+func (m *pathMonitor) Debug(string, string)                                               {}
+
+// pathMonitorTracer is a logging.Tracer that returns the pathMonitor for the connection.
+// A client only dials a single connection, so the same pathMonitor is returned for every connection.
+type pathMonitorTracer struct {
+	monitor *pathMonitor
+}
+
+func (t *pathMonitorTracer) TracerForConnection(context.Context, logging.Perspective, logging.ConnectionID) logging.ConnectionTracer {
+	return t.monitor
+}
+func (t *pathMonitorTracer) SentPacket(net.Addr, *logging.Header, logging.ByteCount, []logging.Frame) {
+}
+func (t *pathMonitorTracer) DroppedPacket(net.Addr, logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
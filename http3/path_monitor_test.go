@@ -0,0 +1,85 @@
+package http3
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Path Monitor", func() {
+	const timeout = 50 * time.Millisecond
+
+	var (
+		monitor *pathMonitor
+		failed  chan struct{}
+	)
+
+	BeforeEach(func() {
+		failed = make(chan struct{}, 1)
+		monitor = newPathMonitor(scaleDuration(timeout))
+		monitor.setFailureHandler(func() { failed <- struct{}{} })
+	})
+
+	AfterEach(func() {
+		monitor.Close()
+	})
+
+	shortHeader := &logging.ExtendedHeader{}
+	frames := []logging.Frame{&logging.PingFrame{}}
+
+	It("detects when no packets are received", func() {
+		start := time.Now()
+		monitor.SentPacket(shortHeader, 100, nil, frames)
+		Eventually(failed).Should(Receive())
+		Expect(time.Since(start)).To(BeNumerically(">=", scaleDuration(timeout)))
+		// the failure is only reported once
+		monitor.SentPacket(shortHeader, 100, nil, frames)
+		Consistently(failed, scaleDuration(2*timeout)).ShouldNot(Receive())
+	})
+
+	It("measures the timeout from the first unacknowledged packet", func() {
+		start := time.Now()
+		monitor.SentPacket(shortHeader, 100, nil, frames)
+		time.Sleep(scaleDuration(timeout / 2))
+		monitor.SentPacket(shortHeader, 100, nil, frames)
+		Eventually(failed).Should(Receive())
+		Expect(time.Since(start)).To(BeNumerically("<", scaleDuration(timeout*5/4)))
+	})
+
+	It("doesn't report a failure when packets are received", func() {
+		for i := 0; i < 5; i++ {
+			monitor.SentPacket(shortHeader, 100, nil, frames)
+			time.Sleep(scaleDuration(timeout / 2))
+			monitor.ReceivedPacket(shortHeader, 100, nil)
+		}
+		Consistently(failed, scaleDuration(2*timeout)).ShouldNot(Receive())
+	})
+
+	It("ignores long header packets", func() {
+		monitor.SentPacket(&logging.ExtendedHeader{Header: logging.Header{IsLongHeader: true}}, 100, nil, frames)
+		Consistently(failed, scaleDuration(2*timeout)).ShouldNot(Receive())
+	})
+
+	It("ignores packets that only contain an ACK", func() {
+		monitor.SentPacket(shortHeader, 100, &logging.AckFrame{}, nil)
+		Consistently(failed, scaleDuration(2*timeout)).ShouldNot(Receive())
+	})
+
+	It("reports failures that occurred before the handler was set", func() {
+		m := newPathMonitor(scaleDuration(timeout))
+		defer m.Close()
+		m.SentPacket(shortHeader, 100, nil, frames)
+		time.Sleep(scaleDuration(2 * timeout))
+		m.setFailureHandler(func() { failed <- struct{}{} })
+		Expect(failed).To(Receive())
+	})
+
+	It("stops monitoring when the connection is closed", func() {
+		monitor.SentPacket(shortHeader, 100, nil, frames)
+		monitor.Close()
+		Consistently(failed, scaleDuration(2*timeout)).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,31 @@
+package http3
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+)
+
+var errCertificateNotPinned = errors.New("http3: the server's certificate chain doesn't contain any of the pinned certificates")
+
+// pinCertificates makes the handshake fail unless the server's certificate chain contains one of the pins,
+// see RoundTripper.PinnedCertificates.
+// It must be called on a copy of the tls.Config.
+func pinCertificates(conf *tls.Config, pins [][]byte) {
+	addVerifyConnection(conf, func(cs tls.ConnectionState) error {
+		return verifyPinnedCertificates(cs, pins)
+	})
+}
+
+// verifyPinnedCertificates checks that one of the certificates presented by the server matches a pin.
+// VerifyConnection is also called for resumed connections, with the certificates of the original connection.
+func verifyPinnedCertificates(cs tls.ConnectionState, pins [][]byte) error {
+	for _, cert := range cs.PeerCertificates {
+		for _, pin := range pins {
+			if bytes.Equal(cert.Raw, pin) {
+				return nil
+			}
+		}
+	}
+	return errCertificateNotPinned
+}
@@ -0,0 +1,42 @@
+package http3
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Certificate Pinning", func() {
+	var ca, leaf, otherLeaf *x509.Certificate
+
+	BeforeEach(func() {
+		ca, _, leaf, _ = generateTestCertificates()
+		_, _, otherLeaf, _ = generateTestCertificates()
+	})
+
+	connState := func(certs ...*x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: certs}
+	}
+
+	It("accepts a chain containing the pinned leaf certificate", func() {
+		Expect(verifyPinnedCertificates(connState(leaf, ca), [][]byte{otherLeaf.Raw, leaf.Raw})).To(Succeed())
+	})
+
+	It("accepts a chain containing a pinned CA certificate", func() {
+		Expect(verifyPinnedCertificates(connState(leaf, ca), [][]byte{ca.Raw})).To(Succeed())
+	})
+
+	It("rejects chains that don't contain a pinned certificate", func() {
+		Expect(verifyPinnedCertificates(connState(leaf, ca), [][]byte{otherLeaf.Raw})).To(MatchError(errCertificateNotPinned))
+		Expect(verifyPinnedCertificates(connState(), [][]byte{leaf.Raw})).To(MatchError(errCertificateNotPinned))
+	})
+
+	It("adds the check to the tls.Config", func() {
+		conf := &tls.Config{}
+		pinCertificates(conf, [][]byte{leaf.Raw})
+		Expect(conf.VerifyConnection(connState(leaf))).To(Succeed())
+		Expect(conf.VerifyConnection(connState(otherLeaf))).To(MatchError(errCertificateNotPinned))
+	})
+})
@@ -0,0 +1,110 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// DefaultUrgency is the urgency of requests that don't specify a priority (RFC 9218, Section 4.1).
+const DefaultUrgency = 3
+
+const maxUrgency = 7
+
+var errPriorityNotSent = errors.New("http3: the request wasn't sent using HTTP/3")
+
+var priorityHandleContextKey = &contextKey{"priority-handle"}
+
+// A Priority is the priority of a request, as defined in RFC 9218.
+type Priority struct {
+	// Urgency is a value between 0 (highest priority) and 7 (lowest priority).
+	Urgency uint8
+	// Incremental says if the response can be processed incrementally.
+	Incremental bool
+}
+
+func (p Priority) String() string {
+	if p.Incremental {
+		return fmt.Sprintf("u=%d, i", p.Urgency)
+	}
+	return fmt.Sprintf("u=%d", p.Urgency)
+}
+
+func (p Priority) validate() error {
+	if p.Urgency > maxUrgency {
+		return fmt.Errorf("http3: invalid urgency: %d", p.Urgency)
+	}
+	return nil
+}
+
+// A PriorityHandle allows changing the priority of a request while it is in flight.
+// It is returned by RoundTripper.RoundTripWithPriority.
+type PriorityHandle struct {
+	mutex    sync.Mutex
+	priority Priority
+	client   *client
+	streamID quic.StreamID
+}
+
+// bind is called when the request was sent on a stream.
+// If the request is retried, it is bound to the stream used for the last attempt.
+func (h *PriorityHandle) bind(c *client, id quic.StreamID) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.client = c
+	h.streamID = id
+}
+
+// Priority returns the current priority of the request.
+func (h *PriorityHandle) Priority() Priority {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.priority
+}
+
+// Update changes the priority of the request by sending a PRIORITY_UPDATE frame.
+// It returns an error if the request wasn't sent using HTTP/3, e.g. because it used the TCP fallback.
+func (h *PriorityHandle) Update(p Priority) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.client == nil {
+		return errPriorityNotSent
+	}
+	if err := h.client.sendPriorityUpdate(h.streamID, p); err != nil {
+		return err
+	}
+	h.priority = p
+	return nil
+}
+
+// RoundTripWithPriority is like RoundTripOpt, but sends the request with the priority p,
+// using the Priority header field.
+// The returned PriorityHandle allows changing the priority while the response is received.
+func (r *RoundTripper) RoundTripWithPriority(req *http.Request, opt RoundTripOpt, p Priority) (*http.Response, *PriorityHandle, error) {
+	if err := p.validate(); err != nil {
+		closeRequestBody(req)
+		return nil, nil, err
+	}
+	h := &PriorityHandle{priority: p}
+	req = req.Clone(context.WithValue(req.Context(), priorityHandleContextKey, h))
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("Priority", p.String())
+	rsp, err := r.RoundTripOpt(req, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rsp, h, nil
+}
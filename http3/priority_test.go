@@ -0,0 +1,36 @@
+package http3
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Priority", func() {
+	It("serializes the priority", func() {
+		Expect(Priority{Urgency: DefaultUrgency}.String()).To(Equal("u=3"))
+		Expect(Priority{Urgency: 0, Incremental: true}.String()).To(Equal("u=0, i"))
+	})
+
+	It("rejects invalid urgencies", func() {
+		Expect(Priority{Urgency: 7}.validate()).To(Succeed())
+		Expect(Priority{Urgency: 8}.validate()).To(MatchError("http3: invalid urgency: 8"))
+	})
+
+	It("doesn't update the priority of requests that weren't sent using HTTP/3", func() {
+		h := &PriorityHandle{priority: Priority{Urgency: 5}}
+		Expect(h.Update(Priority{Urgency: 1})).To(MatchError(errPriorityNotSent))
+		Expect(h.Priority()).To(Equal(Priority{Urgency: 5}))
+		Expect(h.Update(Priority{Urgency: 8})).To(HaveOccurred())
+	})
+
+	It("sets the Priority header field", func() {
+		rt := &RoundTripper{}
+		req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, _, err = rt.RoundTripWithPriority(req, RoundTripOpt{}, Priority{Urgency: 9})
+		Expect(err).To(MatchError("http3: invalid urgency: 9"))
+		Expect(req.Header.Get("Priority")).To(BeEmpty())
+	})
+})
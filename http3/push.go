@@ -0,0 +1,169 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// maxPushID is the maximum push ID the client allows, if Server Push is enabled.
+const maxPushID = 100
+
+// pushPromises matches PUSH_PROMISE frames received on request streams to push streams.
+// A push stream can arrive before the corresponding PUSH_PROMISE, and vice versa.
+// Entries are removed once the push stream received the promise. Since push IDs must not
+// exceed maxPushID, the peer can't make the map grow beyond maxPushID+1 entries.
+type pushPromises struct {
+	mutex    sync.Mutex
+	promises map[uint64]chan *http.Request
+	// received records the push IDs that were already used by a push stream.
+	// Later PUSH_PROMISE frames for these pushes are ignored.
+	received [maxPushID + 1]bool
+}
+
+var errDuplicatePushID = errors.New("received a push stream for a push ID that was already used")
+
+// get returns the channel for the push, or nil if the push was already received.
+// The pushID must not be larger than maxPushID. The mutex must be held.
+func (p *pushPromises) get(pushID uint64) chan *http.Request {
+	if p.promises == nil {
+		p.promises = make(map[uint64]chan *http.Request)
+	}
+	c, ok := p.promises[pushID]
+	if !ok {
+		if p.received[pushID] {
+			return nil
+		}
+		c = make(chan *http.Request, 1)
+		p.promises[pushID] = c
+	}
+	return c
+}
+
+func (p *pushPromises) promise(pushID uint64, req *http.Request) {
+	p.mutex.Lock()
+	c := p.get(pushID)
+	p.mutex.Unlock()
+	if c == nil { // the push stream is already gone
+		return
+	}
+	select {
+	case c <- req:
+	default: // The server may promise the same push on multiple request streams.
+	}
+}
+
+// wait waits for the PUSH_PROMISE of a push stream.
+// Every push ID can only be used by a single push stream.
+func (p *pushPromises) wait(ctx context.Context, pushID uint64) (*http.Request, error) {
+	p.mutex.Lock()
+	if p.received[pushID] {
+		p.mutex.Unlock()
+		return nil, errDuplicatePushID
+	}
+	c := p.get(pushID)
+	p.received[pushID] = true
+	p.mutex.Unlock()
+
+	defer func() {
+		p.mutex.Lock()
+		delete(p.promises, pushID)
+		p.mutex.Unlock()
+	}()
+	select {
+	case req := <-c:
+		return req, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *client) handlePushPromise(str io.Reader, f *pushPromiseFrame) requestError {
+	if c.opts.PushHandler == nil {
+		return newConnError(errorIDError, errors.New("received a PUSH_PROMISE frame, but Server Push is disabled"))
+	}
+	if f.PushID > maxPushID {
+		return newConnError(errorIDError, fmt.Errorf("received a PUSH_PROMISE frame for push ID %d (max: %d)", f.PushID, maxPushID))
+	}
+	hfs, rerr := c.readHeaderBlock(str, "PUSH_PROMISE", f.Length)
+	if rerr.err != nil {
+		return rerr
+	}
+	req, err := requestFromHeaders(hfs)
+	if err != nil {
+		return newConnError(errorGeneralProtocolError, err)
+	}
+	req.URL.Scheme = "https"
+	req.URL.Host = req.Host
+	req.RequestURI = ""
+	req.TLS = nil
+	c.pushPromises.promise(f.PushID, req)
+	return requestError{}
+}
+
+func (c *client) handlePushStream(str quic.ReceiveStream) {
+	pushID, err := quicvarint.Read(quicvarint.NewReader(str))
+	if err != nil {
+		c.logger.Debugf("reading push ID on stream %d failed: %s", str.StreamID(), err)
+		return
+	}
+	if pushID > maxPushID {
+		c.session.CloseWithError(quic.ApplicationErrorCode(errorIDError), "")
+		return
+	}
+	frame, err := parseNextFrame(str)
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(errorFrameError))
+		return
+	}
+	hf, ok := frame.(*headersFrame)
+	if !ok {
+		c.session.CloseWithError(quic.ApplicationErrorCode(errorFrameUnexpected), "")
+		return
+	}
+	hfs, rerr := c.readHeaderBlock(str, "HEADERS", hf.Length)
+	if rerr.err != nil {
+		c.abortPushStream(str, rerr)
+		return
+	}
+	res, rerr := c.responseFromHeaders(hfs)
+	if rerr.err != nil {
+		c.abortPushStream(str, rerr)
+		return
+	}
+	req, err := c.pushPromises.wait(c.session.Context(), pushID)
+	if err == errDuplicatePushID {
+		c.session.CloseWithError(quic.ApplicationErrorCode(errorIDError), err.Error())
+		return
+	}
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+		return
+	}
+	res.Request = req
+	res.ContentLength = -1
+	if clens, ok := res.Header["Content-Length"]; ok && len(clens) == 1 {
+		if clen64, err := strconv.ParseInt(clens[0], 10, 64); err == nil {
+			res.ContentLength = clen64
+		}
+	}
+	res.Body = newResponseBody(str, nil, func() {
+		c.session.CloseWithError(quic.ApplicationErrorCode(errorFrameUnexpected), "")
+	})
+	c.opts.PushHandler(req, res)
+}
+
+func (c *client) abortPushStream(str quic.ReceiveStream, rerr requestError) {
+	if rerr.connErr != 0 {
+		c.session.CloseWithError(quic.ApplicationErrorCode(rerr.connErr), rerr.err.Error())
+		return
+	}
+	str.CancelRead(quic.StreamErrorCode(rerr.streamErr))
+}
@@ -0,0 +1,85 @@
+package http3
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Push Promises", func() {
+	var p *pushPromises
+
+	BeforeEach(func() {
+		p = &pushPromises{}
+	})
+
+	It("matches a PUSH_PROMISE received before the push stream", func() {
+		req := &http.Request{Method: http.MethodGet}
+		p.promise(5, req)
+		Expect(p.promises).To(HaveLen(1))
+		r, err := p.wait(context.Background(), 5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r).To(Equal(req))
+		Expect(p.promises).To(BeEmpty())
+	})
+
+	It("matches a PUSH_PROMISE received after the push stream", func() {
+		req := &http.Request{Method: http.MethodGet}
+		reqChan := make(chan *http.Request)
+		go func() {
+			defer GinkgoRecover()
+			r, err := p.wait(context.Background(), 5)
+			Expect(err).ToNot(HaveOccurred())
+			reqChan <- r
+		}()
+		Eventually(func() int {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			return len(p.promises)
+		}).Should(Equal(1))
+		p.promise(5, req)
+		Eventually(reqChan).Should(Receive(Equal(req)))
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		Expect(p.promises).To(BeEmpty())
+	})
+
+	It("ignores PUSH_PROMISE frames for pushes that were already received", func() {
+		p.promise(5, &http.Request{})
+		_, err := p.wait(context.Background(), 5)
+		Expect(err).ToNot(HaveOccurred())
+		p.promise(5, &http.Request{})
+		Expect(p.promises).To(BeEmpty())
+	})
+
+	It("removes the entry when the push stream stops waiting", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := p.wait(ctx, 5)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(p.promises).To(BeEmpty())
+	})
+
+	It("rejects push streams using the same push ID", func() {
+		p.promise(5, &http.Request{})
+		_, err := p.wait(context.Background(), 5)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = p.wait(context.Background(), 5)
+		Expect(err).To(MatchError(errDuplicatePushID))
+	})
+
+	It("is bounded by the maximum push ID", func() {
+		for id := uint64(0); id <= maxPushID; id++ {
+			p.promise(id, &http.Request{})
+			p.promise(id, &http.Request{}) // the same push promised on a second request stream
+		}
+		Expect(p.promises).To(HaveLen(maxPushID + 1))
+		for id := uint64(0); id <= maxPushID; id++ {
+			_, err := p.wait(context.Background(), id)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(p.promises).To(BeEmpty())
+	})
+})
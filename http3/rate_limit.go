@@ -0,0 +1,84 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a request exceeds RoundTripper.PerHostRate, and RoundTripper.FailOnRateLimit is set.
+var ErrRateLimited = errors.New("http3: request rate limit for the host exceeded")
+
+// A tokenBucket limits the rate of requests to a host, see RoundTripper.PerHostRate.
+// It holds up to burst tokens, and is refilled at rate tokens per second.
+// Every request takes one token.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last call.
+// It must be called with the mutex held.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// allow takes a token, if one is available.
+func (b *tokenBucket) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// wait takes a token, and blocks until the token is available.
+// If the context is canceled before, the token is returned to the bucket.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mutex.Lock()
+	b.refill(time.Now())
+	b.tokens--
+	// the bucket is in debt, until the token has been refilled
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mutex.Lock()
+		b.tokens++
+		b.mutex.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,62 @@
+package http3
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate Limiting", func() {
+	It("paces requests", func() {
+		const rate = 100 // requests per second
+		b := newTokenBucket(rate, 1)
+		start := time.Now()
+		for i := 0; i < 10; i++ {
+			Expect(b.wait(context.Background())).To(Succeed())
+		}
+		// The first request is sent right away, every following one has to wait for a token.
+		Expect(time.Since(start)).To(And(
+			BeNumerically(">=", 9*time.Second/rate),
+			BeNumerically("<", scaleDuration(2*9*time.Second/rate)),
+		))
+	})
+
+	It("allows bursts", func() {
+		b := newTokenBucket(1, 5)
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			Expect(b.wait(context.Background())).To(Succeed())
+		}
+		Expect(time.Since(start)).To(BeNumerically("<", scaleDuration(20*time.Millisecond)))
+		Expect(b.allow()).To(BeFalse())
+	})
+
+	It("refills tokens", func() {
+		b := newTokenBucket(100, 1)
+		Expect(b.allow()).To(BeTrue())
+		Expect(b.allow()).To(BeFalse())
+		time.Sleep(15 * time.Millisecond)
+		Expect(b.allow()).To(BeTrue())
+	})
+
+	It("doesn't accumulate more tokens than the burst", func() {
+		b := newTokenBucket(1000, 2)
+		time.Sleep(20 * time.Millisecond)
+		Expect(b.allow()).To(BeTrue())
+		Expect(b.allow()).To(BeTrue())
+		Expect(b.allow()).To(BeFalse())
+	})
+
+	It("returns the token when the context is canceled", func() {
+		b := newTokenBucket(10, 1)
+		Expect(b.allow()).To(BeTrue())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(b.wait(ctx)).To(MatchError(context.DeadlineExceeded))
+		// The canceled request didn't use up the token that is refilled 100ms after the first request.
+		time.Sleep(100 * time.Millisecond)
+		Expect(b.allow()).To(BeTrue())
+	})
+})
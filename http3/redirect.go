@@ -0,0 +1,28 @@
+package http3
+
+import (
+	"errors"
+	"net/http"
+)
+
+// maxRedirects is the number of redirects that http.Client follows by default.
+const maxRedirects = 10
+
+// CheckRedirect can be used as the CheckRedirect function of an http.Client using the RoundTripper.
+// The RoundTripper only handles https:// URLs, so it can't follow redirects to other schemes, e.g. to http:// URLs.
+// For these redirects, CheckRedirect returns the redirect response to the application, without following it.
+// All other redirects are followed, using http.Client's default policy of following at most 10 redirects.
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if req.URL.Scheme != "https" {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// isRedirect says if the request was created by http.Client to follow a redirect.
+func isRedirect(req *http.Request) bool {
+	return req.Response != nil
+}
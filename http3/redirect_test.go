@@ -0,0 +1,56 @@
+package http3
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redirects", func() {
+	newRequest := func(url string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		Expect(err).ToNot(HaveOccurred())
+		return req
+	}
+
+	It("follows redirects to https URLs", func() {
+		via := []*http.Request{newRequest("https://quic.clemente.io/")}
+		Expect(CheckRedirect(newRequest("https://quic.clemente.io/foo"), via)).To(Succeed())
+	})
+
+	It("doesn't follow redirects to other schemes", func() {
+		via := []*http.Request{newRequest("https://quic.clemente.io/")}
+		Expect(CheckRedirect(newRequest("http://quic.clemente.io/"), via)).To(MatchError(http.ErrUseLastResponse))
+	})
+
+	It("stops after 10 redirects", func() {
+		var via []*http.Request
+		for i := 0; i < 10; i++ {
+			via = append(via, newRequest("https://quic.clemente.io/"))
+		}
+		Expect(CheckRedirect(newRequest("https://quic.clemente.io/foo"), via)).To(MatchError("stopped after 10 redirects"))
+	})
+
+	It("returns the redirect response when using an http.Client", func() {
+		// The TCP fallback is used, since there's no Alt-Svc entry for the server.
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://quic.clemente.io/insecure", http.StatusFound)
+		}))
+		defer server.Close()
+		rt := &RoundTripper{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		defer rt.Close()
+		client := &http.Client{Transport: rt, CheckRedirect: CheckRedirect}
+		rsp, err := client.Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusFound))
+		Expect(rsp.Header.Get("Location")).To(Equal("http://quic.clemente.io/insecure"))
+		Expect(rsp.Body.Close()).To(Succeed())
+
+		client.CheckRedirect = nil
+		_, err = client.Get(server.URL)
+		Expect(err).To(MatchError(ContainSubstring("http3: can't follow redirect to http://quic.clemente.io/insecure")))
+	})
+})
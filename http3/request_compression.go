@@ -0,0 +1,69 @@
+package http3
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const defaultCompressRequestBodyMinSize = 1 << 10 // 1 KB
+
+// shouldCompressRequestBody says if the body of req is large enough to be compressed, see RoundTripper.CompressRequestBody.
+func shouldCompressRequestBody(req *http.Request, minSize int64) bool {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if minSize <= 0 {
+		minSize = defaultCompressRequestBodyMinSize
+	}
+	return req.ContentLength >= minSize
+}
+
+// compressRequestBody returns a copy of req that sends the body compressed with gzip.
+func compressRequestBody(req *http.Request) *http.Request {
+	newReq := *req
+	newReq.Header = req.Header.Clone()
+	newReq.Header.Set("Content-Encoding", "gzip")
+	newReq.ContentLength = -1 // the length of the compressed body is not known in advance
+	newReq.Body = newGzipRequestBody(req.Body)
+	newReq.GetBody = nil
+	return &newReq
+}
+
+// gzipRequestBody compresses the body when it is read.
+// The compression only starts on the first call to Read.
+type gzipRequestBody struct {
+	body io.ReadCloser // the uncompressed body
+	pr   *io.PipeReader
+	pw   *io.PipeWriter
+	once sync.Once
+}
+
+var _ io.ReadCloser = &gzipRequestBody{}
+
+func newGzipRequestBody(body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	return &gzipRequestBody{body: body, pr: pr, pw: pw}
+}
+
+func (b *gzipRequestBody) Read(p []byte) (int, error) {
+	b.once.Do(func() { go b.compress() })
+	return b.pr.Read(p)
+}
+
+func (b *gzipRequestBody) compress() {
+	defer b.body.Close()
+	zw := gzip.NewWriter(b.pw)
+	_, err := io.Copy(zw, b.body)
+	if err == nil {
+		err = zw.Close()
+	}
+	b.pw.CloseWithError(err)
+}
+
+func (b *gzipRequestBody) Close() error {
+	// If the compression was started, closing the pipe makes it stop, and it closes the body.
+	b.once.Do(func() { b.body.Close() })
+	return b.pr.Close()
+}
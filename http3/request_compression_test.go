@@ -0,0 +1,89 @@
+package http3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type closeNotifyingBody struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (b *closeNotifyingBody) Close() error {
+	close(b.closed)
+	return nil
+}
+
+var _ = Describe("Request Body Compression", func() {
+	newRequest := func(body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "https://quic.clemente.io/upload", strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		return req
+	}
+
+	It("only compresses large enough bodies", func() {
+		Expect(shouldCompressRequestBody(newRequest(strings.Repeat("a", 1023)), 0)).To(BeFalse())
+		Expect(shouldCompressRequestBody(newRequest(strings.Repeat("a", 1024)), 0)).To(BeTrue())
+		Expect(shouldCompressRequestBody(newRequest("foobar"), 6)).To(BeTrue())
+		Expect(shouldCompressRequestBody(newRequest("foobar"), 7)).To(BeFalse())
+	})
+
+	It("doesn't compress bodies of unknown length", func() {
+		req := newRequest("foobar")
+		req.ContentLength = 0
+		Expect(shouldCompressRequestBody(req, 1)).To(BeFalse())
+		req.ContentLength = -1
+		Expect(shouldCompressRequestBody(req, 1)).To(BeFalse())
+	})
+
+	It("doesn't compress bodies that are already encoded", func() {
+		req := newRequest("foobar")
+		req.Header.Set("Content-Encoding", "br")
+		Expect(shouldCompressRequestBody(req, 1)).To(BeFalse())
+	})
+
+	It("compresses the body", func() {
+		req := newRequest("foobar")
+		req.Header.Set("Foo", "bar")
+		compressed := compressRequestBody(req)
+		Expect(compressed.Header.Get("Content-Encoding")).To(Equal("gzip"))
+		Expect(compressed.Header.Get("Foo")).To(Equal("bar"))
+		Expect(compressed.ContentLength).To(BeEquivalentTo(-1))
+		// the original request is not modified
+		Expect(req.Header.Get("Content-Encoding")).To(BeEmpty())
+		Expect(req.ContentLength).To(BeEquivalentTo(6))
+		zr, err := gzip.NewReader(compressed.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(io.ReadAll(zr)).To(Equal([]byte("foobar")))
+		Expect(compressed.Body.Close()).To(Succeed())
+	})
+
+	It("closes the body when it wasn't read", func() {
+		body := &mockBody{}
+		body.SetData([]byte("foobar"))
+		b := newGzipRequestBody(body)
+		Expect(b.Close()).To(Succeed())
+		Expect(body.closed).To(BeTrue())
+		_, err := b.Read([]byte{0})
+		Expect(err).To(MatchError(io.ErrClosedPipe))
+	})
+
+	It("returns errors from reading the body", func() {
+		closed := make(chan struct{})
+		body := &closeNotifyingBody{
+			Reader: io.MultiReader(strings.NewReader("foo"), &mockBody{readErr: io.ErrUnexpectedEOF}),
+			closed: closed,
+		}
+		b := newGzipRequestBody(body)
+		_, err := io.Copy(&bytes.Buffer{}, b)
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+		Eventually(closed).Should(BeClosed())
+	})
+})
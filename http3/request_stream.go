@@ -0,0 +1,147 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+var errRequestHeaderNotSent = errors.New("http3: the request header wasn't sent yet")
+
+// A RequestStream gives direct control over a request stream, without the net/http abstraction.
+// The request header is sent by SendRequestHeader, followed by the request body, which is written using Write.
+// Close closes the send direction of the stream.
+// The response header is read by ReadResponse, and the response body is read from the body of that response.
+type RequestStream interface {
+	// StreamID returns the ID of the QUIC stream.
+	StreamID() quic.StreamID
+	// SendRequestHeader sends the HEADERS frame for req. The body of req is not sent.
+	// The Accept-Encoding header is not added, and the response body is never decompressed.
+	SendRequestHeader(req *http.Request) error
+	// Write sends p in a DATA frame.
+	Write(p []byte) (int, error)
+	// Close closes the send direction of the stream, after the request body was sent.
+	Close() error
+	// ReadResponse reads the HEADERS frame of the response.
+	ReadResponse() (*http.Response, error)
+	// CancelRequest aborts the request, resetting both directions of the stream.
+	CancelRequest()
+}
+
+type requestStream struct {
+	str    quic.Stream
+	client *client
+
+	req     *http.Request // set by SendRequestHeader
+	reqDone chan struct{}
+	cancel  context.CancelFunc
+}
+
+var _ RequestStream = &requestStream{}
+
+// OpenRequestStream opens a new request stream, dialing the connection first if necessary.
+// The request is canceled when ctx is canceled.
+// The caller needs to close the body of the response, or call CancelRequest, when it is done with the stream.
+func (c *client) OpenRequestStream(ctx context.Context) (RequestStream, error) {
+	str, err := c.openStream(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	reqDone := make(chan struct{})
+	atomic.AddInt64(&c.inFlight, 1)
+	go func() {
+		defer c.requestCompleted()
+		defer cancel()
+		select {
+		case <-ctx.Done():
+			str.CancelWrite(quic.StreamErrorCode(errorRequestCanceled))
+			str.CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+		case <-reqDone:
+		}
+	}()
+	return &requestStream{
+		str:     str,
+		client:  c,
+		reqDone: reqDone,
+		cancel:  cancel,
+	}, nil
+}
+
+func (s *requestStream) StreamID() quic.StreamID { return s.str.StreamID() }
+
+func (s *requestStream) SendRequestHeader(req *http.Request) error {
+	if s.req != nil {
+		return errors.New("http3: the request header was already sent")
+	}
+	if authorityAddr("https", hostnameFromRequest(req)) != s.client.hostname {
+		return fmt.Errorf("http3: request for %s sent on a stream to %s", req.Host, s.client.hostname)
+	}
+	if err := s.client.requestWriter.writeHeaders(s.str, req, ""); err != nil {
+		return err
+	}
+	s.req = req
+	return nil
+}
+
+func (s *requestStream) Write(p []byte) (int, error) {
+	if s.req == nil {
+		return 0, errRequestHeaderNotSent
+	}
+	buf := &bytes.Buffer{}
+	(&dataFrame{Length: uint64(len(p))}).Write(buf)
+	if _, err := s.str.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return s.str.Write(p)
+}
+
+func (s *requestStream) Close() error {
+	return s.str.Close()
+}
+
+func (s *requestStream) ReadResponse() (*http.Response, error) {
+	if s.req == nil {
+		return nil, errRequestHeaderNotSent
+	}
+	rsp, rerr := s.client.readResponse(s.req, s.str, s.reqDone, "", nil)
+	if rerr.err != nil {
+		s.client.abortRequest(s.str, rerr)
+		s.cancel()
+		return nil, rerr.err
+	}
+	return rsp, nil
+}
+
+func (s *requestStream) CancelRequest() {
+	s.cancel()
+}
+
+// OpenRequestStream opens a new request stream on the QUIC connection to host,
+// dialing a new connection if there's no connection yet. See RequestStream for details.
+func (r *RoundTripper) OpenRequestStream(ctx context.Context, host string) (RequestStream, error) {
+	return r.openRequestStream(ctx, authorityAddr("https", host), RoundTripOpt{})
+}
+
+func (r *RoundTripper) openRequestStream(ctx context.Context, hostname string, opt RoundTripOpt) (RequestStream, error) {
+	cl, err := r.getClient(hostname, opt)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := cl.(*client)
+	if !ok {
+		return nil, errors.New("http3: request streams are not supported by this client")
+	}
+	str, err := c.OpenRequestStream(ctx)
+	if errors.Is(err, errStreamLimitReached) && !opt.overflow {
+		// see OpenConnectionOnStreamLimit
+		opt.overflow = true
+		return r.openRequestStream(ctx, hostname, opt)
+	}
+	return str, err
+}
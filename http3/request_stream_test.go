@@ -0,0 +1,175 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/marten-seemann/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request Stream", func() {
+	var (
+		cl           *client
+		sess         *mockquic.MockEarlySession
+		str          *mockquic.MockStream
+		req          *http.Request
+		testDone     chan struct{}
+		origDialAddr = dialAddr
+	)
+
+	BeforeEach(func() {
+		origDialAddr = dialAddr
+		testDone = make(chan struct{})
+		handshakeCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+		done := testDone
+		controlStr := mockquic.NewMockStream(mockCtrl)
+		controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+		sess = mockquic.NewMockEarlySession(mockCtrl)
+		sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+		sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+			<-done
+			return nil, errors.New("test done")
+		}).AnyTimes()
+		sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+		sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+		str = mockquic.NewMockStream(mockCtrl)
+		sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil).AnyTimes()
+		dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return sess, nil }
+		var err error
+		cl, err = newClient("quic.clemente.io:443", nil, &roundTripperOpts{}, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		req, err = http.NewRequest(http.MethodPost, "https://quic.clemente.io/upload", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		close(testDone)
+		dialAddr = origDialAddr
+	})
+
+	getResponse := func(status string, body []byte) *bytes.Buffer {
+		headerBuf := &bytes.Buffer{}
+		enc := qpack.NewEncoder(headerBuf)
+		Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: status})).To(Succeed())
+		Expect(enc.Close()).To(Succeed())
+		buf := &bytes.Buffer{}
+		(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+		buf.Write(headerBuf.Bytes())
+		(&dataFrame{Length: uint64(len(body))}).Write(buf)
+		buf.Write(body)
+		return buf
+	}
+
+	It("sends the request and reads the response", func() {
+		sent := &bytes.Buffer{}
+		str.EXPECT().Write(gomock.Any()).DoAndReturn(sent.Write).AnyTimes()
+		rspBuf := getResponse("201", []byte("foobar"))
+		str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+		str.EXPECT().Close()
+		str.EXPECT().CancelRead(gomock.Any())
+		rstr, err := cl.OpenRequestStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.requestsInFlight()).To(BeEquivalentTo(1))
+		Expect(rstr.SendRequestHeader(req)).To(Succeed())
+		_, err = rstr.Write([]byte("lorem"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rstr.Write([]byte("ipsum"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rstr.Close()).To(Succeed())
+
+		// check what was sent on the stream
+		frame, err := parseNextFrame(sent)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&headersFrame{}))
+		headerBlock := make([]byte, frame.(*headersFrame).Length)
+		_, err = io.ReadFull(sent, headerBlock)
+		Expect(err).ToNot(HaveOccurred())
+		hfs, err := qpack.NewDecoder(nil).DecodeFull(headerBlock)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(hfs).To(ContainElement(qpack.HeaderField{Name: ":method", Value: "POST"}))
+		Expect(hfs).To(ContainElement(qpack.HeaderField{Name: ":path", Value: "/upload"}))
+		for _, hf := range hfs {
+			Expect(hf.Name).ToNot(Equal("accept-encoding"))
+		}
+		expected := &bytes.Buffer{}
+		(&dataFrame{Length: 5}).Write(expected)
+		expected.WriteString("lorem")
+		(&dataFrame{Length: 5}).Write(expected)
+		expected.WriteString("ipsum")
+		Expect(sent.Bytes()).To(Equal(expected.Bytes()))
+
+		rsp, err := rstr.ReadResponse()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(201))
+		Expect(io.ReadAll(rsp.Body)).To(Equal([]byte("foobar")))
+		Expect(rsp.Body.Close()).To(Succeed())
+		Eventually(cl.requestsInFlight).Should(BeZero())
+	})
+
+	It("requires the request header to be sent first", func() {
+		rstr, err := cl.OpenRequestStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rstr.Write([]byte("foobar"))
+		Expect(err).To(MatchError(errRequestHeaderNotSent))
+		_, err = rstr.ReadResponse()
+		Expect(err).To(MatchError(errRequestHeaderNotSent))
+		str.EXPECT().CancelWrite(quic.StreamErrorCode(errorRequestCanceled))
+		str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled))
+		rstr.CancelRequest()
+		Eventually(cl.requestsInFlight).Should(BeZero())
+	})
+
+	It("refuses requests for a different host", func() {
+		rstr, err := cl.OpenRequestStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rstr.SendRequestHeader(req)).To(MatchError("http3: request for example.com sent on a stream to quic.clemente.io:443"))
+		str.EXPECT().CancelWrite(gomock.Any())
+		str.EXPECT().CancelRead(gomock.Any())
+		rstr.CancelRequest()
+		Eventually(cl.requestsInFlight).Should(BeZero())
+	})
+
+	It("cancels the stream when the context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		rstr, err := cl.OpenRequestStream(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+		Expect(rstr.SendRequestHeader(req)).To(Succeed())
+		canceled := make(chan struct{})
+		str.EXPECT().CancelWrite(quic.StreamErrorCode(errorRequestCanceled))
+		str.EXPECT().CancelRead(quic.StreamErrorCode(errorRequestCanceled)).Do(func(quic.StreamErrorCode) { close(canceled) })
+		cancel()
+		Eventually(canceled).Should(BeClosed())
+		Eventually(cl.requestsInFlight).Should(BeZero())
+	})
+
+	It("closes the session on connection errors", func() {
+		str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+		rspBuf := &bytes.Buffer{}
+		(&dataFrame{Length: 6}).Write(rspBuf)
+		rspBuf.WriteString("foobar")
+		str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+		str.EXPECT().CancelWrite(gomock.Any())
+		str.EXPECT().CancelRead(gomock.Any())
+		sess.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorFrameUnexpected), gomock.Any())
+		rstr, err := cl.OpenRequestStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rstr.SendRequestHeader(req)).To(Succeed())
+		_, err = rstr.ReadResponse()
+		Expect(err).To(MatchError("expected first frame to be a HEADERS frame"))
+		Eventually(cl.requestsInFlight).Should(BeZero())
+	})
+})
@@ -25,6 +25,8 @@ type requestWriter struct {
 	encoder   *qpack.Encoder
 	headerBuf *bytes.Buffer
 
+	userAgent string
+
 	logger utils.Logger
 }
 
@@ -34,13 +36,16 @@ func newRequestWriter(logger utils.Logger) *requestWriter {
 	return &requestWriter{
 		encoder:   encoder,
 		headerBuf: headerBuf,
+		userAgent: defaultUserAgent,
 		logger:    logger,
 	}
 }
 
-func (w *requestWriter) WriteRequest(str quic.Stream, req *http.Request, gzip bool) error {
+// WriteRequest writes the request to the stream.
+// If acceptEncoding is not empty, it is sent as the Accept-Encoding header.
+func (w *requestWriter) WriteRequest(str quic.Stream, req *http.Request, acceptEncoding string) error {
 	buf := &bytes.Buffer{}
-	if err := w.writeHeaders(buf, req, gzip); err != nil {
+	if err := w.writeHeaders(buf, req, acceptEncoding); err != nil {
 		return err
 	}
 	if _, err := str.Write(buf.Bytes()); err != nil {
@@ -90,12 +95,12 @@ func (w *requestWriter) WriteRequest(str quic.Stream, req *http.Request, gzip bo
 	return nil
 }
 
-func (w *requestWriter) writeHeaders(wr io.Writer, req *http.Request, gzip bool) error {
+func (w *requestWriter) writeHeaders(wr io.Writer, req *http.Request, acceptEncoding string) error {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 	defer w.encoder.Close()
 
-	if err := w.encodeHeaders(req, gzip, "", actualContentLength(req)); err != nil {
+	if err := w.encodeHeaders(req, acceptEncoding, "", actualContentLength(req)); err != nil {
 		return err
 	}
 
@@ -114,7 +119,7 @@ func (w *requestWriter) writeHeaders(wr io.Writer, req *http.Request, gzip bool)
 
 // copied from net/transport.go
 
-func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) error {
+func (w *requestWriter) encodeHeaders(req *http.Request, acceptEncoding string, trailers string, contentLength int64) error {
 	host := req.Host
 	if host == "" {
 		host = req.URL.Host
@@ -207,11 +212,11 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		if shouldSendReqContentLength(req.Method, contentLength) {
 			f("content-length", strconv.FormatInt(contentLength, 10))
 		}
-		if addGzipHeader {
-			f("accept-encoding", "gzip")
+		if acceptEncoding != "" {
+			f("accept-encoding", acceptEncoding)
 		}
 		if !didUA {
-			f("user-agent", defaultUserAgent)
+			f("user-agent", w.userAgent)
 		}
 	}
 
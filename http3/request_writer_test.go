@@ -60,7 +60,7 @@ var _ = Describe("Request Writer", func() {
 		str.EXPECT().Close()
 		req, err := http.NewRequest("GET", "https://quic.clemente.io/index.html?foo=bar", nil)
 		Expect(err).ToNot(HaveOccurred())
-		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
 		headerFields := decode(strBuf)
 		Expect(headerFields).To(HaveKeyWithValue(":authority", "quic.clemente.io"))
 		Expect(headerFields).To(HaveKeyWithValue(":method", "GET"))
@@ -75,7 +75,7 @@ var _ = Describe("Request Writer", func() {
 		postData := bytes.NewReader([]byte("foobar"))
 		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", postData)
 		Expect(err).ToNot(HaveOccurred())
-		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
 
 		Eventually(closed).Should(BeClosed())
 		headerFields := decode(strBuf)
@@ -96,7 +96,7 @@ var _ = Describe("Request Writer", func() {
 		str.EXPECT().Close().Do(func() { close(closed) })
 		req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", &foobarReader{})
 		Expect(err).ToNot(HaveOccurred())
-		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
 
 		Eventually(closed).Should(BeClosed())
 		headerFields := decode(strBuf)
@@ -122,16 +122,56 @@ var _ = Describe("Request Writer", func() {
 		}
 		req.AddCookie(cookie1)
 		req.AddCookie(cookie2)
-		Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
 		headerFields := decode(strBuf)
 		Expect(headerFields).To(HaveKeyWithValue("cookie", `Cookie #1="Value #1"; Cookie #2="Value #2"`))
 	})
 
+	It("sends the default User-Agent", func() {
+		str.EXPECT().Close()
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
+		headerFields := decode(strBuf)
+		Expect(headerFields).To(HaveKeyWithValue("user-agent", defaultUserAgent))
+	})
+
+	It("sends the configured User-Agent", func() {
+		rw.userAgent = "foobar/1.0"
+		str.EXPECT().Close()
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
+		headerFields := decode(strBuf)
+		Expect(headerFields).To(HaveKeyWithValue("user-agent", "foobar/1.0"))
+	})
+
+	It("preserves the User-Agent set on the request", func() {
+		rw.userAgent = "foobar/1.0"
+		str.EXPECT().Close()
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("User-Agent", "my-client/2.0")
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
+		headerFields := decode(strBuf)
+		Expect(headerFields).To(HaveKeyWithValue("user-agent", "my-client/2.0"))
+	})
+
+	It("omits the User-Agent if the request sets an empty one", func() {
+		str.EXPECT().Close()
+		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("User-Agent", "")
+		Expect(rw.WriteRequest(str, req, "")).To(Succeed())
+		headerFields := decode(strBuf)
+		Expect(headerFields).ToNot(HaveKey("user-agent"))
+	})
+
 	It("adds the header for gzip support", func() {
 		str.EXPECT().Close()
 		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
 		Expect(err).ToNot(HaveOccurred())
-		Expect(rw.WriteRequest(str, req, true)).To(Succeed())
+		Expect(rw.WriteRequest(str, req, "gzip")).To(Succeed())
 		headerFields := decode(strBuf)
 		Expect(headerFields).To(HaveKeyWithValue("accept-encoding", "gzip"))
 	})
@@ -0,0 +1,39 @@
+package http3
+
+import (
+	"net/http"
+	"time"
+)
+
+// A RetryPolicy decides if a request that failed is automatically sent again.
+// Requests that have a body that can't be sent again (see http.Request.GetBody) are never retried.
+type RetryPolicy interface {
+	// ShouldRetry is called when the attempt-th attempt to send req failed with err, starting at 1.
+	// If it returns true, the request is sent again after the returned delay.
+	ShouldRetry(req *http.Request, attempt int, err error) (bool, time.Duration)
+}
+
+// DefaultRetryPolicy is the RetryPolicy used if RoundTripper.RetryPolicy is nil.
+// It retries requests right away if the server rejected them with H3_REQUEST_REJECTED,
+// and idempotent requests if the connection was lost, e.g. due to a stateless reset.
+type DefaultRetryPolicy struct {
+	// MaxRetries has the same meaning as RoundTripper.MaxRetries.
+	MaxRetries int
+}
+
+var _ RetryPolicy = &DefaultRetryPolicy{}
+
+// ShouldRetry implements the RetryPolicy interface.
+func (p *DefaultRetryPolicy) ShouldRetry(req *http.Request, attempt int, err error) (bool, time.Duration) {
+	return attempt <= p.maxRetries() && canRetryRequest(req, err), 0
+}
+
+func (p *DefaultRetryPolicy) maxRetries() int {
+	if p.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	if p.MaxRetries < 0 {
+		return 0
+	}
+	return p.MaxRetries
+}
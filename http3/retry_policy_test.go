@@ -0,0 +1,73 @@
+package http3
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry Policy", func() {
+	var req *http.Request
+
+	BeforeEach(func() {
+		var err error
+		req, err = http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	rejectedErr := &quic.StreamError{ErrorCode: quic.StreamErrorCode(errorRequestRejected)}
+
+	It("retries rejected requests right away", func() {
+		p := &DefaultRetryPolicy{}
+		retry, delay := p.ShouldRetry(req, 1, rejectedErr)
+		Expect(retry).To(BeTrue())
+		Expect(delay).To(BeZero())
+		retry, _ = p.ShouldRetry(req, 1, errors.New("test error"))
+		Expect(retry).To(BeFalse())
+	})
+
+	It("retries idempotent requests after a stateless reset", func() {
+		p := &DefaultRetryPolicy{}
+		retry, _ := p.ShouldRetry(req, 1, &quic.StatelessResetError{})
+		Expect(retry).To(BeTrue())
+		req.Method = http.MethodPost
+		retry, _ = p.ShouldRetry(req, 1, &quic.StatelessResetError{})
+		Expect(retry).To(BeFalse())
+	})
+
+	It("limits the number of retries", func() {
+		p := &DefaultRetryPolicy{}
+		for attempt := 1; attempt <= defaultMaxRetries; attempt++ {
+			retry, _ := p.ShouldRetry(req, attempt, rejectedErr)
+			Expect(retry).To(BeTrue())
+		}
+		retry, _ := p.ShouldRetry(req, defaultMaxRetries+1, rejectedErr)
+		Expect(retry).To(BeFalse())
+
+		p = &DefaultRetryPolicy{MaxRetries: 5}
+		retry, _ = p.ShouldRetry(req, 5, rejectedErr)
+		Expect(retry).To(BeTrue())
+		retry, _ = p.ShouldRetry(req, 6, rejectedErr)
+		Expect(retry).To(BeFalse())
+
+		p = &DefaultRetryPolicy{MaxRetries: -1}
+		retry, _ = p.ShouldRetry(req, 1, rejectedErr)
+		Expect(retry).To(BeFalse())
+	})
+
+	It("doesn't retry requests with a body that can't be sent again", func() {
+		req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", strings.NewReader("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		p := &DefaultRetryPolicy{}
+		retry, _ := p.ShouldRetry(req, 1, rejectedErr)
+		Expect(retry).To(BeTrue())
+		req.GetBody = nil
+		retry, _ = p.ShouldRetry(req, 1, rejectedErr)
+		Expect(retry).To(BeFalse())
+	})
+})
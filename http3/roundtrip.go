@@ -1,15 +1,20 @@
 package http3
 
 import (
+	"bytes"
+	"container/list"
 	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptrace"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ebi-yade/altsvc-go"
@@ -24,6 +29,7 @@ type roundTripCloser interface {
 }
 
 // RoundTripper implements the http.RoundTripper interface
+// It only handles https URLs. When using it with an http.Client, see CheckRedirect for redirects to other schemes.
 type RoundTripper struct {
 	mutex sync.Mutex
 
@@ -37,19 +43,99 @@ type RoundTripper struct {
 	// uncompressed.
 	DisableCompression bool
 
+	// EnableZstd, if true, additionally requests zstd compression,
+	// when the Transport requests compression on its own (see DisableCompression).
+	// Responses with a "Content-Encoding: zstd" are then transparently decoded.
+	EnableZstd bool
+
+	// DisableDecompressionForContentTypes lists the media types (e.g. "video/mp4", or "image/*" for all subtypes)
+	// of responses that are not transparently decompressed, when the Transport requested compression on its own.
+	// This is useful for content that is already compressed.
+	// The response body and the Content-Encoding header are then passed to the application as received.
+	// Regardless of this setting, compression is never requested for requests with a Range header,
+	// since the byte offsets refer to the compressed representation.
+	DisableDecompressionForContentTypes []string
+
+	// CompressRequestBody, if true, compresses the body of requests sent using HTTP/3 with gzip,
+	// and sets the "Content-Encoding: gzip" request header.
+	// Only request bodies with a known length (see http.Request.ContentLength) of at least
+	// CompressRequestBodyMinSize bytes are compressed, and only if the request doesn't have
+	// a Content-Encoding header already.
+	CompressRequestBody bool
+	// CompressRequestBodyMinSize is the minimum size of request bodies that are compressed.
+	// If zero, a default of 1 KB is used.
+	CompressRequestBodyMinSize int64
+
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client. If nil, the default configuration is used.
+	// The client certificates (Certificates and GetClientCertificate) are also
+	// presented when falling back to TCP.
+	// Encrypted Client Hello (ECH) is not supported, since neither crypto/tls
+	// nor the qtls versions used for QUIC implement it.
 	TLSClientConfig *tls.Config
 
+	// RequireOCSPStaple enforces a must-staple policy, for both QUIC and TCP connections:
+	// The handshake fails if the server doesn't staple an OCSP response, if the response can't be verified,
+	// or if it says that the server's certificate was revoked.
+	// Regardless of this setting, a stapled OCSP response is available in Response.TLS.OCSPResponse.
+	RequireOCSPStaple bool
+
+	// PinnedCertificates contains DER-encoded certificates.
+	// If set, the handshake fails unless the certificate chain presented by the server
+	// (for both QUIC and TCP connections) contains one of these certificates.
+	// This check is performed in addition to the verification of the certificate chain
+	// (unless TLSClientConfig.InsecureSkipVerify is set), so it doesn't replace CA trust.
+	PinnedCertificates [][]byte
+
+	// SessionTicketStore, if set, persists the session tickets issued by servers for QUIC connections,
+	// such that sessions can be resumed (and 0-RTT can be used) after the process restarted,
+	// see NewFileSessionTicketStore. Tickets are stored per host.
+	// It takes precedence over TLSClientConfig.ClientSessionCache for QUIC connections.
+	SessionTicketStore SessionTicketStore
+	sessionCache       tls.ClientSessionCache
+
 	// QuicConfig is the quic.Config used for dialing new connections.
 	// If nil, reasonable default values will be used.
+	// The context passed to the TracerForConnection method of its Tracer carries the values of the context
+	// that the connection was dialed for, i.e. of the request that triggered dialing, or of Warmup / ProbeH3.
+	// This can be used to correlate connections with requests, e.g. using a request ID.
 	QuicConfig *quic.Config
 
+	// Versions are the QUIC versions offered when dialing new connections, in order of preference.
+	// This is a shortcut for setting QuicConfig.Versions: It's used if QuicConfig is nil,
+	// or if it doesn't set any Versions. Versions set in the QuicConfig take precedence.
+	// If the version negotiation fails, or the server doesn't accept the ALPN, the connection is dialed again
+	// using the next version. Up to 3 versions are tried.
+	Versions []quic.VersionNumber
+
 	// Enable support for HTTP/3 datagrams.
 	// If set to true, QuicConfig.EnableDatagram will be set.
 	// See https://www.ietf.org/archive/id/draft-schinazi-masque-h3-datagram-02.html.
 	EnableDatagrams bool
 
+	// DisablePathMTUDiscovery disables Path MTU Discovery for the QUIC connections.
+	// Some networks drop the (larger) probe packets in a way that breaks the connection.
+	// If set to true, QuicConfig.DisablePathMTUDiscovery will be set.
+	DisablePathMTUDiscovery bool
+
+	// TokenStore, if set, stores the address validation tokens that servers issue in NEW_TOKEN frames,
+	// and presents them when dialing new connections to the same server.
+	// This allows the server to skip address validation (e.g. a Retry) on reconnect, saving a round trip.
+	// Tokens are not shared with other servers, see quic.NewLRUTokenStore.
+	// If set, QuicConfig.TokenStore will be set.
+	TokenStore quic.TokenStore
+
+	// InitialCongestionWindow is the initial congestion window of the QUIC connections, in packets.
+	// On links with a high bandwidth-delay product, a larger initial window speeds up the first round trips of a download.
+	// If set, QuicConfig.InitialCongestionWindow will be set.
+	InitialCongestionWindow uint32
+
+	// StreamScheduler, if set, decides the order in which the streams of a QUIC connection send their data,
+	// e.g. to prioritize some request bodies over others.
+	// It overrides the default round-robin scheduling, and is shared by the connections to all hosts.
+	// If set, QuicConfig.StreamScheduler will be set.
+	StreamScheduler quic.StreamScheduler
+
 	// Dial specifies an optional dial function for creating QUIC
 	// connections for requests.
 	// If Dial is nil, quic.DialAddrEarly will be used.
@@ -60,12 +146,285 @@ type RoundTripper struct {
 	// Zero means to use a default limit.
 	MaxResponseHeaderBytes int64
 
+	// MaxResponseBodyBytes specifies a limit on how many bytes of a response body are read.
+	// Reading a larger response body fails with a ResponseBodyTooLargeError once the limit is exceeded,
+	// and the rest of the body is not received.
+	// The limit applies to the body as it's received from the server, i.e. before decompressing it.
+	// Zero means no limit.
+	MaxResponseBodyBytes int64
+
+	// ResponseHeaderTimeout, if non-zero, specifies the amount of time to wait for the server's
+	// response headers after fully writing the request (including its body, if any).
+	// This time does not include the time to read the response body.
+	// When the timeout expires, the stream is reset, and the request fails with an ErrResponseHeaderTimeout.
+	// It also applies to requests sent using the TCP fallback, see http.Transport.ResponseHeaderTimeout.
+	ResponseHeaderTimeout time.Duration
+
+	// ResponseBodyIdleTimeout, if set, detects response bodies that were abandoned by the application,
+	// i.e. bodies that were neither read until the end nor closed.
+	// If a body isn't read from for ResponseBodyIdleTimeout, the stream is reset,
+	// so the server stops sending the rest of the body, and the request is considered done.
+	// Reading from the body afterwards fails with a ResponseBodyAbandonedError.
+	// Zero means that bodies are never abandoned.
+	ResponseBodyIdleTimeout time.Duration
+
+	// IdleReadTimeout, if set, detects stalled response bodies, e.g. of streaming responses.
+	// If a Read of the body doesn't receive any data for IdleReadTimeout, the stream is reset,
+	// and the Read fails with a ResponseBodyReadTimeoutError (which is a net.Error with Timeout() true).
+	// Unlike for the ResponseBodyIdleTimeout, the time that the application doesn't read from the body isn't counted.
+	// It doesn't apply to requests sent using the TCP fallback.
+	IdleReadTimeout time.Duration
+
+	// UserAgent is sent in the User-Agent header of requests that don't set one.
+	// Requests that explicitly set an empty User-Agent header are sent without it.
+	// If empty, "quic-go HTTP/3" is used.
+	UserAgent string
+
+	// BrowserProfile, if set, makes the QUIC connections resemble those of a browser, e.g. BrowserProfileChrome().
+	// It sets the User-Agent (unless UserAgent is set), the HTTP/3 SETTINGS and the TLS curve preferences.
+	// It doesn't apply to requests sent using the TCP fallback.
+	BrowserProfile *BrowserProfile
+
+	// BufferPool, if set, provides the buffers used when response bodies are copied
+	// using io.Copy (or any other user of io.WriterTo).
+	// If nil, a default pool of 32 KB buffers is used.
+	BufferPool BufferPool
+
+	// OnResponseChunk, if set, is called every time a chunk of a response body was read completely,
+	// i.e. after the application read all bytes of a DATA frame from the response body.
+	// The response body is never buffered, so this allows processing streamed responses (e.g. server-sent events)
+	// chunk by chunk. quic-go's server sends every write of the http.Handler in a separate DATA frame.
+	// n is the size of the chunk, before decompressing the response body.
+	OnResponseChunk func(req *http.Request, n int)
+
+	// PushHandler is called for every response pushed by the server.
+	// If nil, Server Push is refused: the client never sends a MAX_PUSH_ID frame,
+	// and closes the connection with H3_ID_ERROR if the server attempts to push.
+	// The handler is responsible for reading and closing the response body.
+	PushHandler func(pushed *http.Request, rsp *http.Response)
+
+	// MaxRetries is the maximum number of times a request is automatically retried,
+	// across all causes, e.g. when the server rejected the request with H3_REQUEST_REJECTED,
+	// or when the connection was closed by a stateless reset.
+	// Requests are only retried if the body can be sent again, see http.Request.GetBody.
+	// If zero, a default of 2 retries is used. If negative, requests are never retried.
+	// MaxRetries is ignored if a RetryPolicy is set.
+	MaxRetries int
+
+	// RetryPolicy decides if requests that failed are automatically retried, and how long to wait before retrying.
+	// If nil, a DefaultRetryPolicy using MaxRetries is used.
+	RetryPolicy RetryPolicy
+
+	// RetryBodyBufferSize makes request bodies that can't be sent again replayable, so that the request can be retried:
+	// If a request has a body, but no GetBody, and its ContentLength is at most RetryBodyBufferSize,
+	// the body is read into memory before sending the request, and GetBody is set on the request that is sent.
+	// Bodies of unknown length are never buffered.
+	// If zero, request bodies are not buffered, and requests without GetBody are not retried.
+	RetryBodyBufferSize int64
+
+	// HedgeDelay enables request hedging, to reduce the tail latency of idempotent requests sent using HTTP/3:
+	// If no response was received after HedgeDelay, a duplicate of the request is sent on a second connection to the host.
+	// The response that arrives first is used, and the other request is canceled.
+	// Requests are only hedged if the body can be sent again, see http.Request.GetBody.
+	// If zero, requests are not hedged.
+	HedgeDelay time.Duration
+
+	// AddressFamilyPreference restricts the addresses that are dialed to one address family,
+	// both for QUIC and for the TCP fallback. This is useful on networks with broken IPv6.
+	// By default, the addresses are used as returned by the resolver.
+	AddressFamilyPreference AddressFamily
+
+	// DialAddrOverride, if set, is called with the authority (host:port) of the origin
+	// every time a new connection is dialed, both for QUIC and for the TCP fallback.
+	// If it returns true, the returned address is dialed instead, e.g. to route the connection through a fixed IP address.
+	// The address is dialed as is, AddressFamilyPreference is not applied.
+	// The TLS ServerName and the :authority of the requests remain the origin.
+	DialAddrOverride func(host string) (string, bool)
+
+	// ConnectionAffinity, if set, derives an affinity key from every request, e.g. from a session cookie
+	// (see CookieAffinity and HeaderAffinity). This is needed for backends that keep state per connection:
+	// Requests to the same host with the same key are always sent on the same QUIC connection,
+	// and requests with different keys never share a connection.
+	// Requests with an empty key use the default connection. The key applies in addition to RoundTripOpt.ConnectionKey.
+	// Every key costs a separate QUIC connection, see MaxAffinityConnsPerHost.
+	ConnectionAffinity func(*http.Request) string
+	// MaxAffinityConnsPerHost limits the number of connections to a host that are dialed for ConnectionAffinity keys.
+	// Every distinct key needs its own handshake, and keeps the state of its connection in memory.
+	// Without a limit, the connections of keys that aren't used any more are only closed by IdleConnTimeout,
+	// or by the QUIC idle timeout.
+	// When the limit is reached, dialing a connection for a new key closes the affinity connection
+	// that has been idle for the longest time. Connections with requests in flight are never closed,
+	// so the limit is exceeded while all of them are busy.
+	// Zero means no limit.
+	MaxAffinityConnsPerHost int
+
+	// PathFailureTimeout enables detecting broken paths, e.g. when the client changed networks,
+	// or when a NAT rebinding occurred.
+	// If no packets are received for PathFailureTimeout after sending packets that the server needs to acknowledge,
+	// the connection is closed, and a new connection is dialed for subsequent requests.
+	// Idempotent requests that were in flight are retried on the new connection (see MaxRetries).
+	// It should be significantly larger than the round-trip time.
+	// If zero, broken paths are only detected by the idle timeout of the connection.
+	PathFailureTimeout time.Duration
+
+	// MaxConcurrentDials limits the number of QUIC connections that are dialed at the same time,
+	// to avoid a storm of handshakes when many new hosts are contacted at once.
+	// Dials beyond this limit wait until one of the running dials completed.
+	// Requests canceled while waiting return right away, but the connection is still dialed for later requests.
+	// If zero, the number of concurrent dials is not limited.
+	MaxConcurrentDials int
+	dialSlots          chan struct{}
+
+	// the transports used when falling back to TCP, see tcpTransport
+	tcpTransports map[string]*http.Transport
+
+	// PerHostRate limits the rate of requests sent to each host, in requests per second.
+	// Requests to a host are limited using a token bucket, which allows bursts of PerHostBurst requests.
+	// Requests exceeding the rate wait until they are allowed to be sent, or until their context is canceled.
+	// If zero, the request rate is not limited.
+	PerHostRate float64
+	// PerHostBurst is the number of requests that can be sent to a host at once, see PerHostRate.
+	// If zero, a burst of 1 is used, i.e. requests are paced at PerHostRate.
+	PerHostBurst int
+	// FailOnRateLimit makes requests exceeding PerHostRate fail with ErrRateLimited, instead of waiting.
+	FailOnRateLimit bool
+	rateLimiters    map[string]*tokenBucket
+
+	// OnConnectionIdle, if set, is called for QUIC connections that don't have any requests in flight,
+	// once they have been idle for ConnectionIdleThreshold, and then every ConnectionIdleThreshold
+	// for as long as they stay idle.
+	// host is the authority (host:port) of the connection, and idleFor the time since the last request completed.
+	// This allows applications to decide if a connection should be closed or kept alive.
+	OnConnectionIdle func(host string, idleFor time.Duration)
+	// ConnectionIdleThreshold is the idle time after which OnConnectionIdle is called.
+	// If zero, 30 seconds is used.
+	ConnectionIdleThreshold time.Duration
+	// IdleConnTimeout, if set, is the time after which a QUIC connection that doesn't have any requests in flight is closed,
+	// similar to http.Transport.IdleConnTimeout. The next request to the host dials a new connection.
+	// It is independent of the QUIC idle timeout (see quic.Config.MaxIdleTimeout),
+	// which closes the connection if no packets are received, e.g. when the server went away.
+	// Zero means no limit.
+	IdleConnTimeout time.Duration
+
+	// OnStreamLimitReached, if set, is called when a request can't be sent right away,
+	// because the server's stream limit (see MAX_STREAMS in RFC 9000) on the connection to host was reached.
+	// Unless OpenConnectionOnStreamLimit is set, the request is sent once the server allows opening a new stream.
+	OnStreamLimitReached func(host string)
+	// OpenConnectionOnStreamLimit opens a second QUIC connection to a host when the server's stream limit
+	// on the first connection was reached, and sends the request on that connection.
+	// If the stream limit is reached on the second connection as well, requests wait for a new stream.
+	OpenConnectionOnStreamLimit bool
+
+	// MaxSendRate limits the rate at which QUIC connections send packets, in bytes per second.
+	// Packets are paced, such that the send rate never exceeds MaxSendRate.
+	// This is intended for testing, e.g. to simulate constrained links.
+	// It has no effect if Dial is set.
+	// If zero, the send rate is not limited.
+	MaxSendRate int
+
+	// PacketLoss drops packets sent and received on QUIC connections, to test the loss recovery.
+	// This is only intended for testing: Requests fail unless the QUIC_GO_ALLOW_PACKET_LOSS_INJECTION
+	// environment variable is set to 1.
+	// It has no effect if Dial is set.
+	PacketLoss *PacketLossConfig
+
+	// EnableLatencyHistograms enables collecting histograms of the handshake duration,
+	// the time to first byte and the total duration of requests sent using HTTP/3.
+	// They can be retrieved using LatencySnapshot.
+	EnableLatencyHistograms bool
+	latency                 *latencyHistograms
+
+	// EnableConnectionStats enables collecting statistics of QUIC connections,
+	// e.g. the RTT and the number of lost packets. They can be retrieved using ConnectionStats.
+	EnableConnectionStats bool
+
+	// AltSvcSoftExpiry blends the two modes of ConnectionDiscovery.
+	// While a cached h3 Alt-Svc entry is valid, HTTP/3 is used right away.
+	// Within the last AltSvcSoftExpiry before the entry expires, HTTP/3 is raced against TCP
+	// (as with ConnectionDiscoveryHappyEyeballs), refreshing the entry from the Alt-Svc header of the TCP response.
+	// Once the entry has expired, the host is probed again, using the ConnectionDiscovery mode.
+	// If zero, Alt-Svc entries are used until they expire.
+	AltSvcSoftExpiry time.Duration
+
+	// ForceTCPHTTP1, if true, restricts requests that fall back to TCP to HTTP/1.1.
+	// By default, HTTP/2 is negotiated via ALPN if the server supports it.
+	ForceTCPHTTP1 bool
+
 	// See https://www.ietf.org/archive/id/draft-ietf-quic-http-34.html#section-3.1.
 	ConnectionDiscovery
 	services map[string][]service
+	// the hosts in services, the most recently used one first, see AltSvcCacheSize
+	servicesLRU      *list.List
+	servicesLRUElems map[string]*list.Element
+
+	// AltSvcCacheSize is the maximum number of hosts that Alt-Svc entries are cached for.
+	// When the limit is exceeded, the entries of the least recently used host are evicted.
+	// A host is used when its entries are updated, or looked up for a request.
+	// Zero means no limit.
+	AltSvcCacheSize int
+
+	// DiscoveryChain, if set, is used instead of ConnectionDiscovery, see ConnectionDiscoveryChain.
+	DiscoveryChain ConnectionDiscoveryChain
+
+	// LookupHTTPSRecord is used by ConnectionDiscoveryDNS to look up the HTTPS DNS record of host.
+	// It returns the ALPN protocols advertised in the record, and the TTL of the record.
+	// The Go resolver doesn't support HTTPS records, so ConnectionDiscoveryDNS never finds
+	// HTTP/3 support if LookupHTTPSRecord is nil.
+	// If h3 is advertised, it is cached as an Alt-Svc entry for the TTL.
+	LookupHTTPSRecord func(ctx context.Context, host string) (alpns []string, ttl time.Duration, err error)
+
+	// ProbePorts are the candidate ports that ConnectionDiscoveryPortProbe probes for HTTP/3, e.g. []int{443, 8443}.
+	// They are dialed on the host of the request, ignoring DialAddrOverride.
+	// Probing is bounded by the request context, and by the handshake timeout (see quic.Config.HandshakeIdleTimeout).
+	ProbePorts []int
+
+	// DiscoveryTimeout bounds the time spent racing QUIC against TCP using Happy Eyeballs.
+	// If neither protocol succeeded when it expires, both attempts are canceled,
+	// and the request fails with an ErrDiscoveryTimeout.
+	// It doesn't apply to the rest of the request, once one of the protocols won the race.
+	// If zero, the race only ends when the request context is canceled.
+	DiscoveryTimeout time.Duration
+
+	// HappyEyeballsWinnerTTL is the duration for which the protocol that won the
+	// Happy Eyeballs race for a host is remembered. Subsequent requests to that host
+	// use the winning protocol right away, and only race both protocols if it fails.
+	// If zero, a default of 5 minutes is used. If negative, the winner isn't cached.
+	// Requests to a host that start while a race to that host is in progress don't race themselves.
+	// They wait for the race to finish, and use the winning protocol.
+	HappyEyeballsWinnerTTL time.Duration
+	winners                map[string]happyEyeballsWinner
+	races                  map[string]*happyEyeballsRace
+
+	// HappyEyeballsReuseConn makes Happy Eyeballs send the request on the cached HTTP/3 connection
+	// without racing TCP, if that connection already completed the handshake.
+	// Otherwise, both protocols are raced until a winner is remembered (see HappyEyeballsWinnerTTL),
+	// even if a QUIC connection to the host was established before, e.g. using Warmup.
+	HappyEyeballsReuseConn bool
 
 	MetricsHandshakeStart time.Time
 	MetricsHandshakeDone  time.Time
+	// MetricsRequestSent and MetricsFirstResponseByte are the times the last request was sent,
+	// and the first byte of its response was received.
+	// See MetricsTimeToFirstByte.
+	MetricsRequestSent       time.Time
+	MetricsFirstResponseByte time.Time
+	// MetricsResumed, MetricsAttempted0RTT and MetricsAccepted0RTT report how the QUIC connection of the last request was established:
+	// MetricsResumed is set if a TLS session was resumed, MetricsAttempted0RTT if 0-RTT was attempted,
+	// and MetricsAccepted0RTT if the server accepted the 0-RTT data.
+	// Requests sent using 0-RTT (see MethodGet0RTT) don't wait for the handshake to complete,
+	// which explains unusually short handshake durations.
+	// They are not set for requests sent over TCP.
+	MetricsResumed       bool
+	MetricsAttempted0RTT bool
+	MetricsAccepted0RTT  bool
+
+	// ParseServerTiming enables parsing of the Server-Timing header of the responses into MetricsServerTiming.
+	// This allows correlating the time spent by the server with the measured latencies.
+	ParseServerTiming bool
+	// MetricsServerTiming are the metrics of the Server-Timing header of the last response, see ParseServerTiming.
+	// It is nil if the response didn't carry a valid Server-Timing header.
+	// Metrics sent in the trailers are not included.
+	MetricsServerTiming []ServerTiming
 
 	clients map[string]roundTripCloser
 }
@@ -78,6 +437,22 @@ type RoundTripOpt struct {
 	// SkipSchemeCheck controls whether we check if the scheme is https.
 	// This allows the use of different schemes, e.g. masque://target.example.com:443/.
 	SkipSchemeCheck bool
+	// ConnectionKey isolates the QUIC connections used for this request.
+	// Requests with different keys never share a connection, even when sent to the same host.
+	ConnectionKey string
+	// InsecureSkipVerify, if set, overrides TLSClientConfig.InsecureSkipVerify for this request.
+	// Requests using this override are sent on a dedicated connection,
+	// which is only shared with requests using the same override.
+	// The certificate chain presented by the server is available in Response.TLS.PeerCertificates,
+	// even if it wasn't verified.
+	InsecureSkipVerify *bool
+
+	// set for the duplicate of a hedged request, which is sent on a separate connection
+	hedge bool
+	// the key returned by RoundTripper.ConnectionAffinity
+	affinity string
+	// set for requests sent on the second connection, see OpenConnectionOnStreamLimit
+	overflow bool
 }
 
 type subTrip struct {
@@ -89,14 +464,77 @@ type ConnectionDiscovery int
 
 const (
 	ConnectionDiscoveryAltSvc ConnectionDiscovery = iota
+	// ConnectionDiscoveryHappyEyeballs races HTTP/3 against TCP, sending the request on both protocols.
+	// Requests with a body that can't be sent again (see http.Request.GetBody) are sent using TCP.
 	ConnectionDiscoveryHappyEyeballs
+	// ConnectionDiscoveryDNS uses HTTP/3 if the HTTPS DNS record (RFC 9460) of the host advertises h3,
+	// see RoundTripper.LookupHTTPSRecord. Otherwise, TCP is used.
+	ConnectionDiscoveryDNS
+	// ConnectionDiscoveryPortProbe probes the ports in RoundTripper.ProbePorts in parallel, by performing a QUIC handshake,
+	// and uses HTTP/3 on the first port that completes the handshake.
+	// The port is cached as an Alt-Svc entry for 24 hours. If none of the ports completes the handshake, TCP is used.
+	// Since probing delays the request until all handshakes failed, it is best used at the end of a ConnectionDiscoveryChain,
+	// e.g. ConnectionDiscoveryChain{ConnectionDiscoveryAltSvc, ConnectionDiscoveryDNS, ConnectionDiscoveryPortProbe}.
+	ConnectionDiscoveryPortProbe
 )
 
+// probedPortMaxAge is the time a port found by ConnectionDiscoveryPortProbe is cached for.
+// This is the default max age of an Alt-Svc entry, see RFC 7838.
+const probedPortMaxAge = 24 * time.Hour
+
+// A ConnectionDiscoveryChain combines multiple ConnectionDiscovery modes, which are tried in order,
+// until one of them finds that the host supports HTTP/3. If none of them does, TCP is used.
+// ConnectionDiscoveryHappyEyeballs always ends the chain, since it races HTTP/3 against TCP.
+// For example, ConnectionDiscoveryChain{ConnectionDiscoveryAltSvc, ConnectionDiscoveryDNS, ConnectionDiscoveryHappyEyeballs}
+// uses the Alt-Svc cache, then the HTTPS DNS record, and then races both protocols.
+type ConnectionDiscoveryChain []ConnectionDiscovery
+
+func (c ConnectionDiscoveryChain) contains(d ConnectionDiscovery) bool {
+	for _, cd := range c {
+		if cd == d {
+			return true
+		}
+	}
+	return false
+}
+
 type service struct {
 	altsvc.Service
 	expiredAt time.Time
 }
 
+const defaultMaxRetries = 2
+
+// tunnelingSchemes are the URL schemes used for tunneling over HTTP/3 (e.g. by MASQUE proxies).
+// Requests with these schemes require RoundTripOpt.SkipSchemeCheck.
+var tunnelingSchemes = map[string]bool{
+	"masque":      true,
+	"connect-udp": true,
+	"connect-ip":  true,
+}
+
+const defaultHappyEyeballsWinnerTTL = 5 * time.Minute
+
+type transportProtocol uint8
+
+const (
+	transportProtocolQUIC transportProtocol = iota
+	transportProtocolTCP
+)
+
+type happyEyeballsWinner struct {
+	protocol  transportProtocol
+	expiredAt time.Time
+}
+
+// A happyEyeballsRace is a Happy Eyeballs race in progress.
+// The winner is guarded by the RoundTripper's mutex, and is final once done is closed.
+type happyEyeballsRace struct {
+	done      chan struct{}
+	winner    transportProtocol
+	hasWinner bool
+}
+
 var _ roundTripCloser = &RoundTripper{}
 
 // ErrNoCachedConn is returned when RoundTripper.OnlyCachedConn is set
@@ -130,6 +568,12 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 		}
 	} else if !opt.SkipSchemeCheck {
 		closeRequestBody(req)
+		if isRedirect(req) {
+			return nil, fmt.Errorf("http3: can't follow redirect to %s: only https URLs are supported (see CheckRedirect)", req.URL)
+		}
+		if tunnelingSchemes[req.URL.Scheme] {
+			return nil, fmt.Errorf("http3: unsupported protocol scheme: %s (set RoundTripOpt.SkipSchemeCheck to use it)", req.URL.Scheme)
+		}
 		return nil, fmt.Errorf("http3: unsupported protocol scheme: %s", req.URL.Scheme)
 	}
 
@@ -139,7 +583,21 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	}
 
 	hostname := authorityAddr("https", hostnameFromRequest(req))
-	cl, err := r.getClient(hostname, opt.OnlyCachedConn)
+	if err := r.waitForRateLimit(req.Context(), hostname); err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	if shouldBufferRequestBody(req, r.RetryBodyBufferSize) {
+		newReq, err := bufferRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		req = newReq
+	}
+	if r.ConnectionAffinity != nil {
+		opt.affinity = r.ConnectionAffinity(req)
+	}
+	cl, err := r.getClient(hostname, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -147,173 +605,1549 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	if !ok { // TODO: return error
 		panic("client is not http3.client")
 	}
-
-	tcp := http.DefaultTransport.(*http.Transport).Clone()
-	tcp.TLSClientConfig = &tls.Config{InsecureSkipVerify: r.TLSClientConfig.InsecureSkipVerify}
-	tcpClient := &http.Client{Transport: tcp}
-
-	ownedSvcs, ok := r.getServices(hostname)
-	h3Ready := false
-	for _, s := range ownedSvcs {
-		if strings.HasPrefix(s.ProtocolID, "h3") {
-			h3Ready = true
-			break
+	res, err := r.roundTripDiscovery(req, hostname, opt, quicClient)
+	if r.ParseServerTiming {
+		r.MetricsServerTiming = nil
+		if err == nil {
+			r.MetricsServerTiming = parseServerTiming(res.Header.Values("Server-Timing"))
 		}
 	}
-	if ok && h3Ready {
-		res, err := quicClient.RoundTrip(req)
-		r.MetricsHandshakeDone = quicClient.metricsHandshakeDone
-		return res, err
+	return res, err
+}
+
+// roundTripDiscovery sends the request using HTTP/3, if the host is known to support it.
+// Otherwise, it runs the ConnectionDiscoveryChain.
+func (r *RoundTripper) roundTripDiscovery(req *http.Request, hostname string, opt RoundTripOpt, quicClient *client) (*http.Response, error) {
+	h3Ready, stale := r.h3ServiceState(hostname)
+	if h3Ready && !stale {
+		return r.roundTripH3(req, hostname, opt, quicClient)
 	}
 	r.MetricsHandshakeStart = time.Now()
 
-	switch r.ConnectionDiscovery {
-	case ConnectionDiscoveryHappyEyeballs:
-		ctxQuic := req.Context()
-		ctxTmp, cancelSelf := context.WithCancel(req.Context())
-		trace := &httptrace.ClientTrace{
-			TLSHandshakeDone: func(state tls.ConnectionState, err error) {
-				if quicClient.session != nil {
-					select {
-					case <-quicClient.session.HandshakeComplete().Done():
-						cancelSelf()
-					default:
-					}
-				} else {
-					r.MetricsHandshakeDone = time.Now()
-				}
-			},
-		}
-		ctxTcp := httptrace.WithClientTrace(ctxTmp, trace)
-
-		var once sync.Once
-		var quicStart sync.WaitGroup
-		quicStart.Add(1)
-		resChan := make(chan subTrip)
-		go func() { // QUIC Subroutine
-			quicStart.Done()
-			req = req.Clone(ctxQuic)
-			res, err := quicClient.RoundTrip(req)
-			if res != nil {
-				once.Do(func() {
-					r.MetricsHandshakeDone = quicClient.metricsHandshakeDone
-					resChan <- subTrip{res: res, err: err}
-				})
+	tcpClient := &http.Client{
+		Transport: r.tcpTransport(opt),
+		// As a http.RoundTripper, the RoundTripper returns redirect responses to the caller (usually an http.Client).
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	chain := r.discoveryChain()
+	if stale {
+		// Race HTTP/3 against TCP, to refresh the Alt-Svc entry before it expires.
+		chain = ConnectionDiscoveryChain{ConnectionDiscoveryHappyEyeballs}
+	}
+	for _, discovery := range chain {
+		switch discovery {
+		case ConnectionDiscoveryAltSvc:
+			// The Alt-Svc cache was already checked above.
+			// Without a cache entry, the Alt-Svc header of the TCP response is used for subsequent requests.
+		case ConnectionDiscoveryDNS:
+			if r.lookupH3(req.Context(), hostname) {
+				return r.roundTripH3(req, hostname, opt, quicClient)
 			}
-		}()
-		go func() { // TCP Subroutine
-			quicStart.Wait()
-			time.Sleep(10 * time.Millisecond)
-			req = req.Clone(ctxTcp)
-			res, err := tcpClient.Do(req)
-			if res != nil {
-				once.Do(func() { resChan <- subTrip{res: res, err: err} })
-				hdr := res.Header.Get("Alt-Svc")
-				if svcs, pErr := altsvc.Parse(hdr); pErr == nil {
-					r.setServices(hostname, svcs)
-				}
+		case ConnectionDiscoveryPortProbe:
+			if c := r.probePorts(req.Context(), hostname, opt, quicClient); c != nil {
+				return r.roundTripH3(req, hostname, opt, c)
 			}
-		}()
-		sub := <-resChan
-		return sub.res, sub.err
-	case ConnectionDiscoveryAltSvc:
-		trace := &httptrace.ClientTrace{
-			TLSHandshakeDone: func(state tls.ConnectionState, err error) {
-				r.MetricsHandshakeDone = time.Now()
-			},
-		}
-		ctxTcp := httptrace.WithClientTrace(req.Context(), trace)
-		req = req.Clone(ctxTcp)
-		res, err := tcpClient.Do(req)
-		hdr := res.Header.Get("Alt-Svc")
-		if svcs, pErr := altsvc.Parse(hdr); pErr == nil {
-			r.setServices(hostname, svcs)
+		case ConnectionDiscoveryHappyEyeballs:
+			return r.roundTripHappyEyeballs(req, hostname, opt, quicClient, tcpClient, stale)
+		default:
+			return nil, fmt.Errorf("invalid value: ConnectionDiscovery")
 		}
-		return res, err
-	default:
-		return nil, fmt.Errorf("invalid value: ConnectionDiscovery")
 	}
+	return r.roundTripTCP(req, hostname, tcpClient)
 }
 
-// RoundTrip does a round trip.
-func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	return r.RoundTripOpt(req, RoundTripOpt{})
+func (r *RoundTripper) discoveryChain() ConnectionDiscoveryChain {
+	if len(r.DiscoveryChain) > 0 {
+		return r.DiscoveryChain
+	}
+	return ConnectionDiscoveryChain{r.ConnectionDiscovery}
 }
 
-func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTripper, error) {
+// lookupH3 says if the HTTPS DNS record of the host advertises h3, see ConnectionDiscoveryDNS.
+func (r *RoundTripper) lookupH3(ctx context.Context, hostname string) bool {
+	if r.LookupHTTPSRecord == nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return false
+	}
+	alpns, ttl, err := r.LookupHTTPSRecord(ctx, host)
+	if err != nil {
+		return false
+	}
+	for _, alpn := range alpns {
+		if alpn == nextProtoH3 {
+			r.setServices(hostname, []altsvc.Service{{
+				ProtocolID:   nextProtoH3,
+				AltAuthority: altsvc.AltAuthority{Port: port},
+				MaxAge:       int(ttl / time.Second),
+			}})
+			return true
+		}
+	}
+	return false
+}
+
+// probePorts probes the ports in ProbePorts in parallel, see ConnectionDiscoveryPortProbe.
+// The client of the first port that completes the handshake replaces quicClient.
+// It returns nil if none of the ports completed the handshake.
+func (r *RoundTripper) probePorts(ctx context.Context, hostname string, opt RoundTripOpt, quicClient *client) *client {
+	if quicClient.handshakeComplete() {
+		// The host was reachable using HTTP/3 before, and the connection is still alive.
+		return quicClient
+	}
+	host, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return nil
+	}
+	type probeResult struct {
+		client *client
+		port   int
+		err    error
+	}
+	results := make(chan probeResult, len(r.ProbePorts))
+	var remaining int
+	for _, port := range r.ProbePorts {
+		r.mutex.Lock()
+		c, err := r.newClient(hostname, opt)
+		r.mutex.Unlock()
+		if err != nil {
+			continue
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		c.opts.DialAddrOverride = func(string) (string, bool) { return addr, true }
+		remaining++
+		go func(port int) {
+			results <- probeResult{client: c, port: port, err: c.warmup(ctx)}
+		}(port)
+	}
+
+	var winner *client
+	var winnerPort int
+loop:
+	for remaining > 0 {
+		select {
+		case res := <-results:
+			remaining--
+			if res.err != nil {
+				res.client.Close()
+				continue
+			}
+			winner, winnerPort = res.client, res.port
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	// Dialing doesn't respect the context, so the other probes might still be handshaking.
+	go func(n int) {
+		for i := 0; i < n; i++ {
+			(<-results).client.Close()
+		}
+	}(remaining)
+	if winner == nil {
+		return nil
+	}
+
+	r.setServices(hostname, []altsvc.Service{{
+		ProtocolID:   nextProtoH3,
+		AltAuthority: altsvc.AltAuthority{Port: strconv.Itoa(winnerPort)},
+		MaxAge:       int(probedPortMaxAge / time.Second),
+	}})
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	key := clientKey(hostname, opt)
+	if cl, ok := r.clients[key]; ok && cl != roundTripCloser(quicClient) {
+		// A concurrent request already replaced the client.
+		if c, ok := cl.(*client); ok {
+			winner.Close()
+			return c
+		}
+	}
+	r.clients[key] = winner
+	quicClient.Close()
+	return winner
+}
 
-	if r.clients == nil {
-		r.clients = make(map[string]roundTripCloser)
+// roundTripH3 sends the request using HTTP/3.
+func (r *RoundTripper) roundTripH3(req *http.Request, hostname string, opt RoundTripOpt, quicClient *client) (*http.Response, error) {
+	if r.HedgeDelay > 0 && canHedgeRequest(req) {
+		return r.roundTripHedged(req, hostname, opt, quicClient)
 	}
+	return r.roundTripWithRetries(req, hostname, opt, quicClient)
+}
 
-	client, ok := r.clients[hostname]
-	if !ok {
-		if onlyCached {
-			return nil, ErrNoCachedConn
+// roundTripHappyEyeballs races HTTP/3 against TCP, see ConnectionDiscoveryHappyEyeballs.
+func (r *RoundTripper) roundTripHappyEyeballs(req *http.Request, hostname string, opt RoundTripOpt, quicClient *client, tcpClient *http.Client, stale bool) (*http.Response, error) {
+	if r.HappyEyeballsReuseConn && !stale && quicClient.handshakeComplete() {
+		// HTTP/3 is already up. Racing TCP would only establish a connection that isn't used.
+		res, cl, err := r.roundTripOnClient(req, hostname, opt, quicClient)
+		if err == nil {
+			r.setMetricsFromClient(cl)
 		}
-		var err error
-		client, err = newClient(
-			hostname,
-			r.TLSClientConfig,
-			&roundTripperOpts{
-				EnableDatagram:     r.EnableDatagrams,
-				DisableCompression: r.DisableCompression,
-				MaxHeaderBytes:     r.MaxResponseHeaderBytes,
-			},
-			r.QuicConfig,
-			r.Dial,
-		)
+		return res, err
+	}
+	if !canRewindRequest(req) {
+		// The request body can only be sent once.
+		// Neither can both protocols be raced, nor can the request be sent again if the winner of the last race fails.
+		return r.roundTripTCP(req, hostname, tcpClient)
+	}
+	// When refreshing a stale Alt-Svc entry, always race both protocols.
+	if winner, ok := r.getWinner(hostname); ok && !stale {
+		winnerReq, err := rewindRequest(req)
 		if err != nil {
 			return nil, err
 		}
-		r.clients[hostname] = client
+		if res, err := r.roundTripWinner(winnerReq, hostname, opt, quicClient, tcpClient, winner); err == nil {
+			return res, nil
+		}
+		// The winner failed. Race both protocols again.
+		r.deleteWinner(hostname)
 	}
-	return client, nil
-}
 
-func (r *RoundTripper) setServices(hostname string, svcs []altsvc.Service) {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	// Only one request races the protocols at a time. Concurrent requests use the winner of its race.
+	race, isRacing := r.joinRace(hostname)
+	if isRacing {
+		defer r.finishRace(hostname, race)
+	} else {
+		select {
+		case <-race.done:
+		case <-req.Context().Done():
+			closeRequestBody(req)
+			return nil, req.Context().Err()
+		}
+		if winner, ok := r.raceWinner(race); ok {
+			winnerReq, err := rewindRequest(req)
+			if err != nil {
+				return nil, err
+			}
+			if res, err := r.roundTripWinner(winnerReq, hostname, opt, quicClient, tcpClient, winner); err == nil {
+				return res, nil
+			}
+		}
+		// Neither protocol won the race, or the winner failed for this request.
+		// Race both protocols, without waiting for other requests.
+		race = nil
+	}
 
-	val := make([]service, len(svcs))
-	for _, s := range svcs {
-		if s.Clear == true {
-			delete(r.services, hostname)
+	// Prepare the requests for both attempts before starting the race,
+	// such that neither attempt fails because the other one already consumed the request body.
+	quicReq, err := rewindRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	tcpReq, err := rewindRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctxQuic := req.Context()
+	// cancelRace cancels both attempts. It is only set if the race is bounded by the DiscoveryTimeout.
+	var cancelRace context.CancelFunc
+	var timeout <-chan time.Time
+	if r.DiscoveryTimeout > 0 {
+		ctxQuic, cancelRace = context.WithCancel(ctxQuic)
+		timer := time.NewTimer(r.DiscoveryTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	ctxTmp, cancelSelf := context.WithCancel(ctxQuic)
+	// The TCP attempt is canceled once both the QUIC and the TCP handshake completed,
+	// unless TCP already received a response.
+	// Letting the TCP handshake complete allows the connection to be reused (see tcpTransport), should QUIC fail later.
+	// raceMutex guards the state shared between the TCP attempt and the QUIC handshake watcher below.
+	var raceMutex sync.Mutex
+	var quicHandshakeDone bool
+	var tcpHandshakeDone time.Time
+	var tcpResponded, tcpCanceled bool
+	// cancelTCP must be called with the raceMutex held.
+	cancelTCP := func() {
+		if quicHandshakeDone && !tcpHandshakeDone.IsZero() && !tcpResponded {
+			tcpCanceled = true
+			cancelSelf()
+		}
+	}
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			raceMutex.Lock()
+			tcpHandshakeDone = time.Now()
+			cancelTCP()
+			raceMutex.Unlock()
+		},
+	}
+	ctxTcp := httptrace.WithClientTrace(ctxTmp, trace)
+	var tcpMetrics tcpRequestMetrics
+	ctxTcp = tcpMetrics.trace(ctxTcp)
+	quicReq = quicReq.Clone(ctxQuic)
+	tcpReq = tcpRequest(tcpReq.Clone(ctxTcp))
+
+	resChan := make(chan subTrip)
+	// closed when the race timed out
+	timedOut := make(chan struct{})
+	// deliver passes the response of the winner on, unless the race already timed out
+	deliver := func(res *http.Response, err error) {
+		if cancelRace != nil {
+			res.Body = &cancelingBody{ReadCloser: res.Body, cancel: cancelRace}
+		}
+		select {
+		case resChan <- subTrip{res: res, err: err}:
+		case <-timedOut:
+			res.Body.Close()
+		}
+	}
+
+	watchCtx, stopWatching := context.WithCancel(ctxQuic)
+	defer stopWatching()
+	go func() {
+		// Dialing is left to the QUIC subroutine, the watcher only observes the handshake.
+		select {
+		case <-quicClient.dialStarted():
+		case <-watchCtx.Done():
 			return
 		}
-		v := service{Service: s}
-		if v.Persist != 1 {
-			v.expiredAt = time.Now().Add(time.Duration(s.MaxAge) * time.Second)
+		if err := quicClient.warmup(watchCtx); err != nil {
+			return
+		}
+		raceMutex.Lock()
+		quicHandshakeDone = true
+		cancelTCP()
+		raceMutex.Unlock()
+	}()
+
+	var once sync.Once
+	var quicStart sync.WaitGroup
+	quicStart.Add(1)
+	quicErrChan := make(chan error, 1)
+	tcpErrChan := make(chan error, 1)
+	go func() { // QUIC Subroutine
+		quicStart.Done()
+		res, cl, err := r.roundTripOnClient(quicReq, hostname, opt, quicClient)
+		if res == nil {
+			quicErrChan <- err
+			return
+		}
+		var delivered bool
+		once.Do(func() {
+			r.setMetricsFromClient(cl)
+			r.setWinner(hostname, transportProtocolQUIC)
+			r.setRaceWinner(race, transportProtocolQUIC)
+			deliver(res, err)
+			delivered = true
+		})
+		if !delivered { // TCP won the race
+			res.Body.Close()
+		}
+	}()
+	go func() { // TCP Subroutine
+		quicStart.Wait()
+		time.Sleep(10 * time.Millisecond)
+		res, err := tcpClient.Do(tcpReq)
+		raceMutex.Lock()
+		tcpResponded = true
+		canceled := tcpCanceled
+		handshakeDone := tcpHandshakeDone
+		raceMutex.Unlock()
+		if res != nil && canceled {
+			// The response arrived just as the QUIC handshake completed, and its body can't be read any more.
+			res.Body.Close()
+			res, err = nil, context.Canceled
+		}
+		if res == nil {
+			tcpErrChan <- err
+			return
+		}
+		var delivered bool
+		once.Do(func() {
+			tcpMetrics.apply(r)
+			if !handshakeDone.IsZero() {
+				r.MetricsHandshakeDone = handshakeDone
+			}
+			r.setWinner(hostname, transportProtocolTCP)
+			r.setRaceWinner(race, transportProtocolTCP)
+			deliver(res, err)
+			delivered = true
+		})
+		hdr := res.Header.Get("Alt-Svc")
+		if svcs, pErr := parseAltSvc(hdr); pErr == nil {
+			r.setServices(hostname, svcs)
+		}
+		if !delivered { // QUIC won the race
+			res.Body.Close()
+		}
+	}()
+	// If both protocols fail, return the error of the TCP fallback,
+	// unless TCP was only canceled because the QUIC handshake completed.
+	var quicErr, tcpErr error
+	for quicErr == nil || tcpErr == nil {
+		select {
+		case sub := <-resChan:
+			return sub.res, sub.err
+		case quicErr = <-quicErrChan:
+		case tcpErr = <-tcpErrChan:
+		case <-timeout:
+			close(timedOut)
+			cancelRace()
+			return nil, &ErrDiscoveryTimeout{Duration: r.DiscoveryTimeout}
 		}
-		val = append(val, v)
 	}
-	if r.services == nil {
-		r.services = map[string][]service{hostname: val}
+	if cancelRace != nil {
+		cancelRace()
 	}
-	r.services[hostname] = val
+	if ctxTmp.Err() != nil && req.Context().Err() == nil {
+		return nil, quicErr
+	}
+	return nil, tcpErr
 }
 
-// getServices returns the slice of valid service.
-func (r *RoundTripper) getServices(hostname string) ([]service, bool) {
+// roundTripWinner sends the request using the protocol that won the Happy Eyeballs race.
+func (r *RoundTripper) roundTripWinner(req *http.Request, hostname string, opt RoundTripOpt, quicClient *client, tcpClient *http.Client, winner transportProtocol) (*http.Response, error) {
+	if winner == transportProtocolQUIC {
+		res, cl, err := r.roundTripOnClient(req, hostname, opt, quicClient)
+		if err != nil {
+			return nil, err
+		}
+		r.setMetricsFromClient(cl)
+		return res, nil
+	}
+	var tcpMetrics tcpRequestMetrics
+	res, err := tcpClient.Do(tcpRequest(req.WithContext(tcpMetrics.trace(req.Context()))))
+	if err != nil {
+		return nil, err
+	}
+	tcpMetrics.apply(r)
+	if svcs, pErr := parseAltSvc(res.Header.Get("Alt-Svc")); pErr == nil {
+		r.setServices(hostname, svcs)
+	}
+	return res, nil
+}
+
+// roundTripTCP sends the request using the TCP fallback,
+// and caches the Alt-Svc entries advertised in the response.
+func (r *RoundTripper) roundTripTCP(req *http.Request, hostname string, tcpClient *http.Client) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			r.MetricsHandshakeDone = time.Now()
+		},
+	}
+	ctxTcp := httptrace.WithClientTrace(req.Context(), trace)
+	var tcpMetrics tcpRequestMetrics
+	req = tcpRequest(req.Clone(tcpMetrics.trace(ctxTcp)))
+	res, err := tcpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	tcpMetrics.apply(r)
+	hdr := res.Header.Get("Alt-Svc")
+	if svcs, pErr := parseAltSvc(hdr); pErr == nil {
+		r.setServices(hostname, svcs)
+	}
+	return res, err
+}
+
+// tcpRequest prepares a request for sending it using the TCP fallback.
+// MethodGet0RTT only has a meaning for HTTP/3, and is sent as a GET request.
+// It modifies req, and must therefore be called on a copy of the request.
+func tcpRequest(req *http.Request) *http.Request {
+	if req.Method == MethodGet0RTT {
+		req.Method = http.MethodGet
+	}
+	return req
+}
+
+// tcpTransport returns the transport used when falling back to TCP.
+// The transport is shared between requests, such that their TCP connections are reused,
+// unless the requests override InsecureSkipVerify.
+// The idle TCP connections are closed by Close and by CloseIdleConnections.
+func (r *RoundTripper) tcpTransport(opt RoundTripOpt) *http.Transport {
+	key := ""
+	if opt.InsecureSkipVerify != nil {
+		key = "insecure=" + strconv.FormatBool(*opt.InsecureSkipVerify)
+	}
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	if r.tcpTransports == nil {
+		r.tcpTransports = make(map[string]*http.Transport)
+	}
+	tcp, ok := r.tcpTransports[key]
+	if !ok {
+		tcp = r.newTCPTransport(opt)
+		r.tcpTransports[key] = tcp
+	}
+	return tcp
+}
 
-	svcs, ok := r.services[hostname]
-	ret := make([]service, len(svcs))
-	for _, s := range svcs {
-		if !time.Now().After(s.expiredAt) || s.Persist == 1 {
-			ret = append(ret, s)
+// closeIdleTCPConnections closes the idle connections of the TCP fallback.
+// It must be called with the mutex held.
+func (r *RoundTripper) closeIdleTCPConnections() {
+	for _, tcp := range r.tcpTransports {
+		tcp.CloseIdleConnections()
+	}
+}
+
+// newTCPTransport creates the transport used when falling back to TCP.
+// It prefers HTTP/2, unless ForceTCPHTTP1 is set.
+func (r *RoundTripper) newTCPTransport(opt RoundTripOpt) *http.Transport {
+	tcp := http.DefaultTransport.(*http.Transport).Clone()
+	tcp.TLSClientConfig = &tls.Config{}
+	if r.TLSClientConfig != nil {
+		tcp.TLSClientConfig.InsecureSkipVerify = r.TLSClientConfig.InsecureSkipVerify
+		// present the same client certificates as on QUIC connections
+		tcp.TLSClientConfig.Certificates = r.TLSClientConfig.Certificates
+		tcp.TLSClientConfig.GetClientCertificate = r.TLSClientConfig.GetClientCertificate
+	}
+	if opt.InsecureSkipVerify != nil {
+		tcp.TLSClientConfig.InsecureSkipVerify = *opt.InsecureSkipVerify
+	}
+	r.addTLSVerifiers(tcp.TLSClientConfig)
+	tcp.ResponseHeaderTimeout = r.ResponseHeaderTimeout
+	if r.ForceTCPHTTP1 {
+		// A non-nil, empty TLSNextProto map disables HTTP/2.
+		tcp.ForceAttemptHTTP2 = false
+		tcp.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		tcp.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	} else {
+		// Setting a custom TLSClientConfig disables HTTP/2, unless ForceAttemptHTTP2 is set.
+		tcp.ForceAttemptHTTP2 = true
+	}
+	network := r.AddressFamilyPreference.tcpNetwork()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	tcp.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		dialNetwork := network
+		if r.DialAddrOverride != nil {
+			if override, ok := r.DialAddrOverride(addr); ok {
+				addr = override
+				dialNetwork = "tcp"
+			}
+		}
+		conn, err := dialer.DialContext(ctx, dialNetwork, addr)
+		if err != nil {
+			return nil, newTCPDialError(addr, err)
 		}
+		return conn, nil
 	}
-	return ret, ok
+	return tcp
+}
+
+// MetricsTimeToFirstByte returns the time from sending the last request until the first byte of its response was received.
+// Unlike the handshake metrics, this doesn't include the cost of establishing the connection.
+// It returns 0 if no response was received yet.
+func (r *RoundTripper) MetricsTimeToFirstByte() time.Duration {
+	if r.MetricsRequestSent.IsZero() || r.MetricsFirstResponseByte.Before(r.MetricsRequestSent) {
+		return 0
+	}
+	return r.MetricsFirstResponseByte.Sub(r.MetricsRequestSent)
+}
+
+func (r *RoundTripper) setMetricsFromClient(cl *client) {
+	cl.metricsMutex.Lock()
+	defer cl.metricsMutex.Unlock()
+
+	r.MetricsHandshakeDone = cl.metricsHandshakeDone
+	r.MetricsRequestSent = cl.metricsRequestSent
+	r.MetricsFirstResponseByte = cl.metricsFirstByte
+	r.MetricsResumed = cl.metricsResumed
+	r.MetricsAttempted0RTT = cl.metricsAttempted0RTT
+	r.MetricsAccepted0RTT = cl.metricsAccepted0RTT
+}
+
+// tcpRequestMetrics records the request metrics of a request sent over TCP.
+type tcpRequestMetrics struct {
+	mutex           sync.Mutex
+	sent, firstByte time.Time
+}
+
+func (m *tcpRequestMetrics) trace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			m.mutex.Lock()
+			m.sent = time.Now()
+			m.mutex.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			m.mutex.Lock()
+			m.firstByte = time.Now()
+			m.mutex.Unlock()
+		},
+	})
+}
+
+func (m *tcpRequestMetrics) apply(r *RoundTripper) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	r.MetricsRequestSent = m.sent
+	r.MetricsFirstResponseByte = m.firstByte
+	r.MetricsResumed = false
+	r.MetricsAttempted0RTT = false
+	r.MetricsAccepted0RTT = false
+}
+
+// RoundTrip does a round trip.
+func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.RoundTripOpt(req, RoundTripOpt{})
+}
+
+func (r *RoundTripper) retryPolicy() RetryPolicy {
+	if r.RetryPolicy != nil {
+		return r.RetryPolicy
+	}
+	return &DefaultRetryPolicy{MaxRetries: r.MaxRetries}
+}
+
+// roundTripWithRetries sends the request using HTTP/3,
+// retrying it as long as the RetryPolicy allows it.
+func (r *RoundTripper) roundTripWithRetries(req *http.Request, hostname string, opt RoundTripOpt, cl *client) (*http.Response, error) {
+	res, cl, err := r.sendWithRetries(req, hostname, opt, cl)
+	r.setMetricsFromClient(cl)
+	return res, err
+}
+
+// sendWithRetries is like roundTripWithRetries, but doesn't set the RoundTripper's metrics.
+// It returns the client that was used for the last attempt.
+func (r *RoundTripper) sendWithRetries(req *http.Request, hostname string, opt RoundTripOpt, cl *client) (*http.Response, *client, error) {
+	policy := r.retryPolicy()
+	for attempt := 1; ; attempt++ {
+		res, usedCl, err := r.roundTripOnClient(req, hostname, opt, cl)
+		cl = usedCl
+		if err == nil || !canRewindRequest(req) {
+			return res, cl, err
+		}
+		retry, delay := policy.ShouldRetry(req, attempt, err)
+		if !retry {
+			return res, cl, err
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, cl, req.Context().Err()
+			}
+		}
+		newReq, rErr := rewindRequest(req)
+		if rErr != nil {
+			return nil, cl, err
+		}
+		req = newReq
+		// If the session was closed by a stateless reset or because the path broke, this dials a new connection.
+		newCl, cErr := r.getClient(hostname, opt)
+		if cErr != nil {
+			return nil, cl, err
+		}
+		next, ok := newCl.(*client)
+		if !ok {
+			return nil, cl, err
+		}
+		cl = next
+	}
+}
+
+// roundTripOnClient sends the request on cl.
+// If the stream limit of cl was reached, the request is sent on the second connection to the host,
+// see OpenConnectionOnStreamLimit. It returns the client that was used.
+func (r *RoundTripper) roundTripOnClient(req *http.Request, hostname string, opt RoundTripOpt, cl *client) (*http.Response, *client, error) {
+	res, err := cl.RoundTrip(req)
+	if !errors.Is(err, errStreamLimitReached) || opt.overflow {
+		return res, cl, err
+	}
+	// The request wasn't sent, so it can be sent on the second connection right away.
+	opt.overflow = true
+	overflowCl, err := r.getClient(hostname, opt)
+	if err != nil {
+		return nil, cl, err
+	}
+	next, ok := overflowCl.(*client)
+	if !ok {
+		res, err = overflowCl.RoundTrip(req)
+		return res, cl, err
+	}
+	res, err = next.RoundTrip(req)
+	return res, next, err
+}
+
+// canRewindRequest says if the request can be sent again, see rewindRequest.
+func canRewindRequest(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// shouldBufferRequestBody says if the body of req needs to be buffered to make it replayable, see RoundTripper.RetryBodyBufferSize.
+func shouldBufferRequestBody(req *http.Request, maxSize int64) bool {
+	if canRewindRequest(req) {
+		return false
+	}
+	return req.ContentLength > 0 && req.ContentLength <= maxSize
+}
+
+// bufferRequestBody returns a copy of req, with the body read into memory.
+// The GetBody of the copy returns a new reader for the buffered body.
+// The body of req is closed.
+func bufferRequestBody(req *http.Request) (*http.Request, error) {
+	defer req.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(req.Body, req.ContentLength))
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = io.NopCloser(bytes.NewReader(data))
+	newReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return &newReq, nil
+}
+
+// canRetryRequest says if a request that failed with err can be retried.
+func canRetryRequest(req *http.Request, err error) bool {
+	if !canRewindRequest(req) {
+		return false
+	}
+	var streamErr *quic.StreamError
+	if errors.As(err, &streamErr) && streamErr.ErrorCode == quic.StreamErrorCode(errorRequestRejected) {
+		// The server guarantees that it didn't process the request.
+		return true
+	}
+	var resetErr *quic.StatelessResetError
+	if errors.As(err, &resetErr) {
+		// The request might have been processed before the server lost the connection state.
+		return isIdempotent(req.Method)
+	}
+	if errors.Is(err, errPathFailure) {
+		// The request might have reached the server before the path broke.
+		return isIdempotent(req.Method)
+	}
+	if errors.Is(err, errConnectionDraining) {
+		// The request wasn't sent.
+		return true
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, MethodGet0RTT:
+		return true
+	default:
+		return false
+	}
+}
+
+// rewindRequest returns a copy of the request that can be sent again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, nil
+}
+
+// dialSemaphore returns the channel used to limit the number of concurrent dials,
+// or nil if MaxConcurrentDials is not set.
+// It must be called with the mutex held.
+func (r *RoundTripper) dialSemaphore() chan struct{} {
+	if r.MaxConcurrentDials <= 0 {
+		return nil
+	}
+	if r.dialSlots == nil {
+		r.dialSlots = make(chan struct{}, r.MaxConcurrentDials)
+	}
+	return r.dialSlots
+}
+
+// waitForRateLimit applies PerHostRate to a request to hostname.
+func (r *RoundTripper) waitForRateLimit(ctx context.Context, hostname string) error {
+	if r.PerHostRate <= 0 {
+		return nil
+	}
+	r.mutex.Lock()
+	if r.rateLimiters == nil {
+		r.rateLimiters = make(map[string]*tokenBucket)
+	}
+	b, ok := r.rateLimiters[hostname]
+	if !ok {
+		b = newTokenBucket(r.PerHostRate, r.PerHostBurst)
+		r.rateLimiters[hostname] = b
+	}
+	r.mutex.Unlock()
+
+	if r.FailOnRateLimit {
+		if !b.allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	return b.wait(ctx)
+}
+
+// latencyHistograms returns the latency histograms, or nil if they are not enabled.
+// It must be called with the mutex held.
+func (r *RoundTripper) latencyHistograms() *latencyHistograms {
+	if !r.EnableLatencyHistograms {
+		return nil
+	}
+	if r.latency == nil {
+		r.latency = &latencyHistograms{}
+	}
+	return r.latency
+}
+
+// LatencySnapshot returns a snapshot of the latency histograms.
+// The histograms are empty unless EnableLatencyHistograms is set.
+func (r *RoundTripper) LatencySnapshot() LatencySnapshot {
+	r.mutex.Lock()
+	l := r.latency
+	r.mutex.Unlock()
+	if l == nil {
+		return (&latencyHistograms{}).snapshot()
+	}
+	return l.snapshot()
+}
+
+// quicTLSConfig returns the tls.Config used for QUIC connections.
+// It must be called with the mutex held.
+func (r *RoundTripper) quicTLSConfig(opt RoundTripOpt) *tls.Config {
+	if opt.InsecureSkipVerify == nil && !r.RequireOCSPStaple && len(r.PinnedCertificates) == 0 && r.SessionTicketStore == nil {
+		return r.TLSClientConfig
+	}
+	tlsConf := &tls.Config{}
+	if r.TLSClientConfig != nil {
+		tlsConf = r.TLSClientConfig.Clone()
+	}
+	if opt.InsecureSkipVerify != nil {
+		tlsConf.InsecureSkipVerify = *opt.InsecureSkipVerify
+	}
+	if r.SessionTicketStore != nil {
+		// All connections share the same cache, so that they don't overwrite each other's tickets.
+		if r.sessionCache == nil {
+			r.sessionCache = NewPersistentSessionCache(r.SessionTicketStore)
+		}
+		tlsConf.ClientSessionCache = r.sessionCache
+	}
+	r.addTLSVerifiers(tlsConf)
+	return tlsConf
+}
+
+// addTLSVerifiers adds the checks for RequireOCSPStaple and PinnedCertificates to a copy of the tls.Config.
+func (r *RoundTripper) addTLSVerifiers(conf *tls.Config) {
+	if r.RequireOCSPStaple {
+		requireOCSPStaple(conf)
+	}
+	if len(r.PinnedCertificates) > 0 {
+		pinCertificates(conf, r.PinnedCertificates)
+	}
+}
+
+func (r *RoundTripper) getClient(hostname string, opt RoundTripOpt) (http.RoundTripper, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.clients == nil {
+		r.clients = make(map[string]roundTripCloser)
+	}
+
+	key := clientKey(hostname, opt)
+	cl, ok := r.clients[key]
+	if ok && connectionLost(cl) {
+		// The server lost the state for this connection, the path broke, or it was closed because it was idle.
+		// Dial a new one.
+		delete(r.clients, key)
+		ok = false
+	}
+	if !ok {
+		if opt.OnlyCachedConn {
+			return nil, ErrNoCachedConn
+		}
+		if opt.affinity != "" {
+			r.evictAffinityClient(hostname)
+		}
+		var err error
+		cl, err = r.newClient(hostname, opt)
+		if err != nil {
+			return nil, err
+		}
+		r.clients[key] = cl
+	}
+	return cl, nil
+}
+
+// evictAffinityClient makes room for a new affinity connection to hostname, see MaxAffinityConnsPerHost.
+// It must be called with the mutex held.
+func (r *RoundTripper) evictAffinityClient(hostname string) {
+	if r.MaxAffinityConnsPerHost <= 0 {
+		return
+	}
+	var num int
+	var lruKey string
+	var lru *client
+	var lruIdleSince int64
+	for key, cl := range r.clients {
+		c, ok := cl.(*client)
+		if !ok || c.hostname != hostname || !strings.Contains(key, "#affinity=") {
+			continue
+		}
+		if connectionLost(c) {
+			delete(r.clients, key)
+			continue
+		}
+		num++
+		// Connections that weren't dialed yet are about to be used.
+		idleSince := atomic.LoadInt64(&c.idleSince)
+		if c.requestsInFlight() > 0 || idleSince == 0 {
+			continue
+		}
+		if lru == nil || idleSince < lruIdleSince {
+			lruKey, lru, lruIdleSince = key, c, idleSince
+		}
+	}
+	if num < r.MaxAffinityConnsPerHost || lru == nil {
+		return
+	}
+	delete(r.clients, lruKey)
+	lru.Close()
+}
+
+// newClient creates a client for hostname, using the RoundTripper's configuration.
+// It must be called with the mutex held.
+func (r *RoundTripper) newClient(hostname string, opt RoundTripOpt) (*client, error) {
+	return newClient(
+		hostname,
+		r.quicTLSConfig(opt),
+		&roundTripperOpts{
+			EnableDatagram:          r.EnableDatagrams,
+			DisablePathMTUDiscovery: r.DisablePathMTUDiscovery,
+			DisableCompression:      r.DisableCompression,
+			EnableZstd:              r.EnableZstd,
+			CompressRequestBody:     r.CompressRequestBody,
+			CompressBodyMinSize:     r.CompressRequestBodyMinSize,
+			MaxHeaderBytes:          r.MaxResponseHeaderBytes,
+			MaxBodyBytes:            r.MaxResponseBodyBytes,
+			PushHandler:             r.PushHandler,
+			UserAgent:               r.UserAgent,
+			BrowserProfile:          r.BrowserProfile,
+			BufferPool:              r.BufferPool,
+			AddressFamily:           r.AddressFamilyPreference,
+			DialAddrOverride:        r.DialAddrOverride,
+			PathFailureTimeout:      r.PathFailureTimeout,
+			DialSemaphore:           r.dialSemaphore(),
+			OnConnectionIdle:        r.OnConnectionIdle,
+			ConnectionIdleThreshold: r.ConnectionIdleThreshold,
+			IdleConnTimeout:         r.IdleConnTimeout,
+			MaxSendRate:             r.MaxSendRate,
+			PacketLoss:              r.PacketLoss,
+			OnResponseChunk:         r.OnResponseChunk,
+			Latency:                 r.latencyHistograms(),
+			OnStreamLimitReached:    r.OnStreamLimitReached,
+			// The second connection waits for a new stream when its stream limit is reached.
+			OpenConnectionOnStreamLimit: r.OpenConnectionOnStreamLimit && !opt.overflow,
+			EnableConnectionStats:       r.EnableConnectionStats,
+			TokenStore:                  r.TokenStore,
+			NoDecompressionContentTypes: r.DisableDecompressionForContentTypes,
+			BodyIdleTimeout:             r.ResponseBodyIdleTimeout,
+			IdleReadTimeout:             r.IdleReadTimeout,
+			InitialCongestionWindow:     r.InitialCongestionWindow,
+			StreamScheduler:             r.StreamScheduler,
+			ResponseHeaderTimeout:       r.ResponseHeaderTimeout,
+			AltSvcAddr:                  r.altSvcDialAddr,
+		},
+		r.quicConfig(),
+		r.Dial,
+	)
+}
+
+// quicConfig returns the quic.Config used for dialing new connections.
+// It applies the Versions, unless the QuicConfig already sets Versions.
+// It must be called with the mutex held, since ForceVersion replaces the QuicConfig.
+func (r *RoundTripper) quicConfig() *quic.Config {
+	if len(r.Versions) == 0 || (r.QuicConfig != nil && len(r.QuicConfig.Versions) > 0) {
+		return r.QuicConfig
+	}
+	var conf *quic.Config
+	if r.QuicConfig == nil {
+		conf = defaultQuicConfig.Clone()
+	} else {
+		// don't modify the config passed by the application
+		conf = r.QuicConfig.Clone()
+	}
+	conf.Versions = r.Versions
+	return conf
+}
+
+// connectionLost says if the connection was closed by a stateless reset, because the path broke,
+// or because it was idle for IdleConnTimeout.
+func connectionLost(cl roundTripCloser) bool {
+	c, ok := cl.(*client)
+	return ok && (c.statelessReset.Get() || c.pathFailed.Get() || c.idleClosed.Get())
+}
+
+// clientKey returns the key used in the clients map.
+// Requests that use different connection keys, or different TLS overrides, never share a client.
+func clientKey(hostname string, opt RoundTripOpt) string {
+	key := hostname
+	if opt.ConnectionKey != "" {
+		key += "#" + opt.ConnectionKey
+	}
+	if opt.InsecureSkipVerify != nil {
+		key += "#insecure=" + strconv.FormatBool(*opt.InsecureSkipVerify)
+	}
+	if opt.affinity != "" {
+		key += "#affinity=" + opt.affinity
+	}
+	if opt.hedge {
+		key += "#hedge"
+	}
+	if opt.overflow {
+		key += "#overflow"
+	}
+	return key
+}
+
+// SetAltServices populates the Alt-Svc cache for host, as if svcs had been
+// advertised in an Alt-Svc header of a response from host.
+// This allows skipping the TCP connection for hosts that are known to support HTTP/3.
+func (r *RoundTripper) SetAltServices(host string, svcs []altsvc.Service) {
+	r.setServices(authorityAddr("https", host), svcs)
+}
+
+// ExportAltSvcCache returns the entries of the Alt-Svc cache, keyed by host:port,
+// e.g. for persisting them when shutting down. Expired entries are excluded.
+// The MaxAge of the entries is the remaining time until they expire,
+// such that they can be restored using ImportAltSvcCache.
+func (r *RoundTripper) ExportAltSvcCache() map[string][]altsvc.Service {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	cache := make(map[string][]altsvc.Service, len(r.services))
+	for hostname, svcs := range r.services {
+		var exported []altsvc.Service
+		for _, s := range svcs {
+			svc := s.Service
+			if s.Persist != 1 {
+				remaining := s.expiredAt.Sub(now)
+				if remaining <= 0 {
+					continue
+				}
+				// round up, so entries don't expire before they were supposed to
+				svc.MaxAge = int((remaining + time.Second - 1) / time.Second)
+			}
+			exported = append(exported, svc)
+		}
+		if len(exported) > 0 {
+			cache[hostname] = exported
+		}
+	}
+	return cache
+}
+
+// ImportAltSvcCache populates the Alt-Svc cache with entries returned by ExportAltSvcCache.
+// It replaces the cached entries of the hosts contained in cache, and keeps the entries of all other hosts.
+func (r *RoundTripper) ImportAltSvcCache(cache map[string][]altsvc.Service) {
+	for host, svcs := range cache {
+		r.SetAltServices(host, svcs)
+	}
+}
+
+func (r *RoundTripper) setServices(hostname string, svcs []altsvc.Service) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	val := make([]service, 0, len(svcs))
+	for _, s := range svcs {
+		if s.Clear == true {
+			delete(r.services, hostname)
+			r.removeServicesLRU(hostname)
+			return
+		}
+		v := service{Service: s}
+		if v.Persist != 1 {
+			v.expiredAt = time.Now().Add(time.Duration(s.MaxAge) * time.Second)
+		}
+		val = append(val, v)
+	}
+	if r.services == nil {
+		r.services = map[string][]service{hostname: val}
+	}
+	r.services[hostname] = val
+	r.touchServicesLRU(hostname)
+	if r.AltSvcCacheSize > 0 {
+		for r.servicesLRU.Len() > r.AltSvcCacheSize {
+			evicted := r.servicesLRU.Remove(r.servicesLRU.Back()).(string)
+			delete(r.servicesLRUElems, evicted)
+			delete(r.services, evicted)
+		}
+	}
+}
+
+// touchServicesLRU marks the Alt-Svc entries of hostname as the most recently used ones.
+// It must be called with the mutex held.
+func (r *RoundTripper) touchServicesLRU(hostname string) {
+	if r.servicesLRU == nil {
+		r.servicesLRU = list.New()
+		r.servicesLRUElems = make(map[string]*list.Element)
+	}
+	if el, ok := r.servicesLRUElems[hostname]; ok {
+		r.servicesLRU.MoveToFront(el)
+		return
+	}
+	r.servicesLRUElems[hostname] = r.servicesLRU.PushFront(hostname)
+}
+
+// removeServicesLRU must be called with the mutex held.
+func (r *RoundTripper) removeServicesLRU(hostname string) {
+	if el, ok := r.servicesLRUElems[hostname]; ok {
+		r.servicesLRU.Remove(el)
+		delete(r.servicesLRUElems, hostname)
+	}
+}
+
+// getServices returns the slice of valid service.
+func (r *RoundTripper) getServices(hostname string) ([]service, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	svcs, ok := r.services[hostname]
+	if ok {
+		r.touchServicesLRU(hostname)
+	}
+	ret := make([]service, 0, len(svcs))
+	for _, s := range svcs {
+		if !time.Now().After(s.expiredAt) || s.Persist == 1 {
+			ret = append(ret, s)
+		}
+	}
+	return ret, ok
+}
+
+// AltService returns the cached Alt-Svc entry that is used when dialing a new QUIC connection to host.
+// If multiple HTTP/3 alternatives are cached, the alternative is selected in a deterministic order:
+// First by the QUIC version (following the order of QuicConfig.Versions, or Versions), then by the lowest port,
+// and then by the order in which the alternatives were advertised.
+// It returns false if there's no valid entry for an HTTP/3 version that the RoundTripper supports.
+func (r *RoundTripper) AltService(host string) (altsvc.Service, bool) {
+	// ForceVersion might replace the QuicConfig concurrently.
+	r.mutex.Lock()
+	conf := r.quicConfig()
+	r.mutex.Unlock()
+	versions := defaultQuicConfig.Versions
+	if conf != nil && len(conf.Versions) > 0 {
+		versions = conf.Versions
+	}
+	svcs, _ := r.getServices(authorityAddr("https", host))
+	s, ok := selectAltService(svcs, versions)
+	return s.Service, ok
+}
+
+// altSvcDialAddr returns the address of the Alt-Svc alternative that a new connection to hostname is dialed to,
+// see AltService.
+func (r *RoundTripper) altSvcDialAddr(hostname string, versions []quic.VersionNumber) (string, bool) {
+	svcs, _ := r.getServices(hostname)
+	s, ok := selectAltService(svcs, versions)
+	if !ok {
+		return "", false
+	}
+	return altSvcAddr(hostname, s.Service)
+}
+
+// h3ServiceState says if a valid h3 Alt-Svc entry is cached for the host,
+// and if it is stale, i.e. if all h3 entries expire within AltSvcSoftExpiry.
+func (r *RoundTripper) h3ServiceState(hostname string) (valid, stale bool) {
+	svcs, _ := r.getServices(hostname)
+	var expiry time.Time
+	for _, s := range svcs {
+		if !strings.HasPrefix(s.ProtocolID, "h3") {
+			continue
+		}
+		if s.Persist == 1 {
+			return true, false
+		}
+		valid = true
+		if s.expiredAt.After(expiry) {
+			expiry = s.expiredAt
+		}
+	}
+	if !valid || r.AltSvcSoftExpiry <= 0 {
+		return valid, false
+	}
+	return true, time.Until(expiry) < r.AltSvcSoftExpiry
+}
+
+func (r *RoundTripper) setWinner(hostname string, p transportProtocol) {
+	ttl := r.HappyEyeballsWinnerTTL
+	if ttl == 0 {
+		ttl = defaultHappyEyeballsWinnerTTL
+	} else if ttl < 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.winners == nil {
+		r.winners = make(map[string]happyEyeballsWinner)
+	}
+	r.winners[hostname] = happyEyeballsWinner{protocol: p, expiredAt: time.Now().Add(ttl)}
+}
+
+// getWinner returns the protocol that won the last Happy Eyeballs race, if it hasn't expired yet.
+func (r *RoundTripper) getWinner(hostname string) (transportProtocol, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	w, ok := r.winners[hostname]
+	if !ok || time.Now().After(w.expiredAt) {
+		return 0, false
+	}
+	return w.protocol, true
+}
+
+func (r *RoundTripper) deleteWinner(hostname string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.winners, hostname)
+}
+
+// joinRace returns the Happy Eyeballs race to hostname that is in progress.
+// If there's none, it starts a new race, and returns true.
+// The caller is then responsible for racing the protocols, and for calling finishRace.
+func (r *RoundTripper) joinRace(hostname string) (*happyEyeballsRace, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if race, ok := r.races[hostname]; ok {
+		return race, false
+	}
+	if r.races == nil {
+		r.races = make(map[string]*happyEyeballsRace)
+	}
+	race := &happyEyeballsRace{done: make(chan struct{})}
+	r.races[hostname] = race
+	return race, true
+}
+
+func (r *RoundTripper) finishRace(hostname string, race *happyEyeballsRace) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.races[hostname] == race {
+		delete(r.races, hostname)
+	}
+	close(race.done)
+}
+
+// setRaceWinner records the winner of the race.
+// It is a no-op if race is nil, or if the race already finished, e.g. because it timed out.
+func (r *RoundTripper) setRaceWinner(race *happyEyeballsRace, p transportProtocol) {
+	if race == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	select {
+	case <-race.done:
+		return
+	default:
+	}
+	race.winner = p
+	race.hasWinner = true
+}
+
+func (r *RoundTripper) raceWinner(race *happyEyeballsRace) (transportProtocol, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return race.winner, race.hasWinner
+}
+
+// ForceVersion restricts the QUIC connections dialed by the RoundTripper to the version v,
+// e.g. for interop testing. Only v is offered in the handshake, and dialing fails with a
+// quic.VersionNegotiationError if the server doesn't support it.
+// It sets the Versions of the QuicConfig, and only applies to connections dialed afterwards.
+func (r *RoundTripper) ForceVersion(v quic.VersionNumber) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.QuicConfig == nil {
+		r.QuicConfig = defaultQuicConfig.Clone()
+	} else {
+		// don't modify the config passed by the application
+		r.QuicConfig = r.QuicConfig.Clone()
+	}
+	r.QuicConfig.Versions = []quic.VersionNumber{v}
+}
+
+// NegotiatedVersion returns the QUIC version used on the connection to host.
+// If the server sent a Version Negotiation packet, this is the version that
+// was chosen from QuicConfig.Versions afterwards.
+// It returns false if there's no connection to host that completed the handshake.
+// Only the default connection to host is reported. The connections dialed for requests that set
+// RoundTripOpt.ConnectionKey or RoundTripOpt.InsecureSkipVerify, for ConnectionAffinity,
+// for hedged requests (see HedgeDelay) and for OpenConnectionOnStreamLimit are not considered.
+func (r *RoundTripper) NegotiatedVersion(host string) (quic.VersionNumber, bool) {
+	r.mutex.Lock()
+	cl, ok := r.clients[authorityAddr("https", host)]
+	r.mutex.Unlock()
+	if !ok {
+		return 0, false
+	}
+	c, ok := cl.(*client)
+	if !ok {
+		return 0, false
+	}
+	return c.negotiatedVersion()
+}
+
+// TLSParameters are the cryptographic parameters negotiated in the TLS 1.3 handshake of a connection.
+// The cipher suite is also available from the TLS field of the http.Response,
+// but the tls.ConnectionState doesn't report the key exchange group.
+type TLSParameters struct {
+	CipherSuite      uint16
+	KeyExchangeGroup tls.CurveID
+}
+
+// NegotiatedTLSParameters returns the cipher suite and the key exchange group used on the connection to host,
+// e.g. for auditing the security of the connection.
+// It returns false if there's no connection to host that completed the handshake.
+// As with NegotiatedVersion, only the default connection to host is reported.
+func (r *RoundTripper) NegotiatedTLSParameters(host string) (TLSParameters, bool) {
+	r.mutex.Lock()
+	cl, ok := r.clients[authorityAddr("https", host)]
+	r.mutex.Unlock()
+	if !ok {
+		return TLSParameters{}, false
+	}
+	c, ok := cl.(*client)
+	if !ok {
+		return TLSParameters{}, false
+	}
+	return c.tlsParameters()
+}
+
+// ConnectionStats returns the statistics of the connection to host, see EnableConnectionStats.
+// It returns false if there's no connection to host, or if connection statistics are not enabled.
+// Only the default connection to host is reported (see NegotiatedVersion),
+// so the statistics don't include the other connections to host.
+func (r *RoundTripper) ConnectionStats(host string) (ConnectionStats, bool) {
+	r.mutex.Lock()
+	cl, ok := r.clients[authorityAddr("https", host)]
+	r.mutex.Unlock()
+	if !ok {
+		return ConnectionStats{}, false
+	}
+	c, ok := cl.(*client)
+	if !ok {
+		return ConnectionStats{}, false
+	}
+	return c.connectionStats()
+}
+
+// ConnectionRTT returns the smoothed RTT of the default connection to host, see EnableConnectionStats and ConnectionStats.
+// It returns false if there's no connection to host, if connection statistics are not enabled,
+// or if no RTT sample was taken yet.
+func (r *RoundTripper) ConnectionRTT(host string) (time.Duration, bool) {
+	stats, ok := r.ConnectionStats(host)
+	if !ok || stats.SmoothedRTT == 0 {
+		return 0, false
+	}
+	return stats.SmoothedRTT, true
+}
+
+// ServerSettings returns the HTTP/3 settings that the server sent on the connection to host.
+// It returns false if there's no connection to host, or if the server's SETTINGS frame wasn't received yet.
+// Only the settings received on the default connection to host are reported, see NegotiatedVersion.
+func (r *RoundTripper) ServerSettings(host string) (Settings, bool) {
+	r.mutex.Lock()
+	cl, ok := r.clients[authorityAddr("https", host)]
+	r.mutex.Unlock()
+	if !ok {
+		return Settings{}, false
+	}
+	c, ok := cl.(*client)
+	if !ok {
+		return Settings{}, false
+	}
+	return c.serverSettings()
+}
+
+// Warmup dials HTTP/3 connections to hosts (given as host or host:port), and waits for the handshakes to complete,
+// such that subsequent requests don't have to wait for a handshake.
+// Requests only use these connections if HTTP/3 is used for a host:
+// if an Alt-Svc entry exists for the host (see SetAltServices), or when using ConnectionDiscoveryHappyEyeballs.
+// If TLSClientConfig.ClientSessionCache is set, the session tickets received on these connections
+// can be used for 0-RTT on future connections (see MethodGet0RTT).
+// Connections that failed are not cached. If dialing any of the hosts failed, the first error is returned.
+func (r *RoundTripper) Warmup(ctx context.Context, hosts ...string) error {
+	errs := make([]error, len(hosts))
+	var wg sync.WaitGroup
+	wg.Add(len(hosts))
+	for i, host := range hosts {
+		go func(i int, hostname string) {
+			defer wg.Done()
+			if err := r.warmup(ctx, hostname); err != nil {
+				errs[i] = fmt.Errorf("http3: warming up the connection to %s failed: %w", hostname, err)
+			}
+		}(i, authorityAddr("https", host))
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RoundTripper) warmup(ctx context.Context, hostname string) error {
+	cl, err := r.getClient(hostname, RoundTripOpt{})
+	if err != nil {
+		return err
+	}
+	c, ok := cl.(*client)
+	if !ok {
+		return nil
+	}
+	if err := c.warmup(ctx); err != nil {
+		r.mutex.Lock()
+		if r.clients[hostname] == c {
+			delete(r.clients, hostname)
+		}
+		r.mutex.Unlock()
+		c.Close()
+		return err
+	}
+	if r.discoveryChain().contains(ConnectionDiscoveryHappyEyeballs) {
+		r.setWinner(hostname, transportProtocolQUIC)
+	}
+	return nil
+}
+
+// ProbeH3 checks if host (given as host or host:port) is reachable using HTTP/3,
+// by performing a QUIC handshake, using the same configuration as for requests.
+// This is lighter than doing a request, e.g. for uptime checks.
+// No request is sent, and the connection is closed after the handshake completed.
+// The connections used for requests are not affected.
+// Setting a deadline on ctx is recommended, since unreachable hosts are only detected
+// when the handshake times out (see quic.Config.HandshakeIdleTimeout).
+// If the handshake failed, or ctx was canceled before it completed, it returns false and the error.
+func (r *RoundTripper) ProbeH3(ctx context.Context, host string) (bool, error) {
+	hostname := authorityAddr("https", host)
+	r.mutex.Lock()
+	c, err := r.newClient(hostname, RoundTripOpt{})
+	r.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+	// Dialing doesn't respect the context, so the handshake might continue in the background.
+	err = c.warmup(ctx)
+	c.Close()
+	if err != nil {
+		return false, fmt.Errorf("http3: probing %s failed: %w", hostname, err)
+	}
+	return true, nil
+}
+
+// DrainConnection stops sending new requests on the QUIC connections to host.
+// Requests in flight complete normally, and the connections are closed once they are idle.
+// New requests to host dial a new connection.
+func (r *RoundTripper) DrainConnection(host string) {
+	hostname := authorityAddr("https", host)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, cl := range r.clients {
+		if key != hostname && !strings.HasPrefix(key, hostname+"#") {
+			continue
+		}
+		delete(r.clients, key)
+		if c, ok := cl.(*client); ok {
+			c.drain()
+		} else {
+			cl.Close()
+		}
+	}
+}
+
+// CancelAll cancels all requests in flight, e.g. to shed load.
+// The request streams are reset with the H3_REQUEST_CANCELLED error code.
+// Requests that are waiting for the response fail with ErrRequestCanceled,
+// and reading response bodies that haven't been read completely fails.
+// Unlike Close, CancelAll keeps the connections open, so they are used for subsequent requests.
+func (r *RoundTripper) CancelAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, cl := range r.clients {
+		if c, ok := cl.(*client); ok {
+			c.cancelAll()
+		}
+	}
+}
+
+// ConnStats describes a connection, see CloseConnections.
+type ConnStats struct {
+	// RequestsInFlight is the number of requests on the connection that haven't completed yet.
+	RequestsInFlight int
+	// IdleFor is the time since the last request completed, or since the connection was dialed.
+	// It is zero while requests are in flight, and if the connection wasn't dialed yet.
+	IdleFor time.Duration
+	// Stats are the statistics of the connection, see ConnectionStats.
+	// They are only set if EnableConnectionStats is set.
+	Stats ConnectionStats
+}
+
+// CloseConnections closes the QUIC connections for which match returns true, and returns the number of connections closed.
+// host is the authority (host:port) of the connection.
+// Requests in flight on a closed connection fail. Subsequent requests to the host dial a new connection.
+// match is called without holding any locks of the RoundTripper.
+func (r *RoundTripper) CloseConnections(match func(host string, stats ConnStats) bool) int {
+	r.mutex.Lock()
+	clients := make(map[string]*client, len(r.clients))
+	for key, cl := range r.clients {
+		if c, ok := cl.(*client); ok {
+			clients[key] = c
+		}
+	}
+	r.mutex.Unlock()
+
+	var closed int
+	for key, c := range clients {
+		if !match(c.hostname, c.connStats()) {
+			continue
+		}
+		r.mutex.Lock()
+		// The connection might have been replaced in the meantime.
+		if r.clients[key] == roundTripCloser(c) {
+			delete(r.clients, key)
+		}
+		r.mutex.Unlock()
+		c.Close()
+		closed++
+	}
+	return closed
+}
+
+// CloseIdleConnections closes the QUIC connections that don't have any requests in flight,
+// as well as the idle connections of the TCP fallback.
+// It is called by http.Client.CloseIdleConnections.
+func (r *RoundTripper) CloseIdleConnections() {
+	r.CloseConnections(func(_ string, stats ConnStats) bool { return stats.RequestsInFlight == 0 })
+	r.mutex.Lock()
+	r.closeIdleTCPConnections()
+	r.mutex.Unlock()
 }
 
-// Close closes the QUIC connections that this RoundTripper has used
+// Close closes the QUIC connections that this RoundTripper has used,
+// as well as the idle connections of the TCP fallback.
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	r.closeIdleTCPConnections()
+	r.tcpTransports = nil
 	for _, client := range r.clients {
 		if err := client.Close(); err != nil {
 			return err
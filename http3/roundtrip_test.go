@@ -5,15 +5,28 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ebi-yade/altsvc-go"
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go"
 	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/marten-seemann/qpack"
+	"golang.org/x/crypto/ocsp"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 type mockClient struct {
@@ -57,6 +70,57 @@ func (m *mockBody) Close() error {
 	return m.closeErr
 }
 
+// handshakingSession is a session that completes the handshake when handshakeDone is canceled.
+type handshakingSession struct {
+	quic.EarlySession
+	handshakeDone context.Context
+}
+
+func (s *handshakingSession) HandshakeComplete() context.Context { return s.handshakeDone }
+
+// slowSession is a session that delays opening streams.
+type slowSession struct {
+	quic.EarlySession
+	delay time.Duration
+}
+
+func (s *slowSession) OpenStreamSync(ctx context.Context) (quic.Stream, error) {
+	time.Sleep(s.delay)
+	return s.EarlySession.OpenStreamSync(ctx)
+}
+
+// cancelingSession is a session that closes the canceled channel when a request stream's CancelRead is called,
+// e.g. when the response body is closed.
+type cancelingSession struct {
+	quic.EarlySession
+	once     sync.Once
+	canceled chan struct{}
+}
+
+func (s *cancelingSession) OpenStreamSync(ctx context.Context) (quic.Stream, error) {
+	str, err := s.EarlySession.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &cancelingStream{Stream: str, session: s}, nil
+}
+
+type cancelingStream struct {
+	quic.Stream
+	session *cancelingSession
+}
+
+func (s *cancelingStream) CancelRead(code quic.StreamErrorCode) {
+	s.session.once.Do(func() { close(s.session.canceled) })
+	s.Stream.CancelRead(code)
+}
+
+type retryPolicyFunc func(req *http.Request, attempt int, err error) (bool, time.Duration)
+
+func (f retryPolicyFunc) ShouldRetry(req *http.Request, attempt int, err error) (bool, time.Duration) {
+	return f(req, attempt, err)
+}
+
 var _ = Describe("RoundTripper", func() {
 	var (
 		rt           *RoundTripper
@@ -76,6 +140,29 @@ var _ = Describe("RoundTripper", func() {
 		handshakeCtx = ctx
 	})
 
+	// waitForDials waits until the connections of the RoundTripper have been dialed, and closes the RoundTripper.
+	// Connections that didn't start dialing yet are never dialed.
+	// Specs that replace dialAddr must call it before restoring dialAddr, since dialing might outlive the spec.
+	waitForDials := func() {
+		rt.mutex.Lock()
+		clients := make([]*client, 0, len(rt.clients))
+		for _, cl := range rt.clients {
+			if c, ok := cl.(*client); ok {
+				clients = append(clients, c)
+			}
+		}
+		rt.mutex.Unlock()
+		for _, c := range clients {
+			c.dialOnce.Do(func() {
+				c.handshakeErr = errors.New("test done")
+				c.dialDone = make(chan struct{})
+				close(c.dialDone)
+			})
+			<-c.dialDone
+		}
+		Expect(rt.Close()).To(Succeed())
+	}
+
 	Context("dialing hosts", func() {
 		origDialAddr := dialAddr
 
@@ -161,6 +248,869 @@ var _ = Describe("RoundTripper", func() {
 			Eventually(closed).Should(BeClosed())
 		})
 
+		It("uses separate clients for requests overriding InsecureSkipVerify", func() {
+			rt.TLSClientConfig = &tls.Config{ServerName: "foo.bar"}
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var tlsConfs []*tls.Config
+			dialAddr = func(_ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+				tlsConfs = append(tlsConfs, tlsConf)
+				return nil, errors.New("handshake error")
+			}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			insecure := true
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{InsecureSkipVerify: &insecure})
+			Expect(err).To(MatchError("handshake error"))
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{InsecureSkipVerify: &insecure})
+			Expect(err).To(MatchError("handshake error"))
+			Expect(rt.clients).To(HaveLen(2))
+			Expect(tlsConfs).To(HaveLen(2))
+			Expect(tlsConfs[0].InsecureSkipVerify).To(BeFalse())
+			Expect(tlsConfs[1].InsecureSkipVerify).To(BeTrue())
+			Expect(tlsConfs[1].ServerName).To(Equal("foo.bar"))
+			// the RoundTripper's tls.Config is not modified
+			Expect(rt.TLSClientConfig.InsecureSkipVerify).To(BeFalse())
+		})
+
+		It("uses the SessionTicketStore for all QUIC connections", func() {
+			rt.TLSClientConfig = &tls.Config{ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+			rt.SessionTicketStore = &memorySessionTicketStore{tickets: make(map[string][]byte)}
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			rt.setServices("example.com:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var tlsConfs []*tls.Config
+			dialAddr = func(_ string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+				tlsConfs = append(tlsConfs, tlsConf)
+				return nil, errors.New("handshake error")
+			}
+			for _, u := range []string{"https://quic.clemente.io/foobar.html", "https://example.com/foobar.html"} {
+				req, err := http.NewRequest("GET", u, nil)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(MatchError("handshake error"))
+			}
+			Expect(tlsConfs).To(HaveLen(2))
+			Expect(tlsConfs[0].ClientSessionCache).To(BeAssignableToTypeOf(&persistentSessionCache{}))
+			Expect(tlsConfs[1].ClientSessionCache).To(BeIdenticalTo(tlsConfs[0].ClientSessionCache))
+			// the RoundTripper's tls.Config is not modified
+			Expect(rt.TLSClientConfig.ClientSessionCache).ToNot(BeAssignableToTypeOf(&persistentSessionCache{}))
+		})
+
+		It("configures the idle callback of the clients", func() {
+			var idleHost string
+			rt.OnConnectionIdle = func(host string, _ time.Duration) { idleHost = host }
+			rt.ConnectionIdleThreshold = time.Minute
+			cl, err := rt.getClient("quic.clemente.io:443", RoundTripOpt{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cl.(*client).opts.ConnectionIdleThreshold).To(Equal(time.Minute))
+			cl.(*client).opts.OnConnectionIdle("quic.clemente.io:443", time.Minute)
+			Expect(idleHost).To(Equal("quic.clemente.io:443"))
+		})
+
+		It("uses separate clients for different connection keys", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return nil, errors.New("handshake error")
+			}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{ConnectionKey: "tenant-a"})
+			Expect(err).To(MatchError("handshake error"))
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{ConnectionKey: "tenant-b"})
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialCount).To(Equal(2))
+			Expect(rt.clients).To(HaveLen(2))
+			// requests with the same key share the client
+			_, err = rt.RoundTripOpt(req, RoundTripOpt{ConnectionKey: "tenant-a"})
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialCount).To(Equal(2))
+			Expect(rt.clients).To(HaveLen(2))
+		})
+
+		It("uses the same client for requests with the same affinity key", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.ConnectionAffinity = CookieAffinity("session")
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return nil, errors.New("handshake error")
+			}
+			newRequest := func(session string) *http.Request {
+				req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+				Expect(err).ToNot(HaveOccurred())
+				if session != "" {
+					req.AddCookie(&http.Cookie{Name: "session", Value: session})
+				}
+				return req
+			}
+			for _, session := range []string{"foo", "bar", "foo", "", "bar", ""} {
+				_, err := rt.RoundTrip(newRequest(session))
+				Expect(err).To(MatchError("handshake error"))
+			}
+			// one connection for "foo", one for "bar", and the default connection
+			Expect(dialCount).To(Equal(3))
+			Expect(rt.clients).To(HaveLen(3))
+			Expect(rt.clients).To(HaveKey("quic.clemente.io:443"))
+			Expect(rt.clients).To(HaveKey("quic.clemente.io:443#affinity=foo"))
+			Expect(rt.clients).To(HaveKey("quic.clemente.io:443#affinity=bar"))
+		})
+
+		It("limits the number of affinity connections per host", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxAffinityConnsPerHost = 2
+			newClient := func(idleFor time.Duration, inFlight int64) *client {
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				c := &client{hostname: "quic.clemente.io:443", session: sess, inFlight: inFlight}
+				atomic.StoreInt64(&c.idleSince, time.Now().Add(-idleFor).UnixNano())
+				return c
+			}
+			recent := newClient(time.Second, 0)
+			old := newClient(time.Hour, 0)
+			old.session.(*mockquic.MockEarlySession).EXPECT().CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+			defaultConn := newClient(2*time.Hour, 0)
+			otherHost := newClient(2*time.Hour, 0)
+			otherHost.hostname = "example.com:443"
+			rt.clients = map[string]roundTripCloser{
+				"quic.clemente.io:443":              defaultConn,
+				"quic.clemente.io:443#affinity=foo": recent,
+				"quic.clemente.io:443#affinity=bar": old,
+				"example.com:443#affinity=foo":      otherHost,
+			}
+			// the connection that was idle for the longest time is closed
+			_, err := rt.getClient("quic.clemente.io:443", RoundTripOpt{affinity: "baz"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rt.clients).To(HaveLen(4))
+			Expect(rt.clients).ToNot(HaveKey("quic.clemente.io:443#affinity=bar"))
+			Expect(rt.clients).To(HaveKey("quic.clemente.io:443#affinity=baz"))
+			// connections with requests in flight are not closed
+			recent.inFlight = 1
+			rt.clients["quic.clemente.io:443#affinity=baz"] = newClient(time.Minute, 1)
+			_, err = rt.getClient("quic.clemente.io:443", RoundTripOpt{affinity: "qux"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rt.clients).To(HaveLen(5))
+			// using a cached connection doesn't close any connections
+			_, err = rt.getClient("quic.clemente.io:443", RoundTripOpt{affinity: "foo"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rt.clients).To(HaveLen(5))
+		})
+
+		It("dials a new connection after draining a connection", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			testDone := make(chan struct{})
+			defer close(testDone)
+			// newSession creates a session that responds with "foobar", and closes the closed channel when it is closed
+			newSession := func(closed chan<- struct{}) quic.EarlySession {
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				sess.EXPECT().OpenUniStream().Return(controlStr, nil)
+				sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				})
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) { close(closed) }).MaxTimes(1)
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				(&dataFrame{Length: 6}).Write(buf)
+				buf.WriteString("foobar")
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				return sess
+			}
+			closed1 := make(chan struct{})
+			closed2 := make(chan struct{})
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				if dialCount == 1 {
+					return newSession(closed1), nil
+				}
+				return newSession(closed2), nil
+			}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp1, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			rt.DrainConnection("quic.clemente.io")
+			Expect(rt.clients).To(BeEmpty())
+			rsp2, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialCount).To(Equal(2))
+			Expect(rt.clients).To(HaveLen(1))
+			// the request on the draining connection completes
+			Consistently(closed1).ShouldNot(BeClosed())
+			Expect(io.ReadAll(rsp1.Body)).To(Equal([]byte("foobar")))
+			Expect(rsp1.Body.Close()).To(Succeed())
+			Eventually(closed1).Should(BeClosed())
+			Expect(io.ReadAll(rsp2.Body)).To(Equal([]byte("foobar")))
+			Expect(rsp2.Body.Close()).To(Succeed())
+			Expect(closed2).ToNot(BeClosed())
+		})
+
+		It("cancels the requests in flight on all connections, without removing them", func() {
+			cl1 := &client{}
+			cl2 := &client{}
+			signal1 := cl1.cancelAllSignal()
+			signal2 := cl2.cancelAllSignal()
+			rt.clients = map[string]roundTripCloser{
+				"quic.clemente.io:443":   cl1,
+				"quic-go.example.io:443": cl2,
+			}
+			rt.CancelAll()
+			Expect(signal1).To(BeClosed())
+			Expect(signal2).To(BeClosed())
+			Expect(rt.clients).To(HaveLen(2))
+			// requests sent after CancelAll are not canceled
+			Expect(cl1.cancelAllSignal()).ToNot(BeClosed())
+		})
+
+		It("limits the number of concurrent dials", func() {
+			const numHosts = 10
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxConcurrentDials = 3
+			var running, maxRunning, dials int32
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				atomic.AddInt32(&dials, 1)
+				n := atomic.AddInt32(&running, 1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil, errors.New("handshake error")
+			}
+			var wg sync.WaitGroup
+			for i := 0; i < numHosts; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					// Use the clients directly, since the RoundTripper's metrics are not safe for concurrent use.
+					hostname := fmt.Sprintf("host%d.clemente.io:443", i)
+					cl, err := rt.getClient(hostname, RoundTripOpt{})
+					Expect(err).ToNot(HaveOccurred())
+					req, err := http.NewRequest("GET", "https://"+hostname+"/foobar.html", nil)
+					Expect(err).ToNot(HaveOccurred())
+					_, err = cl.RoundTrip(req)
+					Expect(err).To(MatchError("handshake error"))
+				}(i)
+			}
+			wg.Wait()
+			Expect(atomic.LoadInt32(&dials)).To(BeEquivalentTo(numHosts))
+			Expect(atomic.LoadInt32(&maxRunning)).To(BeEquivalentTo(3))
+		})
+
+		It("returns when the request is canceled while waiting for a dial slot", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxConcurrentDials = 1
+			testDone := make(chan struct{})
+			defer close(testDone)
+			var dialCount int32
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				atomic.AddInt32(&dialCount, 1)
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+				sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				}).AnyTimes()
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{})
+				sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				return sess, nil
+			}
+			// occupy the only dial slot
+			rt.mutex.Lock()
+			sem := rt.dialSemaphore()
+			rt.mutex.Unlock()
+			sem <- struct{}{}
+			cl, err := rt.getClient("quic.clemente.io:443", RoundTripOpt{})
+			Expect(err).ToNot(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(25*time.Millisecond))
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cl.RoundTrip(req)
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Consistently(func() int32 { return atomic.LoadInt32(&dialCount) }).Should(BeZero())
+			// the canceled request doesn't fail the connection for the next request
+			<-sem
+			cl2, err := rt.getClient("quic.clemente.io:443", RoundTripOpt{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cl2).To(Equal(cl))
+			req, err = http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := cl2.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+		})
+
+		It("redials after the session was closed by a stateless reset", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxRetries = -1
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return session, nil
+			}
+			resetErr := &quic.StatelessResetError{}
+			session.EXPECT().OpenUniStream().Return(nil, resetErr).AnyTimes()
+			session.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, resetErr).AnyTimes()
+			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			session.EXPECT().HandshakeComplete().Return(handshakeCtx).Times(2)
+			session.EXPECT().OpenStreamSync(gomock.Any()).Return(nil, resetErr).Times(2)
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(resetErr))
+			Expect(dialCount).To(Equal(1))
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(resetErr))
+			Expect(dialCount).To(Equal(2))
+			Expect(rt.clients).To(HaveLen(1))
+		})
+
+		It("redials after the response was interrupted by a stateless reset", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxRetries = -1
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			testDone := make(chan struct{})
+			defer close(testDone)
+			resetErr := &quic.StatelessResetError{}
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+				// the stateless reset is only noticed by the request
+				sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				}).AnyTimes()
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+				sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).Return(0, resetErr).AnyTimes()
+				sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				return sess, nil
+			}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(resetErr))
+			Expect(dialCount).To(Equal(1))
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(resetErr))
+			Expect(dialCount).To(Equal(2))
+		})
+
+		It("gives up retrying after MaxRetries", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxRetries = 3
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return session, nil
+			}
+			resetErr := &quic.StatelessResetError{}
+			session.EXPECT().OpenUniStream().Return(nil, resetErr).AnyTimes()
+			session.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, resetErr).AnyTimes()
+			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			session.EXPECT().HandshakeComplete().Return(handshakeCtx).Times(4)
+			session.EXPECT().OpenStreamSync(gomock.Any()).Return(nil, resetErr).Times(4)
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(resetErr))
+			Expect(dialCount).To(Equal(4))
+		})
+
+		It("uses the retry policy", func() {
+			type retryCall struct {
+				attempt int
+				err     error
+			}
+			var calls []retryCall
+			const backoff = 25 * time.Millisecond
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxRetries = -1 // ignored when a RetryPolicy is set
+			rt.RetryPolicy = retryPolicyFunc(func(_ *http.Request, attempt int, err error) (bool, time.Duration) {
+				calls = append(calls, retryCall{attempt: attempt, err: err})
+				return attempt < 3, time.Duration(attempt) * backoff
+			})
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return session, nil
+			}
+			// The policy decides about retries, even for errors that the default policy doesn't retry.
+			testErr := errors.New("test error")
+			session.EXPECT().OpenUniStream().Return(nil, testErr).AnyTimes()
+			session.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, testErr).AnyTimes()
+			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			session.EXPECT().HandshakeComplete().Return(handshakeCtx).Times(3)
+			session.EXPECT().OpenStreamSync(gomock.Any()).Return(nil, testErr).Times(3)
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			start := time.Now()
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(testErr))
+			Expect(time.Since(start)).To(BeNumerically(">=", 3*backoff))
+			Expect(calls).To(Equal([]retryCall{{1, testErr}, {2, testErr}, {3, testErr}}))
+			// the session is reused, since it wasn't closed
+			Expect(dialCount).To(Equal(1))
+		})
+
+		It("stops waiting for the retry backoff when the request is canceled", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.RetryPolicy = retryPolicyFunc(func(*http.Request, int, error) (bool, time.Duration) { return true, time.Hour })
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return session, nil }
+			testErr := errors.New("test error")
+			session.EXPECT().OpenUniStream().Return(nil, testErr).AnyTimes()
+			session.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, testErr).AnyTimes()
+			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			session.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			session.EXPECT().OpenStreamSync(gomock.Any()).Return(nil, testErr)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, "GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("doesn't retry non-idempotent requests after a stateless reset", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return session, nil
+			}
+			resetErr := &quic.StatelessResetError{}
+			session.EXPECT().OpenUniStream().Return(nil, resetErr).AnyTimes()
+			session.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, resetErr).AnyTimes()
+			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			session.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			session.EXPECT().OpenStreamSync(gomock.Any()).Return(nil, resetErr)
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(resetErr))
+			Expect(dialCount).To(Equal(1))
+		})
+
+		It("redials and retries idempotent requests when the path broke", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.PathFailureTimeout = scaleDuration(20 * time.Millisecond)
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			testDone := make(chan struct{})
+			defer close(testDone)
+			newSession := func(response bool) *mockquic.MockEarlySession {
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				closed := make(chan struct{})
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+				sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				}).AnyTimes()
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+				sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) { close(closed) }).MaxTimes(1)
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				if response {
+					headerBuf := &bytes.Buffer{}
+					enc := qpack.NewEncoder(headerBuf)
+					Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+					Expect(enc.Close()).To(Succeed())
+					buf := &bytes.Buffer{}
+					(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+					buf.Write(headerBuf.Bytes())
+					str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				} else {
+					// no response arrives, until the session is closed
+					str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+						<-closed
+						return 0, &quic.ApplicationError{ErrorCode: quic.ApplicationErrorCode(errorNoError)}
+					}).AnyTimes()
+				}
+				sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				return sess
+			}
+			var dialCount int
+			dialAddr = func(_ string, _ *tls.Config, conf *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				Expect(conf.Tracer).ToNot(BeNil())
+				if dialCount == 1 {
+					// The request is sent, but no packets are received.
+					conf.Tracer.TracerForConnection(context.Background(), logging.PerspectiveClient, nil).SentPacket(
+						&logging.ExtendedHeader{},
+						1000,
+						nil,
+						[]logging.Frame{&logging.StreamFrame{}},
+					)
+				}
+				return newSession(dialCount > 1), nil
+			}
+			req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(dialCount).To(Equal(2))
+		})
+
+		It("closes connections that were idle for IdleConnTimeout, and redials", func() {
+			const idleTimeout = 50 * time.Millisecond
+			rt.TLSClientConfig = &tls.Config{}
+			rt.IdleConnTimeout = scaleDuration(idleTimeout)
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			testDone := make(chan struct{})
+			defer close(testDone)
+			closed := make(chan struct{}, 2)
+			newSession := func() *mockquic.MockEarlySession {
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				ctx, cancel := context.WithCancel(context.Background())
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+				sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				}).AnyTimes()
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+				sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+				sess.EXPECT().Context().Return(ctx).AnyTimes()
+				sess.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorNoError), "").Do(func(quic.ApplicationErrorCode, string) {
+					cancel()
+					closed <- struct{}{}
+				}).MaxTimes(1)
+				sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+					headerBuf := &bytes.Buffer{}
+					enc := qpack.NewEncoder(headerBuf)
+					Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+					Expect(enc.Close()).To(Succeed())
+					buf := &bytes.Buffer{}
+					(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+					buf.Write(headerBuf.Bytes())
+					str := mockquic.NewMockStream(mockCtrl)
+					str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+					str.EXPECT().Close().AnyTimes()
+					str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+					str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+					str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+					return str, nil
+				}).AnyTimes()
+				return sess
+			}
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return newSession(), nil
+			}
+			req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			// The connection isn't idle while the response body is still open.
+			Consistently(closed, scaleDuration(2*idleTimeout)).ShouldNot(Receive())
+			start := time.Now()
+			Expect(rsp.Body.Close()).To(Succeed())
+			Eventually(closed).Should(Receive())
+			Expect(time.Since(start)).To(BeNumerically(">=", scaleDuration(idleTimeout)))
+			Expect(dialCount).To(Equal(1))
+
+			rsp, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(dialCount).To(Equal(2))
+			Expect(rt.clients).To(HaveLen(1))
+		})
+
+		It("retries requests rejected by the server", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			rt.MaxRetries = 1
+			rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return session, nil
+			}
+			rejectedErr := &quic.StreamError{ErrorCode: quic.StreamErrorCode(errorRequestRejected)}
+			session.EXPECT().OpenUniStream().Return(nil, errors.New("done")).AnyTimes()
+			session.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, errors.New("done")).AnyTimes()
+			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			session.EXPECT().HandshakeComplete().Return(handshakeCtx).Times(2)
+			bodies := make(chan *bytes.Buffer, 2)
+			for i := 0; i < 2; i++ {
+				buf := &bytes.Buffer{}
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
+				str.EXPECT().Close().Do(func() { bodies <- buf })
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).Return(0, rejectedErr).AnyTimes()
+				session.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			}
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", strings.NewReader("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(rejectedErr))
+			for i := 0; i < 2; i++ {
+				var buf *bytes.Buffer
+				Eventually(bodies).Should(Receive(&buf))
+				Expect(buf.String()).To(HaveSuffix("foobar"))
+			}
+		})
+
+		Context("replaying request bodies", func() {
+			var rejectedErr error
+
+			// expectRejectedRequests sets up a session that rejects n requests,
+			// and returns a channel that receives the data written for every request.
+			expectRejectedRequests := func(n int) <-chan *bytes.Buffer {
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					return session, nil
+				}
+				session.EXPECT().OpenUniStream().Return(nil, errors.New("done")).AnyTimes()
+				session.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, errors.New("done")).AnyTimes()
+				session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+				session.EXPECT().HandshakeComplete().Return(handshakeCtx).Times(n)
+				bodies := make(chan *bytes.Buffer, n)
+				for i := 0; i < n; i++ {
+					buf := &bytes.Buffer{}
+					str := mockquic.NewMockStream(mockCtrl)
+					str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
+					str.EXPECT().Close().Do(func() { bodies <- buf })
+					str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+					str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+					str.EXPECT().Read(gomock.Any()).Return(0, rejectedErr).AnyTimes()
+					session.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+				}
+				return bodies
+			}
+
+			BeforeEach(func() {
+				rt.TLSClientConfig = &tls.Config{}
+				rt.MaxRetries = 1
+				rt.setServices("quic.clemente.io:443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+				rejectedErr = &quic.StreamError{ErrorCode: quic.StreamErrorCode(errorRequestRejected)}
+			})
+
+			It("uses GetBody to get the body for the retry", func() {
+				bodies := expectRejectedRequests(2)
+				req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", strings.NewReader("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				getBody := req.GetBody
+				var getBodyCalls int
+				req.GetBody = func() (io.ReadCloser, error) {
+					getBodyCalls++
+					return getBody()
+				}
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(MatchError(rejectedErr))
+				Expect(getBodyCalls).To(Equal(1))
+				for i := 0; i < 2; i++ {
+					var buf *bytes.Buffer
+					Eventually(bodies).Should(Receive(&buf))
+					Expect(buf.String()).To(HaveSuffix("foobar"))
+				}
+			})
+
+			It("doesn't retry requests with a body that can't be sent again", func() {
+				bodies := expectRejectedRequests(1)
+				req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", io.NopCloser(strings.NewReader("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(req.GetBody).To(BeNil())
+				req.ContentLength = 6
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(MatchError(rejectedErr))
+				var buf *bytes.Buffer
+				Eventually(bodies).Should(Receive(&buf))
+				Expect(buf.String()).To(HaveSuffix("foobar"))
+			})
+
+			It("buffers bodies that can't be sent again, if RetryBodyBufferSize is set", func() {
+				rt.RetryBodyBufferSize = 6
+				bodies := expectRejectedRequests(2)
+				req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", io.NopCloser(strings.NewReader("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				req.ContentLength = 6
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(MatchError(rejectedErr))
+				Expect(req.GetBody).To(BeNil()) // the original request is not modified
+				for i := 0; i < 2; i++ {
+					var buf *bytes.Buffer
+					Eventually(bodies).Should(Receive(&buf))
+					Expect(buf.String()).To(HaveSuffix("foobar"))
+				}
+			})
+
+			It("doesn't buffer bodies larger than RetryBodyBufferSize", func() {
+				rt.RetryBodyBufferSize = 5
+				bodies := expectRejectedRequests(1)
+				req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", io.NopCloser(strings.NewReader("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				req.ContentLength = 6
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(MatchError(rejectedErr))
+				Eventually(bodies).Should(Receive())
+			})
+		})
+
+		It("uses HTTP/3 right away for hosts seeded with SetAltServices", func() {
+			var dialed bool
+			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+				Expect(hostname).To(Equal("quic.clemente.io:443"))
+				dialed = true
+				return nil, errors.New("handshake error")
+			}
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(BeTrue())
+			Expect(rt.MetricsHandshakeStart).To(BeZero()) // no discovery took place
+		})
+
+		It("only offers the forced QUIC version", func() {
+			conf := &quic.Config{Versions: []quic.VersionNumber{quic.Version1, quic.VersionDraft29}, HandshakeIdleTimeout: time.Minute}
+			rt.QuicConfig = conf
+			rt.ForceVersion(quic.VersionDraft29)
+			Expect(conf.Versions).To(HaveLen(2)) // the config passed by the application is not modified
+			var dialed bool
+			dialAddr = func(_ string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				Expect(quicConf.Versions).To(Equal([]quic.VersionNumber{quic.VersionDraft29}))
+				Expect(quicConf.HandshakeIdleTimeout).To(Equal(time.Minute))
+				Expect(tlsConf.NextProtos).To(Equal([]string{nextProtoH3Draft29}))
+				dialed = true
+				return nil, errors.New("handshake error")
+			}
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(BeTrue())
+		})
+
+		It("uses the default config when forcing a QUIC version", func() {
+			rt.ForceVersion(quic.Version1)
+			Expect(rt.QuicConfig.Versions).To(Equal([]quic.VersionNumber{quic.Version1}))
+			Expect(rt.QuicConfig.KeepAlive).To(BeTrue())
+			Expect(defaultQuicConfig.Versions).To(HaveLen(1))
+		})
+
+		It("allows forcing a QUIC version while selecting Alt-Svc alternatives", func() {
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			start := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				<-start
+				for i := 0; i < 10000; i++ {
+					rt.ForceVersion(quic.Version1)
+				}
+			}()
+			close(start)
+			for i := 0; i < 10000; i++ {
+				_, ok := rt.AltService("quic.clemente.io")
+				Expect(ok).To(BeTrue())
+			}
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("offers the configured QUIC versions, if there's no QuicConfig", func() {
+			rt.Versions = []quic.VersionNumber{quic.VersionDraft29, quic.Version1}
+			var dialed bool
+			dialAddr = func(_ string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				Expect(quicConf.Versions).To(Equal([]quic.VersionNumber{quic.VersionDraft29, quic.Version1}))
+				Expect(quicConf.KeepAlive).To(BeTrue()) // the default config is used
+				Expect(tlsConf.NextProtos).To(Equal([]string{nextProtoH3Draft29, nextProtoH3}))
+				dialed = true
+				return nil, errors.New("handshake error")
+			}
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(BeTrue())
+			Expect(rt.QuicConfig).To(BeNil())
+			Expect(defaultQuicConfig.Versions).To(HaveLen(1))
+		})
+
+		It("ignores the configured QUIC versions, if the QuicConfig sets versions", func() {
+			rt.QuicConfig = &quic.Config{Versions: []quic.VersionNumber{quic.Version1}}
+			rt.Versions = []quic.VersionNumber{quic.VersionDraft29}
+			var dialed bool
+			dialAddr = func(_ string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlySession, error) {
+				Expect(quicConf.Versions).To(Equal([]quic.VersionNumber{quic.Version1}))
+				Expect(tlsConf.NextProtos).To(Equal([]string{nextProtoH3}))
+				dialed = true
+				return nil, errors.New("handshake error")
+			}
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(BeTrue())
+		})
+
 		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
 			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
 			Expect(err).ToNot(HaveOccurred())
@@ -169,21 +1119,1793 @@ var _ = Describe("RoundTripper", func() {
 		})
 	})
 
-	Context("validating request", func() {
-		It("rejects plain HTTP requests", func() {
-			req, err := http.NewRequest("GET", "http://www.example.org/", nil)
-			req.Body = &mockBody{}
+	Context("rate limiting", func() {
+		// Using RoundTripOpt.OnlyCachedConn, requests fail right after passing the rate limiter.
+		opt := RoundTripOpt{OnlyCachedConn: true}
+
+		It("paces requests to a host to the configured rate", func() {
+			const rate = 50 // requests per second
+			rt.PerHostRate = rate
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = rt.RoundTrip(req)
-			Expect(err).To(MatchError("http3: unsupported protocol scheme: http"))
-			Expect(req.Body.(*mockBody).closed).To(BeTrue())
+			start := time.Now()
+			for i := 0; i < 5; i++ {
+				_, err = rt.RoundTripOpt(req, opt)
+				Expect(err).To(MatchError(ErrNoCachedConn))
+			}
+			Expect(time.Since(start)).To(And(
+				BeNumerically(">=", 4*time.Second/rate),
+				BeNumerically("<", scaleDuration(2*4*time.Second/rate)),
+			))
+		})
+
+		It("limits the rate per host", func() {
+			rt.PerHostRate = 1
+			rt.FailOnRateLimit = true
+			req1, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://example.com/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTripOpt(req1, opt)
+			Expect(err).To(MatchError(ErrNoCachedConn))
+			_, err = rt.RoundTripOpt(req2, opt)
+			Expect(err).To(MatchError(ErrNoCachedConn))
+			_, err = rt.RoundTripOpt(req1, opt)
+			Expect(err).To(MatchError(ErrRateLimited))
+		})
+
+		It("stops waiting when the request is canceled", func() {
+			rt.PerHostRate = 1
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTripOpt(req, opt)
+			Expect(err).To(MatchError(ErrNoCachedConn))
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err = rt.RoundTripOpt(req.WithContext(ctx), opt)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("selecting an Alt-Svc alternative", func() {
+		BeforeEach(func() {
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{
+				{ProtocolID: "h3-29", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600},
+				{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Host: "alt2.clemente.io", Port: "8443"}, MaxAge: 3600},
+				{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Host: "alt1.clemente.io", Port: "4433"}, MaxAge: 3600},
+				{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "4433"}, MaxAge: 3600},
+			})
+		})
+
+		It("selects the alternative for the preferred version, with the lowest port", func() {
+			s, ok := rt.AltService("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(s.ProtocolID).To(Equal("h3"))
+			Expect(s.AltAuthority).To(Equal(altsvc.AltAuthority{Host: "alt1.clemente.io", Port: "4433"}))
+		})
+
+		It("follows the order of the versions in the QUIC config", func() {
+			rt.QuicConfig = &quic.Config{Versions: []quic.VersionNumber{quic.VersionDraft29, quic.Version1}}
+			s, ok := rt.AltService("quic.clemente.io:443")
+			Expect(ok).To(BeTrue())
+			Expect(s.ProtocolID).To(Equal("h3-29"))
+		})
+
+		It("doesn't select an alternative for hosts without a cached entry", func() {
+			_, ok := rt.AltService("example.com")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("returns the address to dial", func() {
+			addr, ok := rt.altSvcDialAddr("quic.clemente.io:443", []quic.VersionNumber{quic.Version1})
+			Expect(ok).To(BeTrue())
+			Expect(addr).To(Equal("alt1.clemente.io:4433"))
+			addr, ok = rt.altSvcDialAddr("quic.clemente.io:443", []quic.VersionNumber{quic.VersionDraft29})
+			Expect(ok).To(BeTrue())
+			Expect(addr).To(Equal("quic.clemente.io:443"))
+		})
+	})
+
+	Context("exporting the Alt-Svc cache", func() {
+		It("round-trips the cache through export and import", func() {
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{
+				{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600},
+				{ProtocolID: "h3-29", AltAuthority: altsvc.AltAuthority{Port: "443"}, Persist: 1},
+			})
+			rt.SetAltServices("example.com:8443", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "8443"}, MaxAge: 60}})
+			// move the expiry of the first entry, as if 10 minutes had passed
+			rt.mutex.Lock()
+			rt.services["quic.clemente.io:443"][0].expiredAt = time.Now().Add(50 * time.Minute)
+			rt.mutex.Unlock()
+
+			cache := rt.ExportAltSvcCache()
+			Expect(cache).To(HaveLen(2))
+			Expect(cache).To(HaveKey("quic.clemente.io:443"))
+			Expect(cache).To(HaveKey("example.com:8443"))
+			Expect(cache["quic.clemente.io:443"]).To(HaveLen(2))
+			Expect(cache["quic.clemente.io:443"][0].ProtocolID).To(Equal("h3"))
+			Expect(cache["quic.clemente.io:443"][0].MaxAge).To(BeNumerically("~", 50*60, 1))
+			Expect(cache["quic.clemente.io:443"][1]).To(Equal(altsvc.Service{ProtocolID: "h3-29", AltAuthority: altsvc.AltAuthority{Port: "443"}, Persist: 1}))
+			Expect(cache["example.com:8443"][0].MaxAge).To(BeNumerically("~", 60, 1))
+
+			rt2 := &RoundTripper{}
+			rt2.ImportAltSvcCache(cache)
+			Expect(rt2.ExportAltSvcCache()).To(Equal(cache))
+			svcs, ok := rt2.getServices("quic.clemente.io:443")
+			Expect(ok).To(BeTrue())
+			Expect(svcs).To(HaveLen(2))
+			Expect(svcs[0].expiredAt).To(BeTemporally("~", time.Now().Add(50*time.Minute), time.Second))
+			h3Ready, stale := rt2.h3ServiceState("example.com:8443")
+			Expect(h3Ready).To(BeTrue())
+			Expect(stale).To(BeFalse())
+		})
+
+		It("excludes expired entries", func() {
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{
+				{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600},
+				{ProtocolID: "h3-29", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600},
+			})
+			rt.SetAltServices("example.com", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			rt.mutex.Lock()
+			rt.services["quic.clemente.io:443"][1].expiredAt = time.Now().Add(-time.Second)
+			rt.services["example.com:443"][0].expiredAt = time.Now().Add(-time.Second)
+			rt.mutex.Unlock()
+			cache := rt.ExportAltSvcCache()
+			Expect(cache).To(HaveLen(1))
+			Expect(cache["quic.clemente.io:443"]).To(HaveLen(1))
+			Expect(cache["quic.clemente.io:443"][0].ProtocolID).To(Equal("h3"))
+		})
+
+		It("keeps the entries of other hosts when importing", func() {
+			rt.SetAltServices("example.com", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			rt.ImportAltSvcCache(map[string][]altsvc.Service{
+				"quic.clemente.io:443": {{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}},
+			})
+			Expect(rt.ExportAltSvcCache()).To(HaveLen(2))
+		})
+	})
+
+	Context("limiting the Alt-Svc cache", func() {
+		h3 := []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}}
+
+		It("evicts the least recently used host", func() {
+			rt.AltSvcCacheSize = 2
+			rt.setServices("host1.example.com:443", h3)
+			rt.setServices("host2.example.com:443", h3)
+			rt.setServices("host3.example.com:443", h3)
+			Expect(rt.ExportAltSvcCache()).To(HaveLen(2))
+			Expect(rt.ExportAltSvcCache()).ToNot(HaveKey("host1.example.com:443"))
+			// looking up the entries of a host marks them as used
+			_, ok := rt.getServices("host2.example.com:443")
+			Expect(ok).To(BeTrue())
+			rt.setServices("host4.example.com:443", h3)
+			cache := rt.ExportAltSvcCache()
+			Expect(cache).To(HaveLen(2))
+			Expect(cache).To(HaveKey("host2.example.com:443"))
+			Expect(cache).To(HaveKey("host4.example.com:443"))
+		})
+
+		It("doesn't count hosts that were cleared", func() {
+			rt.AltSvcCacheSize = 2
+			rt.setServices("host1.example.com:443", h3)
+			rt.setServices("host2.example.com:443", h3)
+			rt.setServices("host2.example.com:443", []altsvc.Service{{Clear: true}})
+			rt.setServices("host3.example.com:443", h3)
+			cache := rt.ExportAltSvcCache()
+			Expect(cache).To(HaveLen(2))
+			Expect(cache).To(HaveKey("host1.example.com:443"))
+			Expect(cache).To(HaveKey("host3.example.com:443"))
+		})
+
+		It("doesn't limit the cache by default", func() {
+			for i := 0; i < 100; i++ {
+				rt.setServices(fmt.Sprintf("host%d.example.com:443", i), h3)
+			}
+			Expect(rt.ExportAltSvcCache()).To(HaveLen(100))
+		})
+	})
+
+	Context("latency histograms", func() {
+		var (
+			testDone     chan struct{}
+			origDialAddr = dialAddr
+		)
+
+		BeforeEach(func() {
+			testDone = make(chan struct{})
+			origDialAddr = dialAddr
+			rt.EnableLatencyHistograms = true
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+		})
+
+		AfterEach(func() {
+			close(testDone)
+			dialAddr = origDialAddr
+		})
+
+		It("collects histograms", func() {
+			const delay = 5 * time.Millisecond
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+			// AcceptUniStream is called on a goroutine that outlives the spec
+			done := testDone
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).AnyTimes()
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				(&dataFrame{Length: 6}).Write(buf)
+				buf.Write([]byte("foobar"))
+				var delayed bool
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+					if !delayed {
+						time.Sleep(delay)
+						delayed = true
+					}
+					return buf.Read(b)
+				}).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				return str, nil
+			}).AnyTimes()
+			var dialCount int
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialCount++
+				return sess, nil
+			}
+
+			const num = 5
+			for i := 0; i < num; i++ {
+				req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+				Expect(err).ToNot(HaveOccurred())
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				body, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal([]byte("foobar")))
+			}
+			Expect(dialCount).To(Equal(1))
+			Eventually(func() uint64 { return rt.LatencySnapshot().Total.Count }).Should(BeEquivalentTo(num))
+			snapshot := rt.LatencySnapshot()
+			Expect(snapshot.Handshake.Count).To(BeEquivalentTo(1))
+			Expect(snapshot.TimeToFirstByte.Count).To(BeEquivalentTo(num))
+			Expect(snapshot.TimeToFirstByte.Mean()).To(BeNumerically(">=", delay))
+			// The 5ms delay falls into the bucket with an upper bound of 8ms.
+			// Allow for some scheduling delays on slow machines.
+			for _, p := range []float64{50, 99} {
+				Expect(snapshot.TimeToFirstByte.Percentile(p)).To(And(BeNumerically(">=", 8*time.Millisecond), BeNumerically("<=", 64*time.Millisecond)))
+				Expect(snapshot.Total.Percentile(p)).To(BeNumerically(">=", snapshot.TimeToFirstByte.Percentile(p)))
+			}
+		})
+
+		It("returns empty histograms if they are disabled", func() {
+			rt.EnableLatencyHistograms = false
+			snapshot := rt.LatencySnapshot()
+			Expect(snapshot.Handshake.Count).To(BeZero())
+			Expect(snapshot.TimeToFirstByte.Count).To(BeZero())
+			Expect(snapshot.Total.Count).To(BeZero())
+			Expect(snapshot.Total.Percentile(50)).To(BeZero())
+		})
+	})
+
+	Context("time to first byte", func() {
+		const delay = 50 * time.Millisecond
+
+		var (
+			testDone     chan struct{}
+			origDialAddr = dialAddr
+		)
+
+		BeforeEach(func() {
+			testDone = make(chan struct{})
+			origDialAddr = dialAddr
+		})
+
+		AfterEach(func() {
+			close(testDone)
+			dialAddr = origDialAddr
+		})
+
+		It("returns 0 if no request was sent yet", func() {
+			Expect(rt.MetricsTimeToFirstByte()).To(BeZero())
+		})
+
+		It("measures the time to first byte of requests sent over HTTP/3", func() {
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+			// AcceptUniStream is called on a goroutine that outlives the spec
+			done := testDone
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).AnyTimes()
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				var delayed bool
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+					// the server takes some time to process the request
+					if !delayed {
+						time.Sleep(delay)
+						delayed = true
+					}
+					return buf.Read(b)
+				}).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				return str, nil
+			}).AnyTimes()
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return sess, nil }
+
+			req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(rt.MetricsTimeToFirstByte()).To(And(BeNumerically(">=", delay), BeNumerically("<", delay+50*time.Millisecond)))
+			Expect(rt.MetricsRequestSent).ToNot(BeTemporally("<", rt.MetricsHandshakeDone))
+		})
+
+		It("measures the time to first byte of requests sent over TCP", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(delay)
+				w.Write([]byte("foobar"))
+			}))
+			defer server.Close()
+			rt.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(rt.MetricsTimeToFirstByte()).To(And(BeNumerically(">=", delay), BeNumerically("<", delay+50*time.Millisecond)))
+			// the time to first byte doesn't include the handshake
+			Expect(rt.MetricsHandshakeDone).ToNot(BeZero())
+			Expect(rt.MetricsRequestSent).ToNot(BeTemporally("<", rt.MetricsHandshakeDone))
+		})
+	})
+
+	Context("reporting how the connection was established", func() {
+		var (
+			testDone     chan struct{}
+			origDialAddr = dialAddr
+		)
+
+		BeforeEach(func() {
+			testDone = make(chan struct{})
+			origDialAddr = dialAddr
+		})
+
+		AfterEach(func() {
+			close(testDone)
+			dialAddr = origDialAddr
+		})
+
+		// newSession returns a session that responds to every request, and reports the connection state cs.
+		newSession := func(cs quic.ConnectionState) *mockquic.MockEarlySession {
+			done := testDone
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).AnyTimes()
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+			sess.EXPECT().ConnectionState().Return(cs).AnyTimes()
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				return str, nil
+			}).AnyTimes()
+			return sess
+		}
+
+		roundTrip := func(host string, sess quic.EarlySession) {
+			rt.SetAltServices(host, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return sess, nil }
+			req, err := http.NewRequest(MethodGet0RTT, "https://"+host+"/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+		}
+
+		It("reports a 0-RTT connection that was accepted", func() {
+			cs := quic.ConnectionState{Attempted0RTT: true}
+			cs.TLS.DidResume = true
+			cs.TLS.Used0RTT = true
+			roundTrip("quic.clemente.io", newSession(cs))
+			Expect(rt.MetricsResumed).To(BeTrue())
+			Expect(rt.MetricsAttempted0RTT).To(BeTrue())
+			Expect(rt.MetricsAccepted0RTT).To(BeTrue())
+		})
+
+		It("reports a 0-RTT connection that was rejected", func() {
+			cs := quic.ConnectionState{Attempted0RTT: true}
+			cs.TLS.DidResume = true
+			roundTrip("quic.clemente.io", newSession(cs))
+			Expect(rt.MetricsResumed).To(BeTrue())
+			Expect(rt.MetricsAttempted0RTT).To(BeTrue())
+			Expect(rt.MetricsAccepted0RTT).To(BeFalse())
+		})
+
+		It("reports the connection of the last request", func() {
+			cs := quic.ConnectionState{Attempted0RTT: true}
+			cs.TLS.DidResume = true
+			cs.TLS.Used0RTT = true
+			roundTrip("quic.clemente.io", newSession(cs))
+			Expect(rt.MetricsAccepted0RTT).To(BeTrue())
+			roundTrip("example.com", newSession(quic.ConnectionState{}))
+			Expect(rt.MetricsResumed).To(BeFalse())
+			Expect(rt.MetricsAttempted0RTT).To(BeFalse())
+			Expect(rt.MetricsAccepted0RTT).To(BeFalse())
+		})
+	})
+
+	Context("parsing the Server-Timing header", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/timing" {
+					w.Header().Add("Server-Timing", `db;dur=53.5;desc="Database"`)
+					w.Header().Add("Server-Timing", "app;dur=12")
+				}
+			}))
+			rt.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		})
+
+		AfterEach(func() { server.Close() })
+
+		roundTrip := func(path string) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			rsp.Body.Close()
+		}
+
+		It("reports the metrics of the last response", func() {
+			rt.ParseServerTiming = true
+			roundTrip("/timing")
+			Expect(rt.MetricsServerTiming).To(Equal([]ServerTiming{
+				{Name: "db", Duration: 53500 * time.Microsecond, Description: "Database"},
+				{Name: "app", Duration: 12 * time.Millisecond},
+			}))
+			roundTrip("/")
+			Expect(rt.MetricsServerTiming).To(BeNil())
+		})
+
+		It("doesn't parse the header, if not enabled", func() {
+			roundTrip("/timing")
+			Expect(rt.MetricsServerTiming).To(BeNil())
+		})
+	})
+
+	Context("Happy Eyeballs", func() {
+		type receivedRequest struct {
+			method string
+			body   string
+		}
+
+		var (
+			server       *httptest.Server
+			tcpConns     int32
+			tcpRequests  chan receivedRequest // the requests received by the TCP server
+			hostname     string
+			req          *http.Request
+			testDone     chan struct{}
+			origDialAddr = dialAddr
+		)
+
+		newMockSession := func() *mockquic.MockEarlySession {
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+			// AcceptUniStream is called on a goroutine that outlives the spec
+			done := testDone
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).AnyTimes()
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				return str, nil
+			}).AnyTimes()
+			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			return sess
+		}
+
+		BeforeEach(func() {
+			testDone = make(chan struct{})
+			atomic.StoreInt32(&tcpConns, 0)
+			tcpRequests = make(chan receivedRequest, 10)
+			received := tcpRequests
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				select {
+				case received <- receivedRequest{method: r.Method, body: string(body)}:
+				default:
+				}
+			}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&tcpConns, 1)
+				}
+			}
+			server.StartTLS()
+			rt.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			rt.ConnectionDiscovery = ConnectionDiscoveryHappyEyeballs
+			var err error
+			req, err = http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			hostname = authorityAddr("https", hostnameFromRequest(req))
+			origDialAddr = dialAddr
+		})
+
+		AfterEach(func() {
+			close(testDone)
+			// The QUIC attempt might still be dialing if TCP won the race.
+			waitForDials()
+			server.Close()
+			dialAddr = origDialAddr
+		})
+
+		It("remembers that QUIC won the race, and doesn't race again", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return newMockSession(), nil }
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			winner, ok := rt.getWinner(hostname)
+			Expect(ok).To(BeTrue())
+			Expect(winner).To(Equal(transportProtocolQUIC))
+			// the TCP attempt of the race
+			Eventually(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeEquivalentTo(1))
+
+			rsp, err = rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeEquivalentTo(1))
+		})
+
+		It("uses QUIC right away, if it won the last race", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return newMockSession(), nil }
+			rt.setWinner(hostname, transportProtocolQUIC)
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeZero())
+		})
+
+		It("reuses the cached QUIC connection, if configured", func() {
+			var dialCount int32
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				atomic.AddInt32(&dialCount, 1)
+				return newMockSession(), nil
+			}
+			rt.HappyEyeballsReuseConn = true
+			rt.HappyEyeballsWinnerTTL = -1
+			Expect(rt.Warmup(context.Background(), hostname)).To(Succeed())
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+			for i := 0; i < 2; i++ {
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+			}
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+			Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeZero())
+		})
+
+		It("races TCP against a cached QUIC connection, if not configured to reuse it", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return newMockSession(), nil }
+			rt.HappyEyeballsWinnerTTL = -1
+			Expect(rt.Warmup(context.Background(), hostname)).To(Succeed())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Eventually(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeEquivalentTo(1))
+		})
+
+		It("races both protocols, if the cached QUIC connection didn't complete the handshake", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return nil, errors.New("handshake error")
+			}
+			rt.HappyEyeballsReuseConn = true
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(atomic.LoadInt32(&tcpConns)).To(BeEquivalentTo(1))
+		})
+
+		It("races again, if the winner fails", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return nil, errors.New("handshake error")
+			}
+			rt.setWinner(hostname, transportProtocolQUIC)
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(atomic.LoadInt32(&tcpConns)).To(BeEquivalentTo(1))
+			winner, ok := rt.getWinner(hostname)
+			Expect(ok).To(BeTrue())
+			Expect(winner).To(Equal(transportProtocolTCP))
+		})
+
+		It("races again, after the winner expired", func() {
+			rt.HappyEyeballsWinnerTTL = time.Nanosecond
+			rt.setWinner(hostname, transportProtocolQUIC)
+			time.Sleep(time.Millisecond)
+			_, ok := rt.getWinner(hostname)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("doesn't remember the winner, if the TTL is negative", func() {
+			rt.HappyEyeballsWinnerTTL = -1
+			rt.setWinner(hostname, transportProtocolQUIC)
+			_, ok := rt.getWinner(hostname)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("times out the race, if neither QUIC nor TCP succeed", func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer ln.Close()
+			tcpClosed := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				// never respond, and wait for the client to cancel the attempt
+				_, err = conn.Read(make([]byte, 1<<16))
+				for err == nil {
+					_, err = conn.Read(make([]byte, 1<<16))
+				}
+				conn.Close()
+				close(tcpClosed)
+			}()
+			done := testDone
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				<-done
+				return nil, errors.New("test done")
+			}
+			rt.DiscoveryTimeout = 100 * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+ln.Addr().String(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			start := time.Now()
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(&ErrDiscoveryTimeout{Duration: 100 * time.Millisecond}))
+			var netErr net.Error
+			Expect(errors.As(err, &netErr)).To(BeTrue())
+			Expect(netErr.Timeout()).To(BeTrue())
+			Expect(time.Since(start)).To(And(
+				BeNumerically(">=", rt.DiscoveryTimeout),
+				BeNumerically("<", time.Second),
+			))
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+			// the TCP attempt is canceled
+			Eventually(tcpClosed).Should(BeClosed())
+		})
+
+		It("doesn't time out the request after the race was won", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return nil, errors.New("handshake error")
+			}
+			rt.DiscoveryTimeout = 100 * time.Millisecond
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			time.Sleep(2 * rt.DiscoveryTimeout)
+			Expect(rsp.Request.Context().Err()).ToNot(HaveOccurred())
+			_, err = io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Body.Close()).To(Succeed())
+			Expect(rsp.Request.Context().Err()).To(MatchError(context.Canceled))
+		})
+
+		It("cancels the TCP attempt as soon as the QUIC handshake completes", func() {
+			tcpCanceled := make(chan time.Time, 1)
+			slowServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+					tcpCanceled <- time.Now()
+				case <-time.After(scaleDuration(time.Second)):
+				}
+			}))
+			defer slowServer.Close()
+			slowReq, err := http.NewRequest(http.MethodGet, slowServer.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			handshakeCtx, handshakeDone := context.WithCancel(context.Background())
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return &handshakingSession{EarlySession: newMockSession(), handshakeDone: handshakeCtx}, nil
+			}
+			// Give the TCP attempt enough time to send the request.
+			var handshakeCompleted time.Time
+			timer := time.AfterFunc(scaleDuration(100*time.Millisecond), func() {
+				handshakeCompleted = time.Now()
+				handshakeDone()
+			})
+			defer timer.Stop()
+			rsp, err := rt.RoundTrip(slowReq)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(rsp.ProtoMajor).To(Equal(3))
+			var canceled time.Time
+			Eventually(tcpCanceled).Should(Receive(&canceled))
+			Expect(canceled.Sub(handshakeCompleted)).To(BeNumerically("<", scaleDuration(50*time.Millisecond)))
+		})
+
+		It("closes the QUIC response, if TCP won the race", func() {
+			handshakeCtx, handshakeDone := context.WithCancel(context.Background())
+			defer handshakeDone()
+			sess := &cancelingSession{EarlySession: newMockSession(), canceled: make(chan struct{})}
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return &handshakingSession{EarlySession: sess, handshakeDone: handshakeCtx}, nil
+			}
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.ProtoMajor).To(Equal(1))
+			// complete the QUIC handshake after TCP won
+			handshakeDone()
+			Eventually(sess.canceled).Should(BeClosed())
+		})
+
+		It("races only once for concurrent requests", func() {
+			var dialCount int32
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				atomic.AddInt32(&dialCount, 1)
+				// Delay the response, such that all requests start while the race is in progress.
+				return &slowSession{EarlySession: newMockSession(), delay: scaleDuration(50 * time.Millisecond)}, nil
+			}
+			const num = 10
+			var wg sync.WaitGroup
+			wg.Add(num)
+			for i := 0; i < num; i++ {
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					rsp, err := rt.RoundTrip(req.Clone(context.Background()))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rsp.StatusCode).To(Equal(200))
+					Expect(rsp.ProtoMajor).To(Equal(3))
+				}()
+			}
+			wg.Wait()
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+			Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeNumerically("<=", 1))
+		})
+
+		It("races again, if a concurrent race failed", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return nil, errors.New("handshake error")
+			}
+			rt.HappyEyeballsWinnerTTL = -1
+			race, ok := rt.joinRace(hostname)
+			Expect(ok).To(BeTrue())
+			rspChan := make(chan *http.Response)
+			go func() {
+				defer GinkgoRecover()
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				rspChan <- rsp
+			}()
+			Consistently(rspChan).ShouldNot(Receive())
+			Expect(atomic.LoadInt32(&tcpConns)).To(BeZero())
+			rt.finishRace(hostname, race) // without a winner
+			var rsp *http.Response
+			Eventually(rspChan).Should(Receive(&rsp))
+			Expect(rsp.ProtoMajor).To(Equal(1))
+		})
+
+		It("rejects invalid methods before starting the race", func() {
+			var dialed bool
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialed = true
+				return nil, errors.New("handshake error")
+			}
+			req.Method = "foo bar"
+			_, err := rt.RoundTrip(req)
+			Expect(err).To(MatchError(`http3: invalid method "foo bar"`))
+			Expect(dialed).To(BeFalse())
+			Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeZero())
+		})
+
+		It("sends the request body on both attempts", func() {
+			quicBody := gbytes.NewBuffer()
+			// The QUIC handshake completes after the TCP handshake, so the TCP attempt isn't canceled.
+			quicHandshake, quicHandshakeDone := context.WithCancel(context.Background())
+			time.AfterFunc(scaleDuration(100*time.Millisecond), quicHandshakeDone)
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+				sess.EXPECT().AcceptUniStream(gomock.Any()).Return(nil, errors.New("test done")).AnyTimes()
+				sess.EXPECT().HandshakeComplete().Return(quicHandshake).AnyTimes()
+				sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+				sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+				// The QUIC attempt sends the request body, but fails before receiving a response.
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(quicBody.Write).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().Read(gomock.Any()).Return(0, errors.New("stream reset")).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				sess.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil).AnyTimes()
+				return sess, nil
+			}
+			req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(tcpRequests).To(Receive(Equal(receivedRequest{method: http.MethodPost, body: "foobar"})))
+			Eventually(quicBody).Should(gbytes.Say("foobar"))
+		})
+
+		It("doesn't race requests with a body that can't be sent again", func() {
+			var dialed bool
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				dialed = true
+				return nil, errors.New("handshake error")
+			}
+			req, err := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("foobar")))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.GetBody).To(BeNil())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(tcpRequests).To(Receive(Equal(receivedRequest{method: http.MethodPost, body: "foobar"})))
+			Expect(dialed).To(BeFalse())
+		})
+
+		It("sends 0-RTT requests as GET requests using TCP", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return nil, errors.New("handshake error")
+			}
+			req.Method = MethodGet0RTT
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(tcpRequests).To(Receive(Equal(receivedRequest{method: http.MethodGet, body: ""})))
+		})
+
+		Context("using a discovery chain", func() {
+			BeforeEach(func() {
+				rt.DiscoveryChain = ConnectionDiscoveryChain{
+					ConnectionDiscoveryAltSvc,
+					ConnectionDiscoveryDNS,
+					ConnectionDiscoveryHappyEyeballs,
+				}
+			})
+
+			It("races the protocols, if neither Alt-Svc nor DNS advertise h3", func() {
+				var lookedUp string
+				rt.LookupHTTPSRecord = func(_ context.Context, host string) ([]string, time.Duration, error) {
+					lookedUp = host
+					return []string{"h2"}, time.Hour, nil
+				}
+				var quicDials int32
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					atomic.AddInt32(&quicDials, 1)
+					return nil, errors.New("handshake error")
+				}
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(lookedUp).To(Equal("127.0.0.1"))
+				Expect(atomic.LoadInt32(&quicDials)).To(BeEquivalentTo(1))
+				Expect(atomic.LoadInt32(&tcpConns)).To(BeEquivalentTo(1))
+				winner, ok := rt.getWinner(hostname)
+				Expect(ok).To(BeTrue())
+				Expect(winner).To(Equal(transportProtocolTCP))
+			})
+
+			It("uses QUIC right away, if DNS advertises h3", func() {
+				rt.LookupHTTPSRecord = func(context.Context, string) ([]string, time.Duration, error) {
+					return []string{"h2", "h3"}, time.Hour, nil
+				}
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return newMockSession(), nil }
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeZero())
+				h3Ready, _ := rt.h3ServiceState(hostname)
+				Expect(h3Ready).To(BeTrue())
+			})
+
+			It("uses TCP, if the chain doesn't race the protocols", func() {
+				rt.DiscoveryChain = ConnectionDiscoveryChain{ConnectionDiscoveryAltSvc, ConnectionDiscoveryDNS}
+				rt.LookupHTTPSRecord = func(context.Context, string) ([]string, time.Duration, error) {
+					return nil, 0, errors.New("no such record")
+				}
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					Fail("didn't expect a QUIC dial")
+					return nil, nil
+				}
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&tcpConns)).To(BeEquivalentTo(1))
+			})
+		})
+
+		Context("probing ports", func() {
+			BeforeEach(func() {
+				rt.DiscoveryChain = ConnectionDiscoveryChain{ConnectionDiscoveryAltSvc, ConnectionDiscoveryPortProbe}
+				rt.ProbePorts = []int{443, 8443}
+			})
+
+			It("uses the first port that completes the handshake", func() {
+				done := testDone
+				var mutex sync.Mutex
+				var dialed []string
+				dialAddr = func(addr string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+					Expect(tlsConf.ServerName).To(Equal("127.0.0.1"))
+					mutex.Lock()
+					dialed = append(dialed, addr)
+					mutex.Unlock()
+					if addr == "127.0.0.1:8443" {
+						return newMockSession(), nil
+					}
+					// The handshake on port 443 never completes, so the probes must run in parallel.
+					<-done
+					return nil, errors.New("handshake error")
+				}
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&tcpConns)).To(BeZero())
+				Eventually(func() []string {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return append([]string{}, dialed...)
+				}).Should(ConsistOf("127.0.0.1:443", "127.0.0.1:8443"))
+				svc, ok := rt.AltService(hostname)
+				Expect(ok).To(BeTrue())
+				Expect(svc.AltAuthority.Port).To(Equal("8443"))
+				Expect(svc.MaxAge).To(Equal(24 * 60 * 60))
+
+				// the connection is reused
+				rsp, err = rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				mutex.Lock()
+				Expect(dialed).To(HaveLen(2))
+				mutex.Unlock()
+			})
+
+			It("uses TCP, if none of the ports completes the handshake", func() {
+				var dials int32
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					atomic.AddInt32(&dials, 1)
+					return nil, errors.New("handshake error")
+				}
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&dials)).To(BeEquivalentTo(2))
+				Expect(atomic.LoadInt32(&tcpConns)).To(BeEquivalentTo(1))
+				_, ok := rt.AltService(hostname)
+				Expect(ok).To(BeFalse())
+			})
+
+			It("doesn't probe, if no ports are configured", func() {
+				rt.ProbePorts = nil
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					Fail("didn't expect a QUIC dial")
+					return nil, nil
+				}
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&tcpConns)).To(BeEquivalentTo(1))
+			})
+		})
+
+		Context("comparing transports", func() {
+			It("sends the request using both transports, and measures both", func() {
+				const delay = 25 * time.Millisecond
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					time.Sleep(delay)
+					return newMockSession(), nil
+				}
+				h3Res, tcpRes, h3Dur, tcpDur, err := rt.CompareTransports(context.Background(), req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h3Res.StatusCode).To(Equal(200))
+				Expect(h3Res.ProtoMajor).To(Equal(3))
+				Expect(tcpRes.StatusCode).To(Equal(200))
+				Expect(tcpRes.ProtoMajor).ToNot(Equal(3))
+				Expect(tcpRes.Body.Close()).To(Succeed())
+				Expect(h3Dur).To(BeNumerically(">=", delay))
+				Expect(tcpDur).ToNot(BeZero())
+				var r receivedRequest
+				Expect(tcpRequests).To(Receive(&r))
+				Expect(r.method).To(Equal(http.MethodGet))
+				// the loser isn't canceled, and no winner is remembered
+				_, ok := rt.getWinner(hostname)
+				Expect(ok).To(BeFalse())
+			})
+
+			It("sends the request body on both transports", func() {
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) { return newMockSession(), nil }
+				req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				_, tcpRes, _, _, err := rt.CompareTransports(context.Background(), req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tcpRes.Body.Close()).To(Succeed())
+				var r receivedRequest
+				Expect(tcpRequests).To(Receive(&r))
+				Expect(r.body).To(Equal("foobar"))
+			})
+
+			It("returns the response of the other transport, if one of them fails", func() {
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					return nil, errors.New("handshake error")
+				}
+				h3Res, tcpRes, h3Dur, tcpDur, err := rt.CompareTransports(context.Background(), req)
+				Expect(err).To(MatchError("http3: HTTP/3 request failed: handshake error"))
+				Expect(h3Res).To(BeNil())
+				Expect(h3Dur).ToNot(BeZero())
+				Expect(tcpRes.StatusCode).To(Equal(200))
+				Expect(tcpRes.Body.Close()).To(Succeed())
+				Expect(tcpDur).ToNot(BeZero())
+			})
+
+			It("rejects requests with a body that can't be sent again", func() {
+				req, err := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				_, _, _, _, err = rt.CompareTransports(context.Background(), req)
+				Expect(err).To(MatchError("http3: comparing transports requires a request body that can be sent again"))
+				Expect(atomic.LoadInt32(&tcpConns)).To(BeZero())
+			})
+		})
+
+		Context("dial errors", func() {
+			var closedPortReq *http.Request
+
+			BeforeEach(func() {
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ln.Close()).To(Succeed())
+				closedPortReq, err = http.NewRequest(http.MethodGet, "https://"+ln.Addr().String(), nil)
+				Expect(err).ToNot(HaveOccurred())
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					return nil, errors.New("handshake error")
+				}
+			})
+
+			It("returns an ErrTCPDial if both protocols fail", func() {
+				_, err := rt.RoundTrip(closedPortReq)
+				Expect(err).To(HaveOccurred())
+				var tcpErr *ErrTCPDial
+				Expect(errors.As(err, &tcpErr)).To(BeTrue())
+				Expect(tcpErr.Addr).To(Equal(closedPortReq.URL.Host))
+			})
+
+			It("returns an ErrTCPDial when using Alt-Svc discovery", func() {
+				rt.ConnectionDiscovery = ConnectionDiscoveryAltSvc
+				_, err := rt.RoundTrip(closedPortReq)
+				Expect(err).To(HaveOccurred())
+				var tcpErr *ErrTCPDial
+				Expect(errors.As(err, &tcpErr)).To(BeTrue())
+			})
+
+			It("returns an ErrDNS if the host can't be resolved", func() {
+				req, err := http.NewRequest(http.MethodGet, "https://quic-go.invalid", nil)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(HaveOccurred())
+				var dnsErr *ErrDNS
+				Expect(errors.As(err, &dnsErr)).To(BeTrue())
+				Expect(dnsErr.Host).To(Equal("quic-go.invalid:443"))
+			})
+
+			It("returns an ErrQUICDial if the QUIC handshake fails", func() {
+				rt.setServices(hostname, []altsvc.Service{{ProtocolID: "h3", MaxAge: 3600}})
+				_, err := rt.RoundTrip(req)
+				Expect(err).To(MatchError("handshake error"))
+				var quicErr *ErrQUICDial
+				Expect(errors.As(err, &quicErr)).To(BeTrue())
+				Expect(quicErr.Addr).To(Equal(hostname))
+			})
+		})
+
+		Context("soft expiry of Alt-Svc entries", func() {
+			var quicDials int32
+
+			BeforeEach(func() {
+				atomic.StoreInt32(&quicDials, 0)
+				rt.ConnectionDiscovery = ConnectionDiscoveryAltSvc
+				rt.AltSvcSoftExpiry = time.Minute
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					atomic.AddInt32(&quicDials, 1)
+					return newMockSession(), nil
+				}
+			})
+
+			It("uses HTTP/3 right away, if the entry is valid", func() {
+				rt.setServices(hostname, []altsvc.Service{{ProtocolID: "h3", MaxAge: 3600}})
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&quicDials)).To(BeEquivalentTo(1))
+				Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeZero())
+			})
+
+			It("races HTTP/3 against TCP, if the entry is about to expire", func() {
+				rt.setServices(hostname, []altsvc.Service{{ProtocolID: "h3", MaxAge: 30}})
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&quicDials)).To(BeEquivalentTo(1))
+				Eventually(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeEquivalentTo(1))
+			})
+
+			It("races, even if QUIC won the last race", func() {
+				rt.setWinner(hostname, transportProtocolQUIC)
+				rt.setServices(hostname, []altsvc.Service{{ProtocolID: "h3", MaxAge: 30}})
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Eventually(func() int32 { return atomic.LoadInt32(&tcpConns) }).Should(BeEquivalentTo(1))
+			})
+
+			It("uses the ConnectionDiscovery mode, if the entry has expired", func() {
+				rt.setServices(hostname, []altsvc.Service{{ProtocolID: "h3", MaxAge: 3600}})
+				rt.mutex.Lock()
+				rt.services[hostname][0].expiredAt = time.Now().Add(-time.Second)
+				rt.mutex.Unlock()
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&tcpConns)).To(BeEquivalentTo(1))
+				Expect(atomic.LoadInt32(&quicDials)).To(BeZero())
+			})
+
+			It("uses entries until they expire, if the soft expiry is disabled", func() {
+				rt.AltSvcSoftExpiry = 0
+				rt.setServices(hostname, []altsvc.Service{{ProtocolID: "h3", MaxAge: 1}})
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(atomic.LoadInt32(&quicDials)).To(BeEquivalentTo(1))
+				Consistently(func() int32 { return atomic.LoadInt32(&tcpConns) }, 100*time.Millisecond).Should(BeZero())
+			})
+		})
+	})
+
+	Context("falling back to TCP", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			}))
+			server.EnableHTTP2 = true
+			server.StartTLS()
+			rt.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("uses HTTP/2, if the server supports it", func() {
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer rsp.Body.Close()
+			Expect(rsp.ProtoMajor).To(Equal(2))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("HTTP/2.0"))
+		})
+
+		It("overrides InsecureSkipVerify for a single request", func() {
+			rt.TLSClientConfig = &tls.Config{}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			insecure := true
+			rsp, err := rt.RoundTripOpt(req, RoundTripOpt{InsecureSkipVerify: &insecure})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			rsp.Body.Close()
+			// other requests still verify the certificate
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+		})
+
+		It("uses the client certificate selected by GetClientCertificate", func() {
+			server.Close()
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.TLS.PeerCertificates).To(HaveLen(1))
+				w.Write(r.TLS.PeerCertificates[0].Raw)
+			}))
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+			server.StartTLS()
+			clientCert := server.TLS.Certificates[0]
+			var called bool
+			rt.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				called = true
+				return &clientCert, nil
+			}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer rsp.Body.Close()
+			Expect(called).To(BeTrue())
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal(clientCert.Certificate[0]))
+		})
+
+		It("enforces OCSP stapling, if RequireOCSPStaple is set", func() {
+			ca, caKey, leaf, leafKey := generateTestCertificates()
+			staple := createOCSPResponse(ca, caKey, leaf, ocsp.Good, time.Now().Add(time.Hour))
+			server.Close()
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+				Certificate: [][]byte{leaf.Raw, ca.Raw},
+				PrivateKey:  leafKey,
+				OCSPStaple:  staple,
+			}}}
+			server.StartTLS()
+			rt.RequireOCSPStaple = true
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			rsp.Body.Close()
+			Expect(rsp.TLS.OCSPResponse).To(Equal(staple))
+			// the server stops stapling
+			server.TLS.Certificates[0].OCSPStaple = nil
+			server.CloseClientConnections()
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(ContainSubstring(errMissingOCSPStaple.Error())))
+		})
+
+		It("accepts servers presenting a pinned certificate", func() {
+			rt.PinnedCertificates = [][]byte{server.Certificate().Raw}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			rsp.Body.Close()
+			Expect(rsp.StatusCode).To(Equal(200))
+		})
+
+		It("rejects servers that don't present a pinned certificate", func() {
+			_, _, otherCert, _ := generateTestCertificates()
+			rt.PinnedCertificates = [][]byte{otherCert.Raw}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(ContainSubstring(errCertificateNotPinned.Error())))
+		})
+
+		It("uses HTTP/1.1, if ForceTCPHTTP1 is set", func() {
+			rt.ForceTCPHTTP1 = true
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer rsp.Body.Close()
+			Expect(rsp.ProtoMajor).To(Equal(1))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("HTTP/1.1"))
+		})
+
+		It("only dials the preferred address family", func() {
+			// the httptest server only listens on 127.0.0.1
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			rt.AddressFamilyPreference = AddressFamilyIPv4
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			rsp.Body.Close()
+			// The TCP connection would be reused by rt, so use a new RoundTripper.
+			rt2 := &RoundTripper{TLSClientConfig: rt.TLSClientConfig, AddressFamilyPreference: AddressFamilyIPv6}
+			defer rt2.Close()
+			_, err = rt2.RoundTrip(req)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("reuses TCP connections", func() {
+			var conns int32
+			server.Close()
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt32(&conns, 1)
+				}
+			}
+			server.StartTLS()
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 2; i++ {
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				_, err = io.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				rsp.Body.Close()
+			}
+			Expect(atomic.LoadInt32(&conns)).To(BeEquivalentTo(1))
+		})
+
+		It("closes idle TCP connections", func() {
+			var conns int32
+			closed := make(chan struct{}, 2)
+			server.Close()
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				switch state {
+				case http.StateNew:
+					atomic.AddInt32(&conns, 1)
+				case http.StateClosed:
+					closed <- struct{}{}
+				}
+			}
+			server.StartTLS()
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			for _, closeConns := range []func(){rt.CloseIdleConnections, func() { Expect(rt.Close()).To(Succeed()) }} {
+				rsp, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = io.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				rsp.Body.Close()
+				closeConns()
+				Eventually(closed).Should(Receive())
+			}
+			Expect(atomic.LoadInt32(&conns)).To(BeEquivalentTo(2))
+		})
+
+		It("dials the address returned by DialAddrOverride", func() {
+			server.Close()
+			server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Host + " " + r.TLS.ServerName))
+			}))
+			server.StartTLS()
+			var overrideCalledWith string
+			rt.DialAddrOverride = func(host string) (string, bool) {
+				overrideCalledWith = host
+				return server.Listener.Addr().String(), true
+			}
+			req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer rsp.Body.Close()
+			Expect(overrideCalledWith).To(Equal("quic.clemente.io:443"))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("quic.clemente.io quic.clemente.io"))
+		})
+	})
+
+	Context("warming up connections", func() {
+		var (
+			testDone     chan struct{}
+			dialCount    int32
+			origDialAddr = dialAddr
+		)
+
+		BeforeEach(func() {
+			testDone = make(chan struct{})
+			atomic.StoreInt32(&dialCount, 0)
+			origDialAddr = dialAddr
+		})
+
+		AfterEach(func() {
+			close(testDone)
+			waitForDials()
+			dialAddr = origDialAddr
+		})
+
+		newMockSession := func(handshakeDone context.Context) *mockquic.MockEarlySession {
+			done := testDone
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+			sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+			sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-done
+				return nil, errors.New("test done")
+			}).AnyTimes()
+			sess.EXPECT().HandshakeComplete().Return(handshakeDone).AnyTimes()
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+			sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+			sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+			sess.EXPECT().OpenStreamSync(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				Expect(enc.WriteField(qpack.HeaderField{Name: ":status", Value: "200"})).To(Succeed())
+				Expect(enc.Close()).To(Succeed())
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).AnyTimes()
+				str.EXPECT().CancelWrite(gomock.Any()).AnyTimes()
+				return str, nil
+			}).AnyTimes()
+			return sess
+		}
+
+		It("uses the warm connection for subsequent requests", func() {
+			sess := newMockSession(handshakeCtx)
+			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+				Expect(hostname).To(Equal("quic.clemente.io:443"))
+				atomic.AddInt32(&dialCount, 1)
+				return sess, nil
+			}
+			Expect(rt.Warmup(context.Background(), "quic.clemente.io")).To(Succeed())
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+
+			rt.SetAltServices("quic.clemente.io", []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "443"}, MaxAge: 3600}})
+			req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+		})
+
+		It("warms up multiple hosts", func() {
+			var mutex sync.Mutex
+			var hosts []string
+			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+				mutex.Lock()
+				hosts = append(hosts, hostname)
+				mutex.Unlock()
+				return newMockSession(handshakeCtx), nil
+			}
+			Expect(rt.Warmup(context.Background(), "quic.clemente.io", "example.org:1337")).To(Succeed())
+			Expect(hosts).To(ConsistOf("quic.clemente.io:443", "example.org:1337"))
+		})
+
+		It("caches the QUIC winner when using Happy Eyeballs", func() {
+			rt.ConnectionDiscovery = ConnectionDiscoveryHappyEyeballs
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				atomic.AddInt32(&dialCount, 1)
+				return newMockSession(handshakeCtx), nil
+			}
+			Expect(rt.Warmup(context.Background(), "quic.clemente.io")).To(Succeed())
+			req, err := http.NewRequest(http.MethodGet, "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+		})
+
+		It("doesn't cache connections that failed", func() {
+			testErr := errors.New("handshake error")
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				atomic.AddInt32(&dialCount, 1)
+				return nil, testErr
+			}
+			err := rt.Warmup(context.Background(), "quic.clemente.io")
+			Expect(err).To(MatchError("http3: warming up the connection to quic.clemente.io:443 failed: handshake error"))
+			Expect(errors.Is(err, testErr)).To(BeTrue())
+			Expect(rt.Warmup(context.Background(), "quic.clemente.io")).To(HaveOccurred())
+			Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(2))
+		})
+
+		It("returns when the context is canceled before the handshake completes", func() {
+			dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+				return newMockSession(context.Background()), nil
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(25*time.Millisecond))
+			defer cancel()
+			err := rt.Warmup(ctx, "quic.clemente.io")
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			rt.mutex.Lock()
+			Expect(rt.clients).To(BeEmpty())
+			rt.mutex.Unlock()
+		})
+
+		Context("probing HTTP/3 availability", func() {
+			It("reports that a host is reachable, without caching the connection", func() {
+				done := testDone
+				sess := mockquic.NewMockEarlySession(mockCtrl)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				sess.EXPECT().OpenUniStream().Return(controlStr, nil).AnyTimes()
+				sess.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-done
+					return nil, errors.New("test done")
+				}).AnyTimes()
+				sess.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+				sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+				closed := make(chan struct{})
+				sess.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorNoError), "").Do(func(quic.ApplicationErrorCode, string) { close(closed) })
+				dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.EarlySession, error) {
+					Expect(hostname).To(Equal("quic.clemente.io:443"))
+					return sess, nil
+				}
+				ok, err := rt.ProbeH3(context.Background(), "quic.clemente.io")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				Expect(closed).To(BeClosed())
+				rt.mutex.Lock()
+				Expect(rt.clients).To(BeEmpty())
+				rt.mutex.Unlock()
+			})
+
+			It("reports that a host is unreachable", func() {
+				testErr := errors.New("handshake error")
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					return nil, testErr
+				}
+				ok, err := rt.ProbeH3(context.Background(), "quic.clemente.io:1337")
+				Expect(ok).To(BeFalse())
+				Expect(err).To(MatchError("http3: probing quic.clemente.io:1337 failed: handshake error"))
+				Expect(errors.Is(err, testErr)).To(BeTrue())
+			})
+
+			It("returns when the context is canceled before the handshake completes", func() {
+				dialed := make(chan struct{})
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.EarlySession, error) {
+					defer close(dialed)
+					return newMockSession(context.Background()), nil
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(25*time.Millisecond))
+				defer cancel()
+				ok, err := rt.ProbeH3(ctx, "quic.clemente.io")
+				Expect(ok).To(BeFalse())
+				Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+				// the connection isn't cached, so waitForDials can't wait for it
+				Eventually(dialed).Should(BeClosed())
+			})
+		})
+	})
+
+	Context("reporting the negotiated version", func() {
+		It("reports the version of a connection that completed the handshake", func() {
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			sess.EXPECT().ConnectionState().Return(quic.ConnectionState{Version: quic.VersionDraft29})
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": &client{session: sess}}
+			v, ok := rt.NegotiatedVersion("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(v).To(Equal(quic.VersionDraft29))
+		})
+
+		It("doesn't report a version while the handshake is running", func() {
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			sess.EXPECT().HandshakeComplete().Return(context.Background())
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": &client{session: sess}}
+			_, ok := rt.NegotiatedVersion("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("doesn't report a version for unknown hosts", func() {
+			_, ok := rt.NegotiatedVersion("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("closing connections", func() {
+		newSession := func() *mockquic.MockEarlySession {
+			return mockquic.NewMockEarlySession(mockCtrl)
+		}
+
+		It("closes only the connections to a given host", func() {
+			sess1 := newSession()
+			sess2 := newSession()
+			sess3 := newSession()
+			sess1.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+			sess2.EXPECT().CloseWithError(quic.ApplicationErrorCode(errorNoError), "")
+			cl3 := &client{hostname: "example.com:443", session: sess3}
+			rt.clients = map[string]roundTripCloser{
+				"quic.clemente.io:443":              &client{hostname: "quic.clemente.io:443", session: sess1},
+				"quic.clemente.io:443#affinity=foo": &client{hostname: "quic.clemente.io:443", session: sess2},
+				"example.com:443":                   cl3,
+			}
+			n := rt.CloseConnections(func(host string, _ ConnStats) bool { return host == "quic.clemente.io:443" })
+			Expect(n).To(Equal(2))
+			Expect(rt.clients).To(Equal(map[string]roundTripCloser{"example.com:443": cl3}))
+		})
+
+		It("passes the connection's statistics to the predicate", func() {
+			idle := &client{hostname: "idle.example.com:443", session: newSession()}
+			atomic.StoreInt64(&idle.idleSince, time.Now().Add(-time.Hour).UnixNano())
+			busy := &client{hostname: "busy.example.com:443", session: newSession()}
+			atomic.StoreInt64(&busy.inFlight, 2)
+			rt.clients = map[string]roundTripCloser{
+				"idle.example.com:443": idle,
+				"busy.example.com:443": busy,
+			}
+			stats := make(map[string]ConnStats)
+			n := rt.CloseConnections(func(host string, s ConnStats) bool {
+				stats[host] = s
+				return false
+			})
+			Expect(n).To(BeZero())
+			Expect(rt.clients).To(HaveLen(2))
+			Expect(stats["idle.example.com:443"].RequestsInFlight).To(BeZero())
+			Expect(stats["idle.example.com:443"].IdleFor).To(BeNumerically("~", time.Hour, time.Minute))
+			Expect(stats["busy.example.com:443"].RequestsInFlight).To(Equal(2))
+			Expect(stats["busy.example.com:443"].IdleFor).To(BeZero())
+		})
+
+		It("closes idle connections", func() {
+			idleSess := newSession()
+			idleSess.EXPECT().CloseWithError(gomock.Any(), gomock.Any())
+			busy := &client{hostname: "busy.example.com:443", session: newSession()}
+			atomic.StoreInt64(&busy.inFlight, 1)
+			rt.clients = map[string]roundTripCloser{
+				"idle.example.com:443": &client{hostname: "idle.example.com:443", session: idleSess},
+				"busy.example.com:443": busy,
+			}
+			(&http.Client{Transport: rt}).CloseIdleConnections()
+			Expect(rt.clients).To(Equal(map[string]roundTripCloser{"busy.example.com:443": busy}))
+		})
+	})
+
+	Context("reporting the negotiated TLS parameters", func() {
+		It("reports the cipher suite and the key exchange group", func() {
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			sess.EXPECT().HandshakeComplete().Return(handshakeCtx)
+			var cs quic.ConnectionState
+			cs.TLS.CipherSuite = tls.TLS_CHACHA20_POLY1305_SHA256
+			cs.KeyExchangeGroup = tls.X25519
+			sess.EXPECT().ConnectionState().Return(cs)
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": &client{session: sess}}
+			params, ok := rt.NegotiatedTLSParameters("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(params).To(Equal(TLSParameters{
+				CipherSuite:      tls.TLS_CHACHA20_POLY1305_SHA256,
+				KeyExchangeGroup: tls.X25519,
+			}))
+		})
+
+		It("doesn't report parameters while the handshake is running", func() {
+			sess := mockquic.NewMockEarlySession(mockCtrl)
+			sess.EXPECT().HandshakeComplete().Return(context.Background())
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": &client{session: sess}}
+			_, ok := rt.NegotiatedTLSParameters("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("doesn't report parameters for unknown hosts", func() {
+			_, ok := rt.NegotiatedTLSParameters("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("reporting the server's settings", func() {
+		It("reports the settings of a connection", func() {
+			cl := &client{settings: &Settings{MaxFieldSectionSize: 1337}}
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": cl}
+			settings, ok := rt.ServerSettings("quic.clemente.io")
+			Expect(ok).To(BeTrue())
+			Expect(settings.MaxFieldSectionSize).To(BeEquivalentTo(1337))
+		})
+
+		It("doesn't report settings before the SETTINGS frame was received", func() {
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": &client{}}
+			_, ok := rt.ServerSettings("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("doesn't report settings for unknown hosts", func() {
+			_, ok := rt.ServerSettings("quic.clemente.io")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("validating request", func() {
+		It("rejects plain HTTP requests", func() {
+			req, err := http.NewRequest("GET", "http://www.example.org/", nil)
+			req.Body = &mockBody{}
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("http3: unsupported protocol scheme: http"))
+			Expect(req.Body.(*mockBody).closed).To(BeTrue())
+		})
+
+		It("suggests setting SkipSchemeCheck for tunneling schemes", func() {
+			req, err := http.NewRequest("GET", "masque://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("http3: unsupported protocol scheme: masque (set RoundTripOpt.SkipSchemeCheck to use it)"))
+			req, err = http.NewRequest("GET", "connect-udp://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("http3: unsupported protocol scheme: connect-udp (set RoundTripOpt.SkipSchemeCheck to use it)"))
+			// other schemes are not tunneled
+			req, err = http.NewRequest("GET", "ftp://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("http3: unsupported protocol scheme: ftp"))
+		})
+
+		It("rejects redirects to plain HTTP URLs", func() {
+			req, err := http.NewRequest("GET", "http://www.example.org/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Response = &http.Response{StatusCode: http.StatusFound}
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("http3: can't follow redirect to http://www.example.org/: only https URLs are supported (see CheckRedirect)"))
 		})
 
 		It("allow non-https schemes if SkipSchemeCheck is set", func() {
 			req, err := http.NewRequest("GET", "masque://www.example.org/", nil)
 			Expect(err).ToNot(HaveOccurred())
 			_, err = rt.RoundTrip(req)
-			Expect(err).To(MatchError("http3: unsupported protocol scheme: masque"))
+			Expect(err).To(MatchError("http3: unsupported protocol scheme: masque (set RoundTripOpt.SkipSchemeCheck to use it)"))
 			_, err = rt.RoundTripOpt(req, RoundTripOpt{SkipSchemeCheck: true, OnlyCachedConn: true})
 			Expect(err).To(MatchError("http3: no cached connection was available"))
 		})
@@ -245,6 +245,12 @@ func (s *Server) handleConn(sess quic.EarlySession) {
 
 	go s.handleUnidirectionalStreams(sess)
 
+	var datagramMux *DatagramMux
+	if s.EnableDatagrams {
+		datagramMux = newDatagramMux(sess)
+		go datagramMux.run()
+	}
+
 	// Process all requests immediately.
 	// It's the client's responsibility to decide which requests are eligible for 0-RTT.
 	for {
@@ -254,7 +260,7 @@ func (s *Server) handleConn(sess quic.EarlySession) {
 			return
 		}
 		go func() {
-			rerr := s.handleRequest(sess, str, decoder, func() {
+			rerr := s.handleRequest(sess, str, decoder, datagramMux, func() {
 				sess.CloseWithError(quic.ApplicationErrorCode(errorFrameUnexpected), "")
 			})
 			if rerr.err != nil || rerr.streamErr != 0 || rerr.connErr != 0 {
@@ -334,7 +340,7 @@ func (s *Server) maxHeaderBytes() uint64 {
 	return uint64(s.Server.MaxHeaderBytes)
 }
 
-func (s *Server) handleRequest(sess quic.Session, str quic.Stream, decoder *qpack.Decoder, onFrameError func()) requestError {
+func (s *Server) handleRequest(sess quic.Session, str quic.Stream, decoder *qpack.Decoder, datagramMux *DatagramMux, onFrameError func()) requestError {
 	frame, err := parseNextFrame(str)
 	if err != nil {
 		return newStreamError(errorRequestIncomplete, err)
@@ -397,7 +403,11 @@ func (s *Server) handleRequest(sess quic.Session, str quic.Stream, decoder *qpac
 				panicked = true
 			}
 		}()
-		handler.ServeHTTP(r, req)
+		var w http.ResponseWriter = r
+		if datagramMux != nil {
+			w = &datagramResponseWriter{responseWriter: r, mux: datagramMux, sess: sess}
+		}
+		handler.ServeHTTP(w, req)
 	}()
 
 	if !r.usedDataStream() {
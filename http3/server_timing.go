@@ -0,0 +1,81 @@
+package http3
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// A ServerTiming is a metric of the Server-Timing response header, see https://www.w3.org/TR/server-timing/.
+type ServerTiming struct {
+	Name string
+	// Duration is the value of the dur parameter. It is zero if the metric doesn't include a duration.
+	Duration time.Duration
+	// Description is the value of the desc parameter.
+	Description string
+}
+
+// parseServerTiming parses the values of the Server-Timing header.
+// Invalid metrics are skipped, as are unknown parameters.
+// If a parameter is repeated, the first occurrence is used.
+func parseServerTiming(values []string) []ServerTiming {
+	var timings []ServerTiming
+	for _, v := range values {
+		for _, metric := range splitOutsideQuotes(v, ',') {
+			params := splitOutsideQuotes(metric, ';')
+			name := strings.TrimSpace(params[0])
+			if !httpguts.ValidHeaderFieldName(name) {
+				continue
+			}
+			t := ServerTiming{Name: name}
+			var seenDur, seenDesc bool
+			for _, p := range params[1:] {
+				i := strings.IndexByte(p, '=')
+				if i < 0 {
+					continue
+				}
+				key, value := p[:i], strings.TrimSpace(p[i+1:])
+				if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+					value = unquoteHeaderValue(value[1 : len(value)-1])
+				}
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "dur":
+					if seenDur {
+						continue
+					}
+					seenDur = true
+					ms, err := strconv.ParseFloat(value, 64)
+					if err != nil {
+						continue
+					}
+					t.Duration = time.Duration(ms * float64(time.Millisecond))
+				case "desc":
+					if seenDesc {
+						continue
+					}
+					seenDesc = true
+					t.Description = value
+				}
+			}
+			timings = append(timings, t)
+		}
+	}
+	return timings
+}
+
+// unquoteHeaderValue removes the escaping backslashes of the quoted pairs of a quoted string.
+func unquoteHeaderValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package http3
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server-Timing", func() {
+	It("parses metrics", func() {
+		Expect(parseServerTiming([]string{`cache;desc="Cache Read";dur=23.2, db;dur=53`, "miss"})).To(Equal([]ServerTiming{
+			{Name: "cache", Description: "Cache Read", Duration: 23200 * time.Microsecond},
+			{Name: "db", Duration: 53 * time.Millisecond},
+			{Name: "miss"},
+		}))
+	})
+
+	It("parses descriptions that contain separators", func() {
+		Expect(parseServerTiming([]string{`app; desc="a, b; \"c\""; dur = 1`})).To(Equal([]ServerTiming{
+			{Name: "app", Description: `a, b; "c"`, Duration: time.Millisecond},
+		}))
+	})
+
+	It("parses unquoted descriptions", func() {
+		Expect(parseServerTiming([]string{"total;desc=origin"})).To(Equal([]ServerTiming{{Name: "total", Description: "origin"}}))
+	})
+
+	It("uses the first occurrence of a parameter", func() {
+		Expect(parseServerTiming([]string{"db;dur=1;dur=2;desc=a;desc=b"})).To(Equal([]ServerTiming{
+			{Name: "db", Duration: time.Millisecond, Description: "a"},
+		}))
+	})
+
+	It("ignores unknown and invalid parameters", func() {
+		Expect(parseServerTiming([]string{"db;foo=bar;dur=fast;desc"})).To(Equal([]ServerTiming{{Name: "db"}}))
+	})
+
+	It("skips invalid metrics", func() {
+		Expect(parseServerTiming([]string{`, "db";dur=1, cpu;dur=2`})).To(Equal([]ServerTiming{{Name: "cpu", Duration: 2 * time.Millisecond}}))
+		Expect(parseServerTiming(nil)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,139 @@
+package http3
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/lucas-clemente/quic-go/internal/qtls"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A SessionTicketStore persists the session tickets issued by servers,
+// such that sessions can be resumed (and 0-RTT can be used) after the process restarted.
+// The key is the server name the ticket was issued for.
+// Session tickets contain the secrets needed to resume the session,
+// so they need to be stored as carefully as private keys.
+// A SessionTicketStore must be safe for concurrent use.
+type SessionTicketStore interface {
+	// Load returns the ticket stored for the key, or nil if no ticket is stored.
+	Load(key string) ([]byte, error)
+	// Store stores the ticket for the key, replacing any ticket stored before.
+	Store(key string, ticket []byte) error
+	// Delete deletes the ticket stored for the key.
+	Delete(key string) error
+}
+
+type persistentSessionCache struct {
+	store  SessionTicketStore
+	logger utils.Logger
+}
+
+var _ tls.ClientSessionCache = &persistentSessionCache{}
+
+// NewPersistentSessionCache returns a tls.ClientSessionCache that saves the session tickets to the store.
+// Errors returned by the store are logged, and the session ticket is ignored.
+func NewPersistentSessionCache(store SessionTicketStore) tls.ClientSessionCache {
+	return &persistentSessionCache{
+		store:  store,
+		logger: utils.DefaultLogger.WithPrefix("h3 session cache"),
+	}
+}
+
+func (c *persistentSessionCache) Get(key string) (*tls.ClientSessionState, bool) {
+	data, err := c.store.Load(key)
+	if err != nil {
+		c.logger.Debugf("Loading the session ticket for %s failed: %s", key, err)
+		return nil, false
+	}
+	if data == nil {
+		return nil, false
+	}
+	state, err := qtls.UnmarshalClientSessionState(data)
+	if err != nil {
+		c.logger.Debugf("Parsing the session ticket for %s failed: %s", key, err)
+		if err := c.store.Delete(key); err != nil {
+			c.logger.Debugf("Deleting the session ticket for %s failed: %s", key, err)
+		}
+		return nil, false
+	}
+	return state, true
+}
+
+func (c *persistentSessionCache) Put(key string, state *tls.ClientSessionState) {
+	if state == nil {
+		if err := c.store.Delete(key); err != nil {
+			c.logger.Debugf("Deleting the session ticket for %s failed: %s", key, err)
+		}
+		return
+	}
+	data, err := qtls.MarshalClientSessionState(state)
+	if err != nil {
+		c.logger.Debugf("Serializing the session ticket for %s failed: %s", key, err)
+		return
+	}
+	if err := c.store.Store(key, data); err != nil {
+		c.logger.Debugf("Storing the session ticket for %s failed: %s", key, err)
+	}
+}
+
+type fileSessionTicketStore struct {
+	dir string
+}
+
+var _ SessionTicketStore = &fileSessionTicketStore{}
+
+// NewFileSessionTicketStore returns a SessionTicketStore that stores every ticket in a separate file in dir.
+// The directory is created if it doesn't exist yet.
+func NewFileSessionTicketStore(dir string) (SessionTicketStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileSessionTicketStore{dir: dir}, nil
+}
+
+// filename returns the name of the file for the key.
+// The key is hashed, since it might contain characters that can't be used in file names.
+func (s *fileSessionTicketStore) filename(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(h[:]))
+}
+
+func (s *fileSessionTicketStore) Load(key string) ([]byte, error) {
+	data, err := os.ReadFile(s.filename(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *fileSessionTicketStore) Store(key string, ticket []byte) error {
+	// Write to a temporary file first, so that a concurrent Load never reads a partially written ticket.
+	f, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(ticket); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), s.filename(key)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+func (s *fileSessionTicketStore) Delete(key string) error {
+	if err := os.Remove(s.filename(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type memorySessionTicketStore struct {
+	mutex   sync.Mutex
+	tickets map[string][]byte
+	err     error
+}
+
+func (s *memorySessionTicketStore) Load(key string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tickets[key], s.err
+}
+
+func (s *memorySessionTicketStore) Store(key string, ticket []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.tickets[key] = ticket
+	return nil
+}
+
+func (s *memorySessionTicketStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.tickets, key)
+	return s.err
+}
+
+var _ = Describe("Session Ticket Store", func() {
+	Context("file store", func() {
+		var (
+			tmpDir, dir string
+			store       SessionTicketStore
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "session-tickets")
+			Expect(err).ToNot(HaveOccurred())
+			dir = filepath.Join(tmpDir, "tickets")
+			store, err = NewFileSessionTicketStore(dir)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("creates the directory", func() {
+			fi, err := os.Stat(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.IsDir()).To(BeTrue())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0o700)))
+		})
+
+		It("returns nil if no ticket is stored", func() {
+			ticket, err := store.Load("localhost")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ticket).To(BeNil())
+		})
+
+		It("stores and loads tickets", func() {
+			Expect(store.Store("localhost", []byte("foo"))).To(Succeed())
+			Expect(store.Store("quic.clemente.io", []byte("bar"))).To(Succeed())
+			Expect(store.Load("localhost")).To(Equal([]byte("foo")))
+			Expect(store.Load("quic.clemente.io")).To(Equal([]byte("bar")))
+			// the ticket can be loaded by a new store, e.g. after a restart
+			newStore, err := NewFileSessionTicketStore(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(newStore.Load("localhost")).To(Equal([]byte("foo")))
+		})
+
+		It("replaces tickets", func() {
+			Expect(store.Store("localhost", []byte("foo"))).To(Succeed())
+			Expect(store.Store("localhost", []byte("foobar"))).To(Succeed())
+			Expect(store.Load("localhost")).To(Equal([]byte("foobar")))
+			entries, err := os.ReadDir(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			fi, err := entries[0].Info()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		})
+
+		It("handles keys that are not valid file names", func() {
+			Expect(store.Store("../foo/bar:443", []byte("foo"))).To(Succeed())
+			Expect(store.Load("../foo/bar:443")).To(Equal([]byte("foo")))
+			entries, err := os.ReadDir(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("deletes tickets", func() {
+			Expect(store.Store("localhost", []byte("foo"))).To(Succeed())
+			Expect(store.Delete("localhost")).To(Succeed())
+			Expect(store.Load("localhost")).To(BeNil())
+			// deleting a ticket that doesn't exist is not an error
+			Expect(store.Delete("localhost")).To(Succeed())
+		})
+	})
+
+	Context("persistent session cache", func() {
+		var (
+			store *memorySessionTicketStore
+			cache tls.ClientSessionCache
+		)
+
+		BeforeEach(func() {
+			store = &memorySessionTicketStore{tickets: make(map[string][]byte)}
+			cache = NewPersistentSessionCache(store)
+		})
+
+		It("stores and loads session states", func() {
+			_, ok := cache.Get("localhost")
+			Expect(ok).To(BeFalse())
+			state := &tls.ClientSessionState{}
+			cache.Put("localhost", state)
+			Expect(store.tickets).To(HaveKey("localhost"))
+			restored, ok := NewPersistentSessionCache(store).Get("localhost")
+			Expect(ok).To(BeTrue())
+			Expect(restored).ToNot(BeNil())
+		})
+
+		It("deletes session states", func() {
+			cache.Put("localhost", &tls.ClientSessionState{})
+			Expect(store.tickets).To(HaveKey("localhost"))
+			cache.Put("localhost", nil)
+			Expect(store.tickets).To(BeEmpty())
+		})
+
+		It("deletes tickets that can't be parsed", func() {
+			store.tickets["localhost"] = []byte("foobar")
+			_, ok := cache.Get("localhost")
+			Expect(ok).To(BeFalse())
+			Expect(store.tickets).To(BeEmpty())
+		})
+
+		It("ignores errors from the store", func() {
+			store.err = errors.New("test error")
+			cache.Put("localhost", &tls.ClientSessionState{})
+			Expect(store.tickets).To(BeEmpty())
+			_, ok := cache.Get("localhost")
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,52 @@
+package http3
+
+const (
+	settingQPACKMaxTableCapacity = 0x1
+	settingMaxFieldSectionSize   = 0x6
+	settingQPACKBlockedStreams   = 0x7
+	settingEnableConnectProtocol = 0x8
+	settingNoRFC7540Priorities   = 0x9
+)
+
+// Settings are the HTTP/3 settings that the server sent in its SETTINGS frame.
+type Settings struct {
+	// QPACKMaxTableCapacity is the value of SETTINGS_QPACK_MAX_TABLE_CAPACITY.
+	QPACKMaxTableCapacity uint64
+	// MaxFieldSectionSize is the value of SETTINGS_MAX_FIELD_SECTION_SIZE.
+	// It is zero if the server didn't send this setting, i.e. if the size is unlimited.
+	MaxFieldSectionSize uint64
+	// QPACKBlockedStreams is the value of SETTINGS_QPACK_BLOCKED_STREAMS.
+	QPACKBlockedStreams uint64
+	// EnableConnectProtocol is set if the server supports the extended CONNECT method (RFC 9220).
+	EnableConnectProtocol bool
+	// NoRFC7540Priorities is set if the server doesn't use the HTTP/2 prioritization scheme (RFC 9218, Section 2.1).
+	NoRFC7540Priorities bool
+	// Datagram is set if the server supports HTTP/3 datagrams.
+	Datagram bool
+	// Other contains all settings that are not listed above, keyed by their identifier.
+	Other map[uint64]uint64
+}
+
+func settingsFromFrame(f *settingsFrame) Settings {
+	s := Settings{Datagram: f.Datagram}
+	for id, val := range f.other {
+		switch id {
+		case settingQPACKMaxTableCapacity:
+			s.QPACKMaxTableCapacity = val
+		case settingMaxFieldSectionSize:
+			s.MaxFieldSectionSize = val
+		case settingQPACKBlockedStreams:
+			s.QPACKBlockedStreams = val
+		case settingEnableConnectProtocol:
+			s.EnableConnectProtocol = val == 1
+		case settingNoRFC7540Priorities:
+			s.NoRFC7540Priorities = val == 1
+		default:
+			if s.Other == nil {
+				s.Other = make(map[uint64]uint64)
+			}
+			s.Other[id] = val
+		}
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package http3
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// A throttledPacketConn limits the rate at which packets are sent, see RoundTripper.MaxSendRate.
+// Packets are paced: WriteTo blocks until sending the packet doesn't exceed the rate.
+// It doesn't drop any packets, as the sender would on a constrained link if its queue overflows.
+type throttledPacketConn struct {
+	net.PacketConn
+
+	rate int // in bytes per second
+
+	mutex sync.Mutex
+	// the earliest time the next packet may be sent
+	next time.Time
+}
+
+var _ net.PacketConn = &throttledPacketConn{}
+
+func newThrottledPacketConn(conn net.PacketConn, rate int) net.PacketConn {
+	return &throttledPacketConn{PacketConn: conn, rate: rate}
+}
+
+func (c *throttledPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mutex.Lock()
+	now := time.Now()
+	if c.next.Before(now) {
+		c.next = now
+	}
+	sendTime := c.next
+	c.next = c.next.Add(time.Duration(len(p)) * time.Second / time.Duration(c.rate))
+	c.mutex.Unlock()
+
+	if d := time.Until(sendTime); d > 0 {
+		time.Sleep(d)
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
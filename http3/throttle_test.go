@@ -0,0 +1,66 @@
+package http3
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordingPacketConn struct {
+	net.PacketConn
+
+	mutex   sync.Mutex
+	written int
+}
+
+func (c *recordingPacketConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.written += len(p)
+	return len(p), nil
+}
+
+var _ = Describe("Throttling", func() {
+	It("limits the send rate", func() {
+		const (
+			rate       = 1 << 20 // 1 MB/s
+			packetSize = 1200
+			numPackets = 100
+		)
+		conn := &recordingPacketConn{}
+		throttled := newThrottledPacketConn(conn, rate)
+		start := time.Now()
+		for i := 0; i < numPackets; i++ {
+			_, err := throttled.WriteTo(make([]byte, packetSize), nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		elapsed := time.Since(start)
+		Expect(conn.written).To(Equal(numPackets * packetSize))
+		// The first packet is sent right away.
+		// Every following packet has to wait until the previous one was sent at the configured rate.
+		effectiveRate := float64(conn.written-packetSize) / elapsed.Seconds()
+		Expect(effectiveRate).To(BeNumerically("<=", rate))
+		// make sure that the rate is not limited too much
+		Expect(elapsed).To(BeNumerically("<", scaleDuration(2*time.Duration(numPackets*packetSize)*time.Second/rate)))
+	})
+
+	It("doesn't delay packets if the connection was idle", func() {
+		conn := &recordingPacketConn{}
+		throttled := newThrottledPacketConn(conn, 1000)
+		_, err := throttled.WriteTo(make([]byte, 100), nil)
+		Expect(err).ToNot(HaveOccurred())
+		time.Sleep(150 * time.Millisecond) // enough time to send 150 bytes
+		start := time.Now()
+		_, err = throttled.WriteTo(make([]byte, 100), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", scaleDuration(20*time.Millisecond)))
+		// the next packet has to wait for the previous one
+		start = time.Now()
+		_, err = throttled.WriteTo(make([]byte, 100), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 90*time.Millisecond))
+	})
+})
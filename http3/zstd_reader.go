@@ -0,0 +1,41 @@
+package http3
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdReader wraps a response body so it can lazily
+// call zstd.NewReader on the first call to Read
+type zstdReader struct {
+	body io.ReadCloser // underlying Response.Body
+	zr   *zstd.Decoder // lazily-initialized zstd decoder
+	zerr error         // sticky error
+}
+
+func newZstdReader(body io.ReadCloser) io.ReadCloser {
+	return &zstdReader{body: body}
+}
+
+func (zs *zstdReader) Read(p []byte) (n int, err error) {
+	if zs.zerr != nil {
+		return 0, zs.zerr
+	}
+	if zs.zr == nil {
+		// Decode synchronously, so that no goroutines are leaked if the body is not read until EOF.
+		zs.zr, err = zstd.NewReader(zs.body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			zs.zerr = err
+			return 0, err
+		}
+	}
+	return zs.zr.Read(p)
+}
+
+func (zs *zstdReader) Close() error {
+	if zs.zr != nil {
+		zs.zr.Close()
+	}
+	return zs.body.Close()
+}
@@ -0,0 +1,103 @@
+package self_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	quicproxy "github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// firstFlightConn is a net.PacketConn that counts the bytes sent during the first round trip after start.
+type firstFlightConn struct {
+	net.PacketConn
+
+	mutex  sync.Mutex
+	start  time.Time
+	window time.Duration
+	bytes  int
+}
+
+func (c *firstFlightConn) startCounting(window time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.start = time.Now()
+	c.window = window
+}
+
+func (c *firstFlightConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.mutex.Lock()
+	if !c.start.IsZero() && time.Since(c.start) < c.window {
+		c.bytes += len(p)
+	}
+	c.mutex.Unlock()
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func (c *firstFlightConn) firstFlightBytes() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.bytes
+}
+
+var _ = Describe("Initial Congestion Window", func() {
+	const rtt = 100 * time.Millisecond
+
+	// measureFirstFlight uploads data, and returns the number of bytes that the client sends
+	// during the first round trip after the handshake completed.
+	measureFirstFlight := func(initialCongestionWindow uint32) int {
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			io.Copy(io.Discard, str)
+		}()
+
+		proxy, err := quicproxy.NewQuicProxy("localhost:0", &quicproxy.Opts{
+			RemoteAddr:  fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			DelayPacket: func(quicproxy.Direction, []byte) time.Duration { return rtt / 2 },
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer proxy.Close()
+
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer udpConn.Close()
+		conn := &firstFlightConn{PacketConn: udpConn}
+		sess, err := quic.Dial(
+			conn,
+			proxy.LocalAddr(),
+			"localhost",
+			getTLSClientConfig(),
+			getQuicConfig(&quic.Config{InitialCongestionWindow: initialCongestionWindow}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.CloseWithError(0, "")
+		// The server's ACKs for data sent after the handshake arrive one RTT later, at the earliest.
+		conn.startCounting(rtt)
+		str, err := sess.OpenStream()
+		Expect(err).ToNot(HaveOccurred())
+		go str.Write(make([]byte, 1<<20))
+		time.Sleep(rtt)
+		return conn.firstFlightBytes()
+	}
+
+	It("sends more data in the first RTT with a larger initial congestion window", func() {
+		defaultWindow := measureFirstFlight(0)
+		largeWindow := measureFirstFlight(128)
+		fmt.Fprintf(GinkgoWriter, "First flight: %d bytes with the default initial window, %d bytes with 128 packets\n", defaultWindow, largeWindow)
+		Expect(largeWindow).To(BeNumerically(">", 2*defaultWindow))
+	})
+})
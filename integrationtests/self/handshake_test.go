@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"time"
 
 	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
 	"github.com/lucas-clemente/quic-go/integrationtests/tools/israce"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/logging"
@@ -71,6 +73,15 @@ func (t *versionNegotiationTracer) ReceivedVersionNegotiationPacket(*logging.Hea
 	t.receivedVersionNegotiation = true
 }
 
+type transportParameterTracer struct {
+	connTracer
+	received chan *logging.TransportParameters
+}
+
+func (t *transportParameterTracer) ReceivedTransportParameters(tp *logging.TransportParameters) {
+	t.received <- tp
+}
+
 var _ = Describe("Handshake tests", func() {
 	var (
 		server        quic.Listener
@@ -181,6 +192,40 @@ var _ = Describe("Handshake tests", func() {
 		})
 	}
 
+	Context("Version Negotiation for HTTP/3", func() {
+		It("uses the H3 ALPN for the version the server supports", func() {
+			h3Server := &http3.Server{
+				Server:     &http.Server{TLSConfig: getTLSConfig()},
+				QuicConfig: getQuicConfig(&quic.Config{Versions: []protocol.VersionNumber{protocol.VersionDraft29}}),
+			}
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				h3Server.Serve(conn)
+			}()
+			defer func() {
+				Expect(h3Server.Close()).To(Succeed())
+				Eventually(done).Should(BeClosed())
+			}()
+
+			tlsConf := getTLSClientConfig()
+			tlsConf.NextProtos = []string{"h3", "h3-29"}
+			sess, err := quic.DialAddrEarly(
+				fmt.Sprintf("localhost:%d", conn.LocalAddr().(*net.UDPAddr).Port),
+				tlsConf,
+				getQuicConfig(&quic.Config{Versions: []protocol.VersionNumber{protocol.Version1, protocol.VersionDraft29}}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			defer sess.CloseWithError(0, "")
+			Eventually(sess.HandshakeComplete().Done()).Should(BeClosed())
+			Expect(sess.ConnectionState().Version).To(Equal(protocol.VersionDraft29))
+			Expect(sess.ConnectionState().TLS.NegotiatedProtocol).To(Equal("h3-29"))
+		})
+	})
+
 	Context("using different cipher suites", func() {
 		for n, id := range map[string]uint16{
 			"TLS_AES_128_GCM_SHA256":       tls.TLS_AES_128_GCM_SHA256,
@@ -476,6 +521,27 @@ var _ = Describe("Handshake tests", func() {
 		})
 	})
 
+	Context("additional transport parameters", func() {
+		It("sends additional transport parameters", func() {
+			received := make(chan *logging.TransportParameters, 1)
+			serverConfig.Tracer = newTracer(func() logging.ConnectionTracer {
+				return &transportParameterTracer{received: received}
+			})
+			runServer(getTLSConfig())
+
+			sess, err := quic.DialAddr(
+				fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+				getTLSClientConfig(),
+				getQuicConfig(&quic.Config{AdditionalTransportParameters: map[uint64][]byte{0x1337: []byte("foobar")}}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			defer sess.CloseWithError(0, "")
+			var tp *logging.TransportParameters
+			Eventually(received).Should(Receive(&tp))
+			Expect(tp.AdditionalParameters).To(HaveKeyWithValue(uint64(0x1337), []byte("foobar")))
+		})
+	})
+
 	Context("using tokens", func() {
 		It("uses tokens provided in NEW_TOKEN frames", func() {
 			tokenChan := make(chan *quic.Token, 100)
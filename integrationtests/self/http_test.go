@@ -6,24 +6,59 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
+	"os"
+	"runtime"
+	"sort"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/ebi-yade/altsvc-go"
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/http3"
+	quicproxy "github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/logging"
+
+	"golang.org/x/crypto/ocsp"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 )
 
+// maxSizePacketConn records the size of the largest packet sent.
+type maxSizePacketConn struct {
+	net.PacketConn
+	maxSize int64 // accessed atomically
+}
+
+func (c *maxSizePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	for {
+		max := atomic.LoadInt64(&c.maxSize)
+		if int64(len(p)) <= max || atomic.CompareAndSwapInt64(&c.maxSize, max, int64(len(p))) {
+			break
+		}
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// lifoScheduler is a quic.StreamScheduler that serves the most recently opened stream first.
+type lifoScheduler struct{}
+
+func (lifoScheduler) Schedule(streams []quic.StreamID) {
+	sort.Slice(streams, func(i, j int) bool { return streams[i] > streams[j] })
+}
+
 var _ = Describe("HTTP tests", func() {
 	var (
 		mux            *http.ServeMux
@@ -224,6 +259,564 @@ var _ = Describe("HTTP tests", func() {
 				Expect(body).To(Equal(PRData))
 			})
 
+			It("recovers when the path broke", func() {
+				var pathBroken int32
+				proxy, err := quicproxy.NewQuicProxy("localhost:0", &quicproxy.Opts{
+					RemoteAddr: "localhost:" + port,
+					DropPacket: func(quicproxy.Direction, []byte) bool { return atomic.LoadInt32(&pathBroken) == 1 },
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer proxy.Close()
+
+				var dialCount int32
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.PathFailureTimeout = scaleDuration(100 * time.Millisecond)
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				rt.Dial = func(network, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlySession, error) {
+					// The first connection goes through the proxy.
+					// The next connection reaches the server directly, as if the client had switched networks.
+					if atomic.AddInt32(&dialCount, 1) == 1 {
+						addr = proxy.LocalAddr().String()
+						tlsConf = tlsConf.Clone()
+						tlsConf.ServerName = "localhost"
+					}
+					return quic.DialAddrEarly(addr, tlsConf, conf)
+				}
+				resp, err := client.Get("https://localhost:" + port + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+
+				atomic.StoreInt32(&pathBroken, 1)
+				resp, err = client.Get("https://localhost:" + port + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+				Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(2))
+			})
+
+			It("redials after the server lost the connection state", func() {
+				statelessResetKey := make([]byte, 32)
+				rand.Read(statelessResetKey)
+				// serve starts a server that sends stateless resets for unknown connections
+				serve := func(conn net.PacketConn) (*http3.Server, <-chan struct{}) {
+					s := &http3.Server{
+						Server: &http.Server{Handler: mux, TLSConfig: testdata.GetTLSConfig()},
+						QuicConfig: getQuicConfig(&quic.Config{
+							Versions:          []quic.VersionNumber{version},
+							StatelessResetKey: statelessResetKey,
+						}),
+					}
+					done := make(chan struct{})
+					go func() {
+						defer GinkgoRecover()
+						defer close(done)
+						s.Serve(conn)
+					}()
+					return s, done
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				resetServer, resetServerDone := serve(conn)
+				serverAddr := conn.LocalAddr().(*net.UDPAddr)
+
+				var drop int32
+				proxy, err := quicproxy.NewQuicProxy("localhost:0", &quicproxy.Opts{
+					RemoteAddr: serverAddr.String(),
+					DropPacket: func(quicproxy.Direction, []byte) bool { return atomic.LoadInt32(&drop) == 1 },
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer proxy.Close()
+				proxyPort := strconv.Itoa(proxy.LocalPort())
+
+				var dialCount int32
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.MaxRetries = -1 // make the stateless reset visible to the client
+				rt.SetAltServices("localhost:"+proxyPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: proxyPort}, MaxAge: 3600}})
+				rt.Dial = func(network, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlySession, error) {
+					atomic.AddInt32(&dialCount, 1)
+					return quic.DialAddrEarly(addr, tlsConf, conf)
+				}
+				resp, err := client.Get("https://localhost:" + proxyPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+
+				// Restart the server, making sure that the client doesn't receive the CONNECTION_CLOSE.
+				atomic.StoreInt32(&drop, 1)
+				Expect(resetServer.Close()).To(Succeed())
+				Eventually(resetServerDone).Should(BeClosed())
+				Expect(conn.Close()).To(Succeed())
+				time.Sleep(scaleDuration(50 * time.Millisecond))
+				conn, err = net.ListenUDP("udp", serverAddr)
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				resetServer, resetServerDone = serve(conn)
+				defer func() {
+					Expect(resetServer.Close()).To(Succeed())
+					Eventually(resetServerDone).Should(BeClosed())
+				}()
+				atomic.StoreInt32(&drop, 0)
+
+				_, err = client.Get("https://localhost:" + proxyPort + "/hello")
+				Expect(err).To(HaveOccurred())
+				var resetErr *quic.StatelessResetError
+				Expect(errors.As(err, &resetErr)).To(BeTrue())
+				Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(1))
+
+				resp, err = client.Get("https://localhost:" + proxyPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+				Expect(atomic.LoadInt32(&dialCount)).To(BeEquivalentTo(2))
+			})
+
+			for _, d := range []bool{false, true} {
+				disable := d
+				name := "sends MTU probe packets"
+				if disable {
+					name = "doesn't send MTU probe packets if Path MTU Discovery is disabled"
+				}
+
+				It(name, func() {
+					if runtime.GOOS == "windows" {
+						Skip("Path MTU Discovery is disabled on Windows")
+					}
+					conn := &maxSizePacketConn{}
+					rt := client.Transport.(*http3.RoundTripper)
+					rt.DisablePathMTUDiscovery = disable
+					rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+					rt.Dial = func(network, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlySession, error) {
+						Expect(conf.DisablePathMTUDiscovery).To(Equal(disable))
+						udpAddr, err := net.ResolveUDPAddr("udp", addr)
+						Expect(err).ToNot(HaveOccurred())
+						udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+						Expect(err).ToNot(HaveOccurred())
+						conn.PacketConn = udpConn
+						return quic.DialEarly(conn, udpAddr, "localhost", tlsConf, conf)
+					}
+					resp, err := client.Get("https://localhost:" + port + "/hello")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(200))
+					Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+					// Probe packets are larger than any other packet sent on the connection.
+					if disable {
+						Consistently(func() int64 { return atomic.LoadInt64(&conn.maxSize) }, scaleDuration(200*time.Millisecond)).Should(BeNumerically("<=", protocol.InitialPacketSizeIPv4))
+					} else {
+						Eventually(func() int64 { return atomic.LoadInt64(&conn.maxSize) }).Should(BeNumerically(">", protocol.InitialPacketSizeIPv4))
+					}
+				})
+			}
+
+			It("overrides InsecureSkipVerify for a single request", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.TLSClientConfig = &tls.Config{} // the server's certificate is not trusted
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				req, err := http.NewRequest(http.MethodGet, "https://localhost:"+port+"/hello", nil)
+				Expect(err).ToNot(HaveOccurred())
+				insecure := true
+				resp, err := rt.RoundTripOpt(req, http3.RoundTripOpt{InsecureSkipVerify: &insecure})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+				// other requests still verify the certificate
+				_, err = rt.RoundTrip(req)
+				Expect(err).To(MatchError(ContainSubstring("x509")))
+			})
+
+			It("exposes the unverified certificate chain presented by the server", func() {
+				tlsConf := getTLSConfigWithLongCertChain()
+				chainServer := &http3.Server{
+					Server:     &http.Server{Handler: mux, TLSConfig: tlsConf},
+					QuicConfig: getQuicConfig(&quic.Config{Versions: []quic.VersionNumber{version}}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					chainServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(chainServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				chainPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+				rt.SetAltServices("localhost:"+chainPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: chainPort}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + chainPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.ProtoMajor).To(Equal(3))
+				Expect(resp.TLS).ToNot(BeNil())
+				Expect(resp.TLS.VerifiedChains).To(BeEmpty())
+				// the leaf certificate, followed by all intermediates
+				chain := tlsConf.Certificates[0].Certificate
+				Expect(len(chain)).To(BeNumerically(">", 2))
+				Expect(resp.TLS.PeerCertificates).To(HaveLen(len(chain)))
+				for i, cert := range resp.TLS.PeerCertificates {
+					Expect(cert.Raw).To(Equal(chain[i]))
+				}
+			})
+
+			It("presents the client certificate selected by GetClientCertificate", func() {
+				clientCert := testdata.GetTLSConfig().Certificates[0]
+				tlsConf := testdata.GetTLSConfig()
+				tlsConf.ClientAuth = tls.RequireAnyClientCert
+				tlsConf.ClientCAs = testdata.GetRootCA()
+				presentedCerts := make(chan [][]byte, 1)
+				tlsConf.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+					presentedCerts <- rawCerts
+					return nil
+				}
+				mtlsServer := &http3.Server{
+					Server: &http.Server{
+						Handler:   mux,
+						TLSConfig: tlsConf,
+					},
+					QuicConfig: getQuicConfig(&quic.Config{Versions: versions}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					mtlsServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(mtlsServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				mtlsPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				infoChan := make(chan *tls.CertificateRequestInfo, 1)
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.TLSClientConfig.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					infoChan <- info
+					return &clientCert, nil
+				}
+				rt.SetAltServices("localhost:"+mtlsPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: mtlsPort}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + mtlsPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+				Expect(presentedCerts).To(Receive(Equal(clientCert.Certificate)))
+
+				var info *tls.CertificateRequestInfo
+				Expect(infoChan).To(Receive(&info))
+				Expect(info.Version).To(BeEquivalentTo(tls.VersionTLS13))
+				Expect(info.SignatureSchemes).ToNot(BeEmpty())
+				Expect(info.AcceptableCAs).To(Equal(testdata.GetRootCA().Subjects())) //nolint:staticcheck // the pool isn't from the system
+			})
+
+			It("populates the stapled OCSP response", func() {
+				ca, caKey, err := generateCA()
+				Expect(err).ToNot(HaveOccurred())
+				leaf, leafKey, err := generateLeafCert(ca, caKey)
+				Expect(err).ToNot(HaveOccurred())
+				ocspStatus := ocsp.Good
+				ocspServer := &http3.Server{
+					Server: &http.Server{
+						Handler: mux,
+						TLSConfig: &tls.Config{
+							GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+								staple, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+									Status:       ocspStatus,
+									SerialNumber: leaf.SerialNumber,
+									ThisUpdate:   time.Now().Add(-time.Minute),
+									NextUpdate:   time.Now().Add(time.Hour),
+									RevokedAt:    time.Now().Add(-time.Minute),
+								}, caKey)
+								if err != nil {
+									return nil, err
+								}
+								return &tls.Certificate{
+									Certificate: [][]byte{leaf.Raw},
+									PrivateKey:  leafKey,
+									OCSPStaple:  staple,
+								}, nil
+							},
+						},
+					},
+					QuicConfig: getQuicConfig(&quic.Config{Versions: versions}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					ocspServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(ocspServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				ocspPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				root := x509.NewCertPool()
+				root.AddCert(ca)
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.TLSClientConfig.RootCAs = root
+				rt.RequireOCSPStaple = true
+				rt.SetAltServices("localhost:"+ocspPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: ocspPort}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + ocspPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.TLS.OCSPResponse).ToNot(BeEmpty())
+				staple, err := ocsp.ParseResponse(resp.TLS.OCSPResponse, ca)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(staple.Status).To(Equal(ocsp.Good))
+				Expect(staple.SerialNumber).To(Equal(leaf.SerialNumber))
+
+				// new connections fail the handshake once the certificate is revoked
+				ocspStatus = ocsp.Revoked
+				req, err := http.NewRequest(http.MethodGet, "https://localhost:"+ocspPort+"/hello", nil)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = rt.RoundTripOpt(req, http3.RoundTripOpt{ConnectionKey: "new connection"})
+				Expect(err).To(MatchError(ContainSubstring("certificate was revoked")))
+			})
+
+			It("accepts servers presenting a pinned certificate", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.PinnedCertificates = [][]byte{testdata.GetTLSConfig().Certificates[0].Certificate[0]}
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + port + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+			})
+
+			It("fails the handshake if the server doesn't present a pinned certificate", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.PinnedCertificates = [][]byte{getTLSConfig().Certificates[0].Certificate[0]}
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				_, err := client.Get("https://localhost:" + port + "/hello")
+				Expect(err).To(HaveOccurred())
+				var transportErr *quic.TransportError
+				Expect(errors.As(err, &transportErr)).To(BeTrue())
+				Expect(transportErr.ErrorCode.IsCryptoError()).To(BeTrue())
+				Expect(transportErr.Error()).To(ContainSubstring("pinned certificates"))
+			})
+
+			It("dials the address returned by DialAddrOverride", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				// nothing is listening on this port
+				const origin = "localhost:1"
+				rt.DialAddrOverride = func(host string) (string, bool) {
+					if host != origin {
+						return "", false
+					}
+					return "127.0.0.1:" + port, true
+				}
+				rt.SetAltServices(origin, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: "1"}, MaxAge: 3600}})
+				hostChan := make(chan string, 1)
+				mux.HandleFunc("/host", func(w http.ResponseWriter, r *http.Request) {
+					hostChan <- r.Host
+				})
+				resp, err := client.Get("https://" + origin + "/host")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.TLS.ServerName).To(Equal("localhost"))
+				Expect(hostChan).To(Receive(Equal(origin)))
+			})
+
+			It("limits the send rate", func() {
+				const rate = 2 << 20 // 2 MB/s
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.MaxSendRate = rate
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				data := GeneratePRData(500 << 10)
+				start := time.Now()
+				resp, err := client.Post("https://localhost:"+port+"/echo", "text/plain", bytes.NewReader(data))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 10*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal(data))
+				elapsed := time.Since(start)
+				fmt.Fprintf(GinkgoWriter, "Uploading %d bytes took %s.\n", len(data), elapsed)
+				// The packets carry more than just the request body, so this is a lower bound.
+				Expect(float64(len(data)) / elapsed.Seconds()).To(BeNumerically("<=", rate))
+			})
+
+			It("downloads a file despite the injected packet loss", func() {
+				Expect(os.Setenv("QUIC_GO_ALLOW_PACKET_LOSS_INJECTION", "1")).To(Succeed())
+				defer os.Unsetenv("QUIC_GO_ALLOW_PACKET_LOSS_INJECTION")
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.PacketLoss = &http3.PacketLossConfig{Rate: 0.1, Period: 7, Seed: 1337}
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(10*time.Second))
+				defer cancel()
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://localhost:"+port+"/prdata", nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				body, err := io.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal(PRData))
+			})
+
+			It("limits the size of the response body", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.MaxResponseBodyBytes = 1000
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + port + "/prdata")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				Expect(err).To(MatchError(&http3.ResponseBodyTooLargeError{Limit: 1000}))
+				Expect(body).To(Equal(PRData[:1000]))
+			})
+
+			It("compresses the request body", func() {
+				type upload struct {
+					contentEncoding string
+					body            []byte
+				}
+				uploads := make(chan upload, 1)
+				mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					body, err := io.ReadAll(r.Body)
+					Expect(err).ToNot(HaveOccurred())
+					uploads <- upload{contentEncoding: r.Header.Get("Content-Encoding"), body: body}
+				})
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.CompressRequestBody = true
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				data := bytes.Repeat([]byte("foobar"), 1000)
+				resp, err := client.Post("https://localhost:"+port+"/upload", "application/octet-stream", bytes.NewReader(data))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.ProtoMajor).To(Equal(3))
+				var u upload
+				Eventually(uploads).Should(Receive(&u))
+				Expect(u.contentEncoding).To(Equal("gzip"))
+				Expect(len(u.body)).To(BeNumerically("<", len(data)))
+				zr, err := gzip.NewReader(bytes.NewReader(u.body))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(io.ReadAll(zr)).To(Equal(data))
+
+				// small bodies are not compressed
+				resp, err = client.Post("https://localhost:"+port+"/upload", "text/plain", bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Eventually(uploads).Should(Receive(&u))
+				Expect(u.contentEncoding).To(BeEmpty())
+				Expect(u.body).To(Equal([]byte("foobar")))
+			})
+
+			It("streams the response body chunk by chunk", func() {
+				chunks := []string{"data: foo\n\n", "data: bar\n\n", "data: lorem ipsum\n\n"}
+				acks := make(chan struct{})
+				mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					for i, chunk := range chunks {
+						if i > 0 {
+							// only send the next chunk once the client received the previous one
+							select {
+							case <-acks:
+							case <-time.After(scaleDuration(5 * time.Second)):
+								Fail("client didn't receive the chunk")
+							}
+							time.Sleep(scaleDuration(10 * time.Millisecond))
+						}
+						_, err := io.WriteString(w, chunk)
+						Expect(err).ToNot(HaveOccurred())
+						w.(http.Flusher).Flush()
+					}
+				})
+				chunkSizes := make(chan int, len(chunks))
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.OnResponseChunk = func(req *http.Request, n int) {
+					defer GinkgoRecover()
+					Expect(req.URL.Path).To(Equal("/events"))
+					chunkSizes <- n
+				}
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + port + "/events")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				defer resp.Body.Close()
+				buf := make([]byte, 4)
+				for i, chunk := range chunks {
+					var received []byte
+					for len(chunkSizes) == 0 {
+						n, err := resp.Body.Read(buf)
+						received = append(received, buf[:n]...)
+						if i < len(chunks)-1 || err != io.EOF {
+							Expect(err).ToNot(HaveOccurred())
+						}
+					}
+					Expect(<-chunkSizes).To(Equal(len(chunk)))
+					Expect(string(received)).To(Equal(chunk))
+					if i < len(chunks)-1 {
+						acks <- struct{}{}
+					}
+				}
+				_, err = resp.Body.Read(buf)
+				Expect(err).To(Equal(io.EOF))
+			})
+
+			It("uses 0-RTT with a session ticket persisted by a different RoundTripper", func() {
+				dir, err := ioutil.TempDir("", "session-tickets")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(dir)
+				newRoundTripper := func(tracer logging.ConnectionTracer) *http3.RoundTripper {
+					store, err := http3.NewFileSessionTicketStore(dir)
+					Expect(err).ToNot(HaveOccurred())
+					quicConf := &quic.Config{Versions: []protocol.VersionNumber{version}}
+					if tracer != nil {
+						quicConf.Tracer = newTracer(func() logging.ConnectionTracer { return tracer })
+					}
+					rt := &http3.RoundTripper{
+						TLSClientConfig:    &tls.Config{RootCAs: testdata.GetRootCA()},
+						QuicConfig:         getQuicConfig(quicConf),
+						SessionTicketStore: store,
+					}
+					rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+					return rt
+				}
+
+				rt := newRoundTripper(nil)
+				resp, err := (&http.Client{Transport: rt}).Get("https://localhost:" + port + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.TLS.DidResume).To(BeFalse())
+				Expect(rt.MetricsResumed).To(BeFalse())
+				Expect(rt.MetricsAttempted0RTT).To(BeFalse())
+				Eventually(func() ([]os.FileInfo, error) { return ioutil.ReadDir(dir) }).Should(HaveLen(1))
+				Expect(rt.Close()).To(Succeed())
+
+				// simulate a restart: the new RoundTripper only shares the directory
+				tracer := newPacketTracer()
+				rt = newRoundTripper(tracer)
+				req, err := http.NewRequest(http3.MethodGet0RTT, "https://localhost:"+port+"/hello", nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err = rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+				Expect(resp.TLS.DidResume).To(BeTrue())
+				Expect(rt.MetricsResumed).To(BeTrue())
+				Expect(rt.MetricsAttempted0RTT).To(BeTrue())
+				Expect(rt.MetricsAccepted0RTT).To(BeTrue())
+				Expect(rt.Close()).To(Succeed())
+				var num0RTT int
+				for _, p := range tracer.getSentPackets() {
+					if p.hdr.Type == protocol.PacketType0RTT {
+						num0RTT++
+					}
+				}
+				Expect(num0RTT).ToNot(BeZero())
+			})
+
 			It("uses gzip compression", func() {
 				mux.HandleFunc("/gzipped/hello", func(w http.ResponseWriter, r *http.Request) {
 					defer GinkgoRecover()
@@ -276,6 +869,530 @@ var _ = Describe("HTTP tests", func() {
 				Expect(err).To(HaveOccurred())
 			})
 
+			It("sends requests using the low-level request stream API", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				str, err := rt.OpenRequestStream(context.Background(), "localhost:"+port)
+				Expect(err).ToNot(HaveOccurred())
+				req, err := http.NewRequest(http.MethodPost, "https://localhost:"+port+"/echo", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.SendRequestHeader(req)).To(Succeed())
+				for _, chunk := range []string{"foo", "bar", "baz"} {
+					_, err := str.Write([]byte(chunk))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(str.Close()).To(Succeed())
+				rsp, err := str.ReadResponse()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				body, err := io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("foobarbaz"))
+				Expect(rsp.Body.Close()).To(Succeed())
+			})
+
+			It("returns redirects to http URLs", func() {
+				mux.HandleFunc("/redirect-http", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					http.Redirect(w, r, "http://localhost:"+port+"/hello", http.StatusFound)
+				})
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				client.CheckRedirect = http3.CheckRedirect
+				resp, err := client.Get("https://localhost:" + port + "/redirect-http")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.ProtoMajor).To(Equal(3))
+				Expect(resp.StatusCode).To(Equal(http.StatusFound))
+				Expect(resp.Header.Get("Location")).To(Equal("http://localhost:" + port + "/hello"))
+				Expect(resp.Body.Close()).To(Succeed())
+			})
+
+			It("probes HTTP/3 availability", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				ok, err := rt.ProbeH3(context.Background(), "localhost:"+port)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ok).To(BeTrue())
+
+				// nothing is listening on this port
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				unreachablePort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+				Expect(conn.Close()).To(Succeed())
+				ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(200*time.Millisecond))
+				defer cancel()
+				ok, err = rt.ProbeH3(ctx, "localhost:"+unreachablePort)
+				Expect(err).To(HaveOccurred())
+				Expect(ok).To(BeFalse())
+			})
+
+			It("presents the token received on a previous connection", func() {
+				tokenChan := make(chan *quic.Token, 10)
+				tokenServer := &http3.Server{
+					Server: &http.Server{Handler: mux, TLSConfig: testdata.GetTLSConfig()},
+					QuicConfig: getQuicConfig(&quic.Config{
+						Versions: []quic.VersionNumber{version},
+						AcceptToken: func(_ net.Addr, token *quic.Token) bool {
+							if token != nil && !token.IsRetryToken {
+								tokenChan <- token
+							}
+							return true
+						},
+					}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					tokenServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(tokenServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				tokenPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				puts := make(chan string, 10)
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.TokenStore = newTokenStore(make(chan string, 10), puts)
+				rt.SetAltServices("localhost:"+tokenPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: tokenPort}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + tokenPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Body.Close()).To(Succeed())
+				Eventually(puts).Should(Receive())
+				Expect(tokenChan).ToNot(Receive())
+
+				// close the connection, such that the next request dials a new one
+				Expect(rt.Close()).To(Succeed())
+				resp, err = client.Get("https://localhost:" + tokenPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Body.Close()).To(Succeed())
+				Expect(tokenChan).To(Receive())
+			})
+
+			It("times out when the server delays the response headers", func() {
+				const timeout = 100 * time.Millisecond
+				handlerDone := make(chan struct{})
+				mux.HandleFunc("/delayed-headers", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					defer close(handlerDone)
+					select {
+					case <-time.After(10 * timeout):
+						Fail("the stream wasn't reset")
+					case <-r.Context().Done():
+					}
+				})
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.ResponseHeaderTimeout = timeout
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				start := time.Now()
+				_, err := client.Get("https://localhost:" + port + "/delayed-headers")
+				Expect(err).To(HaveOccurred())
+				var terr *http3.ErrResponseHeaderTimeout
+				Expect(errors.As(err, &terr)).To(BeTrue())
+				Expect(terr.Duration).To(Equal(timeout))
+				Expect(time.Since(start)).To(And(
+					BeNumerically(">=", timeout),
+					BeNumerically("<", 5*timeout),
+				))
+				// the stream was reset, which cancels the handler's context
+				Eventually(handlerDone).Should(BeClosed())
+			})
+
+			It("uses the stream scheduler to decide the order of request bodies", func() {
+				const bodySize = 1 << 20
+				var firstReceived int64 // accessed atomically
+				started := make(chan string, 2)
+				completed := make(chan int64, 1) // bytes of the first body received when the second body completed
+				firstCompleted := make(chan struct{})
+				uploadMux := http.NewServeMux()
+				uploadMux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					name := r.URL.Query().Get("name")
+					started <- name
+					buf := make([]byte, 1<<16)
+					var received int64
+					for {
+						n, err := r.Body.Read(buf)
+						received += int64(n)
+						if name == "first" {
+							atomic.AddInt64(&firstReceived, int64(n))
+						}
+						if err == io.EOF {
+							break
+						}
+						Expect(err).ToNot(HaveOccurred())
+					}
+					Expect(received).To(BeEquivalentTo(bodySize))
+					if name == "second" {
+						completed <- atomic.LoadInt64(&firstReceived)
+					} else {
+						close(firstCompleted)
+					}
+				})
+				uploadServer := &http3.Server{
+					Server: &http.Server{Handler: uploadMux, TLSConfig: testdata.GetTLSConfig()},
+					// Use large flow control windows, such that the order of the data is determined by the client.
+					QuicConfig: getQuicConfig(&quic.Config{
+						Versions:                       []quic.VersionNumber{version},
+						InitialStreamReceiveWindow:     bodySize,
+						InitialConnectionReceiveWindow: 2 * bodySize,
+						MaxConnectionReceiveWindow:     2 * bodySize,
+					}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					uploadServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(uploadServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				uploadPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.StreamScheduler = lifoScheduler{}
+				// Limit the send rate, such that both streams have data to send at the same time.
+				rt.MaxSendRate = 4 * bodySize
+				rt.SetAltServices("localhost:"+uploadPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: uploadPort}, MaxAge: 3600}})
+				upload := func(name string, body io.Reader) {
+					defer GinkgoRecover()
+					resp, err := client.Post("https://localhost:"+uploadPort+"/upload?name="+name, "application/octet-stream", body)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(200))
+					Expect(resp.Body.Close()).To(Succeed())
+				}
+				firstBody, firstWriter := io.Pipe()
+				secondBody, secondWriter := io.Pipe()
+				go upload("first", firstBody)
+				Eventually(started).Should(Receive(Equal("first")))
+				go upload("second", secondBody)
+				Eventually(started).Should(Receive(Equal("second")))
+				// Now that both requests were sent, provide the data for both request bodies at the same time.
+				for _, w := range []*io.PipeWriter{firstWriter, secondWriter} {
+					go func(w *io.PipeWriter) {
+						defer GinkgoRecover()
+						_, err := w.Write(make([]byte, bodySize))
+						Expect(err).ToNot(HaveOccurred())
+						Expect(w.Close()).To(Succeed())
+					}(w)
+				}
+				// The scheduler serves the stream of the second request first.
+				// Using round-robin scheduling, both bodies would be received at the same rate.
+				var firstReceivedBefore int64
+				Eventually(completed, 10*time.Second).Should(Receive(&firstReceivedBefore))
+				Expect(firstReceivedBefore).To(BeNumerically("<", bodySize/2))
+				Eventually(firstCompleted, 10*time.Second).Should(BeClosed())
+			})
+
+			It("errors when sending datagrams to a server that doesn't support them", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.EnableDatagrams = true
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + port + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				d, ok := resp.Body.(http3.Datagrammer)
+				Expect(ok).To(BeTrue())
+				err = d.DatagramMux().SendDatagram(d.DatagramFlowID(), []byte("foobar"))
+				var dgErr *http3.ErrDatagramsNotSupported
+				Expect(errors.As(err, &dgErr)).To(BeTrue())
+				Expect(dgErr.MissingSetting).To(BeFalse())
+			})
+
+			It("exposes the addresses of a datagram tunnel, and forwards the client address", func() {
+				forwarded := make(chan http.Header, 1)
+				m := http.NewServeMux()
+				// The proxy forwards the request on behalf of the client.
+				m.HandleFunc("/tunnel", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					t, ok := w.(http3.TunnelAddrs)
+					Expect(ok).To(BeTrue())
+					Expect(t.RemoteAddr().String()).To(Equal(r.RemoteAddr))
+					h := http.Header{}
+					http3.AppendForwarded(h, t.RemoteAddr(), t.LocalAddr())
+					forwarded <- h
+				})
+				proxy := &http3.Server{
+					Server:          &http.Server{Handler: m, TLSConfig: testdata.GetTLSConfig()},
+					QuicConfig:      getQuicConfig(&quic.Config{Versions: []quic.VersionNumber{version}, EnableDatagrams: true}),
+					EnableDatagrams: true,
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					proxy.Serve(conn)
+				}()
+				defer func() {
+					Expect(proxy.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				proxyPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.EnableDatagrams = true
+				rt.SetAltServices("localhost:"+proxyPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: proxyPort}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + proxyPort + "/tunnel")
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(200))
+				t, ok := resp.Body.(http3.TunnelAddrs)
+				Expect(ok).To(BeTrue())
+				Expect(t.RemoteAddr().(*net.UDPAddr).Port).To(Equal(conn.LocalAddr().(*net.UDPAddr).Port))
+
+				var h http.Header
+				Eventually(forwarded).Should(Receive(&h))
+				// The client's socket is not bound to a specific IP, so only the port is known locally.
+				forwardedFor := http3.ForwardedFor(h)
+				Expect(forwardedFor).To(HaveLen(1))
+				clientAddr, err := net.ResolveUDPAddr("udp", forwardedFor[0])
+				Expect(err).ToNot(HaveOccurred())
+				Expect(clientAddr.Port).To(Equal(t.LocalAddr().(*net.UDPAddr).Port))
+				Expect(h.Get("X-Forwarded-For")).To(Equal(clientAddr.IP.String()))
+			})
+
+			It("errors when sending datagrams to a server that doesn't send SETTINGS_H3_DATAGRAM", func() {
+				dgServer := &http3.Server{
+					Server:     &http.Server{Handler: mux, TLSConfig: testdata.GetTLSConfig()},
+					QuicConfig: getQuicConfig(&quic.Config{Versions: []quic.VersionNumber{version}, EnableDatagrams: true}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					dgServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(dgServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				dgPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.EnableDatagrams = true
+				rt.SetAltServices("localhost:"+dgPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: dgPort}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + dgPort + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				d, ok := resp.Body.(http3.Datagrammer)
+				Expect(ok).To(BeTrue())
+				err = d.DatagramMux().SendDatagram(d.DatagramFlowID(), []byte("foobar"))
+				var dgErr *http3.ErrDatagramsNotSupported
+				Expect(errors.As(err, &dgErr)).To(BeTrue())
+				Expect(dgErr.MissingSetting).To(BeTrue())
+			})
+
+			It("forces the QUIC version", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.ForceVersion(version)
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + port + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+				v, ok := rt.NegotiatedVersion("localhost:" + port)
+				Expect(ok).To(BeTrue())
+				Expect(v).To(Equal(version))
+			})
+
+			It("cancels all requests in flight, and keeps the connection open", func() {
+				const num = 3
+				started := make(chan string, num)
+				release := make(chan struct{})
+				defer close(release)
+				mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+					started <- r.RemoteAddr
+					select {
+					case <-r.Context().Done():
+					case <-release:
+					}
+				})
+				remoteAddrs := make(chan string, 1)
+				mux.HandleFunc("/addr", func(w http.ResponseWriter, r *http.Request) {
+					remoteAddrs <- r.RemoteAddr
+				})
+
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				errChan := make(chan error, num)
+				for i := 0; i < num; i++ {
+					go func() {
+						_, err := client.Get("https://localhost:" + port + "/slow")
+						errChan <- err
+					}()
+				}
+				var addr string
+				for i := 0; i < num; i++ {
+					Eventually(started).Should(Receive(&addr))
+				}
+				rt.CancelAll()
+				for i := 0; i < num; i++ {
+					var err error
+					Eventually(errChan).Should(Receive(&err))
+					Expect(errors.Is(err, http3.ErrRequestCanceled)).To(BeTrue())
+				}
+
+				resp, err := client.Get("https://localhost:" + port + "/addr")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(remoteAddrs).To(Receive(Equal(addr)))
+			})
+
+			It("reports the cipher suite and the key exchange group", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				resp, err := client.Get("https://localhost:" + port + "/hello")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(io.ReadAll(resp.Body)).To(Equal([]byte("Hello, World!\n")))
+				Expect(resp.TLS.CipherSuite).ToNot(BeZero())
+				params, ok := rt.NegotiatedTLSParameters("localhost:" + port)
+				Expect(ok).To(BeTrue())
+				Expect(params.CipherSuite).To(Equal(resp.TLS.CipherSuite))
+				Expect(params.KeyExchangeGroup).To(Equal(tls.X25519))
+			})
+
+			It("fails if the server doesn't support the forced QUIC version", func() {
+				var otherVersion protocol.VersionNumber
+				for _, v := range protocol.SupportedVersions {
+					if v != version {
+						otherVersion = v
+					}
+				}
+				otherServer := &http3.Server{
+					Server:     &http.Server{Handler: mux, TLSConfig: testdata.GetTLSConfig()},
+					QuicConfig: getQuicConfig(&quic.Config{Versions: []quic.VersionNumber{otherVersion}}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					otherServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(otherServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				otherPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.ForceVersion(version)
+				rt.SetAltServices("localhost:"+otherPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: otherPort}, MaxAge: 3600}})
+				_, err = client.Get("https://localhost:" + otherPort + "/hello")
+				Expect(err).To(HaveOccurred())
+				var vnErr *quic.VersionNegotiationError
+				Expect(errors.As(err, &vnErr)).To(BeTrue())
+				Expect(vnErr.Ours).To(Equal([]quic.VersionNumber{version}))
+				Expect(vnErr.Theirs).To(ContainElement(otherVersion))
+			})
+
+			It("reports connection statistics", func() {
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.EnableConnectionStats = true
+				rt.SetAltServices("localhost:"+port, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: port}, MaxAge: 3600}})
+				_, ok := rt.ConnectionRTT("localhost:" + port)
+				Expect(ok).To(BeFalse())
+				for i := 0; i < 5; i++ {
+					resp, err := client.Get("https://localhost:" + port + "/prdata")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(200))
+					body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 5*time.Second))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(body).To(Equal(PRData))
+				}
+				rtt, ok := rt.ConnectionRTT("localhost:" + port)
+				Expect(ok).To(BeTrue())
+				Expect(rtt).To(BeNumerically(">", 0))
+				Expect(rtt).To(BeNumerically("<", time.Second))
+				stats, ok := rt.ConnectionStats("localhost:" + port)
+				Expect(ok).To(BeTrue())
+				Expect(stats.SmoothedRTT).To(Equal(rtt))
+				Expect(stats.MinRTT).To(And(BeNumerically(">", 0), BeNumerically("<=", stats.LatestRTT)))
+				Expect(stats.CongestionWindow).To(BeNumerically(">", 0))
+				Expect(stats.BytesInFlight).To(BeNumerically(">=", 0))
+				Expect(stats.PacketsSent).ToNot(BeZero())
+				Expect(stats.BytesReceived).To(BeNumerically(">", 5*len(PRData)))
+				Expect(stats.PacketsReceived).To(BeNumerically(">", stats.PacketsLost))
+			})
+
+			It("opens a second connection when the server's stream limit is reached", func() {
+				unblock := make(chan struct{})
+				blocked := make(chan struct{})
+				mux.HandleFunc("/blocking", func(w http.ResponseWriter, r *http.Request) {
+					close(blocked)
+					<-unblock
+					w.Write([]byte(r.RemoteAddr))
+				})
+				mux.HandleFunc("/remoteaddr", func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(r.RemoteAddr))
+				})
+				limitedServer := &http3.Server{
+					Server: &http.Server{
+						Handler:   mux,
+						TLSConfig: testdata.GetTLSConfig(),
+					},
+					QuicConfig: getQuicConfig(&quic.Config{Versions: versions, MaxIncomingStreams: 1}),
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					limitedServer.Serve(conn)
+				}()
+				defer func() {
+					Expect(limitedServer.Close()).To(Succeed())
+					Eventually(done).Should(BeClosed())
+				}()
+				limitedPort := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+
+				limitReached := make(chan string, 10)
+				rt := client.Transport.(*http3.RoundTripper)
+				rt.OnStreamLimitReached = func(host string) { limitReached <- host }
+				rt.OpenConnectionOnStreamLimit = true
+				rt.SetAltServices("localhost:"+limitedPort, []altsvc.Service{{ProtocolID: "h3", AltAuthority: altsvc.AltAuthority{Port: limitedPort}, MaxAge: 3600}})
+
+				// The first request uses the only stream the server allows.
+				str, err := rt.OpenRequestStream(context.Background(), "localhost:"+limitedPort)
+				Expect(err).ToNot(HaveOccurred())
+				req, err := http.NewRequest(http.MethodGet, "https://localhost:"+limitedPort+"/blocking", nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.SendRequestHeader(req)).To(Succeed())
+				Expect(str.Close()).To(Succeed())
+				Eventually(blocked).Should(BeClosed())
+				Expect(limitReached).To(BeEmpty())
+
+				// The stream limit of the first connection is reached.
+				resp, err := client.Get("https://localhost:" + limitedPort + "/remoteaddr")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				secondAddr, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(limitReached).To(Receive(Equal("localhost:" + limitedPort)))
+
+				close(unblock)
+				rsp, err := str.ReadResponse()
+				Expect(err).ToNot(HaveOccurred())
+				firstAddr, err := io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Body.Close()).To(Succeed())
+				Expect(string(secondAddr)).ToNot(Equal(string(firstAddr)))
+			})
+
 			It("allows streamed HTTP requests", func() {
 				done := make(chan struct{})
 				mux.HandleFunc("/echoline", func(w http.ResponseWriter, r *http.Request) {
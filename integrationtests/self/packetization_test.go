@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"runtime"
 	"time"
 
 	"github.com/lucas-clemente/quic-go"
 	quicproxy "github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/logging"
 
 	. "github.com/onsi/ginkgo"
@@ -119,4 +121,27 @@ var _ = Describe("Packetization", func() {
 			BeNumerically(">", numMsg*9/10),
 		))
 	})
+
+	It("reports the path MTU found by Path MTU Discovery", func() {
+		if runtime.GOOS == "windows" {
+			Skip("Path MTU Discovery is disabled on Windows")
+		}
+		server, err := quic.ListenAddr("localhost:0", getTLSConfig(), getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer server.Close()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			getQuicConfig(nil),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.CloseWithError(0, "")
+		// We start with the initial packet size. It might already have been increased, if the handshake was confirmed quickly.
+		Expect(sess.ConnectionState().MaxPacketSize).To(BeNumerically(">=", protocol.InitialPacketSizeIPv4))
+		// The loopback interface has a large MTU, so Path MTU Discovery increases the packet size
+		// up to the size of our packet buffers.
+		Eventually(func() int64 { return sess.ConnectionState().MaxPacketSize }).Should(BeNumerically(">", protocol.InitialPacketSizeIPv4))
+		Expect(sess.ConnectionState().MaxPacketSize).To(BeNumerically("<=", protocol.MaxPacketBufferSize))
+	})
 })
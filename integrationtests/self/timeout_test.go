@@ -72,6 +72,7 @@ var _ = Describe("Timeout tests", func() {
 		var err error
 		Eventually(errChan).Should(Receive(&err))
 		checkTimeoutError(err)
+		Expect(err.Error()).To(ContainSubstring("handshake progress: sent Initial packet"))
 	})
 
 	It("returns the context error when the context expires", func() {
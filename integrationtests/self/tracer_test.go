@@ -72,6 +72,7 @@ func (t *customConnTracer) DroppedKey(logging.KeyPhase)
 func (t *customConnTracer) SetLossTimer(logging.TimerType, logging.EncryptionLevel, time.Time) {}
 func (t *customConnTracer) LossTimerExpired(logging.TimerType, logging.EncryptionLevel)        {}
 func (t *customConnTracer) LossTimerCanceled()                                                 {}
+func (t *customConnTracer) ReceivedPathChallenge([8]byte)                                      {}
 func (t *customConnTracer) Debug(string, string)                                               {}
 func (t *customConnTracer) Close()                                                             {}
 
@@ -142,3 +143,86 @@ var _ = Describe("Handshake tests", func() {
 		})
 	}
 })
+
+type qlogBuffer struct {
+	bytes.Buffer
+	closed chan struct{}
+}
+
+func (b *qlogBuffer) Close() error {
+	close(b.closed)
+	return nil
+}
+
+var _ = Describe("qlog", func() {
+	It("parses the qlog of a connection", func() {
+		if enableQlog {
+			Skip("This test sets a tracer and won't produce any qlogs.")
+		}
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+		}()
+
+		buf := &qlogBuffer{closed: make(chan struct{})}
+		var odcid []byte
+		conf := getQuicConfig(nil)
+		conf.Tracer = qlog.NewTracer(func(p logging.Perspective, connectionID []byte) io.WriteCloser {
+			odcid = connectionID
+			return buf
+		})
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			conf,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		str, err := sess.AcceptUniStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		data, err := io.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(PRData))
+		Expect(sess.CloseWithError(0, "")).To(Succeed())
+		Eventually(buf.closed).Should(BeClosed())
+
+		r, err := qlog.NewReader(&buf.Buffer)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Metadata().VantagePoint).To(Equal("client"))
+		Expect(r.Metadata().ODCID).To(Equal(fmt.Sprintf("%x", odcid)))
+		var initial *qlog.PacketEvent
+		var numReceived int
+		for {
+			ev, err := r.ReadEvent()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+			if p, ok := ev.Details.(*qlog.PacketEvent); ok {
+				if ev.Name == "packet_received" {
+					numReceived++
+				}
+				if ev.Name == "packet_sent" && initial == nil {
+					initial = p
+				}
+			}
+		}
+		Expect(numReceived).ToNot(BeZero())
+		// the first packet sent is the client's Initial, carrying the ClientHello
+		Expect(initial).ToNot(BeNil())
+		Expect(initial.Header.PacketType).To(Equal("initial"))
+		Expect(initial.Header.PacketNumber).To(BeZero())
+		Expect(initial.Header.DestConnectionID).To(Equal(fmt.Sprintf("%x", odcid)))
+		Expect(initial.Raw.Length).To(BeNumerically(">=", 1200))
+		Expect(initial.Frames).ToNot(BeEmpty())
+		Expect(initial.Frames[0].FrameType).To(Equal("crypto"))
+	})
+})
@@ -141,6 +141,7 @@ var _ = Describe("0-RTT", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(str.Close()).To(Succeed())
 				Expect(sess.ConnectionState().TLS.Used0RTT).To(BeTrue())
+				Expect(sess.ConnectionState().Attempted0RTT).To(BeTrue())
 				Eventually(done).Should(BeClosed())
 				Eventually(sess.Context().Done()).Should(BeClosed())
 			}
@@ -2,6 +2,7 @@ package quic
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
@@ -52,6 +53,19 @@ type TokenStore interface {
 	Put(key string, token *ClientToken)
 }
 
+// A StreamScheduler decides the order in which streams that have data to send are served.
+// It replaces the default scheduling, which serves streams in a round-robin fashion.
+type StreamScheduler interface {
+	// Schedule is called every time STREAM frames are packed into a packet.
+	// streams are the IDs of the streams that have data to send (including unidirectional streams),
+	// in round-robin order. Schedule reorders streams in place, without adding or removing IDs.
+	// STREAM frames are then packed in this order, until the packet is full.
+	// It is called from the session's run loop, so it must not block.
+	// Note that a stream only has data to send while a Write call on it is pending:
+	// A stream that is written to in small chunks might yield to other streams in between.
+	Schedule(streams []StreamID)
+}
+
 // Err0RTTRejected is the returned from:
 // * Open{Uni}Stream{Sync}
 // * Accept{Uni}Stream
@@ -192,6 +206,8 @@ type Session interface {
 	ConnectionState() ConnectionState
 
 	// SendMessage sends a message as a datagram.
+	// If the message doesn't fit into a DATAGRAM frame of the size negotiated with the peer,
+	// a DatagramTooLargeError is returned.
 	// See https://datatracker.ietf.org/doc/draft-pauly-quic-datagram/.
 	SendMessage([]byte) error
 	// ReceiveMessage gets a message received in a datagram.
@@ -214,6 +230,11 @@ type EarlySession interface {
 	NextSession() Session
 }
 
+// A PortRange is a range of UDP ports, including both Min and Max.
+type PortRange struct {
+	Min, Max uint16
+}
+
 // Config contains all configuration data needed for a QUIC server or client.
 type Config struct {
 	// The QUIC versions that can be negotiated.
@@ -292,13 +313,57 @@ type Config struct {
 	// See https://datatracker.ietf.org/doc/draft-ietf-quic-datagram/.
 	// Datagrams will only be available when both peers enable datagram support.
 	EnableDatagrams bool
-	Tracer          logging.Tracer
+	// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that we're willing to receive.
+	// It is advertised to the peer if EnableDatagrams is set.
+	// If not set, it will default to 1220 bytes.
+	MaxDatagramFrameSize int64
+	// AdditionalTransportParameters are sent to the peer in addition to the transport parameters used by quic-go,
+	// indexed by their transport parameter ID. This is intended for experimenting with new transport parameters.
+	// IDs of transport parameters used by quic-go, and IDs reserved for greasing, are not allowed.
+	AdditionalTransportParameters map[uint64][]byte
+	// SourcePortRange restricts the local port of the UDP socket created by DialAddr (and its variants).
+	// A random free port in the range is used. If all ports in the range are in use, dialing fails.
+	// If unset, the operating system chooses a port.
+	// It has no effect when dialing on a net.PacketConn, or for a server.
+	SourcePortRange PortRange
+	// InitialCongestionWindow is the initial congestion window, in packets.
+	// A larger initial window allows sending more data in the first round trips of a connection,
+	// which speeds up transfers on links with a high bandwidth-delay product.
+	// If not set, it will default to 32 packets. The maximum value is 10000 packets.
+	InitialCongestionWindow uint32
+	// StreamScheduler, if set, decides the order in which streams send their data.
+	// The same StreamScheduler is used for all connections that use this Config.
+	StreamScheduler StreamScheduler
+	// RequireTLS13MinVersion rejects a tls.Config with a MinVersion lower than TLS 1.3.
+	// QUIC always uses TLS 1.3, so by default, a lower MinVersion is accepted, and has no effect.
+	// This makes it possible to enforce that a tls.Config doesn't allow older TLS versions, e.g. for compliance reasons.
+	// A tls.Config that doesn't allow TLS 1.3 (i.e. with a MaxVersion lower than TLS 1.3) is always rejected.
+	RequireTLS13MinVersion bool
+	Tracer                 logging.Tracer
 }
 
 // ConnectionState records basic details about a QUIC connection
 type ConnectionState struct {
 	TLS               handshake.ConnectionState
 	SupportsDatagrams bool
+	// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame the peer is willing to receive.
+	// It is only set if datagrams are supported.
+	MaxDatagramFrameSize int64
+	// MaxPacketSize is the current estimate of the maximum size of a QUIC packet (i.e. the UDP payload)
+	// that can be sent on the path.
+	// It grows as Path MTU Discovery finds that larger packets make it through.
+	// The payload of a DATAGRAM frame has to be smaller, since it also needs to fit the packet and frame headers.
+	MaxPacketSize int64
+	// Version is the QUIC version in use.
+	// It reflects the outcome of Version Negotiation, if it took place.
+	Version VersionNumber
+	// KeyExchangeGroup is the group that was used for the (EC)DHE key exchange of the TLS 1.3 handshake.
+	// The tls.ConnectionState doesn't report it, so it isn't part of TLS.
+	// The cipher suite is available as TLS.CipherSuite.
+	KeyExchangeGroup tls.CurveID
+	// Attempted0RTT says if the client attempted 0-RTT, i.e. if it resumed a TLS session that allows sending 0-RTT data.
+	// It is only set for the client. Whether the server accepted the 0-RTT data is reported by TLS.Used0RTT.
+	Attempted0RTT bool
 }
 
 // A Listener for incoming QUIC connections
@@ -93,6 +93,11 @@ var _ = Describe("Cubic Sender", func() {
 	SendAvailableSendWindow := func() int { return SendAvailableSendWindowLen(maxDatagramSize) }
 	LoseNPackets := func(n int) { LoseNPacketsLen(n, maxDatagramSize) }
 
+	It("uses the configured initial congestion window", func() {
+		sender = NewCubicSender(&clock, rttStats, protocol.InitialPacketSizeIPv4, 100, true, nil)
+		Expect(sender.GetCongestionWindow()).To(Equal(100 * protocol.ByteCount(protocol.InitialPacketSizeIPv4)))
+	})
+
 	It("has the right values at startup", func() {
 		// At startup make sure we are at the default.
 		Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP))
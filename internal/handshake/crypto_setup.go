@@ -143,6 +143,8 @@ type cryptoSetup struct {
 	aead          *updatableAEAD
 	has1RTTSealer bool
 	has1RTTOpener bool
+
+	keyExchangeGroup tls.CurveID
 }
 
 var (
@@ -347,6 +349,9 @@ func (h *cryptoSetup) HandleMessage(data []byte, encLevel protocol.EncryptionLev
 		h.onError(alertUnexpectedMessage, err.Error())
 		return false
 	}
+	if msgType == typeServerHello {
+		h.setKeyExchangeGroup(data)
+	}
 	h.messageChan <- data
 	if encLevel == protocol.Encryption1RTT {
 		h.handlePostHandshakeMessage()
@@ -641,6 +646,9 @@ func (h *cryptoSetup) WriteRecord(p []byte) (int, error) {
 	//nolint:exhaustive // LS records can only be written for Initial and Handshake.
 	switch h.writeEncLevel {
 	case protocol.EncryptionInitial:
+		if h.perspective == protocol.PerspectiveServer && len(p) > 0 && messageType(p[0]) == typeServerHello {
+			h.setKeyExchangeGroupLocked(p)
+		}
 		// assume that the first WriteRecord call contains the ClientHello
 		n, err := h.initialStream.Write(p)
 		if !h.clientHelloWritten && h.perspective == protocol.PerspectiveClient {
@@ -798,3 +806,26 @@ func (h *cryptoSetup) Get1RTTOpener() (ShortHeaderOpener, error) {
 func (h *cryptoSetup) ConnectionState() ConnectionState {
 	return qtls.GetConnectionState(h.conn)
 }
+
+// setKeyExchangeGroup records the group selected in a ServerHello (or a HelloRetryRequest).
+// The client parses the ServerHello it receives, the server the ServerHello it sends.
+func (h *cryptoSetup) setKeyExchangeGroup(serverHello []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.setKeyExchangeGroupLocked(serverHello)
+}
+
+func (h *cryptoSetup) setKeyExchangeGroupLocked(serverHello []byte) {
+	group, ok := serverHelloKeyShareGroup(serverHello)
+	if !ok {
+		return
+	}
+	h.logger.Debugf("Selected key exchange group: %s", group)
+	h.keyExchangeGroup = group
+}
+
+func (h *cryptoSetup) KeyExchangeGroup() tls.CurveID {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.keyExchangeGroup
+}
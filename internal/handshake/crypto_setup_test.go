@@ -382,7 +382,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 		}
 
 		It("handshakes", func() {
-			_, _, clientErr, _, serverErr := handshakeWithTLSConf(
+			_, client, clientErr, server, serverErr := handshakeWithTLSConf(
 				clientConf, serverConf,
 				&utils.RTTStats{}, &utils.RTTStats{},
 				&wire.TransportParameters{}, &wire.TransportParameters{},
@@ -390,11 +390,15 @@ var _ = Describe("Crypto Setup TLS", func() {
 			)
 			Expect(clientErr).ToNot(HaveOccurred())
 			Expect(serverErr).ToNot(HaveOccurred())
+			Expect(client.ConnectionState().CipherSuite).ToNot(BeZero())
+			Expect(client.ConnectionState().CipherSuite).To(Equal(server.ConnectionState().CipherSuite))
+			Expect(client.KeyExchangeGroup()).To(Equal(tls.X25519))
+			Expect(server.KeyExchangeGroup()).To(Equal(tls.X25519))
 		})
 
 		It("performs a HelloRetryRequst", func() {
 			serverConf.CurvePreferences = []tls.CurveID{tls.CurveP384}
-			_, _, clientErr, _, serverErr := handshakeWithTLSConf(
+			_, client, clientErr, server, serverErr := handshakeWithTLSConf(
 				clientConf, serverConf,
 				&utils.RTTStats{}, &utils.RTTStats{},
 				&wire.TransportParameters{}, &wire.TransportParameters{},
@@ -402,6 +406,8 @@ var _ = Describe("Crypto Setup TLS", func() {
 			)
 			Expect(clientErr).ToNot(HaveOccurred())
 			Expect(serverErr).ToNot(HaveOccurred())
+			Expect(client.KeyExchangeGroup()).To(Equal(tls.CurveP384))
+			Expect(server.KeyExchangeGroup()).To(Equal(tls.CurveP384))
 		})
 
 		It("handshakes with client auth", func() {
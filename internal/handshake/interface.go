@@ -1,6 +1,7 @@
 package handshake
 
 import (
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
@@ -82,6 +83,8 @@ type CryptoSetup interface {
 	SetLargest1RTTAcked(protocol.PacketNumber) error
 	SetHandshakeConfirmed()
 	ConnectionState() ConnectionState
+	// KeyExchangeGroup returns the group used for the key exchange, or 0 if no ServerHello was processed yet.
+	KeyExchangeGroup() tls.CurveID
 
 	GetInitialOpener() (LongHeaderOpener, error)
 	GetHandshakeOpener() (LongHeaderOpener, error)
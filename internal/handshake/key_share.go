@@ -0,0 +1,49 @@
+package handshake
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const extensionKeyShare uint16 = 51
+
+// serverHelloKeyShareGroup parses a ServerHello message (including the 4 byte handshake message header),
+// and returns the group of the key_share extension.
+// This is the group selected by the server for the (EC)DHE key exchange.
+// For a HelloRetryRequest, it is the group that the client is asked to use for the second ClientHello.
+func serverHelloKeyShareGroup(data []byte) (tls.CurveID, bool) {
+	s := cryptobyte.String(data)
+	var msgType uint8
+	var msg cryptobyte.String
+	if !s.ReadUint8(&msgType) || messageType(msgType) != typeServerHello || !s.ReadUint24LengthPrefixed(&msg) {
+		return 0, false
+	}
+	var sessionID cryptobyte.String
+	var extensions cryptobyte.String
+	if !msg.Skip(2) || // legacy_version
+		!msg.Skip(32) || // random
+		!msg.ReadUint8LengthPrefixed(&sessionID) ||
+		!msg.Skip(2) || // cipher_suite
+		!msg.Skip(1) || // legacy_compression_method
+		!msg.ReadUint16LengthPrefixed(&extensions) {
+		return 0, false
+	}
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return 0, false
+		}
+		if extType != extensionKeyShare {
+			continue
+		}
+		// Both the KeyShareEntry of a ServerHello and the selected_group of a HelloRetryRequest start with the group.
+		var group uint16
+		if !extData.ReadUint16(&group) {
+			return 0, false
+		}
+		return tls.CurveID(group), true
+	}
+	return 0, false
+}
@@ -0,0 +1,69 @@
+package handshake
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/cryptobyte"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ServerHello key share", func() {
+	// serverHello builds a ServerHello with the given extensions.
+	serverHello := func(exts map[uint16][]byte) []byte {
+		b := cryptobyte.NewBuilder(nil)
+		b.AddUint8(uint8(typeServerHello))
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS12)
+			b.AddBytes(make([]byte, 32))
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte("session")) })
+			b.AddUint16(tls.TLS_AES_128_GCM_SHA256)
+			b.AddUint8(0)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for extType, data := range exts {
+					b.AddUint16(extType)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(data) })
+				}
+			})
+		})
+		return b.BytesOrPanic()
+	}
+
+	It("parses the group", func() {
+		data := serverHello(map[uint16][]byte{
+			43:                {0x3, 0x4}, // supported_versions
+			extensionKeyShare: {0x0, 0x17, 0x0, 0x3, 0x1, 0x2, 0x3},
+		})
+		group, ok := serverHelloKeyShareGroup(data)
+		Expect(ok).To(BeTrue())
+		Expect(group).To(Equal(tls.CurveP256))
+	})
+
+	It("parses the selected group of a HelloRetryRequest", func() {
+		data := serverHello(map[uint16][]byte{extensionKeyShare: {0x0, 0x18}})
+		group, ok := serverHelloKeyShareGroup(data)
+		Expect(ok).To(BeTrue())
+		Expect(group).To(Equal(tls.CurveP384))
+	})
+
+	It("doesn't find a group if there's no key_share extension", func() {
+		_, ok := serverHelloKeyShareGroup(serverHello(map[uint16][]byte{43: {0x3, 0x4}}))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("rejects other messages", func() {
+		data := serverHello(map[uint16][]byte{extensionKeyShare: {0x0, 0x17}})
+		data[0] = byte(typeClientHello)
+		_, ok := serverHelloKeyShareGroup(data)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("rejects truncated messages", func() {
+		data := serverHello(map[uint16][]byte{extensionKeyShare: {0x0, 0x17}})
+		for i := range data {
+			_, ok := serverHelloKeyShareGroup(data[:i])
+			Expect(ok).To(BeFalse())
+		}
+	})
+})
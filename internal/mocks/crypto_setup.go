@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	tls "crypto/tls"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -225,6 +226,20 @@ func (mr *MockCryptoSetupMockRecorder) HandleMessage(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleMessage", reflect.TypeOf((*MockCryptoSetup)(nil).HandleMessage), arg0, arg1)
 }
 
+// KeyExchangeGroup mocks base method.
+func (m *MockCryptoSetup) KeyExchangeGroup() tls.CurveID {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KeyExchangeGroup")
+	ret0, _ := ret[0].(tls.CurveID)
+	return ret0
+}
+
+// KeyExchangeGroup indicates an expected call of KeyExchangeGroup.
+func (mr *MockCryptoSetupMockRecorder) KeyExchangeGroup() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KeyExchangeGroup", reflect.TypeOf((*MockCryptoSetup)(nil).KeyExchangeGroup))
+}
+
 // RunHandshake mocks base method.
 func (m *MockCryptoSetup) RunHandshake() {
 	m.ctrl.T.Helper()
@@ -195,6 +195,18 @@ func (mr *MockConnectionTracerMockRecorder) ReceivedPacket(arg0, arg1, arg2 inte
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceivedPacket", reflect.TypeOf((*MockConnectionTracer)(nil).ReceivedPacket), arg0, arg1, arg2)
 }
 
+// ReceivedPathChallenge mocks base method.
+func (m *MockConnectionTracer) ReceivedPathChallenge(arg0 [8]byte) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReceivedPathChallenge", arg0)
+}
+
+// ReceivedPathChallenge indicates an expected call of ReceivedPathChallenge.
+func (mr *MockConnectionTracerMockRecorder) ReceivedPathChallenge(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceivedPathChallenge", reflect.TypeOf((*MockConnectionTracer)(nil).ReceivedPathChallenge), arg0)
+}
+
 // ReceivedRetry mocks base method.
 func (m *MockConnectionTracer) ReceivedRetry(arg0 *wire.Header) {
 	m.ctrl.T.Helper()
@@ -14,6 +14,9 @@ const InitialPacketSizeIPv6 = 1232
 // MaxCongestionWindowPackets is the maximum congestion window in packet.
 const MaxCongestionWindowPackets = 10000
 
+// DefaultInitialCongestionWindow is the default initial congestion window in packets.
+const DefaultInitialCongestionWindow = 32
+
 // MaxUndecryptablePackets limits the number of undecryptable packets that are queued in the session.
 const MaxUndecryptablePackets = 32
 
@@ -73,23 +73,54 @@ func (e *ApplicationError) Error() string {
 	return fmt.Sprintf("Application error %#x: %s", e.ErrorCode, e.ErrorMessage)
 }
 
-type IdleTimeoutError struct{}
+type IdleTimeoutError struct {
+	// HandshakeProgress is the last step of the handshake that was completed.
+	// It is only set if the connection timed out before the handshake completed.
+	HandshakeProgress string
+}
 
 var _ error = &IdleTimeoutError{}
 
-func (e *IdleTimeoutError) Timeout() bool        { return true }
-func (e *IdleTimeoutError) Temporary() bool      { return false }
-func (e *IdleTimeoutError) Error() string        { return "timeout: no recent network activity" }
-func (e *IdleTimeoutError) Is(target error) bool { return target == net.ErrClosed }
+func (e *IdleTimeoutError) Timeout() bool   { return true }
+func (e *IdleTimeoutError) Temporary() bool { return false }
+func (e *IdleTimeoutError) Error() string {
+	if e.HandshakeProgress != "" {
+		return fmt.Sprintf("timeout: no recent network activity (handshake progress: %s)", e.HandshakeProgress)
+	}
+	return "timeout: no recent network activity"
+}
+
+// Is matches any IdleTimeoutError, regardless of the handshake progress, and net.ErrClosed.
+func (e *IdleTimeoutError) Is(target error) bool {
+	if _, ok := target.(*IdleTimeoutError); ok {
+		return true
+	}
+	return target == net.ErrClosed
+}
 
-type HandshakeTimeoutError struct{}
+type HandshakeTimeoutError struct {
+	// HandshakeProgress is the last step of the handshake that was completed.
+	HandshakeProgress string
+}
 
 var _ error = &HandshakeTimeoutError{}
 
-func (e *HandshakeTimeoutError) Timeout() bool        { return true }
-func (e *HandshakeTimeoutError) Temporary() bool      { return false }
-func (e *HandshakeTimeoutError) Error() string        { return "timeout: handshake did not complete in time" }
-func (e *HandshakeTimeoutError) Is(target error) bool { return target == net.ErrClosed }
+func (e *HandshakeTimeoutError) Timeout() bool   { return true }
+func (e *HandshakeTimeoutError) Temporary() bool { return false }
+func (e *HandshakeTimeoutError) Error() string {
+	if e.HandshakeProgress != "" {
+		return fmt.Sprintf("timeout: handshake did not complete in time (handshake progress: %s)", e.HandshakeProgress)
+	}
+	return "timeout: handshake did not complete in time"
+}
+
+// Is matches any HandshakeTimeoutError, regardless of the handshake progress, and net.ErrClosed.
+func (e *HandshakeTimeoutError) Is(target error) bool {
+	if _, ok := target.(*HandshakeTimeoutError); ok {
+		return true
+	}
+	return target == net.ErrClosed
+}
 
 // A VersionNegotiationError occurs when the client and the server can't agree on a QUIC version.
 type VersionNegotiationError struct {
@@ -77,6 +77,24 @@ var _ = Describe("QUIC Errors", func() {
 			Expect(err.Error()).To(Equal("timeout: handshake did not complete in time"))
 		})
 
+		It("handshake timeouts, with handshake progress", func() {
+			err := &HandshakeTimeoutError{HandshakeProgress: "received Initial packet"}
+			Expect(err.Error()).To(Equal("timeout: handshake did not complete in time (handshake progress: received Initial packet)"))
+		})
+
+		It("idle timeouts during the handshake", func() {
+			Expect((&IdleTimeoutError{}).Error()).To(Equal("timeout: no recent network activity"))
+			err := &IdleTimeoutError{HandshakeProgress: "sent Initial packet"}
+			Expect(err.Error()).To(Equal("timeout: no recent network activity (handshake progress: sent Initial packet)"))
+		})
+
+		It("matches timeout errors regardless of the handshake progress", func() {
+			Expect(errors.Is(&HandshakeTimeoutError{HandshakeProgress: "sent Initial packet"}, ErrHandshakeTimeout)).To(BeTrue())
+			Expect(errors.Is(&IdleTimeoutError{HandshakeProgress: "sent Initial packet"}, ErrIdleTimeout)).To(BeTrue())
+			Expect(errors.Is(&IdleTimeoutError{}, &HandshakeTimeoutError{})).To(BeFalse())
+			Expect(errors.Is(&HandshakeTimeoutError{}, &IdleTimeoutError{})).To(BeFalse())
+		})
+
 		It("idle timeouts", func() {
 			//nolint:gosimple // we need to assign to an interface here
 			var err error
@@ -0,0 +1,207 @@
+package qtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+	"unsafe"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// sessionStateVersion is the version of the serialization format of the ClientSessionState.
+// It must be incremented every time the format changes.
+const sessionStateVersion uint8 = 1
+
+// clientSessionState has the same memory layout as the unexported fields of tls.ClientSessionState.
+type clientSessionState struct {
+	sessionTicket      []uint8
+	vers               uint16
+	cipherSuite        uint16
+	masterSecret       []byte
+	serverCertificates []*x509.Certificate
+	verifiedChains     [][]*x509.Certificate
+	receivedAt         time.Time
+	ocspResponse       []byte
+	scts               [][]byte
+	nonce              []byte
+	useBy              time.Time
+	ageAdd             uint32
+}
+
+var (
+	errSessionStateLayout  = errors.New("qtls: unexpected memory layout of the tls.ClientSessionState")
+	errInvalidSessionState = errors.New("qtls: invalid session state")
+)
+
+// clientSessionStateLayoutMatches is true if the layout of the clientSessionState matches tls.ClientSessionState.
+var clientSessionStateLayoutMatches = structsEqual(&tls.ClientSessionState{}, &clientSessionState{})
+
+func structsEqual(a, b interface{}) bool {
+	sa := reflect.ValueOf(a).Elem()
+	sb := reflect.ValueOf(b).Elem()
+	if sa.NumField() != sb.NumField() {
+		return false
+	}
+	for i := 0; i < sa.NumField(); i++ {
+		fa := sa.Type().Field(i)
+		fb := sb.Type().Field(i)
+		if fa.Name != fb.Name || fa.Type != fb.Type || fa.Offset != fb.Offset {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalClientSessionState serializes a ClientSessionState, such that it can be persisted.
+// The serialization contains the secrets needed to resume the session,
+// and needs to be stored as carefully as a private key.
+func MarshalClientSessionState(state *ClientSessionState) ([]byte, error) {
+	if !clientSessionStateLayoutMatches {
+		return nil, errSessionStateLayout
+	}
+	s := (*clientSessionState)(unsafe.Pointer(state))
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(sessionStateVersion)
+	addBytes(b, s.sessionTicket)
+	b.AddUint16(s.vers)
+	b.AddUint16(s.cipherSuite)
+	addBytes(b, s.masterSecret)
+	addCertificates(b, s.serverCertificates)
+	b.AddUint16(uint16(len(s.verifiedChains)))
+	for _, chain := range s.verifiedChains {
+		addCertificates(b, chain)
+	}
+	addTime(b, s.receivedAt)
+	addBytes(b, s.ocspResponse)
+	b.AddUint16(uint16(len(s.scts)))
+	for _, sct := range s.scts {
+		addBytes(b, sct)
+	}
+	addBytes(b, s.nonce)
+	addTime(b, s.useBy)
+	b.AddUint32(s.ageAdd)
+	return b.Bytes()
+}
+
+// UnmarshalClientSessionState parses a ClientSessionState serialized by MarshalClientSessionState.
+func UnmarshalClientSessionState(data []byte) (*ClientSessionState, error) {
+	if !clientSessionStateLayoutMatches {
+		return nil, errSessionStateLayout
+	}
+	s := cryptobyte.String(data)
+	var version uint8
+	if !s.ReadUint8(&version) {
+		return nil, errInvalidSessionState
+	}
+	if version != sessionStateVersion {
+		return nil, fmt.Errorf("qtls: unknown session state version %d", version)
+	}
+	var state clientSessionState
+	var numChains, numSCTs uint16
+	if !readBytes(&s, &state.sessionTicket) ||
+		!s.ReadUint16(&state.vers) ||
+		!s.ReadUint16(&state.cipherSuite) ||
+		!readBytes(&s, &state.masterSecret) {
+		return nil, errInvalidSessionState
+	}
+	var err error
+	if state.serverCertificates, err = readCertificates(&s); err != nil {
+		return nil, err
+	}
+	if !s.ReadUint16(&numChains) {
+		return nil, errInvalidSessionState
+	}
+	for i := 0; i < int(numChains); i++ {
+		chain, err := readCertificates(&s)
+		if err != nil {
+			return nil, err
+		}
+		state.verifiedChains = append(state.verifiedChains, chain)
+	}
+	if !readTime(&s, &state.receivedAt) ||
+		!readBytes(&s, &state.ocspResponse) ||
+		!s.ReadUint16(&numSCTs) {
+		return nil, errInvalidSessionState
+	}
+	for i := 0; i < int(numSCTs); i++ {
+		var sct []byte
+		if !readBytes(&s, &sct) {
+			return nil, errInvalidSessionState
+		}
+		state.scts = append(state.scts, sct)
+	}
+	if !readBytes(&s, &state.nonce) ||
+		!readTime(&s, &state.useBy) ||
+		!s.ReadUint32(&state.ageAdd) ||
+		!s.Empty() {
+		return nil, errInvalidSessionState
+	}
+	return (*ClientSessionState)(unsafe.Pointer(&state)), nil
+}
+
+func addBytes(b *cryptobyte.Builder, data []byte) {
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(data) })
+}
+
+func readBytes(s *cryptobyte.String, data *[]byte) bool {
+	var v cryptobyte.String
+	if !s.ReadUint24LengthPrefixed(&v) {
+		return false
+	}
+	*data = append([]byte{}, v...)
+	return true
+}
+
+// addTime encodes a time with nanosecond precision. The zero time is encoded as 0.
+func addTime(b *cryptobyte.Builder, t time.Time) {
+	var v uint64
+	if !t.IsZero() {
+		v = uint64(t.UnixNano())
+	}
+	b.AddUint32(uint32(v >> 32))
+	b.AddUint32(uint32(v))
+}
+
+func readTime(s *cryptobyte.String, t *time.Time) bool {
+	var hi, lo uint32
+	if !s.ReadUint32(&hi) || !s.ReadUint32(&lo) {
+		return false
+	}
+	if v := uint64(hi)<<32 | uint64(lo); v == 0 {
+		*t = time.Time{}
+	} else {
+		*t = time.Unix(0, int64(v))
+	}
+	return true
+}
+
+func addCertificates(b *cryptobyte.Builder, certs []*x509.Certificate) {
+	b.AddUint16(uint16(len(certs)))
+	for _, cert := range certs {
+		addBytes(b, cert.Raw)
+	}
+}
+
+func readCertificates(s *cryptobyte.String) ([]*x509.Certificate, error) {
+	var num uint16
+	if !s.ReadUint16(&num) {
+		return nil, errInvalidSessionState
+	}
+	certs := make([]*x509.Certificate, 0, num)
+	for i := 0; i < int(num); i++ {
+		var raw []byte
+		if !readBytes(s, &raw) {
+			return nil, errInvalidSessionState
+		}
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("qtls: invalid certificate in session state: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
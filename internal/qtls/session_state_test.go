@@ -0,0 +1,98 @@
+package qtls
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type sessionCache struct {
+	tls.ClientSessionCache
+	puts chan *tls.ClientSessionState
+}
+
+func (c *sessionCache) Put(key string, cs *tls.ClientSessionState) {
+	c.ClientSessionCache.Put(key, cs)
+	if cs != nil {
+		c.puts <- cs
+	}
+}
+
+var _ = Describe("serializing the ClientSessionState", func() {
+	var serverConf *tls.Config
+
+	BeforeEach(func() {
+		// use the same config for all handshakes, so the server uses the same session ticket keys
+		serverConf = testdata.GetTLSConfig()
+	})
+
+	handshake := func(cache tls.ClientSessionCache) tls.ConnectionState {
+		cConn, sConn := net.Pipe()
+		defer cConn.Close()
+		defer sConn.Close()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			conn := tls.Server(sConn, serverConf)
+			Expect(conn.Handshake()).To(Succeed())
+			// write some data, so the client reads the session ticket
+			_, err := conn.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		conn := tls.Client(cConn, &tls.Config{
+			ServerName:         "localhost",
+			RootCAs:            testdata.GetRootCA(),
+			ClientSessionCache: cache,
+		})
+		Expect(conn.Handshake()).To(Succeed())
+		b := make([]byte, 6)
+		_, err := conn.Read(b)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+		return conn.ConnectionState()
+	}
+
+	It("resumes a session from a serialized ClientSessionState", func() {
+		cache := &sessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(1), puts: make(chan *tls.ClientSessionState, 10)}
+		Expect(handshake(cache).DidResume).To(BeFalse())
+		var cs *tls.ClientSessionState
+		Eventually(cache.puts).Should(Receive(&cs))
+		data, err := MarshalClientSessionState(cs)
+		Expect(err).ToNot(HaveOccurred())
+
+		restored, err := UnmarshalClientSessionState(data)
+		Expect(err).ToNot(HaveOccurred())
+		// the x509.Certificates and the time.Times are not identical after parsing, so compare the serializations
+		Expect(MarshalClientSessionState(restored)).To(Equal(data))
+		newCache := tls.NewLRUClientSessionCache(1)
+		newCache.Put("localhost", restored)
+		state := handshake(newCache)
+		Expect(state.DidResume).To(BeTrue())
+		Expect(state.PeerCertificates).ToNot(BeEmpty())
+		Expect(state.VerifiedChains).ToNot(BeEmpty())
+	})
+
+	It("rejects invalid session states", func() {
+		_, err := UnmarshalClientSessionState(nil)
+		Expect(err).To(MatchError(errInvalidSessionState))
+		data, err := MarshalClientSessionState(&tls.ClientSessionState{})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = UnmarshalClientSessionState(data[:len(data)-1])
+		Expect(err).To(MatchError(errInvalidSessionState))
+		_, err = UnmarshalClientSessionState(append(data, 0))
+		Expect(err).To(MatchError(errInvalidSessionState))
+	})
+
+	It("rejects unknown versions", func() {
+		data, err := MarshalClientSessionState(&tls.ClientSessionState{})
+		Expect(err).ToNot(HaveOccurred())
+		data[0]++
+		_, err = UnmarshalClientSessionState(data)
+		Expect(err).To(MatchError(ContainSubstring("unknown session state version")))
+	})
+})
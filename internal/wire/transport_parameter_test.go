@@ -80,6 +80,15 @@ var _ = Describe("Transport Parameters", func() {
 		Expect(p.String()).To(Equal("&wire.TransportParameters{OriginalDestinationConnectionID: deadbeef, InitialSourceConnectionID: (empty), InitialMaxStreamDataBidiLocal: 1234, InitialMaxStreamDataBidiRemote: 2345, InitialMaxStreamDataUni: 3456, InitialMaxData: 4567, MaxBidiStreamNum: 1337, MaxUniStreamNum: 7331, MaxIdleTimeout: 42s, AckDelayExponent: 14, MaxAckDelay: 37s, ActiveConnectionIDLimit: 89}"))
 	})
 
+	It("has a string representation, with additional parameters", func() {
+		p := &TransportParameters{
+			InitialSourceConnectionID: protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+			MaxDatagramFrameSize:      protocol.InvalidByteCount,
+			AdditionalParameters:      map[uint64][]byte{0x1337: []byte("foo")},
+		}
+		Expect(p.String()).To(HaveSuffix(", AdditionalParameters: map[4919:[102 111 111]]}"))
+	})
+
 	It("marshals and unmarshals", func() {
 		var token protocol.StatelessResetToken
 		rand.Read(token[:])
@@ -340,6 +349,45 @@ var _ = Describe("Transport Parameters", func() {
 		Expect(p.Unmarshal(b.Bytes(), protocol.PerspectiveClient)).To(Succeed())
 		Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(protocol.ByteCount(0x1337)))
 		Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(protocol.ByteCount(0x42)))
+		Expect(p.AdditionalParameters).To(Equal(map[uint64][]byte{0x42: []byte("foobar")}))
+	})
+
+	It("doesn't record greased parameters", func() {
+		b := &bytes.Buffer{}
+		quicvarint.Write(b, 27+31*42)
+		quicvarint.Write(b, 6)
+		b.Write([]byte("foobar"))
+		addInitialSourceConnectionID(b)
+		p := &TransportParameters{}
+		Expect(p.Unmarshal(b.Bytes(), protocol.PerspectiveClient)).To(Succeed())
+		Expect(p.AdditionalParameters).To(BeEmpty())
+	})
+
+	It("marshals and unmarshals additional parameters", func() {
+		params := &TransportParameters{
+			InitialSourceConnectionID: protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+			MaxDatagramFrameSize:      protocol.InvalidByteCount,
+			AdditionalParameters: map[uint64][]byte{
+				0x1337: []byte("foobar"),
+				0x42:   {},
+			},
+		}
+		p := &TransportParameters{}
+		Expect(p.Unmarshal(params.Marshal(protocol.PerspectiveClient), protocol.PerspectiveClient)).To(Succeed())
+		Expect(p.AdditionalParameters).To(Equal(params.AdditionalParameters))
+	})
+
+	It("says which transport parameters are known", func() {
+		Expect(IsKnownTransportParameter(uint64(initialMaxDataParameterID))).To(BeTrue())
+		Expect(IsKnownTransportParameter(uint64(maxDatagramFrameSizeParameterID))).To(BeTrue())
+		Expect(IsKnownTransportParameter(0x1337)).To(BeFalse())
+	})
+
+	It("says which transport parameters are greased", func() {
+		Expect(IsGreasedTransportParameter(27)).To(BeTrue())
+		Expect(IsGreasedTransportParameter(27 + 31*100)).To(BeTrue())
+		Expect(IsGreasedTransportParameter(28)).To(BeFalse())
+		Expect(IsGreasedTransportParameter(0)).To(BeFalse())
 	})
 
 	It("rejects duplicate parameters", func() {
@@ -85,6 +85,45 @@ type TransportParameters struct {
 	ActiveConnectionIDLimit uint64
 
 	MaxDatagramFrameSize protocol.ByteCount
+
+	// AdditionalParameters are transport parameters that are not used by quic-go,
+	// indexed by their transport parameter ID.
+	// When marshaling, they are sent in addition to the parameters above.
+	// When unmarshaling, all unknown parameters (except for greased ones) are recorded.
+	AdditionalParameters map[uint64][]byte
+}
+
+// IsKnownTransportParameter says if a transport parameter ID is used by quic-go.
+func IsKnownTransportParameter(id uint64) bool {
+	switch transportParameterID(id) {
+	case originalDestinationConnectionIDParameterID,
+		maxIdleTimeoutParameterID,
+		statelessResetTokenParameterID,
+		maxUDPPayloadSizeParameterID,
+		initialMaxDataParameterID,
+		initialMaxStreamDataBidiLocalParameterID,
+		initialMaxStreamDataBidiRemoteParameterID,
+		initialMaxStreamDataUniParameterID,
+		initialMaxStreamsBidiParameterID,
+		initialMaxStreamsUniParameterID,
+		ackDelayExponentParameterID,
+		maxAckDelayParameterID,
+		disableActiveMigrationParameterID,
+		preferredAddressParameterID,
+		activeConnectionIDLimitParameterID,
+		initialSourceConnectionIDParameterID,
+		retrySourceConnectionIDParameterID,
+		maxDatagramFrameSizeParameterID:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsGreasedTransportParameter says if a transport parameter ID is reserved for greasing,
+// see https://www.rfc-editor.org/rfc/rfc9000.html#section-18.1.
+func IsGreasedTransportParameter(id uint64) bool {
+	return id >= 27 && (id-27)%31 == 0
 }
 
 // Unmarshal the transport parameters
@@ -179,7 +218,16 @@ func (p *TransportParameters) unmarshal(r *bytes.Reader, sentBy protocol.Perspec
 			connID, _ := protocol.ReadConnectionID(r, int(paramLen))
 			p.RetrySourceConnectionID = &connID
 		default:
-			r.Seek(int64(paramLen), io.SeekCurrent)
+			if fromSessionTicket || IsGreasedTransportParameter(uint64(paramID)) {
+				r.Seek(int64(paramLen), io.SeekCurrent)
+				break
+			}
+			val := make([]byte, paramLen)
+			r.Read(val)
+			if p.AdditionalParameters == nil {
+				p.AdditionalParameters = make(map[uint64][]byte)
+			}
+			p.AdditionalParameters[uint64(paramID)] = val
 		}
 	}
 
@@ -394,6 +442,18 @@ func (p *TransportParameters) Marshal(pers protocol.Perspective) []byte {
 	if p.MaxDatagramFrameSize != protocol.InvalidByteCount {
 		p.marshalVarintParam(b, maxDatagramFrameSizeParameterID, uint64(p.MaxDatagramFrameSize))
 	}
+	// additional parameters, sorted by their ID
+	ids := make([]uint64, 0, len(p.AdditionalParameters))
+	for id := range p.AdditionalParameters {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		val := p.AdditionalParameters[id]
+		quicvarint.Write(b, id)
+		quicvarint.Write(b, uint64(len(val)))
+		b.Write(val)
+	}
 	return b.Bytes()
 }
 
@@ -471,6 +531,10 @@ func (p *TransportParameters) String() string {
 		logString += ", MaxDatagramFrameSize: %d"
 		logParams = append(logParams, p.MaxDatagramFrameSize)
 	}
+	if len(p.AdditionalParameters) > 0 {
+		logString += ", AdditionalParameters: %v"
+		logParams = append(logParams, p.AdditionalParameters)
+	}
 	logString += "}"
 	return fmt.Sprintf(logString, logParams...)
 }
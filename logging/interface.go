@@ -114,6 +114,10 @@ type ConnectionTracer interface {
 	ReceivedVersionNegotiationPacket(*Header, []VersionNumber)
 	ReceivedRetry(*Header)
 	ReceivedPacket(hdr *ExtendedHeader, size ByteCount, frames []Frame)
+	// ReceivedPathChallenge is called when a PATH_CHALLENGE frame was received, after the PATH_RESPONSE frame
+	// echoing the data was queued. It doesn't say if the PATH_RESPONSE reached the peer.
+	// This method was added to the interface, so external ConnectionTracer implementations need to implement it.
+	ReceivedPathChallenge(data [8]byte)
 	BufferedPacket(PacketType)
 	DroppedPacket(PacketType, ByteCount, PacketDropReason)
 	UpdatedMetrics(rttStats *RTTStats, cwnd, bytesInFlight ByteCount, packetsInFlight int)
@@ -122,6 +122,12 @@ func (m *connTracerMultiplexer) ReceivedPacket(hdr *ExtendedHeader, size ByteCou
 	}
 }
 
+func (m *connTracerMultiplexer) ReceivedPathChallenge(data [8]byte) {
+	for _, t := range m.tracers {
+		t.ReceivedPathChallenge(data)
+	}
+}
+
 func (m *connTracerMultiplexer) BufferedPacket(typ PacketType) {
 	for _, t := range m.tracers {
 		t.BufferedPacket(typ)
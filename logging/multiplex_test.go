@@ -251,6 +251,12 @@ var _ = Describe("Tracing", func() {
 			tracer.LossTimerExpired(TimerTypePTO, EncryptionHandshake)
 		})
 
+		It("traces the ReceivedPathChallenge event", func() {
+			tr1.EXPECT().ReceivedPathChallenge([8]byte{1, 2, 3, 4, 5, 6, 7, 8})
+			tr2.EXPECT().ReceivedPathChallenge([8]byte{1, 2, 3, 4, 5, 6, 7, 8})
+			tracer.ReceivedPathChallenge([8]byte{1, 2, 3, 4, 5, 6, 7, 8})
+		})
+
 		It("traces the LossTimerCanceled event", func() {
 			tr1.EXPECT().LossTimerCanceled()
 			tr2.EXPECT().LossTimerCanceled()
@@ -0,0 +1,64 @@
+package qlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/logging"
+)
+
+// categoryFilter is a set of event categories.
+// The zero value allows all categories.
+type categoryFilter uint8
+
+func (f categoryFilter) allows(c category) bool {
+	return f == 0 || f&(1<<c) != 0
+}
+
+func parseCategory(s string) (category, error) {
+	for _, c := range []category{categoryConnectivity, categoryTransport, categorySecurity, categoryRecovery} {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("qlog: unknown event category %q", s)
+}
+
+type filteringTracer struct {
+	logging.Tracer
+	filter categoryFilter
+}
+
+// NewFilteringTracer wraps a qlog tracer, such that only events of the given categories are emitted.
+// The tracer must have been created by NewTracer or NewRotatingTracer.
+// Valid categories are "connectivity", "transport", "security" and "recovery".
+func NewFilteringTracer(t logging.Tracer, categories ...string) (logging.Tracer, error) {
+	switch t.(type) {
+	case *tracer, *RotatingTracer:
+	default:
+		return nil, errors.New("qlog: can only filter qlog tracers")
+	}
+	if len(categories) == 0 {
+		return nil, errors.New("qlog: no event categories given")
+	}
+	var filter categoryFilter
+	for _, s := range categories {
+		c, err := parseCategory(s)
+		if err != nil {
+			return nil, err
+		}
+		filter |= 1 << c
+	}
+	return &filteringTracer{Tracer: t, filter: filter}, nil
+}
+
+func (t *filteringTracer) TracerForConnection(ctx context.Context, p logging.Perspective, odcid protocol.ConnectionID) logging.ConnectionTracer {
+	ct := t.Tracer.TracerForConnection(ctx, p, odcid)
+	if ct == nil {
+		return nil
+	}
+	ct.(*connectionTracer).filter = t.filter
+	return ct
+}
@@ -0,0 +1,97 @@
+package qlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filtering tracer", func() {
+	var buf *bytes.Buffer
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+	})
+
+	newTracer := func() logging.Tracer {
+		return NewTracer(func(logging.Perspective, []byte) io.WriteCloser { return nopWriteCloser(buf) })
+	}
+
+	// recordEvents records events of the transport, security and recovery categories
+	recordEvents := func(t logging.Tracer) {
+		tracer := t.TracerForConnection(context.Background(), logging.PerspectiveClient, logging.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+		tracer.BufferedPacket(logging.PacketTypeHandshake)
+		tracer.UpdatedKeyFromTLS(protocol.EncryptionHandshake, protocol.PerspectiveClient)
+		rttStats := &utils.RTTStats{}
+		rttStats.UpdateRTT(15*time.Millisecond, 0, time.Now())
+		tracer.UpdatedMetrics(rttStats, 4321, 1234, 42)
+		tracer.LostPacket(protocol.EncryptionHandshake, 42, logging.PacketLossReorderingThreshold)
+		tracer.Close()
+	}
+
+	eventNames := func() []string {
+		scanner := bufio.NewScanner(buf)
+		Expect(scanner.Scan()).To(BeTrue()) // the trace metadata
+		var names []string
+		for scanner.Scan() {
+			ev := make(map[string]interface{})
+			Expect(json.Unmarshal(scanner.Bytes(), &ev)).To(Succeed())
+			names = append(names, ev["name"].(string))
+		}
+		return names
+	}
+
+	It("only emits the selected categories", func() {
+		t, err := NewFilteringTracer(newTracer(), "recovery")
+		Expect(err).ToNot(HaveOccurred())
+		recordEvents(t)
+		names := eventNames()
+		Expect(names).To(Equal([]string{"recovery:metrics_updated", "recovery:packet_lost"}))
+	})
+
+	It("emits multiple categories", func() {
+		t, err := NewFilteringTracer(newTracer(), "transport", "security")
+		Expect(err).ToNot(HaveOccurred())
+		recordEvents(t)
+		Expect(eventNames()).To(Equal([]string{"transport:packet_buffered", "security:key_updated"}))
+	})
+
+	It("filters rotating tracers", func() {
+		rt := NewRotatingTracer(func(logging.Perspective, []byte, int) io.WriteCloser { return nopWriteCloser(buf) }, 0)
+		t, err := NewFilteringTracer(rt, "security")
+		Expect(err).ToNot(HaveOccurred())
+		recordEvents(t)
+		Expect(eventNames()).To(Equal([]string{"security:key_updated"}))
+	})
+
+	It("returns nil when there's no io.WriteCloser", func() {
+		t, err := NewFilteringTracer(NewTracer(func(logging.Perspective, []byte) io.WriteCloser { return nil }), "recovery")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t.TracerForConnection(context.Background(), logging.PerspectiveClient, logging.ConnectionID{1, 2, 3, 4})).To(BeNil())
+	})
+
+	It("rejects unknown categories", func() {
+		_, err := NewFilteringTracer(newTracer(), "recovery", "foobar")
+		Expect(err).To(MatchError(`qlog: unknown event category "foobar"`))
+	})
+
+	It("rejects an empty set of categories", func() {
+		_, err := NewFilteringTracer(newTracer())
+		Expect(err).To(MatchError("qlog: no event categories given"))
+	})
+
+	It("rejects tracers not created by this package", func() {
+		_, err := NewFilteringTracer(logging.NewMultiplexedTracer(newTracer(), newTracer()), "recovery")
+		Expect(err).To(MatchError("qlog: can only filter qlog tracers"))
+	})
+})
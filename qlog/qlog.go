@@ -82,6 +82,12 @@ type connectionTracer struct {
 	events     chan event
 	encodeErr  error
 	runStopped chan struct{}
+	closed     bool // protected by the mutex
+
+	// only set for rotating tracers
+	rotation *rotation
+	// events of other categories are dropped
+	filter categoryFilter
 
 	lastMetrics *metrics
 }
@@ -90,7 +96,13 @@ var _ logging.ConnectionTracer = &connectionTracer{}
 
 // NewConnectionTracer creates a new tracer to record a qlog for a connection.
 func NewConnectionTracer(w io.WriteCloser, p protocol.Perspective, odcid protocol.ConnectionID) logging.ConnectionTracer {
-	t := &connectionTracer{
+	t := newConnectionTracer(w, p, odcid)
+	go t.run()
+	return t
+}
+
+func newConnectionTracer(w io.WriteCloser, p protocol.Perspective, odcid protocol.ConnectionID) *connectionTracer {
+	return &connectionTracer{
 		w:             w,
 		perspective:   p,
 		odcid:         odcid,
@@ -98,12 +110,37 @@ func NewConnectionTracer(w io.WriteCloser, p protocol.Perspective, odcid protoco
 		events:        make(chan event, eventChanSize),
 		referenceTime: time.Now(),
 	}
-	go t.run()
-	return t
 }
 
 func (t *connectionTracer) run() {
 	defer close(t.runStopped)
+	t.writeHeader()
+	enc := gojay.NewEncoder(t.w)
+	for ev := range t.events {
+		if _, ok := ev.eventDetails.(eventRotate); ok {
+			t.rotate()
+			enc = gojay.NewEncoder(t.w)
+			continue
+		}
+		if t.w == nil || t.encodeErr != nil { // if encoding failed, just continue draining the event channel
+			continue
+		}
+		if err := enc.Encode(ev); err != nil {
+			t.encodeErr = err
+			continue
+		}
+		if _, err := t.w.Write([]byte{'\n'}); err != nil {
+			t.encodeErr = err
+		}
+		if t.rotation.exceedsMaxSize() {
+			t.rotate()
+			enc = gojay.NewEncoder(t.w)
+		}
+	}
+}
+
+// writeHeader writes the first line of a qlog file.
+func (t *connectionTracer) writeHeader() {
 	buf := &bytes.Buffer{}
 	enc := gojay.NewEncoder(buf)
 	tl := &topLevel{
@@ -125,19 +162,6 @@ func (t *connectionTracer) run() {
 	if _, err := t.w.Write(buf.Bytes()); err != nil {
 		t.encodeErr = err
 	}
-	enc = gojay.NewEncoder(t.w)
-	for ev := range t.events {
-		if t.encodeErr != nil { // if encoding failed, just continue draining the event channel
-			continue
-		}
-		if err := enc.Encode(ev); err != nil {
-			t.encodeErr = err
-			continue
-		}
-		if _, err := t.w.Write([]byte{'\n'}); err != nil {
-			t.encodeErr = err
-		}
-	}
 }
 
 func (t *connectionTracer) Close() {
@@ -148,8 +172,22 @@ func (t *connectionTracer) Close() {
 
 // export writes a qlog.
 func (t *connectionTracer) export() error {
+	t.mutex.Lock()
+	t.closed = true
 	close(t.events)
+	t.mutex.Unlock()
 	<-t.runStopped
+	if t.rotation != nil && t.rotation.onClose != nil {
+		t.rotation.onClose()
+	}
+	return t.closeWriter()
+}
+
+// closeWriter closes the current qlog file.
+func (t *connectionTracer) closeWriter() error {
+	if t.w == nil {
+		return nil
+	}
 	if t.encodeErr != nil {
 		return t.encodeErr
 	}
@@ -157,6 +195,9 @@ func (t *connectionTracer) export() error {
 }
 
 func (t *connectionTracer) recordEvent(eventTime time.Time, details eventDetails) {
+	if !t.filter.allows(details.Category()) {
+		return
+	}
 	t.events <- event{
 		RelativeTime: eventTime.Sub(t.referenceTime),
 		eventDetails: details,
@@ -470,6 +511,9 @@ func (t *connectionTracer) LossTimerExpired(tt logging.TimerType, encLevel proto
 	t.mutex.Unlock()
 }
 
+// ReceivedPathChallenge doesn't record an event, since the PATH_CHALLENGE frame is already logged with the packet it was received in.
+func (t *connectionTracer) ReceivedPathChallenge([8]byte) {}
+
 func (t *connectionTracer) LossTimerCanceled() {
 	t.mutex.Lock()
 	t.recordEvent(time.Now(), &eventLossTimerCanceled{})
@@ -0,0 +1,267 @@
+package qlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// TraceMetadata is the metadata of a qlog, as written at the beginning of every qlog file.
+type TraceMetadata struct {
+	QlogFormat  string
+	QlogVersion string
+	Title       string
+	CodeVersion string
+	// VantagePoint is either "client" or "server".
+	VantagePoint string
+	// ODCID is the original destination connection ID, hex-encoded.
+	ODCID string
+	// GroupID is the group ID, hex-encoded.
+	GroupID string
+	// ReferenceTime is the time that the relative times of the events refer to.
+	ReferenceTime time.Time
+}
+
+// An Event is an event read from a qlog.
+type Event struct {
+	// Time is the time of the event, relative to the reference time of the trace.
+	Time     time.Duration
+	Category string
+	Name     string
+	// Data is the raw JSON describing the event.
+	Data json.RawMessage
+	// Details is the parsed event data.
+	// It is nil for events that are not listed here:
+	//  * transport:connection_started: *ConnectionStartedEvent
+	//  * transport:connection_closed: *ConnectionClosedEvent
+	//  * transport:packet_sent and transport:packet_received: *PacketEvent
+	//  * transport:packet_dropped: *PacketDroppedEvent
+	//  * recovery:packet_lost: *PacketLostEvent
+	//  * recovery:metrics_updated: *MetricsUpdatedEvent
+	Details interface{}
+}
+
+// PacketHeader is the header of a packet, as logged in packet events.
+// Connection IDs are hex-encoded.
+type PacketHeader struct {
+	PacketType       string `json:"packet_type"`
+	PacketNumber     int64  `json:"packet_number"`
+	Version          string `json:"version"`
+	SrcConnectionID  string `json:"scid"`
+	DestConnectionID string `json:"dcid"`
+	KeyPhaseBit      string `json:"key_phase_bit"`
+}
+
+// RawInfo contains the sizes of a packet.
+type RawInfo struct {
+	Length        uint64 `json:"length"`
+	PayloadLength uint64 `json:"payload_length"`
+}
+
+// A Frame is a frame, as logged in packet events.
+type Frame struct {
+	FrameType string
+	// Fields contains all fields of the frame, including the frame_type.
+	Fields map[string]interface{}
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (f *Frame) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &f.Fields); err != nil {
+		return err
+	}
+	f.FrameType, _ = f.Fields["frame_type"].(string)
+	return nil
+}
+
+// PacketEvent is a packet_sent or packet_received event.
+type PacketEvent struct {
+	Header PacketHeader `json:"header"`
+	Raw    RawInfo      `json:"raw"`
+	Frames []Frame      `json:"frames"`
+}
+
+// PacketDroppedEvent is a packet_dropped event.
+type PacketDroppedEvent struct {
+	Header  PacketHeader `json:"header"`
+	Raw     RawInfo      `json:"raw"`
+	Trigger string       `json:"trigger"`
+}
+
+// PacketLostEvent is a packet_lost event.
+type PacketLostEvent struct {
+	Header  PacketHeader `json:"header"`
+	Trigger string       `json:"trigger"`
+}
+
+// ConnectionStartedEvent is a connection_started event.
+type ConnectionStartedEvent struct {
+	IPVersion        string `json:"ip_version"`
+	SrcIP            string `json:"src_ip"`
+	SrcPort          int    `json:"src_port"`
+	DestIP           string `json:"dst_ip"`
+	DestPort         int    `json:"dst_port"`
+	SrcConnectionID  string `json:"src_cid"`
+	DestConnectionID string `json:"dst_cid"`
+}
+
+// ConnectionClosedEvent is a connection_closed event.
+type ConnectionClosedEvent struct {
+	Owner           string `json:"owner"`
+	Trigger         string `json:"trigger"`
+	ApplicationCode uint64 `json:"application_code"`
+	ConnectionCode  string `json:"connection_code"`
+	Reason          string `json:"reason"`
+}
+
+// MetricsUpdatedEvent is a metrics_updated event.
+// Only the metrics that changed are logged, all other fields are nil.
+type MetricsUpdatedEvent struct {
+	MinRTT           *time.Duration
+	SmoothedRTT      *time.Duration
+	LatestRTT        *time.Duration
+	RTTVariance      *time.Duration
+	CongestionWindow *uint64
+	BytesInFlight    *uint64
+	PacketsInFlight  *uint64
+	PTOCount         *uint32
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (e *MetricsUpdatedEvent) UnmarshalJSON(b []byte) error {
+	var m struct {
+		MinRTT           *float64 `json:"min_rtt"`
+		SmoothedRTT      *float64 `json:"smoothed_rtt"`
+		LatestRTT        *float64 `json:"latest_rtt"`
+		RTTVariance      *float64 `json:"rtt_variance"`
+		CongestionWindow *uint64  `json:"congestion_window"`
+		BytesInFlight    *uint64  `json:"bytes_in_flight"`
+		PacketsInFlight  *uint64  `json:"packets_in_flight"`
+		PTOCount         *uint32  `json:"pto_count"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	e.MinRTT = durationFromMilliseconds(m.MinRTT)
+	e.SmoothedRTT = durationFromMilliseconds(m.SmoothedRTT)
+	e.LatestRTT = durationFromMilliseconds(m.LatestRTT)
+	e.RTTVariance = durationFromMilliseconds(m.RTTVariance)
+	e.CongestionWindow = m.CongestionWindow
+	e.BytesInFlight = m.BytesInFlight
+	e.PacketsInFlight = m.PacketsInFlight
+	e.PTOCount = m.PTOCount
+	return nil
+}
+
+func durationFromMilliseconds(ms *float64) *time.Duration {
+	if ms == nil {
+		return nil
+	}
+	d := time.Duration(*ms * 1e6)
+	return &d
+}
+
+// A Reader reads a qlog, as written by the tracers of this package.
+// Events are parsed one by one, so the qlog doesn't need to be held in memory.
+type Reader struct {
+	dec      *json.Decoder
+	metadata TraceMetadata
+}
+
+// NewReader creates a new Reader, and reads the trace metadata.
+func NewReader(r io.Reader) (*Reader, error) {
+	dec := json.NewDecoder(r)
+	var tl struct {
+		QlogFormat  string `json:"qlog_format"`
+		QlogVersion string `json:"qlog_version"`
+		Title       string `json:"title"`
+		CodeVersion string `json:"code_version"`
+		Trace       *struct {
+			VantagePoint struct {
+				Type string `json:"type"`
+			} `json:"vantage_point"`
+			CommonFields struct {
+				ODCID         string  `json:"ODCID"`
+				GroupID       string  `json:"group_id"`
+				ReferenceTime float64 `json:"reference_time"`
+				TimeFormat    string  `json:"time_format"`
+			} `json:"common_fields"`
+		} `json:"trace"`
+	}
+	if err := dec.Decode(&tl); err != nil {
+		return nil, fmt.Errorf("qlog: reading trace metadata failed: %w", err)
+	}
+	if tl.Trace == nil {
+		return nil, errors.New("qlog: missing trace metadata")
+	}
+	if tf := tl.Trace.CommonFields.TimeFormat; tf != "relative" {
+		return nil, fmt.Errorf("qlog: unsupported time format %q", tf)
+	}
+	return &Reader{
+		dec: dec,
+		metadata: TraceMetadata{
+			QlogFormat:    tl.QlogFormat,
+			QlogVersion:   tl.QlogVersion,
+			Title:         tl.Title,
+			CodeVersion:   tl.CodeVersion,
+			VantagePoint:  tl.Trace.VantagePoint.Type,
+			ODCID:         tl.Trace.CommonFields.ODCID,
+			GroupID:       tl.Trace.CommonFields.GroupID,
+			ReferenceTime: time.Unix(0, int64(tl.Trace.CommonFields.ReferenceTime*1e6)),
+		},
+	}, nil
+}
+
+// Metadata returns the trace metadata.
+func (r *Reader) Metadata() TraceMetadata {
+	return r.metadata
+}
+
+// ReadEvent reads the next event.
+// It returns io.EOF when there are no more events.
+func (r *Reader) ReadEvent() (*Event, error) {
+	var ev struct {
+		Time float64         `json:"time"`
+		Name string          `json:"name"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := r.dec.Decode(&ev); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("qlog: reading event failed: %w", err)
+	}
+	split := strings.SplitN(ev.Name, ":", 2)
+	if len(split) != 2 {
+		return nil, fmt.Errorf("qlog: invalid event name %q", ev.Name)
+	}
+	e := &Event{
+		Time:     time.Duration(ev.Time * 1e6),
+		Category: split[0],
+		Name:     split[1],
+		Data:     ev.Data,
+	}
+	switch ev.Name {
+	case "transport:connection_started":
+		e.Details = &ConnectionStartedEvent{}
+	case "transport:connection_closed":
+		e.Details = &ConnectionClosedEvent{}
+	case "transport:packet_sent", "transport:packet_received":
+		e.Details = &PacketEvent{}
+	case "transport:packet_dropped":
+		e.Details = &PacketDroppedEvent{}
+	case "recovery:packet_lost":
+		e.Details = &PacketLostEvent{}
+	case "recovery:metrics_updated":
+		e.Details = &MetricsUpdatedEvent{}
+	default:
+		return e, nil
+	}
+	if err := json.Unmarshal(ev.Data, e.Details); err != nil {
+		return nil, fmt.Errorf("qlog: parsing %s event failed: %w", ev.Name, err)
+	}
+	return e, nil
+}
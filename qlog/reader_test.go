@@ -0,0 +1,209 @@
+package qlog
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+	var (
+		tracer logging.ConnectionTracer
+		buf    *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		tracer = NewConnectionTracer(nopWriteCloser(buf), protocol.PerspectiveClient, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+	})
+
+	readAll := func() (*Reader, []*Event) {
+		tracer.Close()
+		r, err := NewReader(buf)
+		Expect(err).ToNot(HaveOccurred())
+		var events []*Event
+		for {
+			ev, err := r.ReadEvent()
+			if err == io.EOF {
+				return r, events
+			}
+			Expect(err).ToNot(HaveOccurred())
+			events = append(events, ev)
+		}
+	}
+
+	It("reads the trace metadata", func() {
+		r, events := readAll()
+		Expect(events).To(BeEmpty())
+		m := r.Metadata()
+		Expect(m.QlogVersion).To(Equal("draft-02"))
+		Expect(m.QlogFormat).To(Equal("NDJSON"))
+		Expect(m.VantagePoint).To(Equal("client"))
+		Expect(m.ODCID).To(Equal("deadbeef"))
+		Expect(m.GroupID).To(Equal("deadbeef"))
+		Expect(m.ReferenceTime).To(BeTemporally("~", time.Now(), scaleDuration(10*time.Millisecond)))
+	})
+
+	It("reads sent packets", func() {
+		tracer.SentPacket(
+			&logging.ExtendedHeader{
+				Header: logging.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					SrcConnectionID:  protocol.ConnectionID{4, 3, 2, 1},
+					Length:           1337,
+					Version:          protocol.VersionTLS,
+				},
+				PacketNumber: 1337,
+			},
+			987,
+			&logging.AckFrame{AckRanges: []logging.AckRange{{Smallest: 1, Largest: 10}}},
+			[]logging.Frame{&logging.StreamFrame{StreamID: 123, Offset: 1234, Length: 6, Fin: true}},
+		)
+		r, events := readAll()
+		Expect(events).To(HaveLen(1))
+		ev := events[0]
+		Expect(r.Metadata().ReferenceTime.Add(ev.Time)).To(BeTemporally("~", time.Now(), scaleDuration(10*time.Millisecond)))
+		Expect(ev.Category).To(Equal("transport"))
+		Expect(ev.Name).To(Equal("packet_sent"))
+		Expect(ev.Details).To(BeAssignableToTypeOf(&PacketEvent{}))
+		p := ev.Details.(*PacketEvent)
+		Expect(p.Header).To(Equal(PacketHeader{
+			PacketType:       "handshake",
+			PacketNumber:     1337,
+			Version:          "1",
+			SrcConnectionID:  "04030201",
+			DestConnectionID: "0102030405060708",
+		}))
+		Expect(p.Raw).To(Equal(RawInfo{Length: 987, PayloadLength: 1337}))
+		Expect(p.Frames).To(HaveLen(2))
+		Expect(p.Frames[0].FrameType).To(Equal("ack"))
+		Expect(p.Frames[1].FrameType).To(Equal("stream"))
+		Expect(p.Frames[1].Fields).To(HaveKeyWithValue("stream_id", float64(123)))
+		Expect(p.Frames[1].Fields).To(HaveKeyWithValue("fin", true))
+	})
+
+	It("reads received packets", func() {
+		tracer.ReceivedPacket(
+			&logging.ExtendedHeader{
+				Header:       logging.Header{DestConnectionID: protocol.ConnectionID{1, 2, 3, 4}},
+				PacketNumber: 42,
+				KeyPhase:     protocol.KeyPhaseOne,
+			},
+			789,
+			[]logging.Frame{&logging.PingFrame{}},
+		)
+		_, events := readAll()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Name).To(Equal("packet_received"))
+		p := events[0].Details.(*PacketEvent)
+		Expect(p.Header.PacketType).To(Equal("1RTT"))
+		Expect(p.Header.PacketNumber).To(BeEquivalentTo(42))
+		Expect(p.Header.KeyPhaseBit).To(Equal("1"))
+		Expect(p.Frames).To(HaveLen(1))
+		Expect(p.Frames[0].FrameType).To(Equal("ping"))
+	})
+
+	It("reads connection starts and closes", func() {
+		tracer.StartedConnection(
+			&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 42},
+			&net.UDPAddr{IP: net.IPv4(192, 168, 12, 34), Port: 24},
+			protocol.ConnectionID{1, 2, 3, 4},
+			protocol.ConnectionID{5, 6, 7, 8},
+		)
+		tracer.ClosedConnection(&quic.ApplicationError{Remote: true, ErrorCode: 1337, ErrorMessage: "foobar"})
+		_, events := readAll()
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Details).To(Equal(&ConnectionStartedEvent{
+			IPVersion:        "ipv4",
+			SrcIP:            "192.168.13.37",
+			SrcPort:          42,
+			DestIP:           "192.168.12.34",
+			DestPort:         24,
+			SrcConnectionID:  "01020304",
+			DestConnectionID: "05060708",
+		}))
+		Expect(events[1].Details).To(Equal(&ConnectionClosedEvent{
+			Owner:           "remote",
+			ApplicationCode: 1337,
+			Reason:          "foobar",
+		}))
+	})
+
+	It("reads lost and dropped packets", func() {
+		tracer.LostPacket(protocol.EncryptionHandshake, 42, logging.PacketLossReorderingThreshold)
+		tracer.DroppedPacket(logging.PacketTypeInitial, 1337, logging.PacketDropPayloadDecryptError)
+		_, events := readAll()
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Details).To(Equal(&PacketLostEvent{
+			Header:  PacketHeader{PacketType: "handshake", PacketNumber: 42},
+			Trigger: "reordering_threshold",
+		}))
+		Expect(events[1].Details).To(Equal(&PacketDroppedEvent{
+			Header:  PacketHeader{PacketType: "initial"},
+			Raw:     RawInfo{Length: 1337},
+			Trigger: "payload_decrypt_error",
+		}))
+	})
+
+	It("reads metrics updates", func() {
+		rttStats := &utils.RTTStats{}
+		rttStats.UpdateRTT(15*time.Millisecond, 0, time.Now())
+		tracer.UpdatedMetrics(rttStats, 4321, 1234, 42)
+		tracer.UpdatedMetrics(rttStats, 4321, 12345, 42)
+		tracer.UpdatedPTOCount(3)
+		_, events := readAll()
+		Expect(events).To(HaveLen(3))
+		m := events[0].Details.(*MetricsUpdatedEvent)
+		Expect(*m.MinRTT).To(Equal(15 * time.Millisecond))
+		Expect(*m.SmoothedRTT).To(Equal(15 * time.Millisecond))
+		Expect(*m.CongestionWindow).To(BeEquivalentTo(4321))
+		Expect(*m.BytesInFlight).To(BeEquivalentTo(1234))
+		Expect(*m.PacketsInFlight).To(BeEquivalentTo(42))
+		Expect(m.PTOCount).To(BeNil())
+		// only changed metrics are logged
+		m = events[1].Details.(*MetricsUpdatedEvent)
+		Expect(m.MinRTT).To(BeNil())
+		Expect(m.CongestionWindow).To(BeNil())
+		Expect(*m.BytesInFlight).To(BeEquivalentTo(12345))
+		m = events[2].Details.(*MetricsUpdatedEvent)
+		Expect(*m.PTOCount).To(BeEquivalentTo(3))
+	})
+
+	It("returns the raw data for other events", func() {
+		tracer.UpdatedKeyFromTLS(protocol.EncryptionHandshake, protocol.PerspectiveClient)
+		_, events := readAll()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Category).To(Equal("security"))
+		Expect(events[0].Name).To(Equal("key_updated"))
+		Expect(events[0].Details).To(BeNil())
+		Expect(string(events[0].Data)).To(ContainSubstring(`"key_type":"client_handshake_secret"`))
+	})
+
+	It("errors on invalid qlogs", func() {
+		_, err := NewReader(strings.NewReader("foobar"))
+		Expect(err).To(MatchError(ContainSubstring("qlog: reading trace metadata failed")))
+		_, err = NewReader(strings.NewReader(`{"qlog_version":"draft-02"}`))
+		Expect(err).To(MatchError("qlog: missing trace metadata"))
+	})
+
+	It("errors on invalid events", func() {
+		tracer.Close()
+		buf.WriteString(`{"time":1,"name":"foobar","data":{}}` + "\n")
+		r, err := NewReader(buf)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = r.ReadEvent()
+		Expect(err).To(MatchError(`qlog: invalid event name "foobar"`))
+	})
+})
@@ -0,0 +1,176 @@
+package qlog
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/francoispqt/gojay"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/logging"
+)
+
+// A RotatingConnectionTracer is a connection tracer that splits the qlog of a connection into multiple files.
+// Every file is a complete qlog, starting with the trace metadata.
+type RotatingConnectionTracer interface {
+	logging.ConnectionTracer
+	// Rotate closes the current qlog file, and continues writing to a new file.
+	Rotate()
+}
+
+// A RotatingTracer is a qlog tracer that splits the qlogs of connections into multiple files.
+type RotatingTracer struct {
+	getLogWriter func(p logging.Perspective, connectionID []byte, index int) io.WriteCloser
+	maxSize      int64
+
+	mutex       sync.Mutex
+	connTracers map[*connectionTracer]struct{}
+}
+
+var _ logging.Tracer = &RotatingTracer{}
+
+// NewRotatingTracer creates a new qlog tracer that rotates the qlog files of connections.
+// getLogWriter is called for every file, index counts the files of a connection, starting at 0.
+// If getLogWriter returns nil, tracing is stopped for this connection.
+// If maxSize is larger than 0, a file is rotated as soon as more than maxSize bytes were written to it.
+func NewRotatingTracer(getLogWriter func(p logging.Perspective, connectionID []byte, index int) io.WriteCloser, maxSize int64) *RotatingTracer {
+	return &RotatingTracer{
+		getLogWriter: getLogWriter,
+		maxSize:      maxSize,
+		connTracers:  make(map[*connectionTracer]struct{}),
+	}
+}
+
+func (t *RotatingTracer) TracerForConnection(_ context.Context, p logging.Perspective, odcid protocol.ConnectionID) logging.ConnectionTracer {
+	connID := odcid.Bytes()
+	ct := newRotatingConnectionTracer(func(index int) io.WriteCloser { return t.getLogWriter(p, connID, index) }, t.maxSize, p, odcid)
+	if ct == nil {
+		return nil
+	}
+	ct.rotation.onClose = func() {
+		t.mutex.Lock()
+		delete(t.connTracers, ct)
+		t.mutex.Unlock()
+	}
+	t.mutex.Lock()
+	t.connTracers[ct] = struct{}{}
+	t.mutex.Unlock()
+	go ct.run()
+	return ct
+}
+
+// Rotate rotates the qlog files of all connections that are currently traced.
+func (t *RotatingTracer) Rotate() {
+	t.mutex.Lock()
+	connTracers := make([]*connectionTracer, 0, len(t.connTracers))
+	for ct := range t.connTracers {
+		connTracers = append(connTracers, ct)
+	}
+	t.mutex.Unlock()
+
+	for _, ct := range connTracers {
+		ct.Rotate()
+	}
+}
+
+func (t *RotatingTracer) SentPacket(net.Addr, *logging.Header, protocol.ByteCount, []logging.Frame) {}
+func (t *RotatingTracer) DroppedPacket(net.Addr, logging.PacketType, protocol.ByteCount, logging.PacketDropReason) {
+}
+
+// NewRotatingConnectionTracer creates a new tracer to record a qlog for a connection, split into multiple files.
+// getLogWriter is called for every file, index counts the files, starting at 0.
+// It returns nil if getLogWriter returns nil for the first file.
+// If maxSize is larger than 0, a file is rotated as soon as more than maxSize bytes were written to it.
+func NewRotatingConnectionTracer(getLogWriter func(index int) io.WriteCloser, maxSize int64, p protocol.Perspective, odcid protocol.ConnectionID) RotatingConnectionTracer {
+	t := newRotatingConnectionTracer(getLogWriter, maxSize, p, odcid)
+	if t == nil {
+		return nil
+	}
+	go t.run()
+	return t
+}
+
+func newRotatingConnectionTracer(getLogWriter func(index int) io.WriteCloser, maxSize int64, p protocol.Perspective, odcid protocol.ConnectionID) *connectionTracer {
+	w := getLogWriter(0)
+	if w == nil {
+		return nil
+	}
+	r := &rotation{getLogWriter: getLogWriter, maxSize: maxSize}
+	t := newConnectionTracer(r.count(w), p, odcid)
+	t.rotation = r
+	return t
+}
+
+// Rotate closes the current qlog file, and continues writing to a new file.
+// It is a no-op if the tracer doesn't rotate.
+func (t *connectionTracer) Rotate() {
+	if t.rotation == nil {
+		return
+	}
+	t.mutex.Lock()
+	if !t.closed {
+		t.events <- event{eventDetails: eventRotate{}}
+	}
+	t.mutex.Unlock()
+}
+
+// rotate closes the current qlog file, and opens the next one.
+// It must only be called from the run loop.
+func (t *connectionTracer) rotate() {
+	if t.rotation == nil || t.w == nil {
+		return
+	}
+	if err := t.closeWriter(); err != nil {
+		log.Printf("exporting qlog failed: %s\n", err)
+	}
+	t.encodeErr = nil
+	t.rotation.index++
+	w := t.rotation.getLogWriter(t.rotation.index)
+	if w == nil {
+		t.w = nil
+		return
+	}
+	t.w = t.rotation.count(w)
+	t.writeHeader()
+}
+
+type rotation struct {
+	getLogWriter func(index int) io.WriteCloser
+	maxSize      int64
+	onClose      func()
+
+	index   int
+	current *countingWriteCloser
+}
+
+func (r *rotation) count(w io.WriteCloser) io.WriteCloser {
+	r.current = &countingWriteCloser{WriteCloser: w}
+	return r.current
+}
+
+func (r *rotation) exceedsMaxSize() bool {
+	return r != nil && r.maxSize > 0 && r.current != nil && r.current.n > r.maxSize
+}
+
+type countingWriteCloser struct {
+	io.WriteCloser
+	n int64
+}
+
+func (w *countingWriteCloser) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// eventRotate is used to signal the run loop to rotate the qlog file.
+// It is never written to the qlog.
+type eventRotate struct{}
+
+func (e eventRotate) Category() category                   { return categoryConnectivity }
+func (e eventRotate) Name() string                         { return "rotate" }
+func (e eventRotate) IsNil() bool                          { return false }
+func (e eventRotate) MarshalJSONObject(enc *gojay.Encoder) {}
@@ -0,0 +1,136 @@
+package qlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rotating tracer", func() {
+	var files []*bytes.Buffer
+
+	getLogWriter := func(index int) io.WriteCloser {
+		defer GinkgoRecover()
+		Expect(index).To(Equal(len(files)))
+		buf := &bytes.Buffer{}
+		files = append(files, buf)
+		return nopWriteCloser(buf)
+	}
+
+	// parse checks that a file is a valid qlog, and returns the names of the events
+	parse := func(buf *bytes.Buffer) []string {
+		scanner := bufio.NewScanner(buf)
+		Expect(scanner.Scan()).To(BeTrue())
+		m := make(map[string]interface{})
+		Expect(json.Unmarshal(scanner.Bytes(), &m)).To(Succeed())
+		Expect(m).To(HaveKeyWithValue("qlog_version", "draft-02"))
+		Expect(m).To(HaveKey("trace"))
+		commonFields := m["trace"].(map[string]interface{})["common_fields"].(map[string]interface{})
+		Expect(commonFields).To(HaveKeyWithValue("ODCID", "deadbeef"))
+		var names []string
+		for scanner.Scan() {
+			ev := make(map[string]interface{})
+			Expect(json.Unmarshal(scanner.Bytes(), &ev)).To(Succeed())
+			Expect(ev).To(HaveKey("time"))
+			Expect(ev).To(HaveKey("data"))
+			names = append(names, ev["name"].(string))
+		}
+		Expect(scanner.Err()).ToNot(HaveOccurred())
+		return names
+	}
+
+	BeforeEach(func() {
+		files = nil
+	})
+
+	It("rotates the qlog file when Rotate is called", func() {
+		t := NewRotatingConnectionTracer(getLogWriter, 0, protocol.PerspectiveClient, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+		t.UpdatedPTOCount(1)
+		t.Rotate()
+		t.UpdatedPTOCount(2)
+		t.LossTimerCanceled()
+		t.Close()
+
+		Expect(files).To(HaveLen(2))
+		Expect(parse(files[0])).To(Equal([]string{"recovery:metrics_updated"}))
+		Expect(parse(files[1])).To(Equal([]string{"recovery:metrics_updated", "recovery:loss_timer_updated"}))
+	})
+
+	It("rotates the qlog file when it exceeds the maximum size", func() {
+		const maxSize = 1000
+		t := NewRotatingConnectionTracer(getLogWriter, maxSize, protocol.PerspectiveClient, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+		const num = 200
+		for i := uint32(0); i < num; i++ {
+			t.UpdatedPTOCount(i)
+		}
+		t.Close()
+
+		Expect(len(files)).To(BeNumerically(">", 2))
+		var numEvents int
+		for _, f := range files {
+			// each file contains at most one event beyond maxSize
+			Expect(f.Len()).To(BeNumerically("<", 2*maxSize))
+			numEvents += len(parse(f))
+		}
+		Expect(numEvents).To(Equal(num))
+	})
+
+	It("stops tracing when no writer is returned for the next file", func() {
+		t := NewRotatingConnectionTracer(func(index int) io.WriteCloser {
+			if index > 0 {
+				return nil
+			}
+			return getLogWriter(index)
+		}, 0, protocol.PerspectiveClient, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+		t.UpdatedPTOCount(1)
+		t.Rotate()
+		t.UpdatedPTOCount(2)
+		t.Rotate()
+		t.Close()
+
+		Expect(files).To(HaveLen(1))
+		Expect(parse(files[0])).To(HaveLen(1))
+	})
+
+	It("returns nil when there's no io.WriteCloser", func() {
+		Expect(NewRotatingConnectionTracer(func(int) io.WriteCloser { return nil }, 0, protocol.PerspectiveClient, protocol.ConnectionID{1, 2, 3, 4})).To(BeNil())
+		t := NewRotatingTracer(func(logging.Perspective, []byte, int) io.WriteCloser { return nil }, 0)
+		Expect(t.TracerForConnection(context.Background(), logging.PerspectiveClient, logging.ConnectionID{1, 2, 3, 4})).To(BeNil())
+	})
+
+	It("rotates the qlog files of all connections", func() {
+		filesPerConn := make(map[string][]*bytes.Buffer)
+		tracer := NewRotatingTracer(func(p logging.Perspective, connID []byte, index int) io.WriteCloser {
+			defer GinkgoRecover()
+			Expect(p).To(Equal(logging.PerspectiveServer))
+			Expect(index).To(Equal(len(filesPerConn[string(connID)])))
+			buf := &bytes.Buffer{}
+			filesPerConn[string(connID)] = append(filesPerConn[string(connID)], buf)
+			return nopWriteCloser(buf)
+		}, 0)
+		t1 := tracer.TracerForConnection(context.Background(), logging.PerspectiveServer, logging.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+		t2 := tracer.TracerForConnection(context.Background(), logging.PerspectiveServer, logging.ConnectionID{0xde, 0xca, 0xfb, 0xad})
+		t1.UpdatedPTOCount(1)
+		t2.UpdatedPTOCount(1)
+		t2.Close()
+		tracer.Rotate()
+		t1.UpdatedPTOCount(2)
+		t1.Close()
+		tracer.Rotate() // no connections are traced any more
+
+		Expect(filesPerConn).To(HaveLen(2))
+		Expect(filesPerConn[string([]byte{0xde, 0xad, 0xbe, 0xef})]).To(HaveLen(2))
+		Expect(filesPerConn[string([]byte{0xde, 0xca, 0xfb, 0xad})]).To(HaveLen(1))
+		for _, f := range filesPerConn[string([]byte{0xde, 0xad, 0xbe, 0xef})] {
+			Expect(parse(f)).To(Equal([]string{"recovery:metrics_updated"}))
+		}
+	})
+})
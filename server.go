@@ -180,6 +180,9 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config, acceptEarl
 	if err := validateConfig(config); err != nil {
 		return nil, err
 	}
+	if err := validateTLSConfig(tlsConf, config); err != nil {
+		return nil, err
+	}
 	config = populateServerConfig(config)
 	for _, v := range config.Versions {
 		if !protocol.IsValidVersion(v) {
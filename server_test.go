@@ -119,6 +119,18 @@ var _ = Describe("Server", func() {
 		Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 	})
 
+	It("errors when the tls.Config doesn't allow TLS 1.3", func() {
+		tlsConf.MaxVersion = tls.VersionTLS12
+		_, err := Listen(nil, tlsConf, nil)
+		Expect(err).To(MatchError("quic: tls.Config.MaxVersion is TLS 1.2, but QUIC requires TLS 1.3"))
+	})
+
+	It("errors when the tls.Config allows older TLS versions, if RequireTLS13MinVersion is set", func() {
+		tlsConf.MinVersion = tls.VersionTLS12
+		_, err := Listen(nil, tlsConf, &Config{RequireTLS13MinVersion: true})
+		Expect(err).To(MatchError("quic: tls.Config.MinVersion is TLS 1.2, but Config.RequireTLS13MinVersion requires TLS 1.3"))
+	})
+
 	It("fills in default values if options are not set in the Config", func() {
 		ln, err := Listen(conn, tlsConf, &Config{})
 		Expect(err).ToNot(HaveOccurred())
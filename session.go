@@ -58,6 +58,7 @@ type cryptoStreamHandler interface {
 	GetSessionTicket() ([]byte, error)
 	io.Closer
 	ConnectionState() handshake.ConnectionState
+	KeyExchangeGroup() tls.CurveID
 }
 
 type packetInfo struct {
@@ -172,6 +173,8 @@ type session struct {
 	frameParser   wire.FrameParser
 	packer        packer
 	mtuDiscoverer mtuDiscoverer // initialized when the handshake completes
+	// the maximum packet size currently used on the path, updated by the mtuDiscoverer
+	maxPacketSize uint32 // to be accessed atomically
 
 	oneRTTStream        cryptoStream // only set for the server
 	cryptoStreamHandler cryptoStreamHandler
@@ -195,6 +198,7 @@ type session struct {
 	earlySessionReadyChan chan struct{}
 	handshakeCompleteChan chan struct{} // is closed when the handshake completes
 	handshakeComplete     bool
+	handshakeProgress     handshakeProgress
 	handshakeConfirmed    bool
 
 	receivedRetry       bool
@@ -290,6 +294,7 @@ var newSession = func(
 	s.sentPacketHandler, s.receivedPacketHandler = ackhandler.NewAckHandler(
 		0,
 		getMaxPacketSize(s.conn.RemoteAddr()),
+		protocol.ByteCount(s.config.InitialCongestionWindow),
 		s.rttStats,
 		s.perspective,
 		s.tracer,
@@ -316,8 +321,11 @@ var newSession = func(
 		RetrySourceConnectionID:         retrySrcConnID,
 	}
 	if s.config.EnableDatagrams {
-		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+		params.MaxDatagramFrameSize = protocol.ByteCount(s.config.MaxDatagramFrameSize)
+	} else {
+		params.MaxDatagramFrameSize = protocol.InvalidByteCount
 	}
+	params.AdditionalParameters = s.config.AdditionalTransportParameters
 	if s.tracer != nil {
 		s.tracer.SentTransportParameters(params)
 	}
@@ -417,6 +425,7 @@ var newClientSession = func(
 	s.sentPacketHandler, s.receivedPacketHandler = ackhandler.NewAckHandler(
 		initialPacketNumber,
 		getMaxPacketSize(s.conn.RemoteAddr()),
+		protocol.ByteCount(s.config.InitialCongestionWindow),
 		s.rttStats,
 		s.perspective,
 		s.tracer,
@@ -440,8 +449,11 @@ var newClientSession = func(
 		InitialSourceConnectionID:      srcConnID,
 	}
 	if s.config.EnableDatagrams {
-		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+		params.MaxDatagramFrameSize = protocol.ByteCount(s.config.MaxDatagramFrameSize)
+	} else {
+		params.MaxDatagramFrameSize = protocol.InvalidByteCount
 	}
+	params.AdditionalParameters = s.config.AdditionalTransportParameters
 	if s.tracer != nil {
 		s.tracer.SentTransportParameters(params)
 	}
@@ -499,6 +511,7 @@ var newClientSession = func(
 
 func (s *session) preSetup() {
 	s.sendQueue = newSendQueue(s.conn)
+	s.maxPacketSize = uint32(getMaxPacketSize(s.conn.RemoteAddr()))
 	s.retransmissionQueue = newRetransmissionQueue(s.version)
 	s.frameParser = wire.NewFrameParser(s.config.EnableDatagrams, s.version)
 	s.rttStats = &utils.RTTStats{}
@@ -518,7 +531,7 @@ func (s *session) preSetup() {
 		s.perspective,
 		s.version,
 	)
-	s.framer = newFramer(s.streamsMap, s.version)
+	s.framer = newFramer(s.streamsMap, s.config.StreamScheduler, s.version)
 	s.receivedPackets = make(chan *receivedPacket, protocol.MaxSessionUnprocessedPackets)
 	s.closeChan = make(chan closeError, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
@@ -664,12 +677,15 @@ runLoop:
 			s.framer.QueueControlFrame(&wire.PingFrame{})
 			s.keepAlivePingSent = true
 		} else if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.config.handshakeTimeout() {
-			s.destroyImpl(qerr.ErrHandshakeTimeout)
+			s.destroyImpl(&qerr.HandshakeTimeoutError{HandshakeProgress: s.handshakeProgress.String()})
 			continue
 		} else {
 			idleTimeoutStartTime := s.idleTimeoutStartTime()
-			if (!s.handshakeComplete && now.Sub(idleTimeoutStartTime) >= s.config.HandshakeIdleTimeout) ||
-				(s.handshakeComplete && now.Sub(idleTimeoutStartTime) >= s.idleTimeout) {
+			if !s.handshakeComplete && now.Sub(idleTimeoutStartTime) >= s.config.HandshakeIdleTimeout {
+				s.destroyImpl(&qerr.IdleTimeoutError{HandshakeProgress: s.handshakeProgress.String()})
+				continue
+			}
+			if s.handshakeComplete && now.Sub(idleTimeoutStartTime) >= s.idleTimeout {
 				s.destroyImpl(qerr.ErrIdleTimeout)
 				continue
 			}
@@ -720,10 +736,25 @@ func (s *session) supportsDatagrams() bool {
 }
 
 func (s *session) ConnectionState() ConnectionState {
-	return ConnectionState{
+	cs := ConnectionState{
 		TLS:               s.cryptoStreamHandler.ConnectionState(),
+		KeyExchangeGroup:  s.cryptoStreamHandler.KeyExchangeGroup(),
 		SupportsDatagrams: s.supportsDatagrams(),
+		MaxPacketSize:     int64(atomic.LoadUint32(&s.maxPacketSize)),
+		Version:           s.version,
+	}
+	if cs.SupportsDatagrams {
+		cs.MaxDatagramFrameSize = int64(s.peerParams.MaxDatagramFrameSize)
+	}
+	if s.perspective == protocol.PerspectiveClient {
+		// On the client side, the early session is only ready if 0-RTT is used.
+		select {
+		case <-s.earlySessionReadyChan:
+			cs.Attempted0RTT = true
+		default:
+		}
 	}
+	return cs
 }
 
 // Time when the next keep-alive packet should be sent.
@@ -826,6 +857,7 @@ func (s *session) handleHandshakeConfirmed() {
 			func(size protocol.ByteCount) {
 				s.sentPacketHandler.SetMaxDatagramSize(size)
 				s.packer.SetMaxPacketSize(size)
+				atomic.StoreUint32(&s.maxPacketSize, uint32(size))
 			},
 		)
 	}
@@ -1163,6 +1195,7 @@ func (s *session) handleUnpackedPacket(
 	s.lastPacketReceivedTime = rcvTime
 	s.firstAckElicitingPacketAfterIdleSentTime = time.Time{}
 	s.keepAlivePingSent = false
+	s.handshakeProgress.receivedPacket(packet.encryptionLevel)
 
 	// Only used for tracing.
 	// If we're not tracing, this slice will always remain empty.
@@ -1358,6 +1391,9 @@ func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 
 func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) {
 	s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
+	if s.tracer != nil {
+		s.tracer.ReceivedPathChallenge(frame.Data)
+	}
 }
 
 func (s *session) handleNewTokenFrame(frame *wire.NewTokenFrame) error {
@@ -1409,7 +1445,7 @@ func (s *session) handleAckFrame(frame *wire.AckFrame, encLevel protocol.Encrypt
 }
 
 func (s *session) handleDatagramFrame(f *wire.DatagramFrame) error {
-	if f.Length(s.version) > protocol.MaxDatagramFrameSize {
+	if f.Length(s.version) > protocol.ByteCount(s.config.MaxDatagramFrameSize) {
 		return &qerr.TransportError{
 			ErrorCode:    qerr.ProtocolViolation,
 			ErrorMessage: "DATAGRAM frame too large",
@@ -1482,6 +1518,8 @@ func (s *session) handleCloseError(closeErr *closeError) {
 	}
 
 	var (
+		idleTimeoutErr        *IdleTimeoutError
+		handshakeTimeoutErr   *HandshakeTimeoutError
 		statelessResetErr     *StatelessResetError
 		versionNegotiationErr *VersionNegotiationError
 		recreateErr           *errCloseForRecreating
@@ -1489,8 +1527,8 @@ func (s *session) handleCloseError(closeErr *closeError) {
 		transportErr          *TransportError
 	)
 	switch {
-	case errors.Is(e, qerr.ErrIdleTimeout),
-		errors.Is(e, qerr.ErrHandshakeTimeout),
+	case errors.As(e, &idleTimeoutErr),
+		errors.As(e, &handshakeTimeoutErr),
 		errors.As(e, &statelessResetErr),
 		errors.As(e, &versionNegotiationErr),
 		errors.As(e, &recreateErr),
@@ -1567,6 +1605,7 @@ func (s *session) handleTransportParameters(params *wire.TransportParameters) {
 		})
 	}
 	s.peerParams = params
+	s.handshakeProgress.record(handshakeStepReceivedTransportParameters)
 	// On the client side we have to wait for handshake completion.
 	// During a 0-RTT connection, we are only allowed to use the new transport parameters for 1-RTT packets.
 	if s.perspective == protocol.PerspectiveServer {
@@ -1768,6 +1807,7 @@ func (s *session) sendPacket() (bool, error) {
 			if s.firstAckElicitingPacketAfterIdleSentTime.IsZero() && p.IsAckEliciting() {
 				s.firstAckElicitingPacketAfterIdleSentTime = now
 			}
+			s.handshakeProgress.sentPacket(p.EncryptionLevel())
 			s.sentPacketHandler.SentPacket(p.ToAckHandlerPacket(now, s.retransmissionQueue))
 		}
 		s.connIDManager.SentPacket()
@@ -1795,6 +1835,7 @@ func (s *session) sendPackedPacket(packet *packedPacket, now time.Time) {
 		s.firstAckElicitingPacketAfterIdleSentTime = now
 	}
 	s.logPacket(packet)
+	s.handshakeProgress.sentPacket(packet.EncryptionLevel())
 	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket(now, s.retransmissionQueue))
 	s.connIDManager.SentPacket()
 	s.sendQueue.Send(packet.buffer)
@@ -1966,8 +2007,8 @@ func (s *session) onStreamCompleted(id protocol.StreamID) {
 
 func (s *session) SendMessage(p []byte) error {
 	f := &wire.DatagramFrame{DataLenPresent: true}
-	if protocol.ByteCount(len(p)) > f.MaxDataLen(s.peerParams.MaxDatagramFrameSize, s.version) {
-		return errors.New("message too large")
+	if maxDataLen := f.MaxDataLen(s.peerParams.MaxDatagramFrameSize, s.version); protocol.ByteCount(len(p)) > maxDataLen {
+		return &DatagramTooLargeError{MaxDataLen: int64(maxDataLen)}
 	}
 	f.Data = make([]byte, len(p))
 	copy(f.Data, p)
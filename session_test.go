@@ -295,6 +295,7 @@ var _ = Describe("Session", func() {
 
 		It("handles PATH_CHALLENGE frames", func() {
 			data := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+			tracer.EXPECT().ReceivedPathChallenge(data)
 			err := sess.handleFrame(&wire.PathChallengeFrame{Data: data}, protocol.Encryption1RTT, protocol.ConnectionID{})
 			Expect(err).ToNot(HaveOccurred())
 			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
@@ -400,6 +401,73 @@ var _ = Describe("Session", func() {
 		Expect(sess.GetVersion()).To(Equal(protocol.VersionNumber(4242)))
 	})
 
+	It("reports the version in the connection state", func() {
+		sess.version = 4242
+		sess.peerParams = &wire.TransportParameters{}
+		cryptoSetup.EXPECT().ConnectionState().Return(handshake.ConnectionState{})
+		cryptoSetup.EXPECT().KeyExchangeGroup()
+		Expect(sess.ConnectionState().Version).To(Equal(protocol.VersionNumber(4242)))
+	})
+
+	It("reports the key exchange group in the connection state", func() {
+		sess.peerParams = &wire.TransportParameters{}
+		cryptoSetup.EXPECT().ConnectionState().Return(handshake.ConnectionState{})
+		cryptoSetup.EXPECT().KeyExchangeGroup().Return(tls.CurveP256)
+		Expect(sess.ConnectionState().KeyExchangeGroup).To(Equal(tls.CurveP256))
+	})
+
+	It("reports the peer's maximum datagram frame size in the connection state", func() {
+		sess.config.EnableDatagrams = true
+		sess.peerParams = &wire.TransportParameters{MaxDatagramFrameSize: 1000}
+		cryptoSetup.EXPECT().ConnectionState().Return(handshake.ConnectionState{})
+		cryptoSetup.EXPECT().KeyExchangeGroup()
+		cs := sess.ConnectionState()
+		Expect(cs.SupportsDatagrams).To(BeTrue())
+		Expect(cs.MaxDatagramFrameSize).To(BeEquivalentTo(1000))
+	})
+
+	if runtime.GOOS != "windows" { // Path MTU Discovery is disabled on Windows
+		It("reports the maximum packet size in the connection state", func() {
+			sess.peerParams = &wire.TransportParameters{MaxUDPPayloadSize: 1400}
+			cryptoSetup.EXPECT().ConnectionState().Return(handshake.ConnectionState{}).Times(2)
+			cryptoSetup.EXPECT().KeyExchangeGroup().Times(2)
+			Expect(sess.ConnectionState().MaxPacketSize).To(BeEquivalentTo(protocol.InitialPacketSizeIPv4))
+			// Path MTU Discovery finds a larger MTU
+			sess.config.DisablePathMTUDiscovery = false
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sess.sentPacketHandler = sph
+			sph.EXPECT().SetHandshakeConfirmed()
+			cryptoSetup.EXPECT().SetHandshakeConfirmed()
+			sess.handleHandshakeConfirmed()
+			sph.EXPECT().SetMaxDatagramSize(protocol.ByteCount(1400))
+			packer.EXPECT().SetMaxPacketSize(protocol.ByteCount(1400))
+			sess.mtuDiscoverer.(*mtuFinder).mtuIncreased(1400)
+			Expect(sess.ConnectionState().MaxPacketSize).To(BeEquivalentTo(1400))
+		})
+	}
+
+	It("refuses to send messages larger than the peer's maximum datagram frame size", func() {
+		sess.config.EnableDatagrams = true
+		sess.peerParams = &wire.TransportParameters{MaxDatagramFrameSize: 100}
+		maxDataLen := (&wire.DatagramFrame{DataLenPresent: true}).MaxDataLen(100, sess.version)
+		err := sess.SendMessage(make([]byte, maxDataLen+1))
+		Expect(err).To(HaveOccurred())
+		var tooLargeErr *DatagramTooLargeError
+		Expect(errors.As(err, &tooLargeErr)).To(BeTrue())
+		Expect(tooLargeErr.MaxDataLen).To(BeEquivalentTo(maxDataLen))
+		Expect(err).To(MatchError(fmt.Sprintf("message too large (maximum: %d bytes)", maxDataLen)))
+	})
+
+	It("rejects DATAGRAM frames larger than the configured maximum", func() {
+		sess.config.EnableDatagrams = true
+		sess.config.MaxDatagramFrameSize = 100
+		err := sess.handleDatagramFrame(&wire.DatagramFrame{DataLenPresent: true, Data: make([]byte, 100)})
+		Expect(err).To(MatchError(&qerr.TransportError{
+			ErrorCode:    qerr.ProtocolViolation,
+			ErrorMessage: "DATAGRAM frame too large",
+		}))
+	})
+
 	Context("closing", func() {
 		var (
 			runErr         chan error
@@ -2227,6 +2295,57 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("reports the handshake progress when the handshake times out", func() {
+			sess.handshakeComplete = false
+			sess.sessionCreationTime = time.Now().Add(-protocol.DefaultHandshakeTimeout).Add(-time.Second)
+			// the handshake stalls after the ServerHello was received in an Initial packet
+			sess.handshakeProgress.sentPacket(protocol.EncryptionInitial)
+			sess.handshakeProgress.receivedPacket(protocol.EncryptionInitial)
+			sessionRunner.EXPECT().Remove(gomock.Any()).Times(2)
+			cryptoSetup.EXPECT().Close()
+			gomock.InOrder(
+				tracer.EXPECT().ClosedConnection(gomock.Any()).Do(func(e error) {
+					Expect(e).To(Equal(&HandshakeTimeoutError{HandshakeProgress: "received Initial packet"}))
+				}),
+				tracer.EXPECT().Close(),
+			)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().MaxTimes(1)
+				err := sess.run()
+				var handshakeTimeoutErr *HandshakeTimeoutError
+				Expect(errors.As(err, &handshakeTimeoutErr)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("handshake progress: received Initial packet"))
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("reports the handshake progress when the handshake idle timeout expires", func() {
+			sess.handshakeComplete = false
+			sess.config.HandshakeIdleTimeout = time.Second
+			sess.lastPacketReceivedTime = time.Now().Add(-time.Minute)
+			sess.handshakeProgress.sentPacket(protocol.EncryptionInitial)
+			sessionRunner.EXPECT().Remove(gomock.Any()).Times(2)
+			cryptoSetup.EXPECT().Close()
+			gomock.InOrder(
+				tracer.EXPECT().ClosedConnection(gomock.Any()).Do(func(e error) {
+					Expect(e).To(Equal(&IdleTimeoutError{HandshakeProgress: "sent Initial packet"}))
+				}),
+				tracer.EXPECT().Close(),
+			)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().MaxTimes(1)
+				err := sess.run()
+				Expect(err.Error()).To(ContainSubstring("handshake progress: sent Initial packet"))
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("does not use the idle timeout before the handshake complete", func() {
 			sess.handshakeComplete = false
 			sess.config.HandshakeIdleTimeout = 9999 * time.Second
@@ -2487,6 +2606,15 @@ var _ = Describe("Client Session", func() {
 		sess.cryptoStreamHandler = cryptoSetup
 	})
 
+	It("reports if 0-RTT was attempted in the connection state", func() {
+		sess.peerParams = &wire.TransportParameters{}
+		cryptoSetup.EXPECT().ConnectionState().Return(handshake.ConnectionState{}).Times(2)
+		cryptoSetup.EXPECT().KeyExchangeGroup().Times(2)
+		Expect(sess.ConnectionState().Attempted0RTT).To(BeFalse())
+		close(sess.earlySessionReadyChan)
+		Expect(sess.ConnectionState().Attempted0RTT).To(BeTrue())
+	})
+
 	It("changes the connection ID when receiving the first packet from the server", func() {
 		unpacker := NewMockUnpacker(mockCtrl)
 		unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, _ time.Time, data []byte) (*unpackedPacket, error) {
@@ -2555,6 +2683,31 @@ var _ = Describe("Client Session", func() {
 		Expect(sess.handleSinglePacket(&receivedPacket{buffer: getPacketBuffer()}, hdr)).To(BeTrue())
 	})
 
+	It("responds to PATH_CHALLENGE frames sent by the server", func() {
+		data := [8]byte{1, 3, 3, 7, 1, 3, 3, 7}
+		b := &bytes.Buffer{}
+		Expect((&wire.PathChallengeFrame{Data: data}).Write(b, sess.version)).To(Succeed())
+		unpacker := NewMockUnpacker(mockCtrl)
+		sess.unpacker = unpacker
+		unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, _ time.Time, _ []byte) (*unpackedPacket, error) {
+			return &unpackedPacket{
+				hdr:             &wire.ExtendedHeader{Header: *hdr, PacketNumberLen: protocol.PacketNumberLen2},
+				data:            b.Bytes(),
+				encryptionLevel: protocol.Encryption1RTT,
+			}, nil
+		})
+		gomock.InOrder(
+			tracer.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), []logging.Frame{&logging.PathChallengeFrame{Data: data}}),
+			tracer.EXPECT().ReceivedPathChallenge(data).Do(func([8]byte) {
+				// the PATH_RESPONSE is queued before the event is reported
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(Equal([]ackhandler.Frame{{Frame: &wire.PathResponseFrame{Data: data}}}))
+			}),
+		)
+		hdr := &wire.Header{DestConnectionID: srcConnID}
+		Expect(sess.handleSinglePacket(&receivedPacket{buffer: getPacketBuffer()}, hdr)).To(BeTrue())
+	})
+
 	It("handles HANDSHAKE_DONE frames", func() {
 		sess.peerParams = &wire.TransportParameters{}
 		sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)